@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// answerQuietPeriod is how long Claude's output must stay quiet after a
+// prompt before it counts as answered. Its UI keeps redrawing a spinner
+// while it works, so a pause this long means it is waiting for input.
+var answerQuietPeriod = 3 * time.Second
+
+// outputActivity records when Claude last printed anything. It is written
+// to alongside the terminal.
+type outputActivity struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (a *outputActivity) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	a.last = time.Now()
+	a.mu.Unlock()
+	return len(p), nil
+}
+
+// lastOutput returns when output was last written
+func (a *outputActivity) lastOutput() time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last
+}
+
+// waitQuiet blocks until there has been no output for quiet, counting from
+// since at the earliest
+func (a *outputActivity) waitQuiet(since time.Time, quiet time.Duration) {
+	for {
+		from := a.lastOutput()
+		if from.Before(since) {
+			from = since
+		}
+		wait := quiet - time.Since(from)
+		if wait <= 0 {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
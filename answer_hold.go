@@ -0,0 +1,66 @@
+package main
+
+import "time"
+
+// answerHold keeps the files that are ready to scan while Claude is
+// answering, for --hold-while-answering, so that a save made in the middle
+// of an answer doesn't strip markers and queue prompts while Claude is still
+// editing. They are scanned once its output has been quiet for
+// answerQuietPeriod. It is only used from the event loop.
+type answerHold struct {
+	activity *outputActivity
+	quiet    chan struct{} // Told once Claude has gone quiet with files held
+	held     []string      // In the order they were saved
+	seen     map[string]bool
+}
+
+// newAnswerHold holds files while activity shows Claude answering. It returns
+// nil without an output to watch, as when attached to a running Claude.
+func newAnswerHold(activity *outputActivity) *answerHold {
+	if activity == nil {
+		return nil
+	}
+	return &answerHold{activity: activity, quiet: make(chan struct{}, 1), seen: make(map[string]bool)}
+}
+
+// holds reports whether path must wait for Claude to finish answering, and
+// if so keeps it. Once files are held, later ones wait with them even if
+// Claude has just gone quiet, so they are all scanned in order. A nil hold
+// never holds a file.
+func (h *answerHold) holds(path string) bool {
+	if h == nil {
+		return false
+	}
+	if len(h.held) == 0 {
+		if time.Since(h.activity.lastOutput()) >= answerQuietPeriod {
+			return false
+		}
+		console.notice("claudewatch: Claude is answering; holding saved files until it is done")
+		go func() {
+			h.activity.waitQuiet(time.Time{}, answerQuietPeriod)
+			h.quiet <- struct{}{}
+		}()
+	}
+	if !h.seen[path] {
+		h.seen[path] = true
+		h.held = append(h.held, path)
+	}
+	return true
+}
+
+// answered is told once Claude has gone quiet with files held. It is nil on
+// a nil hold, so it never fires.
+func (h *answerHold) answered() <-chan struct{} {
+	if h == nil {
+		return nil
+	}
+	return h.quiet
+}
+
+// release returns the files held and stops holding them
+func (h *answerHold) release() []string {
+	held := h.held
+	h.held = nil
+	h.seen = make(map[string]bool)
+	return held
+}
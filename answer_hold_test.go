@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnswerHold(t *testing.T) {
+	old := answerQuietPeriod
+	answerQuietPeriod = 50 * time.Millisecond
+	t.Cleanup(func() { answerQuietPeriod = old })
+
+	activity := &outputActivity{}
+	hold := newAnswerHold(activity)
+	if hold.holds("a.go") {
+		t.Fatal("a file saved while Claude is quiet was held")
+	}
+
+	// Claude starts answering
+	activity.Write([]byte("thinking"))
+	for _, path := range []string{"b.go", "c.go", "b.go"} {
+		if !hold.holds(path) {
+			t.Fatalf("%s, saved while Claude is answering, wasn't held", path)
+		}
+	}
+
+	select {
+	case <-hold.answered():
+	case <-time.After(time.Second):
+		t.Fatal("the hold wasn't released once Claude went quiet")
+	}
+	if got, want := hold.release(), []string{"b.go", "c.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("release() = %v, want %v", got, want)
+	}
+	if hold.holds("b.go") {
+		t.Error("a file saved after Claude answered was held")
+	}
+
+	var none *answerHold
+	if none.holds("a.go") || none.answered() != nil {
+		t.Error("a nil hold held a file")
+	}
+	if newAnswerHold(nil) != nil {
+		t.Error("newAnswerHold(nil) made a hold without an output to watch")
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// procRoot is where running processes are discovered; tests point it elsewhere
+var procRoot = "/proc"
+
+// claudeProcess is a running Claude CLI found for --attach-pid or --attach-auto
+type claudeProcess struct {
+	PID           int
+	TTY           string // Controlling terminal, e.g. /dev/pts/3
+	TmuxPane      string // $TMUX_PANE from the process environment, if it runs in tmux
+	ScreenSession string // $STY, if it runs in GNU screen
+	ScreenWindow  string // $WINDOW, if it runs in GNU screen
+}
+
+// isClaudeCommand reports whether a process command line runs the Claude CLI,
+// either directly or as a script run by node
+func isClaudeCommand(cmdline []string) bool {
+	isClaude := func(arg string) bool {
+		name := filepath.Base(arg)
+		return name == "claude" || name == "claude-cli"
+	}
+	if len(cmdline) == 0 {
+		return false
+	}
+	if isClaude(cmdline[0]) {
+		return true
+	}
+	switch filepath.Base(cmdline[0]) {
+	case "node", "bun":
+		return len(cmdline) > 1 && isClaude(cmdline[1])
+	}
+	return false
+}
+
+// readCmdline returns the NUL-separated command line of pid
+func readCmdline(root string, pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00"), nil
+}
+
+// processUID returns the real user ID pid runs as
+func processUID(root string, pid int) (int, error) {
+	data, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "Uid:" {
+			return strconv.Atoi(fields[1])
+		}
+	}
+	return 0, fmt.Errorf("no Uid line in status of pid %d", pid)
+}
+
+// inspectProcess checks that pid belongs to the current user and runs on a
+// terminal, and collects what is needed to type into that terminal
+func inspectProcess(root string, pid int) (*claudeProcess, error) {
+	uid, err := processUID(root, pid)
+	if err != nil {
+		return nil, fmt.Errorf("pid %d: %w", pid, err)
+	}
+	if uid != os.Getuid() {
+		return nil, fmt.Errorf("pid %d belongs to another user", pid)
+	}
+
+	tty, err := os.Readlink(filepath.Join(root, strconv.Itoa(pid), "fd", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("pid %d: reading stdin: %w", pid, err)
+	}
+	if !strings.HasPrefix(tty, "/dev/pts/") && !strings.HasPrefix(tty, "/dev/tty") {
+		return nil, fmt.Errorf("pid %d is not running on a terminal (stdin is %s)", pid, tty)
+	}
+
+	proc := &claudeProcess{PID: pid, TTY: tty}
+	if environ, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "environ")); err == nil {
+		for _, entry := range bytes.Split(environ, []byte{0}) {
+			key, value, _ := strings.Cut(string(entry), "=")
+			switch key {
+			case "TMUX_PANE":
+				proc.TmuxPane = value
+			case "STY":
+				proc.ScreenSession = value
+			case "WINDOW":
+				proc.ScreenWindow = value
+			}
+		}
+	}
+	return proc, nil
+}
+
+// findClaudeProcesses lists the current user's Claude CLI processes that run
+// on a terminal, ordered by PID
+func findClaudeProcesses(root string) ([]*claudeProcess, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %w", err)
+	}
+
+	var found []*claudeProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, err := readCmdline(root, pid)
+		if err != nil || !isClaudeCommand(cmdline) {
+			continue
+		}
+		if proc, err := inspectProcess(root, pid); err == nil {
+			found = append(found, proc)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].PID < found[j].PID })
+	return found, nil
+}
+
+// findAttachTarget returns the Claude process to attach to: pid when it is
+// non-zero, otherwise the only Claude process the current user is running
+func findAttachTarget(root string, pid int) (*claudeProcess, error) {
+	if pid != 0 {
+		return inspectProcess(root, pid)
+	}
+
+	found, err := findClaudeProcesses(root)
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, errors.New("no running Claude CLI found for this user")
+	case 1:
+		return found[0], nil
+	}
+	var candidates []string
+	for _, proc := range found {
+		candidates = append(candidates, fmt.Sprintf("%d (%s)", proc.PID, proc.TTY))
+	}
+	return nil, fmt.Errorf("several Claude CLIs are running: %s; choose one with --attach-pid", strings.Join(candidates, ", "))
+}
+
+// tmuxPaneID asks tmux for the ID (e.g. %4) of the pane target names, in any
+// form tmux accepts (session:window.pane, a pane ID, ...); tests replace it
+var tmuxPaneID = func(target string) (string, error) {
+	out, err := exec.Command("tmux", "display-message", "-p", "-t", target, "#{pane_id}").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// findTmuxTarget returns the Claude process running in the tmux pane target
+// (--tmux-target)
+func findTmuxTarget(root, target string) (*claudeProcess, error) {
+	pane, err := tmuxPaneID(target)
+	if err != nil {
+		return nil, fmt.Errorf("tmux pane %s: %w", target, err)
+	}
+	found, err := findClaudeProcesses(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, proc := range found {
+		if proc.TmuxPane == pane {
+			return proc, nil
+		}
+	}
+	return nil, fmt.Errorf("no Claude CLI is running in tmux pane %s (%s)", target, pane)
+}
+
+// attachedBackend types prompts into the terminal of a Claude CLI that
+// claudewatch did not start. It injects keystrokes with TIOCSTI where the
+// kernel permits it, and otherwise through tmux or GNU screen when the
+// process runs inside one.
+type attachedBackend struct {
+	mu     sync.Mutex
+	proc   *claudeProcess // Replaced when --reconnect finds Claude again
+	config *Config
+}
+
+// target returns the process prompts are typed into
+func (b *attachedBackend) target() *claudeProcess {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.proc
+}
+
+func (b *attachedBackend) Name() string {
+	return fmt.Sprintf("attached Claude (pid %d)", b.target().PID)
+}
+
+func (b *attachedBackend) Send(prompt string) error {
+	proc := b.target()
+	if err := syscall.Kill(proc.PID, 0); err != nil {
+		return fmt.Errorf("attached Claude (pid %d) is gone: %w", proc.PID, err)
+	}
+
+	var failures []string
+	for _, method := range b.methods() {
+		infoLog(b.config, "Typing prompt into pid %d via %s", proc.PID, method.name)
+		err := method.typeText(b.config.InputEncoding.encode(prompt))
+		if err == nil {
+			// Submitted the same way as when Claude runs on our own PTY
+			err = b.config.Submit.submit(method.typeText)
+		}
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, method.name+": "+err.Error())
+	}
+	return fmt.Errorf("cannot type into %s: %s", proc.TTY, strings.Join(failures, "; "))
+}
+
+// ping checks that the attached process is still running and, when it runs
+// in tmux, that its pane is still alive
+func (b *attachedBackend) ping() error {
+	proc := b.target()
+	if err := syscall.Kill(proc.PID, 0); errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("pid %d has exited", proc.PID)
+	}
+	if proc.TmuxPane != "" {
+		out, err := exec.Command("tmux", "display-message", "-p", "-t", proc.TmuxPane, "#{pane_dead}").Output()
+		if err != nil {
+			return fmt.Errorf("tmux pane %s: %w", proc.TmuxPane, err)
+		}
+		if strings.TrimSpace(string(out)) == "1" {
+			return fmt.Errorf("tmux pane %s is dead", proc.TmuxPane)
+		}
+	}
+	return nil
+}
+
+// reconnect attaches to a Claude CLI started again where the attached one
+// ran: in the same tmux pane, else on the same terminal, else (with
+// --attach-auto) the only one the user is running
+func (b *attachedBackend) reconnect() error {
+	match, err := b.findAgain(procRoot)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.proc = match
+	b.mu.Unlock()
+	claudeCwd.follow(match.PID)
+	console.notice("claudewatch: reattached to Claude (pid %d on %s)", match.PID, match.TTY)
+	return nil
+}
+
+// findAgain returns the Claude process reconnect attaches to, looking in the
+// /proc tree at root
+func (b *attachedBackend) findAgain(root string) (*claudeProcess, error) {
+	old := b.target()
+	found, err := findClaudeProcesses(root)
+	if err != nil {
+		return nil, err
+	}
+	var match *claudeProcess
+	for _, proc := range found {
+		if (old.TmuxPane != "" && proc.TmuxPane == old.TmuxPane) || (old.TmuxPane == "" && proc.TTY == old.TTY) {
+			match = proc
+			break
+		}
+	}
+	if match == nil && b.config.AttachAuto && len(found) == 1 {
+		match = found[0]
+	}
+	if match == nil {
+		return nil, errors.New("no Claude CLI running where the attached one was")
+	}
+	return match, nil
+}
+
+// injectMethod is one way of typing text into the attached terminal
+type injectMethod struct {
+	name     string
+	typeText func(text string) error
+}
+
+// methods lists the injection methods available for the process, in order of
+// preference. With --tmux-target, prompts only go through tmux.
+func (b *attachedBackend) methods() []injectMethod {
+	proc := b.target()
+	var methods []injectMethod
+	tmuxOnly := b.config.TmuxTarget != ""
+	if tiocstiPermitted() && !tmuxOnly {
+		methods = append(methods, injectMethod{"TIOCSTI", func(text string) error { return tiocstiType(proc.TTY, text) }})
+	}
+	if proc.TmuxPane != "" {
+		methods = append(methods, injectMethod{"tmux", func(text string) error {
+			return exec.Command("tmux", "send-keys", "-t", proc.TmuxPane, "-l", "--", text).Run()
+		}})
+	}
+	if proc.ScreenSession != "" && !tmuxOnly {
+		methods = append(methods, injectMethod{"screen", func(text string) error {
+			args := []string{"-S", proc.ScreenSession}
+			if proc.ScreenWindow != "" {
+				args = append(args, "-p", proc.ScreenWindow)
+			}
+			return exec.Command("screen", append(args, "-X", "stuff", screenEscape(text))...).Run()
+		}})
+	}
+	return methods
+}
+
+// tiocstiPermitted reports whether the kernel may allow TIOCSTI. Linux 6.2 and
+// later can disable it with the dev.tty.legacy_tiocsti sysctl.
+func tiocstiPermitted() bool {
+	data, err := os.ReadFile("/proc/sys/dev/tty/legacy_tiocsti")
+	return err != nil || strings.TrimSpace(string(data)) != "0"
+}
+
+// tiocstiType pushes text into the input queue of the terminal at ttyPath, one byte at a time
+func tiocstiType(ttyPath, text string) error {
+	tty, err := os.OpenFile(ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TIOCSTI, uintptr(unsafe.Pointer(&b))); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
+
+// screenEscape escapes the characters GNU screen's stuff command interprets
+func screenEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `^`, `\^`).Replace(text)
+}
+
+// waitForProcessExit blocks until pid exits or stop receives a value. It
+// returns true if the process exited.
+func waitForProcessExit(pid int, stop <-chan os.Signal) bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+			if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+				return true
+			}
+		}
+	}
+}
+
+// runAttached watches for markers and types the prompts into an already
+// running Claude CLI. It returns once that process exits (or, with a fallback
+// command, once the user interrupts claudewatch).
+func runAttached(config *Config, watcher fileWatcher, resolver *promptResolver, signalActions map[syscall.Signal]string) {
+	var proc *claudeProcess
+	var err error
+	if config.TmuxTarget != "" {
+		proc, err = findTmuxTarget(procRoot, config.TmuxTarget)
+	} else {
+		proc, err = findAttachTarget(procRoot, config.AttachPID)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error attaching to Claude: %v\n", err)
+		os.Exit(1)
+	}
+
+	primary := &attachedBackend{proc: proc, config: config}
+	if len(primary.methods()) == 0 {
+		fmt.Fprintf(os.Stderr, "Error attaching to Claude: TIOCSTI is disabled (sysctl dev.tty.legacy_tiocsti=0) and pid %d is not running in tmux or screen\n", proc.PID)
+		os.Exit(1)
+	}
+	dispatch := &dispatcher{
+		primary:    primary,
+		preamble:   resetPreamble(config.FileConfig),
+		budget:     newPromptBudget(config.MaxPerMinute, config.MaxPerSession),
+		checkpoint: newGitCheckpoints(config),
+		branches:   newBranchSwitcher(config),
+		hooks:      newSendHooks(config),
+		events:     config.Events,
+		history:    openSessionHistory(config),
+		clipboard:  config.Clipboard,
+		echo:       config.ShowPrompts,
+	}
+	setFallback(dispatch, config)
+	startDigest(dispatch, config)
+	startBatch(dispatch, config)
+	fmt.Fprintf(os.Stderr, "claudewatch: attached to Claude (pid %d on %s); press Ctrl-C to stop\n", proc.PID, proc.TTY)
+	claudeCwd.follow(proc.PID)
+	warnCwdDrift(config)
+
+	// Claude's terminal is elsewhere, so our own stdin only answers questions
+	input := newInputRouter(io.Discard)
+	go input.run(os.Stdin)
+
+	// No output to watch here, so in-progress comments come out as soon as
+	// their prompt is typed
+	var progress *progressTracker
+	if config.ProgressComments {
+		progress = newProgressTracker(config.markerScanner())
+	}
+
+	notes := openSessionNotes(config)
+
+	prompts := make(chan promptRequest)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processor := newFileProcessor(config, resolver, prompts)
+		processor.confirm = input.confirm
+		processor.pick = input.pick
+		processor.progress = progress
+		processor.notes = notes
+		watchAndDispatch(config, watcher, processor, dispatch, signalActions, prompts)
+	}()
+
+	// Check the session stays reachable, holding prompts while it isn't
+	stopHealth := make(chan struct{})
+	go monitorHealth(config, dispatch, config.Reconnect, stopHealth)
+	defer close(stopHealth)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	if config.Reconnect {
+		// monitorHealth waits for Claude to come back instead
+		<-stop
+	} else if waitForProcessExit(proc.PID, stop) {
+		if dispatch.failover("attached Claude exited") {
+			fmt.Fprintf(os.Stderr, "claudewatch: still watching; press Ctrl-C to stop\n")
+			<-stop
+		} else {
+			fmt.Fprintf(os.Stderr, "claudewatch: attached Claude (pid %d) exited\n", proc.PID)
+		}
+	}
+	signal.Stop(stop)
+
+	close(prompts)
+	<-done
+	dispatch.abandon()
+	progress.removeAll()
+	dispatch.history.close()
+	logStats(config)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProc adds a process to a fake /proc tree
+func fakeProc(t *testing.T, root string, pid, uid int, stdin string, cmdline, environ []string) {
+	t.Helper()
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	files := map[string]string{
+		"cmdline": strings.Join(cmdline, "\x00") + "\x00",
+		"status":  fmt.Sprintf("Name:\tx\nUid:\t%d\t%d\t%d\t%d\n", uid, uid, uid, uid),
+		"environ": strings.Join(environ, "\x00"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.Symlink(stdin, filepath.Join(dir, "fd", "0")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+}
+
+func TestIsClaudeCommand(t *testing.T) {
+	tests := []struct {
+		cmdline []string
+		want    bool
+	}{
+		{[]string{"claude"}, true},
+		{[]string{"/usr/local/bin/claude", "--resume"}, true},
+		{[]string{"node", "/home/me/.npm/bin/claude"}, true},
+		{[]string{"vim", "claude"}, false},
+		{[]string{"claudewatch"}, false},
+		{[]string{"bash", "-c", "claude"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := isClaudeCommand(tt.cmdline); got != tt.want {
+			t.Errorf("isClaudeCommand(%q) = %v, want %v", tt.cmdline, got, tt.want)
+		}
+	}
+}
+
+func TestFindAttachTargetAuto(t *testing.T) {
+	root := t.TempDir()
+	uid := os.Getuid()
+	fakeProc(t, root, 100, uid, "/dev/pts/3", []string{"node", "/usr/bin/claude"}, []string{"TMUX_PANE=%4", "HOME=/home/me"})
+	fakeProc(t, root, 101, uid+1, "/dev/pts/4", []string{"claude"}, nil)    // Another user's
+	fakeProc(t, root, 102, uid, "/dev/null", []string{"claude", "-p"}, nil) // Not on a terminal
+	fakeProc(t, root, 103, uid, "/dev/pts/5", []string{"vim"}, nil)
+
+	proc, err := findAttachTarget(root, 0)
+	if err != nil {
+		t.Fatalf("findAttachTarget() error = %v", err)
+	}
+	if proc.PID != 100 || proc.TTY != "/dev/pts/3" || proc.TmuxPane != "%4" {
+		t.Errorf("findAttachTarget() = %+v, want pid 100 on /dev/pts/3 in tmux pane %%4", proc)
+	}
+}
+
+func TestFindAttachTargetAutoAmbiguous(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, 100, os.Getuid(), "/dev/pts/3", []string{"claude"}, nil)
+	fakeProc(t, root, 200, os.Getuid(), "/dev/pts/7", []string{"claude"}, nil)
+
+	_, err := findAttachTarget(root, 0)
+	if err == nil || !strings.Contains(err.Error(), "100 (/dev/pts/3), 200 (/dev/pts/7)") {
+		t.Errorf("findAttachTarget() error = %v, want both candidates listed", err)
+	}
+
+	if _, err := findAttachTarget(t.TempDir(), 0); err == nil {
+		t.Error("findAttachTarget() found a process in an empty tree")
+	}
+}
+
+func TestFindAttachTargetByPID(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, 100, os.Getuid(), "/dev/pts/3", []string{"claude"}, []string{"STY=1234.main", "WINDOW=2"})
+	fakeProc(t, root, 101, os.Getuid()+1, "/dev/pts/4", []string{"claude"}, nil)
+
+	proc, err := findAttachTarget(root, 100)
+	if err != nil {
+		t.Fatalf("findAttachTarget() error = %v", err)
+	}
+	if proc.ScreenSession != "1234.main" || proc.ScreenWindow != "2" {
+		t.Errorf("findAttachTarget() = %+v, want the screen session and window", proc)
+	}
+
+	if _, err := findAttachTarget(root, 101); err == nil {
+		t.Error("findAttachTarget() attached to another user's process")
+	}
+}
+
+func TestScreenEscape(t *testing.T) {
+	if got, want := screenEscape(`a\b^c`), `a\\b\^c`; got != want {
+		t.Errorf("screenEscape() = %q, want %q", got, want)
+	}
+}
+
+func TestFindTmuxTarget(t *testing.T) {
+	root := t.TempDir()
+	fakeProc(t, root, 100, os.Getuid(), "/dev/pts/3", []string{"claude"}, []string{"TMUX_PANE=%4"})
+	fakeProc(t, root, 200, os.Getuid(), "/dev/pts/7", []string{"claude"}, []string{"TMUX_PANE=%9"})
+
+	orig := tmuxPaneID
+	defer func() { tmuxPaneID = orig }()
+	panes := map[string]string{"work:1.0": "%9", "notes:0.0": "%2"}
+	tmuxPaneID = func(target string) (string, error) {
+		if pane, ok := panes[target]; ok {
+			return pane, nil
+		}
+		return "", errors.New("can't find pane: " + target)
+	}
+
+	proc, err := findTmuxTarget(root, "work:1.0")
+	if err != nil || proc.PID != 200 {
+		t.Errorf("findTmuxTarget(work:1.0) = %+v, %v; want pid 200", proc, err)
+	}
+	if _, err := findTmuxTarget(root, "notes:0.0"); err == nil || !strings.Contains(err.Error(), "no Claude CLI is running in tmux pane notes:0.0 (%2)") {
+		t.Errorf("findTmuxTarget of a pane without Claude = %v", err)
+	}
+	if _, err := findTmuxTarget(root, "gone:0"); err == nil || !strings.Contains(err.Error(), "can't find pane") {
+		t.Errorf("findTmuxTarget of a missing pane = %v", err)
+	}
+}
+
+func TestTmuxTargetOnlyUsesTmux(t *testing.T) {
+	proc := &claudeProcess{PID: 100, TTY: "/dev/pts/3", TmuxPane: "%4", ScreenSession: "1234.main"}
+	b := &attachedBackend{proc: proc, config: &Config{TmuxTarget: "work:1.0"}}
+	methods := b.methods()
+	if len(methods) != 1 || methods[0].name != "tmux" {
+		var names []string
+		for _, m := range methods {
+			names = append(names, m.name)
+		}
+		t.Errorf("methods() = %v, want only tmux", names)
+	}
+}
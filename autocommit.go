@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// commitSubjectMax is how many characters an auto-commit's subject line may
+// have before the instruction in it is cut short
+const commitSubjectMax = 72
+
+// commitPathspec is what auto-commits consider: the whole repository but
+// claudewatch's own state directories, at whatever depth they are
+var commitPathspec = []string{".", ":(exclude,glob)**/" + stateDirName + "/**"}
+
+// autoCommitter implements --auto-commit: once Claude has answered a prompt,
+// what it changed in the repository is committed, with the prompt's
+// instructions as the message, for a history of one commit per instruction.
+// Only the paths that changed while the prompt was in flight are committed,
+// so the user's own uncommitted work stays out of it.
+type autoCommitter struct {
+	config *Config
+	roots  gitRoots
+	mu     sync.Mutex // One commit at a time
+}
+
+// newAutoCommitter returns the committer, or nil without --auto-commit
+func newAutoCommitter(config *Config) *autoCommitter {
+	if !config.AutoCommit {
+		return nil
+	}
+	return &autoCommitter{config: config}
+}
+
+// track returns the callbacks of a prompt for from: sending snapshots the
+// repositories of its files just before it is sent, and answered calls
+// done, then commits what changed in them since
+func (a *autoCommitter) track(done func(), from []pendingPrompt) (sending, answered func()) {
+	var bases map[string]string // Tree of each repository as the prompt was sent, keyed by its top
+	sending = func() {
+		order, _, err := a.repositories(from)
+		if err != nil {
+			console.warn("Could not snapshot the repository before the prompt: %v", err)
+			return
+		}
+		bases = make(map[string]string, len(order))
+		for _, root := range order {
+			tree, err := snapshotTree(root, commitPathspec...)
+			if err != nil {
+				console.warn("Could not snapshot %s before the prompt: %v", root, err)
+				continue
+			}
+			bases[root] = tree
+		}
+	}
+	answered = func() {
+		if done != nil {
+			done()
+		}
+		if err := a.commit(from, bases); err != nil {
+			console.warn("Could not commit Claude's changes: %v", err)
+		}
+	}
+	return sending, answered
+}
+
+// repositories groups the prompts in from by the top of the repository
+// their file is in, returning the tops in the order first seen. Files
+// outside a repository are left out.
+func (a *autoCommitter) repositories(from []pendingPrompt) ([]string, map[string][]pendingPrompt, error) {
+	var order []string
+	byRoot := make(map[string][]pendingPrompt)
+	for _, pending := range from {
+		root, err := a.roots.lookup(filepath.Dir(pending.path))
+		if err != nil {
+			return nil, nil, err
+		}
+		if root == "" {
+			continue
+		}
+		if _, ok := byRoot[root]; !ok {
+			order = append(order, root)
+		}
+		byRoot[root] = append(byRoot[root], pending)
+	}
+	return order, byRoot, nil
+}
+
+// commit commits the paths in the repositories of the prompts' files that
+// differ from bases, the trees snapshotted as the prompt was sent. A
+// repository with nothing to commit (Claude only answered a question, say)
+// or without a snapshot is left alone.
+func (a *autoCommitter) commit(from []pendingPrompt, bases map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	order, byRoot, err := a.repositories(from)
+	if err != nil {
+		return err
+	}
+	for _, root := range order {
+		base, ok := bases[root]
+		if !ok {
+			debugLog(a.config, "No snapshot of %s from before the prompt; not committing", root)
+			continue
+		}
+		paths, err := changedSince(root, base)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			debugLog(a.config, "Nothing to commit in %s", root)
+			continue
+		}
+		if _, err := git(root, nil, append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+			return err
+		}
+		// Naming the paths commits only them, leaving anything else the
+		// user has staged as it is
+		args := append([]string{"commit", "--quiet", "-m", commitMessage(a.config.markerScanner(), root, byRoot[root]), "--only", "--"}, paths...)
+		if _, err := git(root, nil, args...); err != nil {
+			return err
+		}
+		head, _ := git(root, nil, "rev-parse", "--short", "HEAD")
+		console.notice("claudewatch: committed Claude's changes as %s", head)
+	}
+	return nil
+}
+
+// changedSince returns literal pathspecs for the paths in root's working
+// tree that differ from the tree base
+func changedSince(root, base string) ([]string, error) {
+	tree, err := snapshotTree(root, commitPathspec...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(root, nil, "diff-tree", "-r", "-z", "--no-renames", "--name-only", base, tree)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" {
+			paths = append(paths, ":(literal)"+path)
+		}
+	}
+	return paths, nil
+}
+
+// commitMessage is the message of the commit for prompts: the first
+// instruction as the subject, and every instruction with its file and line
+// in the body
+func commitMessage(scanner *claudewatch.Scanner, root string, prompts []pendingPrompt) string {
+	var subject string
+	var body strings.Builder
+	count := 0
+	for _, pending := range prompts {
+		file := pending.path
+		if abs, err := filepath.Abs(file); err == nil {
+			if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+		}
+		for _, marker := range pending.original {
+			text := instructionText(scanner, marker)
+			if subject == "" {
+				subject = text
+			}
+			count++
+			fmt.Fprintf(&body, "- %s:%d: %s\n", file, marker.LineNumber, text)
+		}
+	}
+	if subject == "" {
+		subject = "Changes from Claude"
+	}
+	if count > 1 {
+		subject += fmt.Sprintf(" (and %d more)", count-1)
+	}
+	subject = "claudewatch: " + subject
+	if runes := []rune(subject); len(runes) > commitSubjectMax {
+		subject = strings.TrimSpace(string(runes[:commitSubjectMax-3])) + "..."
+	}
+	return subject + "\n\n" + body.String()
+}
+
+// instructionText is the instruction a marker gives, without the marker,
+// its directives or the comment syntax around it. An instruction written
+// over several comment lines is joined into one.
+func instructionText(scanner *claudewatch.Scanner, marker claudewatch.Marker) string {
+	if marker.Comment == "" {
+		return commentText(scanner, marker.LineText, marker.Type)
+	}
+	var words []string
+	for _, line := range strings.Split(marker.Comment, "\n") {
+		if text := commentText(scanner, line, marker.Type); text != "" {
+			words = append(words, text)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// commentText is what the comment on line says, less any marker on it
+func commentText(scanner *claudewatch.Scanner, line, markerType string) string {
+	if stripped, _, err := scanner.StripMarkers(line, []claudewatch.Marker{{LineNumber: 1, Type: markerType}}); err == nil {
+		line = stripped
+	}
+	if i := strings.Index(line, "<!--"); i >= 0 && scanner.CommentLeader(line) == "" {
+		line = line[i+len("<!--"):]
+	} else if leader := scanner.CommentLeader(line); leader != "" {
+		if i := strings.Index(line, leader); i >= 0 {
+			line = line[i+len(leader):]
+		}
+	}
+	line = strings.TrimSpace(line)
+	for _, closer := range []string{"-->", "*/"} {
+		if i := strings.Index(line, closer); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+			break
+		}
+	}
+	return strings.TrimSpace(strings.TrimLeft(line, "/#*"))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestInstructionText(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"// handle errors here ai!", "handle errors here"},
+		{"\t# Rename this ai!", "Rename this"},
+		{"x := 1 // why is this 1? ai?", "why is this 1?"},
+		{"/* split this function ai! */", "split this function"},
+		{"// ai! ai:priority=high make it faster", "make it faster"},
+		{"  <!-- improve accessibility here ai! -->", "improve accessibility here"},
+		{"<div>{/* use a list ai! */}</div>", "use a list"},
+		{"{/* use a list ai! */}", "use a list"},
+	}
+	for _, tt := range tests {
+		if got := instructionText(defaultMarkerScanner, claudewatch.Marker{LineNumber: 7, LineText: tt.line}); got != tt.want {
+			t.Errorf("instructionText(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestInstructionTextOfCommentRun(t *testing.T) {
+	marker := defaultMarkerScanner.Scan("// Use a map here,\n//   keyed by name.\n// ai!\n")[0] // ai:ignore
+	if got, want := instructionText(defaultMarkerScanner, marker), "Use a map here, keyed by name."; got != want {
+		t.Errorf("instructionText = %q, want %q", got, want)
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	root := t.TempDir()
+	prompts := []pendingPrompt{
+		{path: filepath.Join(root, "a.go"), original: []claudewatch.Marker{
+			{LineNumber: 3, LineText: "// handle errors ai!"},
+			{LineNumber: 9, LineText: "// and log them ai!"},
+		}},
+		{path: filepath.Join(root, "pkg", "b.go"), original: []claudewatch.Marker{
+			{LineNumber: 1, LineText: "// rename ai!"},
+		}},
+	}
+	want := "claudewatch: handle errors (and 2 more)\n\n- a.go:3: handle errors\n- a.go:9: and log them\n- pkg/b.go:1: rename\n"
+	if got := commitMessage(defaultMarkerScanner, root, prompts); got != want {
+		t.Errorf("commitMessage = %q, want %q", got, want)
+	}
+
+	long := []pendingPrompt{{path: filepath.Join(root, "a.go"), original: []claudewatch.Marker{
+		{LineNumber: 1, LineText: "// " + strings.Repeat("word ", 30) + "ai!"},
+	}}}
+	subject, _, _ := strings.Cut(commitMessage(defaultMarkerScanner, root, long), "\n")
+	if len(subject) != commitSubjectMax || !strings.HasSuffix(subject, "...") {
+		t.Errorf("subject = %q, want it cut to %d characters", subject, commitSubjectMax)
+	}
+}
+
+func TestAutoCommit(t *testing.T) {
+	dir := gitRepo(t)
+	for _, env := range checkpointIdentity {
+		name, value, _ := strings.Cut(env, "=")
+		t.Setenv(name, value)
+	}
+	file := filepath.Join(dir, "main.go")
+	pending := pendingPrompt{path: file, original: []claudewatch.Marker{{LineNumber: 1, LineText: "// add a main function ai!"}}}
+	committer := newAutoCommitter(&Config{AutoCommit: true})
+
+	// Nothing changed: no commit
+	before, _ := git(dir, nil, "rev-parse", "HEAD")
+	called := false
+	sending, answered := committer.track(func() { called = true }, []pendingPrompt{pending})
+	sending()
+	answered()
+	if !called {
+		t.Error("the prompt's own done callback wasn't called")
+	}
+	if head, _ := git(dir, nil, "rev-parse", "HEAD"); head != before {
+		t.Errorf("committed %s with nothing changed", head)
+	}
+
+	// Claude's edits, new files included, are committed; the user's own
+	// work from before the prompt and claudewatch's state are not
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "mine\n")
+	if err := os.Mkdir(filepath.Join(dir, stateDirName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sending, answered = committer.track(nil, []pendingPrompt{pending})
+	sending()
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n")
+	writeTestFile(t, filepath.Join(dir, "util.go"), "package main\n")
+	writeTestFile(t, filepath.Join(dir, stateDirName, "transcript.log"), "prompt\n")
+	answered()
+	if subject, _ := git(dir, nil, "log", "-1", "--format=%s"); subject != "claudewatch: add a main function" {
+		t.Errorf("commit subject = %q", subject)
+	}
+	if files, _ := git(dir, nil, "show", "--format=", "--name-only", "HEAD"); files != "main.go\nutil.go" {
+		t.Errorf("committed files = %q, want main.go and util.go", files)
+	}
+	if status, _ := git(dir, nil, "status", "--porcelain"); status != "?? .claudewatch/\n?? notes.txt" {
+		t.Errorf("status = %q after the commit, want only the state directory and notes.txt left", status)
+	}
+	if newAutoCommitter(&Config{}) != nil {
+		t.Error("newAutoCommitter without --auto-commit is not nil")
+	}
+}
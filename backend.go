@@ -0,0 +1,627 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stateDirName is the directory (relative to the current directory) where
+// claudewatch keeps logs and other state between runs
+const stateDirName = ".claudewatch"
+
+// ensureStateDir creates the state directory if needed and returns its absolute path
+func ensureStateDir() (string, error) {
+	dir, err := filepath.Abs(stateDirName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// promptRequest is a rendered prompt waiting to be dispatched
+type promptRequest struct {
+	Prompt   string
+	File     string                     // File the prompt's markers are in; empty for a reset from a signal
+	Target   backend                    // Session to send to; nil means the main Claude session
+	Restore  func()                     // Puts the prompt's markers back into the file if it can't be delivered
+	Reset    bool                       // Prompt is clearCommand, from an ai:reset directive or the reset signal action
+	Priority priority                   // Queued prompts with a higher priority are delivered first
+	Done     func()                     // Called once Claude has answered the prompt; may be nil
+	Sending  func()                     // Called just before the prompt is sent; may be nil
+	Expand   func(prompt string) string // Rewrites the prompt just before it is sent (--expand-command); may be nil
+
+	Instruction string       // The first marker's instruction, which names its branch with --branch-per-instruction
+	Sites       []markerSite // Where the prompt's markers are, for --event-socket
+	Model       string       // Model a marker asked for with model=, switched to before the prompt; empty keeps the current one
+}
+
+// expanded returns the prompt to send for req: its Prompt passed through
+// Expand, if it has one. The expansion can take a while, so it is done on
+// the way out rather than as the prompt is queued.
+func (req promptRequest) expanded() string {
+	if req.Expand == nil || req.Reset {
+		return req.Prompt
+	}
+	return req.Expand(req.Prompt)
+}
+
+// clearCommand is typed into Claude to clear its context
+const clearCommand = "/clear"
+
+// modelCommand is typed into Claude, followed by a model name, to switch models
+const modelCommand = "/model"
+
+// resetSettleDelay is how long to give Claude to clear its context, or
+// switch models, before the next prompt is typed
+var resetSettleDelay = time.Second
+
+// backend delivers a rendered prompt to a Claude session
+type backend interface {
+	Name() string
+	Send(prompt string) error
+}
+
+// ptyBackend types prompts into the interactive Claude CLI running on a PTY
+type ptyBackend struct {
+	pty    io.Writer
+	config *Config
+}
+
+func (b *ptyBackend) Name() string { return "interactive Claude" }
+
+func (b *ptyBackend) Send(prompt string) error {
+	// Write prompt to Claude's stdin
+	infoLog(b.config, "Writing prompt to Claude's PTY")
+	if _, err := b.pty.Write([]byte(b.config.InputEncoding.encode(prompt))); err != nil {
+		return fmt.Errorf("writing prompt to Claude's PTY: %w", err)
+	}
+
+	// Give the CLI time to take in the prompt, then submit it
+	debugLog(b.config, "Submitting the prompt")
+	return b.config.Submit.submit(func(keys string) error {
+		if _, err := b.pty.Write([]byte(keys)); err != nil {
+			return fmt.Errorf("submitting the prompt to Claude's PTY: %w", err)
+		}
+		return nil
+	})
+}
+
+// headlessBackend runs a non-interactive command (e.g. "claude -p") once per
+// prompt, feeding the prompt on stdin and appending the output to a log file
+// for later review.
+type headlessBackend struct {
+	command string
+	logPath string
+	config  *Config
+}
+
+func (b *headlessBackend) Name() string { return "fallback (" + b.command + ")" }
+
+func (b *headlessBackend) Send(prompt string) error {
+	logFile, err := os.OpenFile(b.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening fallback log: %w", err)
+	}
+	defer logFile.Close()
+
+	fmt.Fprintf(logFile, "\n=== %s: %s ===\n%s\n--- output ---\n", time.Now().Format(time.RFC3339), b.command, prompt)
+
+	infoLog(b.config, "Running fallback command: %s", b.command)
+	cmd := exec.Command("sh", "-c", b.command)
+	cmd.Stdin = strings.NewReader(prompt)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(logFile, "--- failed: %v ---\n", err)
+		return fmt.Errorf("running fallback command %q: %w", b.command, err)
+	}
+	return nil
+}
+
+// setFallback configures the --fallback-command backend on dispatch, if one was given
+func setFallback(dispatch *dispatcher, config *Config) {
+	if config.FallbackCommand == "" {
+		return
+	}
+	stateDir, err := ensureStateDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", stateDirName, err)
+		os.Exit(1)
+	}
+	dispatch.fallback = &headlessBackend{
+		command: config.FallbackCommand,
+		logPath: filepath.Join(stateDir, "fallback.log"),
+		config:  config,
+	}
+}
+
+// dispatcher sends prompts to the primary backend, switching permanently to
+// the fallback backend (when one is configured) once the primary has failed.
+// Prompts wait in a queue ordered by priority until delivered; while paused,
+// they are held there and delivered on resume.
+type dispatcher struct {
+	mu          sync.Mutex
+	primary     backend
+	fallback    backend
+	failedOver  bool
+	paused      bool
+	holding     bool // With --digest, prompts wait in the queue for deliverBatch
+	unavailable bool // The main session is restarting or unreachable; prompts wait for it
+	queue       promptQueue
+	delivery    chan struct{} // Wakes the delivery goroutine of watchAndDispatch to flush the queue; nil without one
+
+	sendMu     sync.Mutex          // Serializes deliveries so prompts never interleave
+	count      int                 // Number of prompts delivered so far
+	transcript *transcriptRecorder // Tagged with each dispatch when recording
+	preamble   string              // Sent ahead of the first prompt after a reset
+	cleared    map[backend]bool    // Sessions reset since their last prompt; nil key is the main session
+	activity   *outputActivity     // Output of the main session, watched to tell when a prompt is answered
+	lastMain   time.Time           // When a prompt was last typed into the main session
+	budget     *promptBudget       // With --max-per-minute or --max-per-session, limits how many prompts are sent
+	checkpoint *gitCheckpoints     // With --git-checkpoint, snapshots the repository before each prompt
+	branches   *branchSwitcher     // With --branch-per-instruction, checks out a new branch before each prompt
+	hooks      *sendHooks          // The config file's pre_send and post_send hooks
+	events     *eventSocket        // With --event-socket, told of each prompt sent and when Claude goes idle
+	clipboard  *clipboard          // With --clipboard, where each prompt is copied once sent
+	echo       bool                // With --show-prompt, each prompt is printed to the console before it is sent
+	history    *instructionHistory // Where each dispatched instruction is recorded, for claudewatch history
+	model      string              // Model last switched the main session to for a model= marker argument
+	answers    sync.WaitGroup      // Done callbacks of delivered prompts that haven't been called yet
+}
+
+// current returns the backend prompts are currently dispatched to
+func (d *dispatcher) current() backend {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failedOver {
+		return d.fallback
+	}
+	return d.primary
+}
+
+// failover switches dispatching to the fallback backend. It returns false if
+// no fallback is configured.
+func (d *dispatcher) failover(reason string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fallback == nil {
+		return false
+	}
+	if !d.failedOver {
+		d.failedOver = true
+		console.notice("%s; dispatching to %s", reason, d.fallback.Name())
+	}
+	return true
+}
+
+// Name names the backend d currently sends to. With Send, it makes d a
+// backend itself, as which it is the target of a namespace's prompts.
+func (d *dispatcher) Name() string { return d.current().Name() }
+
+// Send delivers prompt with send
+func (d *dispatcher) Send(prompt string) error { return d.send(prompt) }
+
+// send delivers prompt, failing over and retrying once if the primary backend errors
+func (d *dispatcher) send(prompt string) error {
+	b := d.current()
+	err := b.Send(prompt)
+	if err == nil || b != d.primary {
+		return err
+	}
+	if !d.failover(fmt.Sprintf("%s failed: %v", b.Name(), err)) {
+		return err
+	}
+	return d.current().Send(prompt)
+}
+
+// resetMain clears the main session's context. The headless fallback starts
+// every prompt with a fresh context, so once dispatching has failed over
+// there is nothing to clear.
+func (d *dispatcher) resetMain() error {
+	if d.current() != d.primary {
+		return nil
+	}
+	err := d.primary.Send(clearCommand)
+	if err != nil && d.failover(fmt.Sprintf("%s failed: %v", d.primary.Name(), err)) {
+		return nil
+	}
+	return err
+}
+
+// selectModel switches the main session to model before a prompt whose
+// markers ask for it. The session stays on it afterwards, as if the user had
+// typed the command, so nothing is typed when it is already selected. The
+// headless fallback can't switch, so prompts go to it as they are. It is
+// called with sendMu held.
+func (d *dispatcher) selectModel(model string) {
+	if model == d.model {
+		return
+	}
+	if d.current() != d.primary {
+		console.warn("Not switching to model %s for prompt #%d: %s can't switch models", model, d.count, d.current().Name())
+		return
+	}
+	if err := d.primary.Send(modelCommand + " " + model); err != nil {
+		console.warn("Could not switch to model %s for prompt #%d: %v", model, d.count, err)
+		return
+	}
+	d.model = model
+	console.notice("claudewatch: switched to model %s for prompt #%d", model, d.count)
+	time.Sleep(resetSettleDelay)
+}
+
+// submit queues req and delivers the queue, unless dispatching is paused
+func (d *dispatcher) submit(req promptRequest) error {
+	d.enqueue(req)
+	return d.flush()
+}
+
+// enqueue adds req to the prompts waiting to be delivered
+func (d *dispatcher) enqueue(req promptRequest) {
+	d.mu.Lock()
+	d.queue.push(req)
+	d.mu.Unlock()
+}
+
+// flush delivers queued prompts, highest priority first, until the queue is
+// empty or dispatching is paused. Prompts queued while it is delivering are
+// picked up in priority order as well. A prompt for the main session waits
+// until Claude has answered the one before, as typing it mid-answer would
+// mangle both. It returns any delivery errors.
+func (d *dispatcher) flush() error {
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	var errs []error
+	for {
+		d.mu.Lock()
+		req, ok, busy := promptRequest{}, false, false
+		if !d.paused && !d.holding && !d.unavailable && len(d.queue) > 0 && d.withinBudget(d.queue[0]) {
+			if busy = d.queue[0].Target == nil && d.answering(); !busy {
+				req, ok = d.queue.pop()
+			}
+		}
+		queued := len(d.queue)
+		d.mu.Unlock()
+		if busy {
+			// Look at the queue again afterwards, as it may have changed
+			d.awaitAnswered(queued)
+			continue
+		}
+		if !ok {
+			return errors.Join(errs...)
+		}
+		if err := d.deliver(req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
+
+// withinBudget reports whether req may be sent under --max-per-minute and
+// --max-per-session. Resets don't count. When the per-minute limit holds it
+// back, the queue is flushed again once it allows. It is called with mu held.
+func (d *dispatcher) withinBudget(req promptRequest) bool {
+	if d.budget == nil || req.Reset {
+		return true
+	}
+	wait := d.budget.wait(time.Now())
+	switch {
+	case wait == 0:
+		return true
+	case wait < 0:
+		if !d.budget.warned {
+			console.warn("claudewatch: %d prompts sent this session (--max-per-session); holding the rest", d.budget.total)
+		}
+	default:
+		if !d.budget.warned {
+			console.warn("claudewatch: %d prompts sent in the last minute (--max-per-minute); holding the rest for %s", len(d.budget.recent), wait.Round(time.Second))
+		}
+		if d.budget.retry == nil {
+			d.budget.retry = time.AfterFunc(wait, func() {
+				d.mu.Lock()
+				d.budget.retry = nil
+				d.mu.Unlock()
+				d.release()
+			})
+		}
+	}
+	d.budget.warned = true
+	return false
+}
+
+// answering reports whether Claude is still answering the last prompt typed
+// into the main session, going by its output. An attached session's output
+// can't be watched, and the fallback finishes each prompt as it is sent. It
+// is called with mu and sendMu held.
+func (d *dispatcher) answering() bool {
+	if d.activity == nil || d.failedOver || d.lastMain.IsZero() {
+		return false
+	}
+	from := d.activity.lastOutput()
+	if from.Before(d.lastMain) {
+		from = d.lastMain
+	}
+	return time.Since(from) < answerQuietPeriod
+}
+
+// awaitAnswered waits until Claude has answered the last prompt typed into
+// the main session, while queued prompts wait for it. It is called with
+// sendMu held.
+func (d *dispatcher) awaitAnswered(queued int) {
+	console.notice("claudewatch: Claude is busy; %d prompt(s) queued until it has answered", queued)
+	d.activity.waitQuiet(d.lastMain, answerQuietPeriod)
+}
+
+// deliverBatch delivers every prompt held for a digest batch, highest
+// priority first, and reports how each went. Prompts queued meanwhile wait
+// for the next batch. While dispatching is paused, nothing is delivered.
+func (d *dispatcher) deliverBatch() []batchResult {
+	return d.deliverHeld(nil)
+}
+
+// held returns how many prompts are waiting to be delivered
+func (d *dispatcher) held() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queue)
+}
+
+// deliverHeld delivers every held prompt as deliverBatch does, after
+// rearranging them with combine if it isn't nil
+func (d *dispatcher) deliverHeld(combine func([]promptRequest) []promptRequest) []batchResult {
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+
+	d.mu.Lock()
+	batch := d.queue
+	if d.paused || d.unavailable {
+		batch = nil
+	} else {
+		d.queue = nil
+	}
+	d.mu.Unlock()
+	if combine != nil && len(batch) > 0 {
+		batch = combine(batch)
+	}
+
+	results := make([]batchResult, 0, len(batch))
+	for i, req := range batch {
+		d.mu.Lock()
+		if !d.withinBudget(req) {
+			// The rest wait for a later batch
+			for _, held := range batch[i:] {
+				d.queue.push(held)
+			}
+			d.mu.Unlock()
+			break
+		}
+		busy := req.Target == nil && d.answering()
+		d.mu.Unlock()
+		if busy {
+			d.awaitAnswered(len(batch) - i)
+		}
+		results = append(results, batchResult{req: req, err: d.deliver(req)})
+	}
+	return results
+}
+
+// deliver sends req to its target session, or the main session if it has
+// none. It is called with sendMu held.
+func (d *dispatcher) deliver(req promptRequest) error {
+	req.Prompt = req.expanded()
+	if d.hooks != nil && !req.Reset {
+		if err := d.hooks.beforeSend(req); err != nil {
+			if req.Restore != nil {
+				req.Restore()
+			}
+			d.recordHistory(req, 0, outcomeCancelled, err)
+			return fmt.Errorf("prompt for %s cancelled: %w", req.File, err)
+		}
+	}
+	d.count++
+	if d.transcript != nil {
+		d.transcript.beginDispatch(d.count, firstLine(req.Prompt))
+	}
+	if d.branches != nil && !req.Reset {
+		// What was done for the previous prompt (and its --auto-commit)
+		// belongs on that prompt's branch
+		d.answers.Wait()
+		if name, err := d.branches.start(req); err != nil {
+			console.warn("Could not create a branch for prompt #%d: %v; staying on the current branch", d.count, err)
+		} else if name != "" {
+			console.notice("claudewatch: checked out branch %s for prompt #%d", name, d.count)
+		}
+	}
+	if d.checkpoint != nil && !req.Reset {
+		if _, err := d.checkpoint.record(d.count, req); err != nil {
+			console.warn("Could not record a git checkpoint before prompt #%d: %v", d.count, err)
+		}
+	}
+	if req.Sending != nil {
+		req.Sending()
+	}
+	if req.Model != "" && req.Target == nil && !req.Reset {
+		d.selectModel(req.Model)
+	}
+	prompt := req.Prompt
+	if !req.Reset && d.preamble != "" && d.cleared[req.Target] {
+		prompt = d.preamble + "\n\n" + prompt
+	}
+	if d.echo && !req.Reset {
+		console.prompt(promptTitle(d.count, req), prompt)
+	}
+
+	var err error
+	switch {
+	case req.Target != nil:
+		err = req.Target.Send(prompt)
+	case req.Reset:
+		err = d.resetMain()
+	default:
+		err = d.send(prompt)
+	}
+	if err != nil {
+		if req.Restore != nil {
+			req.Restore()
+		}
+		d.recordHistory(req, d.count, outcomeFailed, err)
+		return err
+	}
+	d.recordHistory(req, d.count, outcomeSent, nil)
+
+	// After a reset, the preamble goes ahead of the session's next prompt
+	if req.Reset {
+		if d.cleared == nil {
+			d.cleared = make(map[backend]bool)
+		}
+		d.cleared[req.Target] = true
+		time.Sleep(resetSettleDelay)
+	} else {
+		delete(d.cleared, req.Target)
+	}
+	if req.Target == nil {
+		d.lastMain = time.Now()
+	}
+	if d.budget != nil && !req.Reset {
+		d.mu.Lock()
+		d.budget.record(time.Now())
+		d.mu.Unlock()
+	}
+	if d.clipboard != nil && !req.Reset {
+		if err := d.clipboard.copy(prompt); err != nil {
+			console.warn("Could not copy prompt #%d to the clipboard: %v", d.count, err)
+		}
+	}
+	if d.hooks != nil && !req.Reset {
+		d.hooks.afterSend(d.count, req)
+	}
+	if !req.Reset {
+		d.events.emit(editorEvent{Event: eventSent, File: req.File, Prompt: d.count, Markers: req.Sites})
+	}
+	if req.Done != nil || d.events != nil {
+		d.awaitAnswer(req, time.Now())
+	}
+	return nil
+}
+
+// awaitAnswer calls req.Done (if set) once Claude has answered req, which is
+// when the main session's output has gone quiet, and tells --event-socket
+// if nothing else is waiting. A headless command has finished by the time
+// Send returns and an attached session's output can't be watched, so for
+// those it is called straight away.
+func (d *dispatcher) awaitAnswer(req promptRequest, sent time.Time) {
+	answered := func() {
+		if req.Done != nil {
+			req.Done()
+		}
+		d.mu.Lock()
+		idle := len(d.queue) == 0
+		d.mu.Unlock()
+		if idle {
+			d.events.emit(editorEvent{Event: eventIdle})
+		}
+	}
+	d.answers.Add(1)
+	if req.Target != nil || d.activity == nil || d.current() != d.primary {
+		answered()
+		d.answers.Done()
+		return
+	}
+	go func() {
+		defer d.answers.Done()
+		d.activity.waitQuiet(sent, answerQuietPeriod)
+		answered()
+	}()
+}
+
+// abandon drops any queued prompts without sending them, restoring their
+// markers. It is called on shutdown so instructions held while paused aren't lost.
+func (d *dispatcher) abandon() {
+	d.mu.Lock()
+	held := d.queue
+	d.queue = nil
+	d.mu.Unlock()
+
+	for _, req := range held {
+		if req.Restore != nil {
+			req.Restore()
+		}
+	}
+}
+
+// setUnavailable holds prompts while the main session is being relaunched or
+// can't be reached, or delivers those held once it is back
+func (d *dispatcher) setUnavailable(unavailable bool) {
+	d.mu.Lock()
+	was := d.unavailable
+	d.unavailable = unavailable
+	d.mu.Unlock()
+
+	if was && !unavailable {
+		d.release()
+	}
+}
+
+// togglePause pauses or resumes dispatching, returning whether it is now
+// paused. Prompts held while paused are delivered on resume.
+func (d *dispatcher) togglePause() bool {
+	d.mu.Lock()
+	d.paused = !d.paused
+	paused := d.paused
+	d.mu.Unlock()
+
+	if !paused {
+		d.release()
+	}
+	return paused
+}
+
+// release delivers the queued prompts once they may go out again. With a
+// delivery goroutine, that goroutine is woken to flush them, so they can't
+// race the prompts it is delivering; without one, they are flushed here.
+func (d *dispatcher) release() {
+	d.mu.Lock()
+	if d.delivery != nil {
+		select {
+		case d.delivery <- struct{}{}:
+		default: // A flush is already due and will pick them up
+		}
+		d.mu.Unlock()
+		return
+	}
+	d.mu.Unlock()
+
+	if err := d.flush(); err != nil {
+		console.errorf("Error sending prompt: %v", err)
+	}
+}
+
+// setDelivery makes queued the channel release wakes the delivery goroutine
+// with; nil goes back to flushing on the caller's goroutine
+func (d *dispatcher) setDelivery(queued chan struct{}) {
+	d.mu.Lock()
+	d.delivery = queued
+	d.mu.Unlock()
+}
+
+// promptTitle heads prompt n as shown with --show-prompt
+func promptTitle(n int, req promptRequest) string {
+	title := fmt.Sprintf("prompt #%d", n)
+	if req.File != "" {
+		title += " for " + req.File
+	}
+	if req.Target != nil {
+		title += " to " + req.Target.Name()
+	}
+	return title
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// fakeBackend records the prompts it receives and optionally fails
+type fakeBackend struct {
+	name    string
+	err     error
+	prompts []string
+}
+
+func (b *fakeBackend) Name() string { return b.name }
+
+func (b *fakeBackend) Send(prompt string) error {
+	b.prompts = append(b.prompts, prompt)
+	return b.err
+}
+
+func TestDispatcherUsesPrimaryWhileHealthy(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	fallback := &fakeBackend{name: "fallback"}
+	d := &dispatcher{primary: primary, fallback: fallback}
+
+	if err := d.send("hello"); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if len(primary.prompts) != 1 || len(fallback.prompts) != 0 {
+		t.Errorf("primary got %d prompts, fallback got %d; want 1 and 0", len(primary.prompts), len(fallback.prompts))
+	}
+}
+
+func TestDispatcherFailsOverWhenPrimaryErrors(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: errors.New("pty closed")}
+	fallback := &fakeBackend{name: "fallback"}
+	d := &dispatcher{primary: primary, fallback: fallback}
+
+	if err := d.send("first"); err != nil {
+		t.Fatalf("send() error = %v, want nil after failover", err)
+	}
+	if err := d.send("second"); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	if len(primary.prompts) != 1 {
+		t.Errorf("primary got %d prompts, want 1 (no retries after failover)", len(primary.prompts))
+	}
+	if got := strings.Join(fallback.prompts, ","); got != "first,second" {
+		t.Errorf("fallback prompts = %q, want %q", got, "first,second")
+	}
+}
+
+func TestDispatcherWithoutFallbackReturnsError(t *testing.T) {
+	primary := &fakeBackend{name: "primary", err: errors.New("pty closed")}
+	d := &dispatcher{primary: primary}
+
+	if err := d.send("hello"); err == nil {
+		t.Error("send() error = nil, want the primary's error")
+	}
+	if d.failover("test") {
+		t.Error("failover() = true without a fallback configured")
+	}
+}
+
+func TestHeadlessBackendLogsOutput(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "fallback.log")
+	b := &headlessBackend{command: "cat", logPath: logPath, config: &Config{}}
+
+	if err := b.Send("do the thing"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	// The prompt appears once as the logged input and once echoed by cat
+	if n := bytes.Count(content, []byte("do the thing")); n != 2 {
+		t.Errorf("log contains prompt %d times, want 2:\n%s", n, content)
+	}
+}
+
+func TestDispatcherWaitsForAnswerBeforeNextPrompt(t *testing.T) {
+	old := answerQuietPeriod
+	answerQuietPeriod = 50 * time.Millisecond
+	t.Cleanup(func() { answerQuietPeriod = old })
+
+	activity := &outputActivity{}
+	primary := &fakeBackend{name: "primary"}
+	specialist := &fakeBackend{name: "specialist"}
+	d := &dispatcher{primary: primary, activity: activity}
+	if err := d.submit(promptRequest{Prompt: "first"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// Claude is still answering, but a namespace's own session isn't kept waiting
+	start := time.Now()
+	if err := d.submit(promptRequest{Prompt: "aside", Target: specialist}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if waited := time.Since(start); waited >= answerQuietPeriod {
+		t.Errorf("prompt for another session waited %s for Claude", waited)
+	}
+
+	// Claude keeps printing for a while; the next prompt waits it out
+	_, _ = activity.Write([]byte("."))
+	printed := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			time.Sleep(20 * time.Millisecond)
+			_, _ = activity.Write([]byte("."))
+		}
+		close(printed)
+	}()
+	if err := d.submit(promptRequest{Prompt: "second"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	select {
+	case <-printed:
+	default:
+		t.Error("second prompt sent while Claude was still answering")
+	}
+	if got := strings.Join(primary.prompts, ","); got != "first,second" {
+		t.Errorf("primary prompts = %q, want %q", got, "first,second")
+	}
+}
+
+func TestDispatcherSwitchesModelForMarkerArgument(t *testing.T) {
+	old := resetSettleDelay
+	resetSettleDelay = 0
+	defer func() { resetSettleDelay = old }()
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+
+	for _, req := range []promptRequest{
+		{Prompt: "plain"},
+		{Prompt: "first", Model: "opus"},
+		{Prompt: "second", Model: "opus"},
+		{Prompt: "headless", Model: "haiku", Target: &fakeBackend{name: "be"}},
+		{Prompt: "third", Model: "sonnet"},
+	} {
+		if err := d.deliver(req); err != nil {
+			t.Fatalf("deliver(%q) = %v", req.Prompt, err)
+		}
+	}
+	want := []string{"plain", "/model opus", "first", "second", "/model sonnet", "third"}
+	if !reflect.DeepEqual(primary.prompts, want) {
+		t.Errorf("primary got %q, want %q", primary.prompts, want)
+	}
+
+	// The fallback can't switch models; the prompt goes as it is
+	fallback := &fakeBackend{name: "fallback"}
+	d = &dispatcher{primary: primary, fallback: fallback, failedOver: true}
+	if err := d.deliver(promptRequest{Prompt: "fourth", Model: "opus"}); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+	if !reflect.DeepEqual(fallback.prompts, []string{"fourth"}) {
+		t.Errorf("fallback got %q, want only the prompt", fallback.prompts)
+	}
+}
+
+func TestPromptModel(t *testing.T) {
+	from := []pendingPrompt{
+		{data: TemplateData{Markers: []claudewatch.Marker{{LineNumber: 1}}}},
+		{data: TemplateData{Markers: []claudewatch.Marker{{LineNumber: 2, Args: map[string]string{"lines": "+2"}}, {LineNumber: 3, Args: map[string]string{"model": "opus"}}}}},
+	}
+	if got := promptModel(from); got != "opus" {
+		t.Errorf("promptModel() = %q, want opus", got)
+	}
+	if got := promptModel(from[:1]); got != "" {
+		t.Errorf("promptModel() without model= = %q, want none", got)
+	}
+}
+
+func TestPromptTitle(t *testing.T) {
+	if got := promptTitle(3, promptRequest{File: "a.go"}); got != "prompt #3 for a.go" {
+		t.Errorf("promptTitle() = %q", got)
+	}
+	req := promptRequest{File: "b.go", Target: &fakeBackend{name: "headless review"}}
+	if got := promptTitle(4, req); got != "prompt #4 for b.go to headless review" {
+		t.Errorf("promptTitle() with a target = %q", got)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// backupDirName is the directory under the state directory holding --backup copies
+const backupDirName = "backups"
+
+// backupTimeLayout is the timestamp suffix of backup file names. It sorts
+// chronologically and contains no characters that need quoting in a shell.
+const backupTimeLayout = "20060102T150405.000000000"
+
+// backupKey returns the name a file's backups are stored under: its path
+// relative to the current directory, or its absolute path (without the
+// leading separator) for files outside it
+func backupKey(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(cwd, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel, nil
+	}
+	return strings.TrimPrefix(abs, string(filepath.Separator)), nil
+}
+
+// writeBackup saves content as a backup of path taken at t, as
+// <backupsDir>/<key>@<timestamp>, and returns the backup's path
+func writeBackup(backupsDir, path string, content []byte, t time.Time) (string, error) {
+	key, err := backupKey(path)
+	if err != nil {
+		return "", err
+	}
+	backupPath := filepath.Join(backupsDir, key+"@"+t.UTC().Format(backupTimeLayout))
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(backupPath, content, 0o644); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// backupEntry is one backup found under the backups directory
+type backupEntry struct {
+	Key  string    // The backed up file, as returned by backupKey
+	Time time.Time // When the backup was taken
+	Path string    // Where the backup is stored
+}
+
+// listBackups returns the backups under backupsDir, optionally only those of
+// key, ordered by file and then oldest first
+func listBackups(backupsDir, key string) ([]backupEntry, error) {
+	var entries []backupEntry
+	err := filepath.WalkDir(backupsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(backupsDir, path)
+		if err != nil {
+			return err
+		}
+		at := strings.LastIndex(rel, "@")
+		if at < 0 {
+			return nil
+		}
+		t, err := time.Parse(backupTimeLayout, rel[at+1:])
+		if err != nil {
+			return nil // Not one of ours
+		}
+		if key == "" || rel[:at] == key {
+			entries = append(entries, backupEntry{Key: rel[:at], Time: t, Path: path})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// restoreBackup overwrites path with the backup's content, keeping the
+// file's current permissions if it still exists
+func restoreBackup(entry backupEntry, path string) error {
+	content, err := os.ReadFile(entry.Path)
+	if err != nil {
+		return err
+	}
+	return claudewatch.WriteFileAtomic(path, content, 0o644)
+}
+
+// runRestore implements "claudewatch restore": it lists the backups taken
+// with --backup or copies one back over the file it was taken from. It
+// returns the process exit code.
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	list := fs.Bool("list", false, "List available backups (of FILE, or of every file) instead of restoring")
+	at := fs.String("at", "", "Restore the backup with this timestamp (as shown by --list) instead of the newest")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch restore [--at TIMESTAMP] FILE")
+		fmt.Fprintln(fs.Output(), "       claudewatch restore --list [FILE]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Restore a file from the backups taken with --backup.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 || (!*list && fs.NArg() != 1) {
+		fs.Usage()
+		return 2
+	}
+
+	var key string
+	if fs.NArg() == 1 {
+		var err error
+		if key, err = backupKey(fs.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+	}
+
+	backupsDir := filepath.Join(stateDirName, backupDirName)
+	entries, err := listBackups(backupsDir, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading backups: %v\n", err)
+		return 2
+	}
+	if len(entries) == 0 {
+		if key == "" {
+			fmt.Fprintf(os.Stderr, "No backups in %s; start claudewatch with --backup to take them\n", backupsDir)
+		} else {
+			fmt.Fprintf(os.Stderr, "No backups of %s in %s\n", key, backupsDir)
+		}
+		return 1
+	}
+
+	if *list {
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  (%s)\n", entry.Time.UTC().Format(backupTimeLayout), entry.Key, entry.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+		return 0
+	}
+
+	chosen := entries[len(entries)-1]
+	if *at != "" {
+		found := false
+		for _, entry := range entries {
+			if entry.Time.UTC().Format(backupTimeLayout) == *at {
+				chosen, found = entry, true
+				break
+			}
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "No backup of %s at %s (see claudewatch restore --list %s)\n", key, *at, fs.Arg(0))
+			return 1
+		}
+	}
+
+	if err := restoreBackup(chosen, fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring %s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+	fmt.Printf("Restored %s from the backup taken %s\n", fs.Arg(0), chosen.Time.Local().Format("2006-01-02 15:04:05"))
+	return 0
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestBackupKey(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	if key, err := backupKey("src/main.go"); err != nil || key != filepath.Join("src", "main.go") {
+		t.Errorf("backupKey(src/main.go) = %q, %v; want the relative path", key, err)
+	}
+	outside := filepath.Join(filepath.Dir(dir), "other", "f.go")
+	if key, err := backupKey(outside); err != nil || key != outside[1:] {
+		t.Errorf("backupKey(%s) = %q, %v; want the absolute path without its leading slash", outside, key, err)
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	chdir(t, t.TempDir())
+	backupsDir := filepath.Join(stateDirName, backupDirName)
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, file := range []string{"b.go", "a.go", "b.go"} {
+		if _, err := writeBackup(backupsDir, file, []byte(file), first.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("writeBackup: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(backupsDir, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	all, err := listBackups(backupsDir, "")
+	if err != nil {
+		t.Fatalf("listBackups: %v", err)
+	}
+	if len(all) != 3 || all[0].Key != "a.go" || all[1].Key != "b.go" || !all[1].Time.Equal(first) {
+		t.Errorf("listBackups() = %+v, want a.go then b.go oldest first", all)
+	}
+
+	onlyB, err := listBackups(backupsDir, "b.go")
+	if err != nil || len(onlyB) != 2 {
+		t.Errorf("listBackups(b.go) = %+v, %v; want its two backups", onlyB, err)
+	}
+
+	if none, err := listBackups(filepath.Join(t.TempDir(), "missing"), ""); err != nil || len(none) != 0 {
+		t.Errorf("listBackups(missing dir) = %+v, %v; want nothing and no error", none, err)
+	}
+}
+
+func TestRunRestore(t *testing.T) {
+	chdir(t, t.TempDir())
+	backupsDir := filepath.Join(stateDirName, backupDirName)
+	older := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	if _, err := writeBackup(backupsDir, "f.go", []byte("v1 ai!\n"), older); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	if _, err := writeBackup(backupsDir, "f.go", []byte("v2 ai!\n"), older.Add(time.Hour)); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	if err := os.WriteFile("f.go", []byte("v2\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if code := runRestore([]string{"f.go"}); code != 0 {
+		t.Fatalf("runRestore(f.go) = %d, want 0", code)
+	}
+	if got := readString(t, "f.go"); got != "v2 ai!\n" {
+		t.Errorf("f.go = %q, want the newest backup", got)
+	}
+	if info, err := os.Stat("f.go"); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("restore changed the file's permissions: %v, %v", info.Mode(), err)
+	}
+
+	if code := runRestore([]string{"--at", older.Format(backupTimeLayout), "f.go"}); code != 0 {
+		t.Fatalf("runRestore(--at) = %d, want 0", code)
+	}
+	if got := readString(t, "f.go"); got != "v1 ai!\n" {
+		t.Errorf("f.go = %q, want the backup chosen with --at", got)
+	}
+
+	if code := runRestore([]string{"other.go"}); code != 1 {
+		t.Errorf("runRestore(other.go) = %d, want 1 for a file without backups", code)
+	}
+	if code := runRestore(nil); code != 2 {
+		t.Errorf("runRestore() = %d, want 2 without a file", code)
+	}
+}
+
+func TestProcessBacksUpBeforeStripping(t *testing.T) {
+	chdir(t, t.TempDir())
+	content := "// use a map ai!\n"
+	if err := os.WriteFile("f.go", []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	prompts := make(chan promptRequest, 1)
+	newFileProcessor(&Config{Backup: true}, resolver, prompts).process("f.go")
+
+	entries, err := listBackups(filepath.Join(stateDirName, backupDirName), "f.go")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("listBackups() = %+v, %v; want one backup", entries, err)
+	}
+	if got := readString(t, entries[0].Path); got != content {
+		t.Errorf("backup = %q, want the content before stripping", got)
+	}
+	if got := readString(t, "f.go"); got != "// use a map\n" {
+		t.Errorf("f.go = %q, want the markers stripped", got)
+	}
+}
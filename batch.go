@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// flushFifoName is the named pipe in the state directory that "claudewatch
+// flush" writes to, to send the instructions held with --batch
+const flushFifoName = "flush.fifo"
+
+// batchKey is the key (Ctrl-]) that sends the instructions held with --batch
+// when pressed in the terminal claudewatch runs Claude in
+const batchKey = 0x1d
+
+// batchHeader starts the prompt the instructions held with --batch are sent
+// in, given how many there are
+const batchHeader = "The following %d instructions were left together as one batch. Treat them as a single coordinated change: read them all before editing anything, and keep the edits consistent with each other."
+
+// startBatch makes dispatch hold prompts until the batch is flushed, when
+// --batch is set
+func startBatch(dispatch *dispatcher, config *Config) {
+	if config.Batch {
+		dispatch.holding = true
+	}
+}
+
+// flushBatch delivers the prompts held with --batch, those for the main
+// session combined into one, and reports how each went
+func (d *dispatcher) flushBatch() []batchResult {
+	return d.deliverHeld(combineBatch)
+}
+
+// releaseBatch sends the held prompts when the batch is flushed, by the
+// hotkey, "claudewatch flush" or a signal (how, for the notice)
+func releaseBatch(config *Config, dispatch *dispatcher, how string) {
+	held := dispatch.held()
+	if held == 0 {
+		console.notice("claudewatch: no instructions are held (%s)", how)
+		return
+	}
+	console.notice("claudewatch: sending %d held prompt(s) as a batch (%s)", held, how)
+	results := dispatch.flushBatch()
+	if len(results) == 0 {
+		console.notice("claudewatch: dispatching is paused; the batch is still held")
+		return
+	}
+	for _, result := range results {
+		if result.err != nil {
+			console.errorf("Error sending prompt: %v", result.err)
+			warnLog(config, "Error sending batched prompt for %s: %v", result.req.File, result.err)
+		}
+	}
+}
+
+// combineBatch merges the prompts for the main session in held into one,
+// where the first of them was; resets and prompts for other sessions are
+// left as they are. held is in delivery order.
+func combineBatch(held []promptRequest) []promptRequest {
+	var main []promptRequest
+	for _, req := range held {
+		if req.Target == nil && !req.Reset {
+			main = append(main, req)
+		}
+	}
+	if len(main) < 2 {
+		return held
+	}
+
+	combined := combineRequests(main)
+	batch := make([]promptRequest, 0, len(held)-len(main)+1)
+	added := false
+	for _, req := range held {
+		if req.Target != nil || req.Reset {
+			batch = append(batch, req)
+		} else if !added {
+			batch = append(batch, combined)
+			added = true
+		}
+	}
+	return batch
+}
+
+// combineRequests makes one prompt of reqs, numbering each one's prompt
+// under batchHeader. Its markers are restored, and it is answered, when all
+// of theirs would be.
+func combineRequests(reqs []promptRequest) promptRequest {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, batchHeader, len(reqs))
+	var files []string
+	seen := make(map[string]bool)
+	combined := promptRequest{Priority: reqs[0].Priority, Instruction: reqs[0].Instruction}
+	for i, req := range reqs {
+		fmt.Fprintf(&prompt, "\n\n### Instruction %d of %d\n\n%s", i+1, len(reqs), strings.TrimRight(req.expanded(), "\n"))
+		if req.File != "" && !seen[req.File] {
+			seen[req.File] = true
+			files = append(files, req.File)
+		}
+		combined.Sites = append(combined.Sites, req.Sites...)
+		if combined.Model == "" {
+			combined.Model = req.Model
+		}
+		if combined.Instruction == "" {
+			combined.Instruction = req.Instruction
+		}
+	}
+	combined.Prompt = prompt.String()
+	combined.File = strings.Join(files, ", ")
+	combined.Restore = func() {
+		for _, req := range reqs {
+			if req.Restore != nil {
+				req.Restore()
+			}
+		}
+	}
+	combined.Done = func() {
+		for _, req := range reqs {
+			if req.Done != nil {
+				req.Done()
+			}
+		}
+	}
+	combined.Sending = func() {
+		for _, req := range reqs {
+			if req.Sending != nil {
+				req.Sending()
+			}
+		}
+	}
+	return combined
+}
+
+// runFlush implements "claudewatch flush": it tells the session running in
+// the current directory with --batch to send the instructions it holds
+func runFlush(args []string) int {
+	fs := flag.NewFlagSet("flush", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch flush")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Send the instructions held by the claudewatch --batch session running in this")
+		fmt.Fprintln(fs.Output(), "directory, as one prompt.")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	path := filepath.Join(stateDirName, flushFifoName)
+	if err := writeInstruction(path, "flush\n"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (is claudewatch running with --batch?)\n", err)
+		return 1
+	}
+	return 0
+}
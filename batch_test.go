@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFlushBatchCombinesMainSessionPrompts(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	other := &fakeBackend{name: "docs"}
+	d := &dispatcher{primary: primary, holding: true}
+
+	var restored, done []string
+	request := func(prompt, file string) promptRequest {
+		return promptRequest{
+			Prompt:  prompt,
+			File:    file,
+			Restore: func() { restored = append(restored, prompt) },
+			Done:    func() { done = append(done, prompt) },
+		}
+	}
+	d.enqueue(request("rename Foo to Bar", "a.go"))
+	d.enqueue(promptRequest{Prompt: "update the guide", File: "guide.md", Target: other})
+	d.enqueue(request("update the callers of Foo", "b.go"))
+	if err := d.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(primary.prompts) != 0 {
+		t.Fatalf("prompts sent before the batch was flushed: %q", primary.prompts)
+	}
+
+	results := d.flushBatch()
+	if len(results) != 2 {
+		t.Fatalf("flushBatch delivered %d prompts, want the combined one and the docs one", len(results))
+	}
+	if len(primary.prompts) != 1 {
+		t.Fatalf("main session got %d prompts, want 1", len(primary.prompts))
+	}
+	prompt := primary.prompts[0]
+	for _, want := range []string{"The following 2 instructions", "### Instruction 1 of 2\n\nrename Foo to Bar", "### Instruction 2 of 2\n\nupdate the callers of Foo"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("combined prompt = %q, want it to contain %q", prompt, want)
+		}
+	}
+	if results[0].req.File != "a.go, b.go" {
+		t.Errorf("combined prompt's file = %q, want both files", results[0].req.File)
+	}
+	if len(other.prompts) != 1 || other.prompts[0] != "update the guide" {
+		t.Errorf("docs session got %q, want its prompt unchanged", other.prompts)
+	}
+	if strings.Join(done, ",") != "rename Foo to Bar,update the callers of Foo" {
+		t.Errorf("Done called for %q, want every combined prompt", done)
+	}
+
+	results[0].req.Restore()
+	if len(restored) != 2 {
+		t.Errorf("Restore put back %q, want the markers of both prompts", restored)
+	}
+}
+
+func TestCombineBatchLeavesSinglePromptAlone(t *testing.T) {
+	held := []promptRequest{{Prompt: clearCommand, Reset: true}, {Prompt: "rename Foo"}}
+	if got := combineBatch(held); len(got) != 2 || got[1].Prompt != "rename Foo" {
+		t.Errorf("combineBatch() = %+v, want the prompts unchanged", got)
+	}
+}
+
+func TestInputRouterHotkey(t *testing.T) {
+	var dest bytes.Buffer
+	r := newInputRouter(&dest)
+	pressed := make(chan struct{}, 1)
+	r.hotkey = batchKey
+	r.onHotkey = func() { pressed <- struct{}{} }
+
+	r.route([]byte{'a', batchKey, 'b'})
+	<-pressed
+	if got := dest.String(); got != "ab" {
+		t.Errorf("forwarded input = %q, want the hotkey kept from Claude", got)
+	}
+}
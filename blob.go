@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// Limits on the content context providers ({{readFile}}, {{shell}}, --context)
+// put into a prompt. Prompts are typed into Claude's terminal, so a binary
+// file or a minified bundle pasted in whole can lock it up and blow through
+// Claude's context.
+const (
+	contextMaxBytes   = 256 * 1024 // Content beyond this many bytes is truncated
+	contextMaxLineLen = 2000       // Content with a longer line is treated as minified
+)
+
+// longestLine returns the length in bytes of the longest line in text
+func longestLine(text string) int {
+	longest := 0
+	for len(text) > 0 {
+		n := strings.IndexByte(text, '\n')
+		if n < 0 {
+			n = len(text)
+		}
+		if n > longest {
+			longest = n
+		}
+		text = text[min(n+1, len(text)):]
+	}
+	return longest
+}
+
+// guardContext returns text as it should be embedded in a prompt: binary or
+// minified content is replaced by a note saying what was left out, and long
+// text is truncated at a line boundary
+func guardContext(text string) string {
+	if claudewatch.LooksBinary([]byte(text)) {
+		return fmt.Sprintf("[binary content omitted: %d bytes]", len(text))
+	}
+	if longest := longestLine(text); longest > contextMaxLineLen {
+		return fmt.Sprintf("[minified content omitted: %d bytes, longest line %d bytes]", len(text), longest)
+	}
+	if len(text) > contextMaxBytes {
+		cut := strings.LastIndexByte(text[:contextMaxBytes], '\n') + 1
+		if cut == 0 {
+			cut = contextMaxBytes
+		}
+		return text[:cut] + fmt.Sprintf("[truncated: %d of %d bytes shown]", cut, len(text))
+	}
+	return text
+}
+
+// guardContextLine is guardContext for a single line of a file
+func guardContextLine(line string) string {
+	if claudewatch.LooksBinary([]byte(line)) {
+		return fmt.Sprintf("[binary line omitted: %d bytes]", len(line))
+	}
+	if len(line) > contextMaxLineLen {
+		return fmt.Sprintf("[long line omitted: %d bytes]", len(line))
+	}
+	return line
+}
+
+// defaultMaxFileSizeKB is the size above which files aren't scanned for
+// markers, unless --max-file-size or max_file_size_kb says otherwise
+const defaultMaxFileSizeKB = 1024
+
+// maxFileSize returns the scan size limit in bytes: flagKB if it was given
+// (it is negative otherwise), else the config file's max_file_size_kb, else
+// the default. 0 means no limit.
+func maxFileSize(flagKB int, fileConfig *FileConfig) int64 {
+	kb := defaultMaxFileSizeKB
+	if flagKB >= 0 {
+		kb = flagKB
+	} else if fileConfig != nil && fileConfig.MaxFileSizeKB != nil {
+		kb = *fileConfig.MaxFileSizeKB
+	}
+	if kb < 0 {
+		kb = 0
+	}
+	return int64(kb) << 10
+}
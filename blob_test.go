@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuardContext(t *testing.T) {
+	if got := guardContext("line one\nline two\n"); got != "line one\nline two\n" {
+		t.Errorf("guardContext() changed ordinary text to %q", got)
+	}
+	if got := guardContext("\x89PNG\r\n\x1a\n\x00\x00"); got != "[binary content omitted: 10 bytes]" {
+		t.Errorf("guardContext(binary) = %q", got)
+	}
+
+	minified := "a\n" + strings.Repeat("x", contextMaxLineLen+1) + "\n"
+	if got := guardContext(minified); !strings.HasPrefix(got, "[minified content omitted:") {
+		t.Errorf("guardContext(minified) = %q, want a placeholder", got)
+	}
+
+	long := strings.Repeat(strings.Repeat("y", 99)+"\n", contextMaxBytes/100+10)
+	got := guardContext(long)
+	if !strings.Contains(got, "[truncated: ") || len(got) > contextMaxBytes+100 {
+		t.Errorf("guardContext(long) returned %d bytes, want it truncated with a note", len(got))
+	}
+	if body := got[:strings.Index(got, "[truncated")]; !strings.HasSuffix(body, "\n") {
+		t.Error("guardContext(long) cut a line in half")
+	}
+}
+
+func TestReadFileHelperOmitsBinary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := templateReadFile(path)
+	if err != nil {
+		t.Fatalf("templateReadFile: %v", err)
+	}
+	if !strings.HasPrefix(got, "[binary content omitted") {
+		t.Errorf("templateReadFile() = %q, want a placeholder", got)
+	}
+}
+
+func TestWithContextOmitsLongLines(t *testing.T) {
+	content := strings.Repeat("z", contextMaxLineLen+1) + "\n// fix this ai!\nreturn\n"
+	markers := withContext(content, defaultMarkerScanner.Scan(content), 1)
+	want := "1: [long line omitted: 2001 bytes]\n2: // fix this ai!\n3: return"
+	if len(markers) != 1 || markers[0].Context != want {
+		t.Errorf("context = %q, want %q", markers[0].Context, want)
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	zero, two := 0, 2
+	tests := []struct {
+		name       string
+		flagKB     int
+		fileConfig *FileConfig
+		want       int64
+	}{
+		{"default", -1, nil, defaultMaxFileSizeKB << 10},
+		{"config", -1, &FileConfig{MaxFileSizeKB: &two}, 2048},
+		{"config disables", -1, &FileConfig{MaxFileSizeKB: &zero}, 0},
+		{"flag wins", 4, &FileConfig{MaxFileSizeKB: &two}, 4096},
+	}
+
+	for _, tt := range tests {
+		if got := maxFileSize(tt.flagKB, tt.fileConfig); got != tt.want {
+			t.Errorf("%s: maxFileSize() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessSkipsOversizedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.js")
+	if err := os.WriteFile(path, []byte("// fix this ai!\n"+strings.Repeat("x = 1;\n", 500)), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	p := newFileProcessor(&Config{MaxFileSize: 1024}, nil, prompts)
+
+	p.process(path)
+	if len(prompts) != 0 {
+		t.Error("an oversized file was scanned and sent")
+	}
+	if !strings.HasPrefix(readString(t, path), "// fix this ai!") {
+		t.Error("markers were removed from an oversized file")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// instructionBranchPrefix starts the name of every branch
+// --branch-per-instruction creates
+const instructionBranchPrefix = "claudewatch/"
+
+// branchSlugMax bounds the length of the part of a branch name taken from
+// the instruction
+const branchSlugMax = 40
+
+// branchSwitcher implements --branch-per-instruction: before each prompt
+// is sent, a branch named from its instruction is created in the file's
+// repository and checked out, so each change lands on its own branch. Every
+// branch starts from the one checked out when the repository was first
+// seen, not from the previous instruction's branch, unless the working tree
+// has uncommitted changes (such as the marker just stripped) to files that
+// differ between the two: the checkout would overwrite those, so the branch
+// starts from the current one instead.
+type branchSwitcher struct {
+	config *Config
+	roots  gitRoots
+	bases  map[string]string // Repository to the branch (or commit) instructions start from
+}
+
+// newBranchSwitcher returns the branch switcher, or nil without
+// --branch-per-instruction
+func newBranchSwitcher(config *Config) *branchSwitcher {
+	if !config.BranchPerPrompt {
+		return nil
+	}
+	return &branchSwitcher{config: config, bases: make(map[string]string)}
+}
+
+// start creates and checks out the branch for req, returning its name.
+// Prompts without a file (resets) stay on the current branch, as do files
+// outside a repository.
+func (b *branchSwitcher) start(req promptRequest) (string, error) {
+	if req.File == "" {
+		return "", nil
+	}
+	root, err := b.roots.lookup(requestDir(req))
+	if err != nil || root == "" {
+		return "", err
+	}
+	base, ok := b.bases[root]
+	if !ok {
+		if base, err = git(root, nil, "symbolic-ref", "--quiet", "--short", "HEAD"); err != nil {
+			// A detached HEAD is its commit
+			if base, err = git(root, nil, "rev-parse", "HEAD"); err != nil {
+				return "", err
+			}
+		}
+		b.bases[root] = base
+	}
+
+	name, err := b.freeName(root, instructionBranchName(req.Instruction, req.File))
+	if err != nil {
+		return "", err
+	}
+	from := base
+	if clash, err := uncommittedClash(root, base); err != nil {
+		return "", err
+	} else if clash != "" {
+		console.notice("claudewatch: %s has uncommitted changes to %s, which differs from %s; branching from the current branch", root, clash, base)
+		from = "HEAD"
+	}
+	if _, err := git(root, nil, "checkout", "--quiet", "-b", name, from); err != nil {
+		return "", err
+	}
+	infoLog(b.config, "Checked out %s (from %s) in %s", name, from, root)
+	return name, nil
+}
+
+// uncommittedClash returns a file with uncommitted changes in the repository
+// at root that differs between HEAD and base, which checking out base would
+// overwrite, or "" if there is none
+func uncommittedClash(root, base string) (string, error) {
+	changed, err := git(root, nil, "diff", "--name-only", "HEAD")
+	if err != nil || changed == "" {
+		return "", err
+	}
+	differing, err := git(root, nil, "diff", "--name-only", base, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	diverged := make(map[string]bool)
+	for _, file := range strings.Split(differing, "\n") {
+		diverged[file] = true
+	}
+	for _, file := range strings.Split(changed, "\n") {
+		if diverged[file] {
+			return file, nil
+		}
+	}
+	return "", nil
+}
+
+// freeName returns name, or name with a number after it if a branch of that
+// name exists already
+func (b *branchSwitcher) freeName(root, name string) (string, error) {
+	for n := 1; ; n++ {
+		candidate := name
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", name, n)
+		}
+		if _, err := git(root, nil, "rev-parse", "--quiet", "--verify", "refs/heads/"+candidate); err != nil {
+			return candidate, nil
+		}
+		if n >= 100 {
+			return "", fmt.Errorf("no free branch name for %s", name)
+		}
+	}
+}
+
+// instructionBranchName is the branch named after an instruction, such as
+// claudewatch/handle-errors-in-foo; without words to use, the file names it
+func instructionBranchName(instruction, file string) string {
+	slug := branchSlug(instruction)
+	if slug == "" {
+		slug = branchSlug(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+	}
+	if slug == "" {
+		slug = "instruction"
+	}
+	return instructionBranchPrefix + slug
+}
+
+// branchSlug turns text into lowercase words joined by hyphens, cut at a
+// word boundary to at most branchSlugMax characters
+func branchSlug(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	var slug string
+	for _, word := range words {
+		next := word
+		if slug != "" {
+			next = slug + "-" + word
+		}
+		if len(next) > branchSlugMax {
+			if slug == "" {
+				slug = word[:branchSlugMax]
+			}
+			break
+		}
+		slug = next
+	}
+	return slug
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstructionBranchName(t *testing.T) {
+	tests := []struct {
+		instruction, file string
+		want              string
+	}{
+		{"Handle errors in foo", "foo.go", "claudewatch/handle-errors-in-foo"},
+		{"why isn't this cached?", "a.go", "claudewatch/why-isn-t-this-cached"},
+		{"split parseConfig() into parse_file + validate", "a.go", "claudewatch/split-parseconfig-into-parse-file"},
+		{"make the retry loop give up after five attempts and report why", "a.go", "claudewatch/make-the-retry-loop-give-up-after-five"},
+		{"", "pkg/server_test.go", "claudewatch/server-test"},
+		{"日本語", "", "claudewatch/instruction"},
+	}
+	for _, tt := range tests {
+		if got := instructionBranchName(tt.instruction, tt.file); got != tt.want {
+			t.Errorf("instructionBranchName(%q, %q) = %q, want %q", tt.instruction, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBranchSwitcherStart(t *testing.T) {
+	dir := gitRepo(t)
+	base, _ := git(dir, nil, "symbolic-ref", "--short", "HEAD")
+	baseCommit, _ := git(dir, nil, "rev-parse", "HEAD")
+	file := filepath.Join(dir, "main.go")
+	b := newBranchSwitcher(&Config{BranchPerPrompt: true})
+
+	name, err := b.start(promptRequest{File: file, Instruction: "Handle errors"})
+	if err != nil || name != "claudewatch/handle-errors" {
+		t.Fatalf("start = %q, %v; want claudewatch/handle-errors", name, err)
+	}
+	if current, _ := git(dir, nil, "symbolic-ref", "--short", "HEAD"); current != name {
+		t.Errorf("checked out %s, want %s", current, name)
+	}
+
+	// The instruction's change is committed on its branch
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n")
+	if _, err := git(dir, checkpointIdentity, "commit", "-q", "-am", "handled"); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	// The next instruction starts from the original branch again, under a
+	// free name
+	name, err = b.start(promptRequest{File: file, Instruction: "handle errors"})
+	if err != nil || name != "claudewatch/handle-errors-2" {
+		t.Fatalf("start = %q, %v; want claudewatch/handle-errors-2", name, err)
+	}
+	if head, _ := git(dir, nil, "rev-parse", "HEAD"); head != baseCommit {
+		t.Errorf("second branch starts at %s, want %s (%s)", head, baseCommit, base)
+	}
+
+	// A second instruction in the same file: its stripped marker is an
+	// uncommitted change to a file the previous branch changed, so the
+	// branch starts from there rather than failing to check out the base
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n\n// log it\n")
+	if _, err := git(dir, checkpointIdentity, "commit", "-q", "-am", "handled again"); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	branched, _ := git(dir, nil, "rev-parse", "HEAD")
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n\n// log it\n// and retry\n")
+	name, err = b.start(promptRequest{File: file, Instruction: "and retry"})
+	if err != nil || name != "claudewatch/and-retry" {
+		t.Fatalf("start = %q, %v; want claudewatch/and-retry", name, err)
+	}
+	if head, _ := git(dir, nil, "rev-parse", "HEAD"); head != branched {
+		t.Errorf("third branch starts at %s, want the previous branch's %s", head, branched)
+	}
+	if got := readString(t, file); !strings.HasSuffix(got, "// and retry\n") {
+		t.Errorf("content = %q, want the stripped change kept", got)
+	}
+
+	// Resets stay where they are
+	if name, err := b.start(promptRequest{Prompt: clearCommand, Reset: true}); name != "" || err != nil {
+		t.Errorf("start of a reset = %q, %v; want nothing", name, err)
+	}
+	if newBranchSwitcher(&Config{}) != nil {
+		t.Error("newBranchSwitcher without --branch-per-instruction is not nil")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+)
+
+// budgetWindow is the period --max-per-minute counts prompts over
+var budgetWindow = time.Minute
+
+// promptBudget implements --max-per-minute and --max-per-session, which guard
+// against a save loop (a formatter and an editor fighting over a file, say)
+// burning through API quota. Prompts over budget wait in the queue.
+type promptBudget struct {
+	perMinute  int         // 0 for no limit
+	perSession int         // 0 for no limit
+	recent     []time.Time // When prompts were sent within the last budgetWindow
+	total      int         // Prompts sent this session
+	warned     bool        // The current hold has been reported
+	retry      *time.Timer // Flushes the queue once the per-minute limit allows
+}
+
+// newPromptBudget returns the budget for the given limits, or nil if there
+// are none
+func newPromptBudget(perMinute, perSession int) *promptBudget {
+	if perMinute <= 0 && perSession <= 0 {
+		return nil
+	}
+	return &promptBudget{perMinute: perMinute, perSession: perSession}
+}
+
+// wait returns how long until another prompt may be sent at now: zero if it
+// may be sent right away, and a negative duration if the session's budget is
+// spent
+func (b *promptBudget) wait(now time.Time) time.Duration {
+	if b.perSession > 0 && b.total >= b.perSession {
+		return -1
+	}
+	for len(b.recent) > 0 && now.Sub(b.recent[0]) >= budgetWindow {
+		b.recent = b.recent[1:]
+	}
+	if b.perMinute > 0 && len(b.recent) >= b.perMinute {
+		return b.recent[0].Add(budgetWindow).Sub(now)
+	}
+	return 0
+}
+
+// record counts a prompt sent at now
+func (b *promptBudget) record(now time.Time) {
+	b.recent = append(b.recent, now)
+	b.total++
+	b.warned = false
+}
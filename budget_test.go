@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromptBudgetWait(t *testing.T) {
+	if newPromptBudget(0, 0) != nil {
+		t.Error("newPromptBudget(0, 0) is not nil")
+	}
+
+	now := time.Now()
+	b := newPromptBudget(2, 3)
+	b.record(now)
+	b.record(now.Add(10 * time.Second))
+	if got := b.wait(now.Add(20 * time.Second)); got != 40*time.Second {
+		t.Errorf("wait() at the per-minute limit = %s, want 40s", got)
+	}
+	if got := b.wait(now.Add(61 * time.Second)); got != 0 {
+		t.Errorf("wait() once the first prompt left the window = %s, want 0", got)
+	}
+	b.record(now.Add(61 * time.Second))
+	if got := b.wait(now.Add(time.Hour)); got >= 0 {
+		t.Errorf("wait() after the session budget is spent = %s, want it negative", got)
+	}
+}
+
+func TestDispatcherHoldsPromptsOverBudget(t *testing.T) {
+	old := budgetWindow
+	budgetWindow = 50 * time.Millisecond
+	t.Cleanup(func() { budgetWindow = old })
+
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, budget: newPromptBudget(1, 0)}
+	for _, prompt := range []string{"first", "second"} {
+		if err := d.submit(promptRequest{Prompt: prompt}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	d.sendMu.Lock()
+	sent := strings.Join(primary.prompts, ",")
+	d.sendMu.Unlock()
+	if sent != "first" {
+		t.Fatalf("sent %q, want only the prompt within budget", sent)
+	}
+
+	// The held prompt goes out once the window has passed
+	waitFor(t, "the held prompt", func() bool {
+		d.sendMu.Lock()
+		defer d.sendMu.Unlock()
+		return len(primary.prompts) == 2
+	})
+}
+
+func TestDispatcherSessionBudgetKeepsPromptsQueued(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, budget: newPromptBudget(0, 1)}
+	for _, prompt := range []string{"first", "second"} {
+		if err := d.submit(promptRequest{Prompt: prompt}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	// Resets don't count against the budget
+	if err := d.submit(promptRequest{Prompt: clearCommand, Reset: true, Priority: priorityHigh}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	if got := strings.Join(primary.prompts, ","); got != "first,"+clearCommand {
+		t.Errorf("sent %q, want the first prompt and the reset", got)
+	}
+	restored := false
+	d.queue[0].Restore = func() { restored = true }
+	d.abandon()
+	if !restored {
+		t.Error("the held prompt's markers were not put back on exit")
+	}
+}
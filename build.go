@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildIgnoreRule ignores changes to a build's output only while the build
+// is running, so generated files don't trigger scans but stay watched
+type BuildIgnoreRule struct {
+	// Process is a regex matched against the command line (arguments joined
+	// by spaces) of every running process, e.g. "go (build|install)"
+	Process string `json:"process"`
+	// Paths are regexes matched against changed paths, as in .claudewatchignore
+	Paths []string `json:"paths"`
+}
+
+// buildRule is a compiled BuildIgnoreRule
+type buildRule struct {
+	process *regexp.Regexp
+	paths   IgnorePatterns
+}
+
+// Builds are looked for this often, and count as running for buildGracePeriod
+// after they were last seen, since a build's last writes are often reported
+// after it has exited
+var (
+	buildPollInterval = time.Second
+	buildGracePeriod  = 2 * time.Second
+)
+
+// buildActivity tracks which of the build_ignore rules' builds are running
+type buildActivity struct {
+	rules []buildRule
+
+	mu       sync.Mutex
+	lastSeen []time.Time // When each rule's build was last seen running
+}
+
+// compileBuildIgnoreRules checks the build_ignore rules from the config file.
+// It returns nil when there are none, so no processes are polled.
+func compileBuildIgnoreRules(fileConfig *FileConfig) (*buildActivity, error) {
+	if fileConfig == nil || len(fileConfig.BuildIgnore) == 0 {
+		return nil, nil
+	}
+	b := &buildActivity{lastSeen: make([]time.Time, len(fileConfig.BuildIgnore))}
+	for i, rule := range fileConfig.BuildIgnore {
+		process, err := regexp.Compile(rule.Process)
+		if err != nil || rule.Process == "" {
+			return nil, fmt.Errorf("build_ignore[%d]: bad process pattern %q", i, rule.Process)
+		}
+		compiled := buildRule{process: process}
+		for _, path := range rule.Paths {
+			pattern, err := regexp.Compile(path)
+			if err != nil {
+				return nil, fmt.Errorf("build_ignore[%d]: bad path pattern %q: %w", i, path, err)
+			}
+			compiled.paths = append(compiled.paths, pattern)
+		}
+		if len(compiled.paths) == 0 {
+			return nil, fmt.Errorf("build_ignore[%d]: no paths given", i)
+		}
+		b.rules = append(b.rules, compiled)
+	}
+	return b, nil
+}
+
+// poll looks through the running processes once, recording which builds are running
+func (b *buildActivity) poll(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, err := readCmdline(root, pid)
+		if err != nil {
+			continue
+		}
+		command := strings.Join(cmdline, " ")
+		for i, rule := range b.rules {
+			if rule.process.MatchString(command) {
+				b.mu.Lock()
+				b.lastSeen[i] = now
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+// run polls for builds every buildPollInterval, for as long as claudewatch runs
+func (b *buildActivity) run(config *Config) {
+	debugLog(config, "Polling processes for %d build_ignore rule(s)", len(b.rules))
+	for {
+		b.poll(procRoot)
+		time.Sleep(buildPollInterval)
+	}
+}
+
+// ignores reports whether a change to path is output of a build that is
+// running, and if so the pattern of the build. It is false on a nil tracker.
+func (b *buildActivity) ignores(path string) (bool, string) {
+	if b == nil {
+		return false, ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, rule := range b.rules {
+		if time.Since(b.lastSeen[i]) <= buildGracePeriod && rule.paths.MatchesAnyPattern(path) {
+			return true, rule.process.String()
+		}
+	}
+	return false, ""
+}
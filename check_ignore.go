@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// runCheckIgnore implements "claudewatch check-ignore": like git
+// check-ignore, it reports for each path whether the watcher would skip it
+// and by which rule. It returns the process exit code: 0 when any path is
+// ignored, 1 when none is and 2 for errors.
+func runCheckIgnore(args []string) int {
+	fs := flag.NewFlagSet("check-ignore", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "The watched directory, whose .claudewatchignore applies")
+	ignore := fs.String("ignore", "", "Regex pattern of files to skip, as with claudewatch --ignore")
+	projectScope := fs.Bool("project-scope", false, "Apply projects' own .claudewatchignore files, as with claudewatch --project-scope")
+	noBuiltinIgnores := fs.Bool("no-builtin-ignores", false, "Don't skip editors' temp files, as with claudewatch --no-builtin-ignores")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch check-ignore [options] PATH...")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Report whether claudewatch would ignore each path, and which rule makes it:")
+		fmt.Fprintln(fs.Output(), "a built-in rule, --ignore or a .claudewatchignore line. Exits 1 if none is ignored.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	config := &Config{RootDirectories: []string{*dir}, ProjectScope: *projectScope, WatchEditorTemps: *noBuiltinIgnores}
+	if *ignore != "" {
+		pattern, err := regexp.Compile(*ignore)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ignore pattern: %v\n", err)
+			return 2
+		}
+		config.IgnorePattern = pattern
+	}
+	config.Projects = newProjectIndex(config)
+	rules, err := loadIgnoreRules(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading .claudewatchignore in %s: %v\n", *dir, err)
+		return 2
+	}
+
+	status := 1
+	failed := false
+	for _, path := range fs.Args() {
+		reason, err := explainIgnore(config, rules, path)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+			failed = true
+		case reason == "":
+			fmt.Printf("%s: not ignored\n", path)
+		default:
+			fmt.Printf("%s: %s\n", path, reason)
+			status = 0
+		}
+	}
+	if failed {
+		return 2
+	}
+	return status
+}
+
+// explainIgnore returns the rule that makes the watcher skip path, or "" if
+// none does. Like the watcher, it checks each directory on the way down
+// from the watched root before the path itself: built-in rules first, then
+// --ignore, the root's .claudewatchignore (rules) and, with
+// --project-scope, the project's.
+func explainIgnore(config *Config, rules []ignoreRule, path string) (string, error) {
+	root := config.RootDirectories[0]
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(rootAbs, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("not in the watched directory %s", root)
+	}
+	if rel == "." {
+		return "", nil
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		// Paths are matched as the watcher sees them, under the root as given
+		current := filepath.Join(root, filepath.Join(parts[:i+1]...))
+		kind := "file"
+		if info, err := os.Stat(current); i < len(parts)-1 || (err == nil && info.IsDir()) {
+			kind = "directory"
+		}
+		via := ""
+		if i < len(parts)-1 {
+			via = " (via directory " + current + ")"
+		}
+
+		switch {
+		case strings.HasPrefix(part, "."):
+			return fmt.Sprintf("built-in rule: hidden %s %s", kind, current), nil
+		case config.skipsFile(part):
+			return fmt.Sprintf("built-in rule: editor temp file %s", current), nil
+		case config.IgnorePattern != nil && config.IgnorePattern.MatchString(current):
+			return fmt.Sprintf("--ignore: %s%s", config.IgnorePattern, via), nil
+		}
+		if rule, ok := matchingRule(rules, current); ok {
+			return fmt.Sprintf("%s:%d: %s%s", rule.file, rule.line, rule.pattern, via), nil
+		}
+		if rule, ok := projectRule(config, current); ok {
+			return fmt.Sprintf("%s:%d: %s%s", rule.file, rule.line, rule.pattern, via), nil
+		}
+	}
+	return "", nil
+}
+
+// matchingRule returns the first of rules that matches path
+func matchingRule(rules []ignoreRule, path string) (ignoreRule, bool) {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(path) {
+			return rule, true
+		}
+	}
+	return ignoreRule{}, false
+}
+
+// projectRule returns the rule of path's project .claudewatchignore that
+// matches it, with --project-scope. As when watching, it is matched against
+// the path relative to the top of the project, and a project at the watched
+// root is left out, its ignore file being the root's.
+func projectRule(config *Config, path string) (ignoreRule, bool) {
+	root := config.Projects.rootOf(path)
+	if root == "" || config.Projects.isWatchedRoot(root) {
+		return ignoreRule{}, false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rules, err := loadIgnoreRules(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Error loading .claudewatchignore in %s: %v\n", root, err)
+		return ignoreRule{}, false
+	}
+	return matchingRule(rules, filepath.ToSlash(rel))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestExplainIgnore(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src/gen", ".git", "svc/api"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		".claudewatchignore":         "# generated code\n\n/gen$\n\\.min\\.js$\n",
+		"svc/api/go.mod":             "module api\n",
+		"svc/api/.claudewatchignore": "^fixtures/\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &Config{RootDirectories: []string{root}, IgnorePattern: regexp.MustCompile(`_test\.go$`), ProjectScope: true}
+	config.Projects = newProjectIndex(config)
+	rules, err := loadIgnoreRules(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignoreFile := filepath.Join(root, ".claudewatchignore")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"src/main.go", ""},
+		{"src/gen/types.go", ignoreFile + ":3: /gen$ (via directory " + filepath.Join(root, "src/gen") + ")"},
+		{"src/app.min.js", ignoreFile + ":4: \\.min\\.js$"},
+		{"src/main_test.go", "--ignore: _test\\.go$"},
+		{".git/config", "built-in rule: hidden directory " + filepath.Join(root, ".git")},
+		{"src/.env", "built-in rule: hidden file " + filepath.Join(root, "src/.env")},
+		{"src/main.go.swp", "built-in rule: editor temp file " + filepath.Join(root, "src/main.go.swp")},
+		{"svc/api/fixtures/a.json", filepath.Join(root, "svc/api/.claudewatchignore") + ":1: ^fixtures/"},
+		{"svc/fixtures/a.json", ""},
+	}
+	for _, tt := range tests {
+		got, err := explainIgnore(config, rules, filepath.Join(root, tt.path))
+		if err != nil || got != tt.want {
+			t.Errorf("explainIgnore(%s) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+
+	if _, err := explainIgnore(config, rules, filepath.Dir(root)); err == nil {
+		t.Error("explainIgnore() of a path outside the watched directory succeeded")
+	}
+}
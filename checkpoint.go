@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// checkpointRef is the shadow branch --git-checkpoint records snapshots on.
+// It lives outside refs/heads, so it never shows up as a branch to check out.
+const checkpointRef = "refs/claudewatch/checkpoints"
+
+// gitCheckpoints implements --git-checkpoint: before each prompt is sent,
+// the state of its file's repository is committed to checkpointRef, so what
+// Claude does for the instruction can be diffed and rolled back. Snapshots
+// are built in a temporary index; HEAD, the index and the working tree are
+// never touched.
+type gitCheckpoints struct {
+	config *Config
+	roots  gitRoots
+}
+
+// newGitCheckpoints returns the checkpoint recorder, or nil without --git-checkpoint
+func newGitCheckpoints(config *Config) *gitCheckpoints {
+	if !config.GitCheckpoint {
+		return nil
+	}
+	return &gitCheckpoints{config: config}
+}
+
+// record snapshots the repository holding req's file before prompt n is
+// sent, returning the checkpoint commit. Files outside a repository have
+// none, and resets have no file.
+func (c *gitCheckpoints) record(n int, req promptRequest) (string, error) {
+	if req.File == "" {
+		return "", nil
+	}
+	root, err := c.roots.lookup(requestDir(req))
+	if err != nil || root == "" {
+		return "", err
+	}
+
+	tree, err := snapshotTree(root, ".")
+	if err != nil {
+		return "", err
+	}
+
+	// Each checkpoint follows the previous one, or HEAD for the first
+	args := []string{"commit-tree", tree, "-m", checkpointMessage(n, root, req)}
+	if parent, err := git(root, nil, "rev-parse", "--quiet", "--verify", checkpointRef); err == nil {
+		args = append(args, "-p", parent)
+	} else if head, err := git(root, nil, "rev-parse", "--quiet", "--verify", "HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	commit, err := git(root, checkpointIdentity, args...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := git(root, nil, "update-ref", "-m", fmt.Sprintf("claudewatch: before prompt #%d", n), checkpointRef, commit); err != nil {
+		return "", err
+	}
+	infoLog(c.config, "Checkpoint %s of %s before prompt #%d", shortHash(commit), root, n)
+	return commit, nil
+}
+
+// snapshotTree writes the tree of root's working tree, limited to pathspec,
+// as `git add --all` would stage it, and returns its hash. It is built in a
+// temporary index, leaving the real one alone.
+func snapshotTree(root string, pathspec ...string) (string, error) {
+	// Start from a copy of the real index, so unchanged files aren't hashed again
+	index, err := os.CreateTemp("", "claudewatch-index-*")
+	if err != nil {
+		return "", err
+	}
+	indexPath := index.Name()
+	defer os.Remove(indexPath)
+	if realIndex, err := git(root, nil, "rev-parse", "--git-path", "index"); err == nil {
+		if !filepath.IsAbs(realIndex) {
+			realIndex = filepath.Join(root, realIndex)
+		}
+		if src, err := os.Open(realIndex); err == nil {
+			_, err = io.Copy(index, src)
+			src.Close()
+			if err != nil {
+				index.Close()
+				return "", err
+			}
+		}
+	}
+	if err := index.Close(); err != nil {
+		return "", err
+	}
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+	if _, err := git(root, env, append([]string{"add", "--all", "--"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	return git(root, env, "write-tree")
+}
+
+// requestDir is the directory of req's file, or of the first of its files
+// when coalesced
+func requestDir(req promptRequest) string {
+	file, _, _ := strings.Cut(req.File, ", ")
+	return filepath.Dir(file)
+}
+
+// gitRoots caches the top of the repository each directory is in
+type gitRoots struct {
+	mu    sync.Mutex
+	roots map[string]string // "" for a directory outside any repository
+}
+
+// lookup returns the top of the repository dir is in, or "" if it isn't in one
+func (r *gitRoots) lookup(dir string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if root, ok := r.roots[dir]; ok {
+		return root, nil
+	}
+	root, err := git(dir, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		if _, lookErr := exec.LookPath("git"); lookErr != nil {
+			return "", lookErr
+		}
+		root = "" // Not a repository
+	}
+	if r.roots == nil {
+		r.roots = make(map[string]string)
+	}
+	r.roots[dir] = root
+	return root, nil
+}
+
+// checkpointIdentity commits checkpoints as claudewatch, so they work without
+// a configured git identity and stand apart from the user's own commits
+var checkpointIdentity = []string{
+	"GIT_AUTHOR_NAME=claudewatch", "GIT_AUTHOR_EMAIL=claudewatch@localhost",
+	"GIT_COMMITTER_NAME=claudewatch", "GIT_COMMITTER_EMAIL=claudewatch@localhost",
+}
+
+// checkpointMessage is the commit message of the checkpoint before prompt n:
+// the file relative to the repository, then the prompt
+func checkpointMessage(n int, root string, req promptRequest) string {
+	file := req.File
+	if abs, err := filepath.Abs(file); err == nil {
+		if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+	return fmt.Sprintf("Before prompt #%d: %s\n\n%s\n", n, file, strings.TrimSpace(req.Prompt))
+}
+
+// git runs a git command in dir with extra environment variables, returning
+// its output without the trailing newline
+func git(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// shortHash abbreviates a commit hash for messages
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
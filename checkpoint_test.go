@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository in a temporary directory with one commit of
+// main.go, or skips the test if git isn't installed
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "main.go"), "package main\n")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		if _, err := git(dir, checkpointIdentity, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	return dir
+}
+
+func TestGitCheckpointRecord(t *testing.T) {
+	dir := gitRepo(t)
+	head, _ := git(dir, nil, "rev-parse", "HEAD")
+	file := filepath.Join(dir, "main.go")
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n")
+	writeTestFile(t, filepath.Join(dir, "new.go"), "package main\n")
+	statusBefore, _ := git(dir, nil, "status", "--porcelain")
+
+	c := newGitCheckpoints(&Config{GitCheckpoint: true})
+	first, err := c.record(1, promptRequest{File: file, Prompt: "Modify main.go"})
+	if err != nil || first == "" {
+		t.Fatalf("record = %q, %v", first, err)
+	}
+
+	// The snapshot holds the working tree, untracked files included
+	if content, err := git(dir, nil, "show", first+":main.go"); err != nil || !strings.Contains(content, "func main") {
+		t.Errorf("checkpoint main.go = %q, %v; want the edited file", content, err)
+	}
+	if _, err := git(dir, nil, "cat-file", "-e", first+":new.go"); err != nil {
+		t.Errorf("checkpoint lacks the untracked file: %v", err)
+	}
+	if parent, _ := git(dir, nil, "rev-parse", first+"^"); parent != head {
+		t.Errorf("first checkpoint's parent = %s, want HEAD %s", parent, head)
+	}
+	if message, _ := git(dir, nil, "log", "-1", "--format=%B", first); !strings.HasPrefix(message, "Before prompt #1: main.go") || !strings.Contains(message, "Modify main.go") {
+		t.Errorf("checkpoint message = %q", message)
+	}
+
+	// HEAD, the index and the working tree are left alone
+	if now, _ := git(dir, nil, "rev-parse", "HEAD"); now != head {
+		t.Errorf("HEAD moved to %s", now)
+	}
+	if statusAfter, _ := git(dir, nil, "status", "--porcelain"); statusAfter != statusBefore {
+		t.Errorf("status = %q after checkpoint, want %q", statusAfter, statusBefore)
+	}
+
+	// The next checkpoint follows the first on the shadow branch
+	second, err := c.record(2, promptRequest{File: file, Prompt: "Again"})
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if parent, _ := git(dir, nil, "rev-parse", second+"^"); parent != first {
+		t.Errorf("second checkpoint's parent = %s, want %s", parent, first)
+	}
+	if ref, _ := git(dir, nil, "rev-parse", checkpointRef); ref != second {
+		t.Errorf("%s = %s, want %s", checkpointRef, ref, second)
+	}
+}
+
+func TestGitCheckpointOutsideRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newGitCheckpoints(&Config{GitCheckpoint: true})
+	if commit, err := c.record(1, promptRequest{File: file, Prompt: "x"}); commit != "" || err != nil {
+		t.Errorf("record outside a repository = %q, %v; want nothing", commit, err)
+	}
+	if commit, err := c.record(2, promptRequest{Prompt: clearCommand, Reset: true}); commit != "" || err != nil {
+		t.Errorf("record of a reset = %q, %v; want nothing", commit, err)
+	}
+	if newGitCheckpoints(&Config{}) != nil {
+		t.Error("newGitCheckpoints without --git-checkpoint is not nil")
+	}
+}
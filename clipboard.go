@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboard copies prompts to the system clipboard for --clipboard, through
+// whichever of the platform's clipboard commands is installed
+type clipboard struct {
+	command []string
+}
+
+// findClipboard picks the clipboard command: pbcopy on macOS; elsewhere
+// wl-copy under Wayland, else xclip or xsel
+func findClipboard(goos string, getenv func(string) string, lookPath func(string) (string, error)) (*clipboard, error) {
+	var candidates [][]string
+	switch {
+	case goos == "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case getenv("WAYLAND_DISPLAY") != "":
+		candidates = [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	default:
+		candidates = [][]string{{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"wl-copy"}}
+	}
+	var names []string
+	for _, command := range candidates {
+		if _, err := lookPath(command[0]); err == nil {
+			return &clipboard{command: command}, nil
+		}
+		names = append(names, command[0])
+	}
+	return nil, fmt.Errorf("no clipboard command found (install %s)", strings.Join(names, " or "))
+}
+
+// newClipboard finds the clipboard command for this system
+func newClipboard() (*clipboard, error) {
+	return findClipboard(runtime.GOOS, os.Getenv, exec.LookPath)
+}
+
+// copy replaces the clipboard's contents with text
+func (c *clipboard) copy(text string) error {
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return fmt.Errorf("running %s: %w", c.command[0], err)
+	}
+	return nil
+}
+
+// clipboardBackend is the main session with --no-claude --clipboard: prompts
+// are copied to the clipboard, for the user to paste where they like
+type clipboardBackend struct {
+	clipboard *clipboard
+}
+
+func (b *clipboardBackend) Name() string { return "the clipboard" }
+
+func (b *clipboardBackend) Send(prompt string) error {
+	// Pasting a reset or a model switch means nothing, and it would replace
+	// the last prompt
+	if prompt == clearCommand || strings.HasPrefix(prompt, modelCommand+" ") {
+		return nil
+	}
+	return b.clipboard.copy(prompt)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindClipboard(t *testing.T) {
+	tests := []struct {
+		goos      string
+		wayland   string
+		installed []string
+		want      []string
+	}{
+		{"darwin", "", []string{"pbcopy", "xclip"}, []string{"pbcopy"}},
+		{"linux", "wayland-0", []string{"wl-copy", "xclip"}, []string{"wl-copy"}},
+		{"linux", "wayland-0", []string{"xsel"}, []string{"xsel", "--clipboard", "--input"}},
+		{"linux", "", []string{"wl-copy", "xclip"}, []string{"xclip", "-selection", "clipboard"}},
+		{"freebsd", "", []string{"wl-copy"}, []string{"wl-copy"}},
+	}
+	for _, tt := range tests {
+		getenv := func(key string) string {
+			if key == "WAYLAND_DISPLAY" {
+				return tt.wayland
+			}
+			return ""
+		}
+		lookPath := func(name string) (string, error) {
+			for _, installed := range tt.installed {
+				if name == installed {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+		c, err := findClipboard(tt.goos, getenv, lookPath)
+		if err != nil || !reflect.DeepEqual(c.command, tt.want) {
+			t.Errorf("findClipboard(%s, %q, %v) = %v, %v; want %v", tt.goos, tt.wayland, tt.installed, c, err, tt.want)
+		}
+	}
+
+	none := func(string) (string, error) { return "", errors.New("not found") }
+	if _, err := findClipboard("darwin", func(string) string { return "" }, none); err == nil || !strings.Contains(err.Error(), "pbcopy") {
+		t.Errorf("findClipboard without pbcopy = %v, want an error naming it", err)
+	}
+}
+
+// fakeClipboard is a clipboard whose command writes the copied text to a file
+func fakeClipboard(t *testing.T) (*clipboard, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clipboard")
+	return &clipboard{command: []string{"sh", "-c", `cat > "$0"`, path}}, path
+}
+
+func TestDispatcherCopiesToClipboard(t *testing.T) {
+	clip, path := fakeClipboard(t)
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, clipboard: clip}
+
+	if err := d.deliver(promptRequest{Prompt: "Fix it"}); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+	if len(primary.prompts) != 1 {
+		t.Errorf("primary got %d prompts, want 1", len(primary.prompts))
+	}
+	if got := readString(t, path); got != "Fix it" {
+		t.Errorf("clipboard = %q, want the prompt", got)
+	}
+
+	// A failing copy doesn't fail the prompt
+	d.clipboard = &clipboard{command: []string{"sh", "-c", "echo no display >&2; exit 1"}}
+	if err := d.deliver(promptRequest{Prompt: "Fix that"}); err != nil {
+		t.Errorf("deliver() with a failing clipboard = %v, want nil", err)
+	}
+	if err := d.clipboard.copy("x"); err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("copy() = %v, want the command's message", err)
+	}
+}
+
+func TestClipboardBackendSkipsResets(t *testing.T) {
+	clip, path := fakeClipboard(t)
+	b := &clipboardBackend{clipboard: clip}
+	if err := b.Send("Fix it"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := b.Send(clearCommand); err != nil {
+		t.Fatalf("Send of a reset: %v", err)
+	}
+	if got := readString(t, path); got != "Fix it" {
+		t.Errorf("clipboard = %q, want the last prompt kept", got)
+	}
+}
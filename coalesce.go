@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// coalesceWindow is how long, with --coalesce, claudewatch waits for more
+// files to become due for a scan after one is, so that files saved together
+// (an editor's "save all", a refactoring tool) make a single prompt
+var coalesceWindow = 500 * time.Millisecond
+
+// MultiFileData is the template data of a prompt coalescing the edits of
+// several files, rendered through the multi-file template
+type MultiFileData struct {
+	Files []TemplateData // One per file, as a single-file prompt would get it
+
+	NotesFile string // Path of the session notes file with --session-notes, otherwise empty
+}
+
+// defaultMultiFileTemplate is the multi-file template unless the config
+// file's multi_file_template replaces it ai:ignore
+const defaultMultiFileTemplate = `Modify the following files together, as one change. Address the feedback in the comments in each:
+
+{{range .Files}}{{.File}}:
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{if .Region}}Applies to lines {{.RegionStart}}-{{.RegionEnd}}:
+{{.Region}}
+
+{{end}}{{if .Context}}Surrounding code:
+{{.Context}}
+
+{{end}}{{end}}{{if .ReadOnly}}{{.File}} is read-only, so do not try to edit it. Describe the changes it would need instead.
+{{end}}
+{{end}}For the scope of this instruction, do not modify any files other than these. However, if modifying other files would be necessary to fully address the feedback, stop, explain your reasoning, and wait for further instruction.
+
+Once your editing task is complete, stop and await instruction.`
+
+// compileMultiFileTemplate returns the template for coalesced prompts: the
+// config file's multi_file_template, else the built-in one
+func compileMultiFileTemplate(fileConfig *FileConfig) (*template.Template, error) {
+	text := defaultMultiFileTemplate
+	if fileConfig != nil && fileConfig.MultiFileTemplate != "" {
+		text = fileConfig.MultiFileTemplate
+	}
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("multi_file_template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// collectReady returns first and the paths that become due on ready after
+// it, until none has for coalesceWindow
+func collectReady(first string, ready <-chan string) []string {
+	paths := []string{first}
+	seen := map[string]bool{first: true}
+	for {
+		select {
+		case path := <-ready:
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		case <-time.After(coalesceWindow):
+			return paths
+		}
+	}
+}
+
+// processAll processes paths. With --coalesce, their edits for the main
+// session are sent as one prompt, rendered through the multi-file template,
+// when there are several.
+func (p *fileProcessor) processAll(paths []string) {
+	if p.coalesce == nil {
+		for _, path := range paths {
+			p.process(path)
+		}
+		return
+	}
+
+	batch := []pendingPrompt{}
+	p.batch = &batch
+	for _, path := range paths {
+		p.process(path)
+	}
+	p.batch = nil
+
+	switch len(batch) {
+	case 0:
+		return
+	case 1:
+		p.send(batch[0])
+		return
+	}
+
+	data := MultiFileData{NotesFile: p.notes.filePath()}
+	var files []string
+	level := priorityLow
+	for _, pending := range batch {
+		data.Files = append(data.Files, pending.data)
+		files = append(files, pending.path)
+		level = max(level, pending.level)
+	}
+	var promptBuf strings.Builder
+	if err := p.coalesce.Execute(&promptBuf, data); err != nil {
+		console.errorf("Error executing multi-file prompt template: %v", err)
+		for _, pending := range batch {
+			pending.restore()
+		}
+		return
+	}
+	infoLog(p.config, "Coalesced the edits of %d files into one prompt", len(batch))
+
+	restore := func() {
+		for _, pending := range batch {
+			pending.restore()
+		}
+	}
+	done := func() {
+		for _, pending := range batch {
+			if pending.done != nil {
+				pending.done()
+			}
+		}
+	}
+	p.queue(strings.Join(files, ", "), promptBuf.String(), nil, restore, done, level, batch)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessAllCoalescesEdits(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	if err := os.WriteFile(a, []byte("package p\n// ai! move Foo to b.go\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(b, []byte("package p\n// ai! add Foo here\n// why is this here ai?\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, err := compileMultiFileTemplate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := newPromptResolver(tmpl, nil, nil)
+	resolver.byMarkerType, _ = compileMarkerTypeTemplates(nil)
+	prompts := make(chan promptRequest, 3)
+	newFileProcessor(&Config{Coalesce: multi}, resolver, prompts).processAll([]string{a, b})
+
+	// The question goes on its own, as soon as its file is processed
+	if req := <-prompts; !strings.Contains(req.Prompt, "Answer the questions") {
+		t.Errorf("first prompt = %q, want the question", req.Prompt)
+	}
+	req := <-prompts
+	for _, want := range []string{"Modify the following files together", a + ":\nLine 2: // move Foo to b.go", b + ":\nLine 2: // add Foo here"} {
+		if !strings.Contains(req.Prompt, want) {
+			t.Errorf("coalesced prompt = %q, want it to contain %q", req.Prompt, want)
+		}
+	}
+	if req.File != a+", "+b {
+		t.Errorf("File = %q, want both files", req.File)
+	}
+	if len(prompts) != 0 {
+		t.Errorf("%d more prompts sent, want the edits in one", len(prompts))
+	}
+
+	// An undelivered prompt puts the markers back into both files
+	req.Restore()
+	if got := readString(t, a); !strings.Contains(got, "ai!") {
+		t.Errorf("a.go after restore = %q, want its marker back", got)
+	}
+	if got := readString(t, b); !strings.Contains(got, "// ai! add Foo here") {
+		t.Errorf("b.go after restore = %q, want its marker back", got)
+	}
+}
+
+func TestProcessAllSingleFileUsesItsTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(path, []byte("package p\n// ai! tidy up\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, err := compileMultiFileTemplate(&FileConfig{MultiFileTemplate: "{{len .Files}} files"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := make(chan promptRequest, 1)
+	newFileProcessor(&Config{Coalesce: multi}, newPromptResolver(tmpl, nil, nil), prompts).processAll([]string{path})
+
+	if req := <-prompts; !strings.HasPrefix(req.Prompt, "Modify "+path) {
+		t.Errorf("prompt = %q, want the per-file template", req.Prompt)
+	}
+}
+
+func TestCollectReady(t *testing.T) {
+	old := coalesceWindow
+	coalesceWindow = 50 * time.Millisecond
+	t.Cleanup(func() { coalesceWindow = old })
+
+	ready := make(chan string, 4)
+	ready <- "b"
+	ready <- "a"
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ready <- "c"
+	}()
+	if got := strings.Join(collectReady("a", ready), ","); got != "a,b,c" {
+		t.Errorf("collectReady() = %q, want a,b,c", got)
+	}
+
+	if _, err := compileMultiFileTemplate(&FileConfig{MultiFileTemplate: "{{range}}"}); err == nil {
+		t.Error("compileMultiFileTemplate() accepted a broken template")
+	}
+}
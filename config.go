@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// configFileName is the optional JSON configuration file. Unless --config is
+// given, the nearest one at or above the current directory is used.
+const configFileName = ".claudewatch.json"
+
+// FileConfig mirrors the contents of a .claudewatch.json file
+type FileConfig struct {
+	// ExtensionTemplates maps file extensions (e.g. ".go") to prompt template text
+	ExtensionTemplates map[string]string `json:"extension_templates"`
+
+	// Namespaces maps marker namespaces (the "be" in "be-ai!") to their template and session
+	Namespaces map[string]NamespaceConfig `json:"namespaces"`
+
+	// MarkerTemplates maps marker types ("edit" for "ai!" and "!ai",
+	// "question" for "ai?", "todo" for "TODO(ai):" and "FIXME(ai):") to
+	// prompt template text
+	MarkerTemplates map[string]string `json:"marker_templates"`
+
+	// Tags maps marker tags (the "test" in "ai!test") to prompt template text
+	Tags map[string]string `json:"tags"`
+
+	// Partials are templates, by name, that every prompt template can
+	// include with {{template "name" .}}
+	Partials map[string]string `json:"partials"`
+
+	// CommentPrefixes are more comment leaders to find markers after, such as
+	// "--" or ";;", keyed by the extension of the files they apply to, or
+	// "*" for every file
+	CommentPrefixes map[string][]string `json:"comment_prefixes"`
+
+	// TodoMarkers also treats "TODO(ai):" and "FIXME(ai):" comments as
+	// markers, with their own template
+	TodoMarkers bool `json:"todo_markers"`
+
+	// Signals maps SIGUSR1/SIGUSR2 to the actions "pause", "rescan" or "none"
+	Signals map[string]string `json:"signals"`
+
+	// Presets defines prompt templates selectable with --preset, by name
+	Presets map[string]string `json:"presets"`
+
+	// InputEncoding chooses how prompts are typed into Claude's input box
+	InputEncoding *InputEncodingConfig `json:"input_encoding"`
+
+	// Submit configures the keystrokes that submit a typed prompt
+	Submit *SubmitConfig `json:"submit"`
+
+	// HistoryKeepDays is how long logs and backups are kept in the state
+	// directory; 0 keeps them forever. Unset uses defaultHistoryKeepDays.
+	HistoryKeepDays *int `json:"history_keep_days"`
+
+	// TranscriptMaxMB caps the size of the session transcript; 0 lets it grow.
+	// Unset uses defaultTranscriptMaxMB.
+	TranscriptMaxMB *int `json:"transcript_max_mb"`
+
+	// MaxFileSizeKB is the size above which files aren't scanned for markers;
+	// 0 scans any size. Unset uses defaultMaxFileSizeKB.
+	MaxFileSizeKB *int `json:"max_file_size_kb"`
+
+	// ResetPreamble is sent ahead of the first prompt after an ai:reset, to
+	// restate the project's standing conventions in the fresh context
+	ResetPreamble string `json:"reset_preamble"`
+
+	// Priorities assigns a default dispatch priority to files by path; the
+	// first matching rule applies
+	Priorities []PriorityRule `json:"priorities"`
+
+	// ExpandCommand is a headless command that rewrites each prompt before it
+	// is sent, as with --expand-command (which takes precedence)
+	ExpandCommand string `json:"expand_command"`
+
+	// ExpandInstruction replaces the instruction sent to the expand command
+	// ahead of each prompt
+	ExpandInstruction string `json:"expand_instruction"`
+
+	// FormatterSettleMS is how long, in milliseconds, a changed file is given
+	// to be rewritten by an on-save formatter while one is running; 0 turns
+	// formatter detection off. Unset uses defaultFormatterSettleMS.
+	FormatterSettleMS *int `json:"formatter_settle_ms"`
+
+	// Formatters adds executable or script names to the formatters detected
+	Formatters []string `json:"formatters"`
+
+	// ClaudeCommand is the Claude CLI binary to run, as with --claude-command
+	// (which takes precedence)
+	ClaudeCommand string `json:"claude_command"`
+
+	// SessionNotes keeps a work log of dispatched prompts, as with --session-notes
+	SessionNotes bool `json:"session_notes"`
+
+	// Digest configures --digest: when held prompts are sent and where the
+	// summary of each batch goes
+	Digest *DigestConfig `json:"digest"`
+
+	// MultiFileTemplate replaces the template that, with --coalesce, renders
+	// the edits of files saved together as one prompt
+	MultiFileTemplate string `json:"multi_file_template"`
+
+	// FileTreeDepth is how many directory levels {{.FileTree}} lists below the
+	// changed file's directory. Unset uses defaultFileTreeDepth.
+	FileTreeDepth *int `json:"file_tree_depth"`
+
+	// BuildIgnore ignores changes to build output while the build is running
+	BuildIgnore []BuildIgnoreRule `json:"build_ignore"`
+
+	// DirtyTree is what to do when an edit would land on top of uncommitted
+	// changes to other files: "warn" (the default), "block" or "off".
+	// --require-clean blocks.
+	DirtyTree string `json:"dirty_tree"`
+
+	// Hooks are shell commands run before and after each prompt is sent
+	Hooks *HooksConfig `json:"hooks"`
+}
+
+// LoadFileConfig reads and parses the configuration file at path
+func LoadFileConfig(path string) (*FileConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileConfig FileConfig
+	if err := json.Unmarshal(content, &fileConfig); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &fileConfig, nil
+}
+
+// findConfigFile returns the nearest .claudewatch.json at or above startDir,
+// or an empty string if there is none.
+func findConfigFile(startDir string) string {
+	return findFileUpward(startDir, configFileName)
+}
+
+// normalizeExtension lowercases ext and ensures it starts with a dot, so
+// "go", ".go" and ".GO" all name the same extension.
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// compileExtensionTemplates parses the per-extension prompt templates from the config file
+func compileExtensionTemplates(fileConfig *FileConfig) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	if fileConfig == nil {
+		return templates, nil
+	}
+
+	for ext, text := range fileConfig.ExtensionTemplates {
+		tmpl, err := parsePromptTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("template for %q: %w", ext, err)
+		}
+		templates[normalizeExtension(ext)] = tmpl
+	}
+	return templates, nil
+}
+
+// extensionOf returns the normalized extension of filePath
+func extensionOf(filePath string) string {
+	return normalizeExtension(filepath.Ext(filePath))
+}
+
+// compileMarkerTypeTemplates parses the config file's marker_templates, keyed
+// by marker type. The built-in question and TODO templates aren't among them:
+// they only apply when no extension template or prompt file does (see
+// promptResolver).
+func compileMarkerTypeTemplates(fileConfig *FileConfig) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	if fileConfig == nil {
+		return templates, nil
+	}
+
+	for markerType, text := range fileConfig.MarkerTemplates {
+		if markerType != claudewatch.TypeEdit && markerType != claudewatch.TypeQuestion && markerType != claudewatch.TypeTodo {
+			return nil, fmt.Errorf("marker_templates: unknown marker type %q (want %q, %q or %q)", markerType, claudewatch.TypeEdit, claudewatch.TypeQuestion, claudewatch.TypeTodo)
+		}
+		tmpl, err := parsePromptTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("template for %s markers: %w", markerType, err)
+		}
+		templates[markerType] = tmpl
+	}
+	return templates, nil
+}
+
+// compileTagTemplates parses the prompt templates of the marker tags in the
+// config file, keyed by tag in lower case
+func compileTagTemplates(fileConfig *FileConfig) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	if fileConfig == nil {
+		return templates, nil
+	}
+	for tag, text := range fileConfig.Tags {
+		tmpl, err := parsePromptTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("template for tag %q: %w", tag, err)
+		}
+		templates[strings.ToLower(tag)] = tmpl
+	}
+	return templates, nil
+}
+
+// markerTags returns the tags configured in the config file, sorted
+func markerTags(fileConfig *FileConfig) []string {
+	if fileConfig == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(fileConfig.Tags))
+	for tag := range fileConfig.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// newMarkerScanner returns the Scanner for the config file's marker
+// namespaces, tags, todo_markers and comment_prefixes
+func newMarkerScanner(fileConfig *FileConfig) (*claudewatch.Scanner, error) {
+	if fileConfig == nil {
+		return claudewatch.NewScanner(claudewatch.ScannerOptions{})
+	}
+	opts := claudewatch.ScannerOptions{
+		Tags:        markerTags(fileConfig),
+		TodoMarkers: fileConfig.TodoMarkers,
+	}
+	for _, name := range sortedKeys(fileConfig.Namespaces) {
+		if strings.TrimSpace(name) != "" {
+			opts.Namespaces = append(opts.Namespaces, name)
+		}
+	}
+	for _, ext := range sortedKeys(fileConfig.CommentPrefixes) {
+		prefixes := fileConfig.CommentPrefixes[ext]
+		if ext == "*" {
+			if opts.CommentSyntaxes == nil {
+				opts.CommentSyntaxes = claudewatch.DefaultCommentSyntaxes()
+			}
+			opts.CommentSyntaxes = append(opts.CommentSyntaxes, prefixes...)
+			continue
+		}
+		if normalizeExtension(ext) == "" {
+			return nil, fmt.Errorf("comment_prefixes: empty extension (use \"*\" for every file)")
+		}
+		if opts.FileCommentSyntaxes == nil {
+			opts.FileCommentSyntaxes = make(map[string][]string)
+		}
+		opts.FileCommentSyntaxes[normalizeExtension(ext)] = append(opts.FileCommentSyntaxes[normalizeExtension(ext)], prefixes...)
+	}
+	return claudewatch.NewScanner(opts)
+}
+
+// resetPreamble returns the configured reset preamble, if any
+func resetPreamble(fileConfig *FileConfig) string {
+	if fileConfig == nil {
+		return ""
+	}
+	return strings.TrimSpace(fileConfig.ResetPreamble)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// Where a setting shown by "claudewatch config show" comes from
+const (
+	sourceDefault     = "default"
+	sourceFlag        = "flag"
+	sourceConfigFile  = "config file"
+	sourceEnvironment = "environment"
+)
+
+// configEnvironment are the environment variables claudewatch reads
+var configEnvironment = []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE", "TERM", "WATCHMAN_SOCK", "WAYLAND_DISPLAY"}
+
+// setting is one effective setting of a watch session, for "claudewatch
+// config show"
+type setting struct {
+	Name   string
+	Value  string
+	Source string // sourceDefault, sourceFlag, sourceConfigFile, sourceEnvironment, or the file it was read from
+}
+
+// shownTemplate is a prompt template in effect, shown in full
+type shownTemplate struct {
+	Name   string // What it is used for
+	Source string
+	Text   string
+}
+
+// effectiveConfig is the configuration a watch session with the same
+// command line would run with
+type effectiveConfig struct {
+	Settings  []setting
+	Templates []shownTemplate
+	Ignores   []string // Ignore rules, in the order they are checked
+}
+
+// runConfigShow implements "config show": it prints the configuration a
+// watch session started with the same options would use
+func runConfigShow(args []string) int {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "help") {
+		fmt.Println("Usage: claudewatch config show [options] [directory...] [-- claude_arguments]")
+		fmt.Println("")
+		fmt.Println("Print the configuration claudewatch would run with, given the same options:")
+		fmt.Println("defaults, the config file, the environment and flags merged, with where each")
+		fmt.Println("setting comes from, the prompt templates in full and the ignore patterns.")
+		return 0
+	}
+	opts, err := parseArgs(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	configPath := opts.configPath
+	if configPath == "" {
+		configPath = findConfigFile(".")
+	}
+	var fileConfig *FileConfig
+	if configPath != "" {
+		if fileConfig, err = LoadFileConfig(configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config file: %v\n", err)
+			return 1
+		}
+	}
+
+	effective, err := resolveEffectiveConfig(opts, configPath, fileConfig, os.Getenv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	effective.write(os.Stdout)
+	return 0
+}
+
+// resolveEffectiveConfig works out the settings opts, the config file at
+// configPath (fileConfig, nil if there is none) and the environment add up
+// to, as the watch session would
+func resolveEffectiveConfig(opts *cliOptions, configPath string, fileConfig *FileConfig, getenv func(string) string) (*effectiveConfig, error) {
+	e := &effectiveConfig{}
+	add := func(name, value, source string) {
+		e.Settings = append(e.Settings, setting{Name: name, Value: value, Source: source})
+	}
+	// from picks the source of a setting a flag, the config file or neither set
+	from := func(flagSet, configSet bool) string {
+		switch {
+		case flagSet:
+			return sourceFlag
+		case configSet:
+			return sourceConfigFile
+		}
+		return sourceDefault
+	}
+	if fileConfig == nil {
+		fileConfig = &FileConfig{}
+	}
+
+	switch {
+	case configPath == "":
+		add("config file", "none", sourceDefault)
+	case opts.configPath != "":
+		add("config file", configPath, sourceFlag)
+	default:
+		add("config file", configPath, "nearest to the current directory")
+	}
+
+	dirs := opts.dirs
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	add("directories", strings.Join(dirs, ", "), from(len(opts.dirs) > 0, false))
+
+	command := "claude"
+	if opts.claudeCommand != "" {
+		command = opts.claudeCommand
+	} else if c := strings.TrimSpace(fileConfig.ClaudeCommand); c != "" {
+		command = c
+	}
+	add("claude command", command, from(opts.claudeCommand != "", fileConfig.ClaudeCommand != ""))
+	if len(opts.claudeArgs) > 0 {
+		add("claude arguments", strings.Join(opts.claudeArgs, " "), sourceFlag)
+	}
+
+	switch {
+	case opts.noClaude && opts.output != "":
+		add("prompts go to", opts.output+" (--no-claude)", sourceFlag)
+	case opts.noClaude:
+		add("prompts go to", "standard output (--no-claude)", sourceFlag)
+	case opts.attachPID != 0:
+		add("prompts go to", fmt.Sprintf("Claude process %d (--attach-pid)", opts.attachPID), sourceFlag)
+	case opts.attachAuto:
+		add("prompts go to", "a running Claude (--attach-auto)", sourceFlag)
+	case opts.tmuxTarget != "":
+		add("prompts go to", "tmux pane "+opts.tmuxTarget, sourceFlag)
+	default:
+		add("prompts go to", "a Claude started by claudewatch", sourceDefault)
+	}
+
+	var encodingVersions bool
+	if fileConfig.InputEncoding != nil {
+		encodingVersions = len(fileConfig.InputEncoding.Versions) > 0
+	}
+	encoding, err := resolveInputEncoding(opts.inputEncoding, fileConfig.InputEncoding, func() string { return cliVersion(command) })
+	if err != nil {
+		return nil, err
+	}
+	add("input encoding", string(encoding), from(opts.inputEncoding != "", fileConfig.InputEncoding != nil))
+	if encodingVersions && opts.inputEncoding == "" {
+		e.Settings[len(e.Settings)-1].Source += " (by CLI version)"
+	}
+
+	maxKB := maxFileSize(opts.maxFileSizeKB, fileConfig) >> 10
+	add("max file size", describeLimit(int(maxKB), "KiB"), from(opts.maxFileSizeKB >= 0, fileConfig.MaxFileSizeKB != nil))
+	add("file tree depth", fmt.Sprint(fileTreeDepth(fileConfig)), from(false, fileConfig.FileTreeDepth != nil))
+	add("context lines", fmt.Sprint(opts.contextLines), from(opts.contextLines > 0, false))
+	add("cooldown", opts.cooldown.String(), from(opts.cooldown != defaultCooldown, false))
+	add("dedupe window", opts.dedupeWindow.String(), from(opts.dedupeWindow != defaultDedupeWindow, false))
+	add("max per minute", describeLimit(opts.maxPerMinute, "prompts"), from(opts.maxPerMinute > 0, false))
+	add("max per session", describeLimit(opts.maxPerSession, "prompts"), from(opts.maxPerSession > 0, false))
+	add("watcher backend", opts.watcherBackend, from(opts.watcherBackend != watcherFsnotify, false))
+
+	expand := opts.expandCommand
+	if expand == "" {
+		expand = strings.TrimSpace(fileConfig.ExpandCommand)
+	}
+	if expand == "" {
+		expand = "none"
+	}
+	add("expand command", expand, from(opts.expandCommand != "", fileConfig.ExpandCommand != ""))
+
+	dirty, err := dirtyTreeMode(fileConfig, opts.requireClean)
+	if err != nil {
+		return nil, err
+	}
+	add("dirty tree", dirty, from(opts.requireClean, fileConfig.DirtyTree != ""))
+
+	add("session notes", onOff(opts.sessionNotes || fileConfig.SessionNotes), from(opts.sessionNotes, fileConfig.SessionNotes))
+	for _, toggle := range []struct {
+		name string
+		on   bool
+	}{
+		{"keep markers", opts.keepMarkers},
+		{"confirm strip", opts.confirmStrip},
+		{"pick", opts.pick},
+		{"backup", opts.backup},
+		{"progress comments", opts.progressComments},
+		{"record", opts.record},
+		{"digest", opts.digest},
+		{"batch", opts.batch},
+		{"hold while answering", opts.holdWhileAnswering},
+		{"coalesce", opts.coalesce},
+		{"git checkpoint", opts.gitCheckpoint},
+		{"auto commit", opts.autoCommit},
+		{"branch per instruction", opts.branchPerPrompt},
+		{"tracked only", opts.trackedOnly},
+		{"project scope", opts.projectScope},
+		{"follow symlinks", opts.followSymlinks},
+		{"template shell", opts.allowTemplateShell},
+		{"quiet", opts.quiet},
+		{"show prompt", opts.showPrompt},
+	} {
+		add(toggle.name, onOff(toggle.on), from(toggle.on, false))
+	}
+	add("log level", opts.logLevel.String(), from(opts.logLevel != levelOff, false))
+	if opts.logFile != "" {
+		add("log file", opts.logFile, sourceFlag)
+	}
+
+	signalActions, err := resolveSignalActions(configSignals(fileConfig))
+	if err != nil {
+		return nil, err
+	}
+	add("signals", describeSignalActions(signalActions), from(false, len(fileConfig.Signals) > 0))
+	retention := retentionFromConfig(fileConfig)
+	add("history keep days", describeLimit(retention.KeepDays, "days"), from(false, fileConfig.HistoryKeepDays != nil))
+	add("transcript max size", describeLimit(int(retention.TranscriptMaxLen>>20), "MiB"), from(false, fileConfig.TranscriptMaxMB != nil))
+
+	if len(fileConfig.Namespaces) > 0 {
+		add("marker namespaces", strings.Join(sortedKeys(fileConfig.Namespaces), ", "), sourceConfigFile)
+	}
+	add("todo markers", onOff(fileConfig.TodoMarkers), from(false, fileConfig.TodoMarkers))
+	if tags := markerTags(fileConfig); len(tags) > 0 {
+		add("marker tags", strings.Join(tags, ", "), sourceConfigFile)
+	}
+	for _, ext := range sortedKeys(fileConfig.CommentPrefixes) {
+		add("comment prefixes "+ext, strings.Join(fileConfig.CommentPrefixes[ext], " "), sourceConfigFile)
+	}
+
+	for _, name := range configEnvironment {
+		if value := getenv(name); value != "" {
+			add(name, value, sourceEnvironment)
+		}
+	}
+
+	if err := e.addTemplates(opts, fileConfig, dirs[0]); err != nil {
+		return nil, err
+	}
+	return e, e.addIgnores(opts, dirs)
+}
+
+// addTemplates adds the prompt templates in effect for files in dir: the
+// config file's partials, the one for edit markers, then those the config
+// file sets by marker type, extension and tag
+func (e *effectiveConfig) addTemplates(opts *cliOptions, fileConfig *FileConfig, dir string) error {
+	if err := setTemplatePartials(fileConfig); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(fileConfig.Partials) {
+		e.Templates = append(e.Templates, shownTemplate{Name: "partial " + name, Source: sourceConfigFile, Text: fileConfig.Partials[name]})
+	}
+
+	name, source, text := "prompt", "", ""
+	switch {
+	case opts.prompt != nil:
+		source, text = "--prompt", *opts.prompt
+	case opts.preset != "":
+		if _, err := loadPreset(opts.preset, fileConfig.Presets); err != nil {
+			return err
+		}
+		var ok bool
+		if text, ok = fileConfig.Presets[opts.preset]; !ok {
+			text = builtinPresets[opts.preset]
+		}
+		source = "--preset " + opts.preset
+	case fileConfig.MarkerTemplates[claudewatch.TypeEdit] != "":
+		source, text = "marker_templates in the config file", fileConfig.MarkerTemplates[claudewatch.TypeEdit]
+	default:
+		if path := findPromptFile(dir); path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, source, text = "prompt for files in "+dir, path, string(content)
+		} else {
+			tmpl, err := GetDefaultPromptTemplate()
+			if err != nil {
+				return err
+			}
+			source, text = "built-in default", tmpl.Tree.Root.String()
+		}
+	}
+	if _, err := parsePromptTemplate(text); err != nil {
+		return fmt.Errorf("prompt template (%s): %w", source, err)
+	}
+	e.Templates = append(e.Templates, shownTemplate{Name: name, Source: source, Text: text})
+
+	add := func(kind string, templates map[string]string, compile func(*FileConfig) (map[string]*template.Template, error)) error {
+		if _, err := compile(fileConfig); err != nil {
+			return err
+		}
+		for _, key := range sortedKeys(templates) {
+			e.Templates = append(e.Templates, shownTemplate{Name: kind + " " + key, Source: sourceConfigFile, Text: templates[key]})
+		}
+		return nil
+	}
+	if err := add("marker type", fileConfig.MarkerTemplates, compileMarkerTypeTemplates); err != nil {
+		return err
+	}
+	if err := add("extension", fileConfig.ExtensionTemplates, compileExtensionTemplates); err != nil {
+		return err
+	}
+	return add("tag", fileConfig.Tags, compileTagTemplates)
+}
+
+// addIgnores adds the ignore rules checked for paths in dirs, in order
+func (e *effectiveConfig) addIgnores(opts *cliOptions, dirs []string) error {
+	if opts.noBuiltinIgnores {
+		e.Ignores = append(e.Ignores, "built-in: hidden files and directories")
+	} else {
+		e.Ignores = append(e.Ignores, "built-in: hidden files and directories, editor temp files")
+	}
+	if opts.ignore != "" {
+		e.Ignores = append(e.Ignores, "--ignore: "+opts.ignore)
+	}
+	for _, dir := range dirs {
+		rules, err := loadIgnoreRules(dir)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", filepath.Join(dir, ignoreFileName), err)
+		}
+		for _, rule := range rules {
+			e.Ignores = append(e.Ignores, fmt.Sprintf("%s:%d: %s", rule.file, rule.line, rule.pattern))
+		}
+	}
+	if opts.projectScope {
+		e.Ignores = append(e.Ignores, "each project's own "+ignoreFileName+" (--project-scope)")
+	}
+	return nil
+}
+
+// write prints the configuration: the settings, one per line with where
+// each comes from, then the ignore rules and the templates in full
+func (e *effectiveConfig) write(w io.Writer) {
+	width := 0
+	for _, s := range e.Settings {
+		width = max(width, len(s.Name))
+	}
+	for _, s := range e.Settings {
+		fmt.Fprintf(w, "%-*s  %s  (%s)\n", width+1, s.Name+":", s.Value, s.Source)
+	}
+
+	fmt.Fprintln(w, "\nIgnore rules:")
+	for _, rule := range e.Ignores {
+		fmt.Fprintf(w, "  %s\n", rule)
+	}
+	for _, t := range e.Templates {
+		fmt.Fprintf(w, "\nTemplate: %s (%s)\n", t.Name, t.Source)
+		for _, line := range strings.Split(strings.TrimRight(t.Text, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
+
+// describeLimit shows n of unit, where 0 means no limit
+func describeLimit(n int, unit string) string {
+	if n <= 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// onOff shows a boolean setting
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveEffectiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ignoreFileName), []byte("# generated\n_gen\\.go$\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, promptFileName), []byte("Fix {{.File}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseArgs([]string{"--cooldown", "3s", "--ignore", `\.pb\.go$`, dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := 64
+	fileConfig := &FileConfig{MaxFileSizeKB: &size, ClaudeCommand: "claude-beta", ExtensionTemplates: map[string]string{".py": "Fix the Python in {{.File}}"}}
+	env := map[string]string{"NO_COLOR": "1"}
+	e, err := resolveEffectiveConfig(opts, "/src/.claudewatch.json", fileConfig, func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := make(map[string]setting)
+	for _, s := range e.Settings {
+		settings[s.Name] = s
+	}
+	for name, want := range map[string]setting{
+		"config file":     {Value: "/src/.claudewatch.json", Source: "nearest to the current directory"},
+		"directories":     {Value: dir, Source: sourceFlag},
+		"claude command":  {Value: "claude-beta", Source: sourceConfigFile},
+		"max file size":   {Value: "64 KiB", Source: sourceConfigFile},
+		"cooldown":        {Value: "3s", Source: sourceFlag},
+		"dedupe window":   {Value: "0s", Source: sourceDefault},
+		"NO_COLOR":        {Value: "1", Source: sourceEnvironment},
+		"keep markers":    {Value: "off", Source: sourceDefault},
+		"file tree depth": {Value: "2", Source: sourceDefault},
+	} {
+		got := settings[name]
+		if got.Value != want.Value || got.Source != want.Source {
+			t.Errorf("%s = %q (%s), want %q (%s)", name, got.Value, got.Source, want.Value, want.Source)
+		}
+	}
+	if _, ok := settings["TERM"]; ok {
+		t.Error("an environment variable that isn't set was shown")
+	}
+
+	wantIgnores := []string{
+		"built-in: hidden files and directories, editor temp files",
+		`--ignore: \.pb\.go$`,
+		filepath.Join(dir, ignoreFileName) + `:2: _gen\.go$`,
+	}
+	if strings.Join(e.Ignores, "\n") != strings.Join(wantIgnores, "\n") {
+		t.Errorf("ignores = %q, want %q", e.Ignores, wantIgnores)
+	}
+
+	if len(e.Templates) != 2 {
+		t.Fatalf("templates = %+v, want the .claudewatchprompt and the .py template", e.Templates)
+	}
+	if got := e.Templates[0]; got.Source != filepath.Join(dir, promptFileName) || got.Text != "Fix {{.File}}" {
+		t.Errorf("prompt template = %+v, want the .claudewatchprompt", got)
+	}
+	if got := e.Templates[1]; got.Name != "extension .py" || got.Source != sourceConfigFile {
+		t.Errorf("second template = %+v, want the .py template", got)
+	}
+}
+
+func TestResolveEffectiveConfigRejectsBadTemplate(t *testing.T) {
+	opts, err := parseArgs([]string{"--prompt", "{{.File"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveEffectiveConfig(opts, "", nil, func(string) string { return "" }); err == nil {
+		t.Error("a --prompt that doesn't parse was shown")
+	}
+}
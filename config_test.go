@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// writeConfigFile writes a .claudewatch.json with the given content into dir
+func writeConfigFile(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, configFileName)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile(%q): %v", path, err)
+	}
+	return path
+}
+
+// render executes tmpl with data for a single marker in file
+func render(t *testing.T, tmpl *template.Template, file string) string {
+	t.Helper()
+	var buf strings.Builder
+	data := TemplateData{File: file, Markers: []claudewatch.Marker{{LineNumber: 1, LineText: "// fix"}}}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	return buf.String()
+}
+
+func TestLoadFileConfig(t *testing.T) {
+	path := writeConfigFile(t, t.TempDir(), `{"extension_templates": {".go": "go: {{.File}}"}, "claude_command": "/opt/claude/bin/claude"}`)
+
+	fileConfig, err := LoadFileConfig(path)
+	if err != nil {
+		t.Fatalf("LoadFileConfig: %v", err)
+	}
+	if got := fileConfig.ExtensionTemplates[".go"]; got != "go: {{.File}}" {
+		t.Errorf("ExtensionTemplates[.go] = %q", got)
+	}
+	if fileConfig.ClaudeCommand != "/opt/claude/bin/claude" {
+		t.Errorf("ClaudeCommand = %q", fileConfig.ClaudeCommand)
+	}
+}
+
+func TestLoadFileConfigInvalidJSON(t *testing.T) {
+	path := writeConfigFile(t, t.TempDir(), `{"extension_templates": `)
+
+	if _, err := LoadFileConfig(path); err == nil {
+		t.Error("LoadFileConfig() error = nil, want a parse error")
+	}
+}
+
+func TestFindConfigFileWalksUp(t *testing.T) {
+	root := t.TempDir()
+	want := writeConfigFile(t, root, `{}`)
+	start := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(start, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	if got := findConfigFile(start); got != want {
+		t.Errorf("findConfigFile(%q) = %q, want %q", start, got, want)
+	}
+}
+
+func TestNormalizeExtension(t *testing.T) {
+	tests := []struct {
+		ext  string
+		want string
+	}{
+		{".go", ".go"},
+		{"go", ".go"},
+		{".GO", ".go"},
+		{" md ", ".md"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeExtension(tt.ext); got != tt.want {
+			t.Errorf("normalizeExtension(%q) = %q, want %q", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestPromptResolverPrefersExtensionTemplate(t *testing.T) {
+	root := t.TempDir()
+	defaultTmpl := template.Must(parsePromptTemplate("default"))
+	templates, err := compileExtensionTemplates(&FileConfig{
+		ExtensionTemplates: map[string]string{"go": "strict", ".MD": "loose"},
+	})
+	if err != nil {
+		t.Fatalf("compileExtensionTemplates: %v", err)
+	}
+
+	resolver := newPromptResolver(defaultTmpl, nil, nil)
+	resolver.byExtension = templates
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{filepath.Join(root, "main.go"), "strict"},
+		{filepath.Join(root, "README.md"), "loose"},
+		{filepath.Join(root, "script.py"), "default"},
+	}
+
+	for _, tt := range tests {
+		if got := render(t, resolver.resolve(tt.file), tt.file); got != tt.want {
+			t.Errorf("resolve(%q) rendered %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestPromptResolverOverrideBeatsExtensionTemplate(t *testing.T) {
+	override := template.Must(parsePromptTemplate("override"))
+	resolver := newPromptResolver(override, override, nil)
+	resolver.byExtension = map[string]*template.Template{
+		".go": template.Must(parsePromptTemplate("strict")),
+	}
+
+	if got := render(t, resolver.resolve("/tmp/main.go"), "/tmp/main.go"); got != "override" {
+		t.Errorf("resolve() rendered %q, want the --prompt override", got)
+	}
+}
+
+func TestCompileExtensionTemplatesReportsParseErrors(t *testing.T) {
+	_, err := compileExtensionTemplates(&FileConfig{
+		ExtensionTemplates: map[string]string{".go": "{{.File"},
+	})
+	if err == nil || !strings.Contains(err.Error(), ".go") {
+		t.Errorf("compileExtensionTemplates() error = %v, want an error naming the extension", err)
+	}
+}
+
+// mustMarkerScanner returns the marker Scanner for fileConfig
+func mustMarkerScanner(t *testing.T, fileConfig *FileConfig) *claudewatch.Scanner {
+	t.Helper()
+	scanner, err := newMarkerScanner(fileConfig)
+	if err != nil {
+		t.Fatalf("newMarkerScanner: %v", err)
+	}
+	return scanner
+}
+
+func TestNewMarkerScanner(t *testing.T) {
+	scanner := mustMarkerScanner(t, &FileConfig{
+		CommentPrefixes: map[string][]string{"sql": {"--"}, "*": {";;"}},
+		Namespaces:      map[string]NamespaceConfig{"be": {}},
+		Tags:            map[string]string{"test": "T"},
+		TodoMarkers:     true,
+	})
+
+	if markers := scanner.ScanFile("q.sql", "-- use a join ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(q.sql) = %+v, want one marker", markers)
+	}
+	if markers := scanner.ScanFile("init.el", ";; bind this ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(init.el) = %+v, want one marker", markers)
+	}
+	if markers := scanner.ScanFile("main.go", "// still found ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(main.go) = %+v, want the default comment syntaxes kept", markers)
+	}
+	markers := scanner.Scan("// page this be-ai!test\n// TODO(ai): use a map\n") // ai:ignore
+	if len(markers) != 2 || markers[0].Namespace != "be" || markers[0].Tag != "test" || markers[1].Type != claudewatch.TypeTodo {
+		t.Errorf("Scan() = %+v, want a be marker tagged test and a TODO marker", markers)
+	}
+
+	// Other scanners are left as they were
+	if markers := defaultMarkerScanner.ScanFile("q.sql", "-- use a join ai!\n"); len(markers) != 0 { // ai:ignore
+		t.Errorf("the default scanner found %+v after newMarkerScanner, want nothing", markers)
+	}
+	if _, err := newMarkerScanner(&FileConfig{CommentPrefixes: map[string][]string{"": {"--"}}}); err == nil {
+		t.Error("newMarkerScanner accepted an empty extension")
+	}
+	if _, err := newMarkerScanner(&FileConfig{Tags: map[string]string{"two words": "T"}}); err == nil {
+		t.Error("newMarkerScanner accepted a tag that isn't a word")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// ANSI styles used for claudewatch's own messages
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiDim    = "\x1b[2m"
+)
+
+// consoleWriter writes claudewatch's own runtime messages (status lines,
+// diffs, questions) to stderr, interleaved with Claude's terminal UI. On a
+// terminal, which is in raw mode while Claude runs, lines end in CRLF and
+// may be colored; redirected to a file, messages are plain text with LF
+// line endings. Claude's own output never passes through here.
+type consoleWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	color   bool
+	newline string
+	log     io.Writer // With --log-file, where messages are copied, uncolored
+}
+
+// console is where runtime messages go
+var console = newConsoleWriter(os.Stderr, term.IsTerminal(int(os.Stderr.Fd())), os.Getenv)
+
+func newConsoleWriter(out io.Writer, isTerminal bool, getenv func(string) string) *consoleWriter {
+	c := &consoleWriter{out: out, color: colorEnabled(isTerminal, getenv), newline: "\n"}
+	if isTerminal {
+		c.newline = "\r\n"
+	}
+	return c
+}
+
+// colorEnabled decides whether to color output, following the NO_COLOR
+// (no-color.org) and CLICOLOR/CLICOLOR_FORCE conventions: NO_COLOR always
+// wins, CLICOLOR_FORCE colors even when not on a terminal, CLICOLOR=0 turns
+// color off, and otherwise only capable terminals get color.
+func colorEnabled(isTerminal bool, getenv func(string) string) bool {
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if getenv("CLICOLOR") == "0" || !isTerminal {
+		return false
+	}
+	switch getenv("TERM") {
+	case "", "dumb":
+		return false
+	}
+	return true
+}
+
+// logTo copies every message to log as well
+func (c *consoleWriter) logTo(log io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log = log
+}
+
+// paint wraps text in style when color is enabled
+func (c *consoleWriter) paint(style, text string) string {
+	if !c.color || text == "" {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// write prints text, converting its line endings for the destination, and
+// copies it to the log if there is one
+func (c *consoleWriter) write(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.log != nil {
+		_, _ = io.WriteString(c.log, ansiEscape.ReplaceAllString(text, ""))
+	}
+	if c.newline != "\n" {
+		text = strings.ReplaceAll(text, "\n", c.newline)
+	}
+	_, _ = io.WriteString(c.out, text)
+}
+
+// notice prints a bracketed status line on a line of its own, set off from
+// whatever Claude printed last
+func (c *consoleWriter) notice(format string, args ...interface{}) {
+	c.write("\n" + c.paint(ansiCyan, "["+fmt.Sprintf(format, args...)+"]") + "\n")
+}
+
+// detail prints an indented line belonging to the preceding notice
+func (c *consoleWriter) detail(format string, args ...interface{}) {
+	c.write("  " + fmt.Sprintf(format, args...) + "\n")
+}
+
+// warn prints a bracketed status line about something that went wrong but
+// was handled
+func (c *consoleWriter) warn(format string, args ...interface{}) {
+	c.write(c.paint(ansiYellow, "["+fmt.Sprintf(format, args...)+"]") + "\n")
+}
+
+// errorf prints an error message
+func (c *consoleWriter) errorf(format string, args ...interface{}) {
+	c.write(c.paint(ansiRed, fmt.Sprintf(format, args...)) + "\n")
+}
+
+// diff prints a unified diff, coloring added and removed lines
+func (c *consoleWriter) diff(text string) {
+	var out strings.Builder
+	out.WriteString("\n")
+	for _, line := range strings.SplitAfter(text, "\n") {
+		body := strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(body, "+++"), strings.HasPrefix(body, "---"):
+			out.WriteString(body)
+		case strings.HasPrefix(body, "+"):
+			out.WriteString(c.paint(ansiGreen, body))
+		case strings.HasPrefix(body, "-"):
+			out.WriteString(c.paint(ansiRed, body))
+		case strings.HasPrefix(body, "@@"):
+			out.WriteString(c.paint(ansiCyan, body))
+		default:
+			out.WriteString(body)
+		}
+		out.WriteString(line[len(body):])
+	}
+	c.write(out.String())
+}
+
+// prompt prints a prompt about to be sent, for --show-prompt: dimmed, in a
+// box headed by title, so it stands apart from Claude's interface
+func (c *consoleWriter) prompt(title, text string) {
+	var out strings.Builder
+	out.WriteString("\n" + c.paint(ansiDim, "╭─ "+title) + "\n")
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		out.WriteString(c.paint(ansiDim, strings.TrimRight("│ "+line, " ")) + "\n")
+	}
+	out.WriteString(c.paint(ansiDim, "╰─") + "\n")
+	c.write(out.String())
+}
+
+// ask prints a question, leaving the cursor on the same line for the answer
+func (c *consoleWriter) ask(text string) {
+	c.write(c.paint(ansiYellow, text) + " ")
+}
+
+// answer finishes the line started by ask
+func (c *consoleWriter) answer(text string) {
+	c.write(text + "\n")
+}
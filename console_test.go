@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// env returns a getenv function backed by vars
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		name       string
+		isTerminal bool
+		vars       map[string]string
+		want       bool
+	}{
+		{"terminal", true, map[string]string{"TERM": "xterm-256color"}, true},
+		{"redirected", false, map[string]string{"TERM": "xterm-256color"}, false},
+		{"NO_COLOR", true, map[string]string{"TERM": "xterm", "NO_COLOR": "1"}, false},
+		{"NO_COLOR beats CLICOLOR_FORCE", true, map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, false},
+		{"CLICOLOR_FORCE when redirected", false, map[string]string{"CLICOLOR_FORCE": "1"}, true},
+		{"CLICOLOR_FORCE=0", false, map[string]string{"CLICOLOR_FORCE": "0"}, false},
+		{"CLICOLOR=0", true, map[string]string{"TERM": "xterm", "CLICOLOR": "0"}, false},
+		{"dumb terminal", true, map[string]string{"TERM": "dumb"}, false},
+		{"no TERM", true, map[string]string{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := colorEnabled(tt.isTerminal, env(tt.vars)); got != tt.want {
+			t.Errorf("%s: colorEnabled() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConsoleWriterRedirectedIsPlain(t *testing.T) {
+	var out bytes.Buffer
+	c := newConsoleWriter(&out, false, env(map[string]string{"TERM": "xterm"}))
+	c.notice("File change detected: %s", "a.go")
+	c.detail("Line %d: %s", 3, "// fix this")
+	c.warn("declined")
+	c.ask("Remove markers? [y/N]")
+	c.answer("n")
+	c.diff("--- a\n+++ b\n-old\r\n+new\n")
+
+	want := "\n[File change detected: a.go]\n  Line 3: // fix this\n[declined]\nRemove markers? [y/N] n\n\n--- a\n+++ b\n-old\n+new\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestConsoleWriterTerminal(t *testing.T) {
+	var out bytes.Buffer
+	c := newConsoleWriter(&out, true, env(map[string]string{"TERM": "xterm"}))
+	c.errorf("Error: %v", "boom")
+	c.diff("@@ -1 +1 @@\n-old\n+new\n ctx\n")
+
+	want := ansiRed + "Error: boom" + ansiReset + "\r\n" +
+		"\r\n" + ansiCyan + "@@ -1 +1 @@" + ansiReset + "\r\n" +
+		ansiRed + "-old" + ansiReset + "\r\n" +
+		ansiGreen + "+new" + ansiReset + "\r\n" +
+		" ctx\r\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	c = newConsoleWriter(&out, true, env(map[string]string{"TERM": "xterm", "NO_COLOR": "1"}))
+	c.warn("held")
+	if got := out.String(); got != "[held]\r\n" {
+		t.Errorf("NO_COLOR output = %q, want plain text with CRLF", got)
+	}
+}
+
+func TestConsoleWriterPrompt(t *testing.T) {
+	var out bytes.Buffer
+	c := newConsoleWriter(&out, false, env(map[string]string{}))
+	c.prompt("prompt #2 for a.go", "Modify a.go.\n\nLine 3: use a map\n")
+
+	want := "\n╭─ prompt #2 for a.go\n│ Modify a.go.\n│\n│ Line 3: use a map\n╰─\n"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	c = newConsoleWriter(&out, true, env(map[string]string{"TERM": "xterm"}))
+	c.prompt("prompt #1", "Fix it")
+	want = "\r\n" + ansiDim + "╭─ prompt #1" + ansiReset + "\r\n" + ansiDim + "│ Fix it" + ansiReset + "\r\n" + ansiDim + "╰─" + ansiReset + "\r\n"
+	if got := out.String(); got != want {
+		t.Errorf("terminal output = %q, want %q", got, want)
+	}
+}
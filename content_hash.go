@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// contentHashes remembers a hash of each file's content as last processed,
+// so a write that leaves the bytes as they were (a touch, or a tool saving
+// unchanged files) isn't scanned again
+type contentHashes struct {
+	mu   sync.Mutex
+	sums map[string][sha256.Size]byte
+}
+
+func newContentHashes() *contentHashes {
+	return &contentHashes{sums: make(map[string][sha256.Size]byte)}
+}
+
+// unchanged reports whether content is what path held when it was last
+// processed, and otherwise records it as path's content
+func (h *contentHashes) unchanged(path string, content []byte) bool {
+	sum := sha256.Sum256(content)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if previous, ok := h.sums[path]; ok && previous == sum {
+		return true
+	}
+	h.sums[path] = sum
+	return false
+}
+
+// forget drops what is remembered about path, and about the files under it
+// when it was a directory, so they are processed on their next write even
+// if their content is the same
+func (h *contentHashes) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	h.mu.Lock()
+	for file := range h.sums {
+		if file == path || strings.HasPrefix(file, prefix) {
+			delete(h.sums, file)
+		}
+	}
+	h.mu.Unlock()
+}
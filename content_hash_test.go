@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestContentHashes(t *testing.T) {
+	h := newContentHashes()
+	if h.unchanged("a.go", []byte("one")) {
+		t.Fatal("a file seen for the first time reported unchanged")
+	}
+	if !h.unchanged("a.go", []byte("one")) {
+		t.Error("the same content reported changed")
+	}
+	if h.unchanged("b.go", []byte("one")) {
+		t.Error("another file with the same content reported unchanged")
+	}
+	if h.unchanged("a.go", []byte("two")) {
+		t.Error("new content reported unchanged")
+	}
+
+	dir := filepath.Join("src", "pkg")
+	h.unchanged(filepath.Join(dir, "c.go"), []byte("three"))
+	h.forget(dir)
+	if h.unchanged(filepath.Join(dir, "c.go"), []byte("three")) {
+		t.Error("file under a forgotten directory reported unchanged")
+	}
+}
+
+func TestProcessSkipsUnchangedContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// use a map ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	prompts := make(chan promptRequest, 4)
+	p := newFileProcessor(&Config{KeepMarkers: true}, resolver, prompts)
+
+	got := processKeeping(t, p, prompts, path)
+	if len(got) != 1 {
+		t.Fatalf("first save sent %d prompts, want 1", len(got))
+	}
+
+	// Touching the file isn't a change
+	p.sent = make(map[string]map[string]bool)
+	if again := processKeeping(t, p, prompts, path); len(again) != 0 {
+		t.Errorf("touching the file sent %+v, want nothing", again)
+	}
+
+	// After a failed delivery, the next save sends the marker again even if
+	// the content is the same
+	got[0].Restore()
+	if again := processKeeping(t, p, prompts, path); len(again) != 1 {
+		t.Errorf("saving after a failed delivery sent %d prompts, want 1", len(again))
+	}
+}
+
+func TestProcessSendsMarkerAddedBackAfterStrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "package p\n\n// use a map ai!\n" // ai:ignore
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	prompts := make(chan promptRequest, 4)
+	p := newFileProcessor(&Config{}, resolver, prompts)
+
+	p.process(path)
+	if len(prompts) != 1 {
+		t.Fatalf("first save sent %d prompts, want 1", len(prompts))
+	}
+	<-prompts
+
+	// The user writes the same marker again, leaving the file as it was
+	// before the strip
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	p.process(path)
+	if len(prompts) != 1 {
+		t.Errorf("adding the marker back sent %d prompts, want 1", len(prompts))
+	}
+}
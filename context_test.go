@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestWithContext(t *testing.T) {
+	content := "line one\nline two\n// fix this\nline four\nline five"
+	markers := []claudewatch.Marker{{LineNumber: 3, LineText: "// fix this"}}
+
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"No context", 0, ""},
+		{"One line", 1, "2: line two\n3: // fix this\n4: line four"},
+		{"Clamped at file boundaries", 10, "1: line one\n2: line two\n3: // fix this\n4: line four\n5: line five"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withContext(content, markers, tt.n)
+			if got[0].Context != tt.want {
+				t.Errorf("withContext(n=%d).Context = %q, want %q", tt.n, got[0].Context, tt.want)
+			}
+			if got[0].LineNumber != 3 || got[0].LineText != "// fix this" {
+				t.Errorf("withContext changed the marker itself: %+v", got[0])
+			}
+		})
+	}
+}
+
+func TestWithContextDoesNotMutateInput(t *testing.T) {
+	markers := []claudewatch.Marker{{LineNumber: 1, LineText: "// a"}}
+	withContext("// a\nb", markers, 1)
+	if markers[0].Context != "" {
+		t.Errorf("input marker Context = %q, want it left empty", markers[0].Context)
+	}
+}
+
+func TestDefaultTemplateRendersContext(t *testing.T) {
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatalf("GetDefaultPromptTemplate: %v", err)
+	}
+
+	var buf strings.Builder
+	data := TemplateData{
+		File:    "/tmp/x.go",
+		Markers: []claudewatch.Marker{{LineNumber: 2, LineText: "// fix", Context: "1: a\n2: // fix\n3: b"}},
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Surrounding code:\n1: a\n2: // fix\n3: b") {
+		t.Errorf("rendered prompt is missing the context block:\n%s", buf.String())
+	}
+}
+
+func TestDefaultTemplateRendersCommentRun(t *testing.T) {
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatalf("GetDefaultPromptTemplate: %v", err)
+	}
+
+	var buf strings.Builder
+	data := TemplateData{
+		File:    "/tmp/x.go",
+		Markers: []claudewatch.Marker{{LineNumber: 4, LineText: "// keyed by name", CommentStart: 3, Comment: "// Use a map,\n// keyed by name"}},
+	}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Lines 3-4:\n// Use a map,\n// keyed by name\n") {
+		t.Errorf("rendered prompt is missing the comment:\n%s", buf.String())
+	}
+}
+
+func TestProcessRendersLineNumbersOfStrippedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "package p\n// ai!\n// use a map ai!\nvar m []int // ai!\n// and here ai!"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineNumber}}: {{.LineText}}\n{{end}}")), nil, nil)
+	newFileProcessor(&Config{}, resolver, prompts).process(path)
+
+	// Each marker's line number is that of the file Claude reads
+	if got := readString(t, path); got != "package p\n// use a map\nvar m []int\n// and here" {
+		t.Fatalf("stripped content = %q", got)
+	}
+	if req := <-prompts; req.Prompt != "2: //\n2: // use a map\n3: var m []int\n4: // and here\n" {
+		t.Errorf("prompt = %q, want the stripped file's line numbers", req.Prompt)
+	}
+}
+
+func TestProcessIncludesMarkerRegion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "package p\n// ai!(lines=+2) speed this up\nfunc a() {\n}\nvar x int\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFileProcessor(&Config{}, newPromptResolver(tmpl, nil, nil), prompts).process(path)
+
+	if got := readString(t, path); got != "package p\n// speed this up\nfunc a() {\n}\nvar x int\n" {
+		t.Fatalf("stripped content = %q", got)
+	}
+	want := "Line 2: // speed this up\nApplies to lines 3-4:\n3: func a() {\n4: }\n"
+	if req := <-prompts; !strings.Contains(req.Prompt, want) {
+		t.Errorf("prompt = %q, want it to contain %q", req.Prompt, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultCooldown is how long changes to a file are ignored after it is
+// processed, so the several writes of one save are scanned once
+const defaultCooldown = time.Second
+
+// fileCooldown remembers when each file was last processed, for --cooldown.
+// Files processed longer ago than the window are dropped, at most once per
+// window, so it only holds the files saved recently.
+type fileCooldown struct {
+	window  time.Duration
+	last    map[string]time.Time
+	evicted time.Time // When files were last dropped
+}
+
+// newFileCooldown returns a cooldown of window, or nil if window is zero
+func newFileCooldown(window time.Duration) *fileCooldown {
+	if window <= 0 {
+		return nil
+	}
+	return &fileCooldown{window: window, last: make(map[string]time.Time)}
+}
+
+// cooling reports when path was last processed, if that was within the
+// window, and otherwise records it as processed at now. A nil cooldown never
+// holds a file back.
+func (c *fileCooldown) cooling(path string, now time.Time) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	if now.Sub(c.evicted) >= c.window {
+		for file, at := range c.last {
+			if now.Sub(at) >= c.window {
+				delete(c.last, file)
+			}
+		}
+		c.evicted = now
+	}
+	if at, ok := c.last[path]; ok && now.Sub(at) < c.window {
+		return at, true
+	}
+	c.last[path] = now
+	return time.Time{}, false
+}
+
+// forget drops path, and the files under it when it was a directory, so
+// their next changes are processed at once
+func (c *fileCooldown) forget(path string) {
+	if c == nil {
+		return
+	}
+	prefix := path + string(filepath.Separator)
+	for file := range c.last {
+		if file == path || strings.HasPrefix(file, prefix) {
+			delete(c.last, file)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCooldown(t *testing.T) {
+	now := time.Now()
+	c := newFileCooldown(3 * time.Second)
+	if _, cooling := c.cooling("a.go", now); cooling {
+		t.Fatal("first change held back")
+	}
+	if at, cooling := c.cooling("a.go", now.Add(2*time.Second)); !cooling || !at.Equal(now) {
+		t.Errorf("cooling() within the window = %v, %v; want the first change", at, cooling)
+	}
+	if _, cooling := c.cooling("b.go", now.Add(2*time.Second)); cooling {
+		t.Error("another file held back by the first one's cooldown")
+	}
+	if _, cooling := c.cooling("a.go", now.Add(4*time.Second)); cooling {
+		t.Error("change held back after the window")
+	}
+
+	// Files processed more than a window ago are evicted
+	c.cooling("c.go", now.Add(10*time.Second))
+	if len(c.last) != 1 {
+		t.Errorf("cooldown holds %d files after the others expired, want 1", len(c.last))
+	}
+
+	dir := filepath.Join("src", "pkg")
+	c.cooling(filepath.Join(dir, "d.go"), now.Add(10*time.Second))
+	c.forget(dir)
+	if _, cooling := c.cooling(filepath.Join(dir, "d.go"), now.Add(11*time.Second)); cooling {
+		t.Error("file under a forgotten directory held back")
+	}
+
+	disabled := newFileCooldown(0)
+	for i := 0; i < 2; i++ {
+		if _, cooling := disabled.cooling("a.go", now); cooling {
+			t.Error("a disabled cooldown held a change back")
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// corpusFS holds the marker corpus: sample files in several languages, each
+// next to golden files recording the markers claudewatch should find in it
+// (NAME.markers) and the file as it should look once they are removed
+// (NAME.stripped). It is embedded so "claudewatch selftest" can check the
+// installed binary against it.
+//
+//go:embed testdata/corpus
+var corpusFS embed.FS
+
+// corpusDir is the corpus's directory within corpusFS
+const corpusDir = "testdata/corpus"
+
+// Extensions of the golden files that accompany each corpus file
+const (
+	corpusMarkersExt  = ".markers"
+	corpusStrippedExt = ".stripped"
+)
+
+// corpusResult is the outcome of checking one corpus file
+type corpusResult struct {
+	Name     string
+	Problems []string // Empty when the file matched its golden files
+}
+
+// corpusFiles lists the sample files in dir of fsys, leaving out golden files
+func corpusFiles(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || ext == corpusMarkersExt || ext == corpusStrippedExt {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// formatCorpusMarkers renders markers in the format of a .markers golden
+// file: one line per marker with its line number, token, type and, if it has
+// one, namespace
+func formatCorpusMarkers(markers []claudewatch.Marker) string {
+	var out strings.Builder
+	for _, marker := range markers {
+		fmt.Fprintf(&out, "%d %s %s", marker.LineNumber, marker.Token, marker.Type)
+		if marker.Namespace != "" {
+			fmt.Fprintf(&out, " %s", marker.Namespace)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// scanCorpusFile runs marker detection and removal over content, the
+// contents of the file named name, returning what the file's .markers and
+// .stripped golden files should hold
+func scanCorpusFile(name, content string) (string, string, error) {
+	markers := defaultMarkerScanner.ScanFile(name, content)
+	stripped, _, err := defaultMarkerScanner.ForFile(name).StripMarkers(content, markers)
+	if err != nil {
+		return "", "", err
+	}
+	return formatCorpusMarkers(markers), stripped, nil
+}
+
+// checkCorpus runs detection and removal over every file in dir of fsys and
+// compares the results with the golden files
+func checkCorpus(fsys fs.FS, dir string) ([]corpusResult, error) {
+	names, err := corpusFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]corpusResult, 0, len(names))
+	for _, name := range names {
+		result := corpusResult{Name: name}
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		markers, stripped, err := scanCorpusFile(name, string(content))
+		if err != nil {
+			result.Problems = append(result.Problems, err.Error())
+			results = append(results, result)
+			continue
+		}
+
+		for _, golden := range []struct{ ext, got string }{{corpusMarkersExt, markers}, {corpusStrippedExt, stripped}} {
+			want, err := fs.ReadFile(fsys, path.Join(dir, name+golden.ext))
+			if err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("missing golden file %s", name+golden.ext))
+				continue
+			}
+			if golden.got != string(want) {
+				result.Problems = append(result.Problems, fmt.Sprintf("%s differs:\n%s", name+golden.ext, unifiedDiff(name+golden.ext, string(want), golden.got)))
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runSelftest implements "claudewatch selftest": it checks the embedded
+// corpus and reports any file whose markers were detected or removed
+// differently from the golden files. It returns the process exit code.
+func runSelftest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	verbose := flags.Bool("v", false, "List every corpus file, not just failures")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: claudewatch selftest [-v]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Check marker detection and removal against the built-in corpus of sample files.")
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	results, err := checkCorpus(corpusFS, corpusDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading corpus: %v\n", err)
+		return 2
+	}
+
+	failed := 0
+	for _, result := range results {
+		if len(result.Problems) == 0 {
+			if *verbose {
+				fmt.Printf("ok   %s\n", result.Name)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n", result.Name)
+		for _, problem := range result.Problems {
+			fmt.Printf("     %s\n", strings.ReplaceAll(strings.TrimRight(problem, "\n"), "\n", "\n     "))
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d corpus files failed\n", failed, len(results))
+		return 1
+	}
+	fmt.Printf("All %d corpus files passed\n", len(results))
+	return 0
+}
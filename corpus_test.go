@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var updateCorpus = flag.Bool("update-corpus", false, "Rewrite the corpus golden files from the current behavior")
+
+// TestCorpus checks marker detection and removal over testdata/corpus. After
+// an intended change in behavior, regenerate the golden files with
+// "go test -run TestCorpus -update-corpus" and review the diff.
+func TestCorpus(t *testing.T) {
+	if *updateCorpus {
+		names, err := corpusFiles(os.DirFS("."), corpusDir)
+		if err != nil {
+			t.Fatalf("corpusFiles: %v", err)
+		}
+		for _, name := range names {
+			content := readString(t, filepath.Join(corpusDir, name))
+			markers, stripped, err := scanCorpusFile(name, content)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for ext, golden := range map[string]string{corpusMarkersExt: markers, corpusStrippedExt: stripped} {
+				if err := os.WriteFile(filepath.Join(corpusDir, name+ext), []byte(golden), 0o644); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+		}
+	}
+
+	results, err := checkCorpus(os.DirFS("."), corpusDir)
+	if err != nil {
+		t.Fatalf("checkCorpus: %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("corpus is empty")
+	}
+	for _, result := range results {
+		for _, problem := range result.Problems {
+			t.Errorf("%s: %s", result.Name, problem)
+		}
+	}
+}
+
+func TestEmbeddedCorpusMatchesTestdata(t *testing.T) {
+	embedded, err := corpusFiles(corpusFS, corpusDir)
+	if err != nil {
+		t.Fatalf("corpusFiles: %v", err)
+	}
+	onDisk, err := corpusFiles(os.DirFS("."), corpusDir)
+	if err != nil {
+		t.Fatalf("corpusFiles: %v", err)
+	}
+	if len(embedded) != len(onDisk) {
+		t.Errorf("embedded corpus has %d files, testdata has %d", len(embedded), len(onDisk))
+	}
+}
+
+func TestCheckCorpusReportsRegressions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"c/a.go":          {Data: []byte("// fix ai!\nx := 1\n")},
+		"c/a.go.markers":  {Data: []byte("1 ai! edit\n")},
+		"c/a.go.stripped": {Data: []byte("// fix\nx := 1\n")},
+		"c/b.go":          {Data: []byte("// fix ai!\n")},
+		"c/b.go.markers":  {Data: []byte("1 ai? question\n")},
+	}
+
+	results, err := checkCorpus(fsys, "c")
+	if err != nil {
+		t.Fatalf("checkCorpus: %v", err)
+	}
+	if len(results) != 2 || len(results[0].Problems) != 0 {
+		t.Fatalf("results = %+v, want a.go to pass", results)
+	}
+	if len(results[1].Problems) != 2 {
+		t.Errorf("b.go problems = %q, want a marker mismatch and a missing .stripped", results[1].Problems)
+	}
+}
+
+func TestRunSelftest(t *testing.T) {
+	if code := runSelftest(nil); code != 0 {
+		t.Errorf("runSelftest() = %d, want 0", code)
+	}
+	if code := runSelftest([]string{"extra"}); code != 2 {
+		t.Errorf("runSelftest(extra) = %d, want 2", code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cwdTracker follows the working directory of the Claude process, which is
+// what relative paths in a prompt are resolved against. It reads it from
+// /proc, falling back to the directory claudewatch was started in when there
+// is no process to follow or /proc isn't available.
+type cwdTracker struct {
+	mu   sync.Mutex
+	pid  int
+	last string // Directory reported by the last call to check
+}
+
+// claudeCwd tracks the working directory of the Claude session prompts go to
+var claudeCwd = &cwdTracker{}
+
+// follow starts tracking the working directory of process pid
+func (c *cwdTracker) follow(pid int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pid = pid
+	c.last = ""
+}
+
+// dir returns the tracked process's current working directory
+func (c *cwdTracker) dir() string {
+	c.mu.Lock()
+	pid := c.pid
+	c.mu.Unlock()
+
+	if pid > 0 {
+		if dir, err := os.Readlink(filepath.Join(procRoot, strconv.Itoa(pid), "cwd")); err == nil {
+			return dir
+		}
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// check returns the tracked working directory along with the one the
+// previous check returned, which is empty the first time
+func (c *cwdTracker) check() (dir, previous string) {
+	dir = c.dir()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, c.last = c.last, dir
+	return dir, previous
+}
+
+// relativeTo returns path relative to dir when path lies inside dir, and as
+// an absolute path otherwise, where a relative path would have to climb out
+// of dir with "..".
+func relativeTo(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if dir == "" {
+		return abs
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
+
+// rootsOutside returns the roots that don't lie inside dir. Files under them
+// can only be named to a session running in dir by absolute path.
+func rootsOutside(dir string, roots []string) []string {
+	if dir == "" {
+		return nil
+	}
+	var outside []string
+	for _, root := range roots {
+		if filepath.IsAbs(relativeTo(dir, root)) {
+			outside = append(outside, root)
+		}
+	}
+	return outside
+}
+
+// warnCwdDrift checks Claude's working directory against the watched roots
+// the first time it is called and whenever the directory has changed since
+// (for example because the session was told to cd somewhere), warning about
+// roots outside it
+func warnCwdDrift(config *Config) {
+	dir, previous := claudeCwd.check()
+	if dir == previous {
+		return
+	}
+	debugLog(config, "Claude's working directory: %s", dir)
+	if previous != "" {
+		console.notice("Claude's working directory changed from %s to %s", previous, dir)
+	}
+	for _, root := range rootsOutside(dir, config.RootDirectories) {
+		console.warn("Watching %s, outside Claude's working directory %s; relPath gives absolute paths for its files", root, dir)
+	}
+}
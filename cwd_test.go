@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCwdTrackerFollowsProcess(t *testing.T) {
+	root := t.TempDir()
+	oldProcRoot := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = oldProcRoot })
+
+	first, second := t.TempDir(), t.TempDir()
+	link := filepath.Join(root, "42", "cwd")
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.Symlink(first, link); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+
+	tracker := &cwdTracker{}
+	tracker.follow(42)
+	if dir, previous := tracker.check(); dir != first || previous != "" {
+		t.Errorf("check() = %q, %q; want %q and no previous directory", dir, previous, first)
+	}
+
+	// The session changes directory
+	if err := os.Remove(link); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := os.Symlink(second, link); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	if dir, previous := tracker.check(); dir != second || previous != first {
+		t.Errorf("check() = %q, %q; want %q after %q", dir, previous, second, first)
+	}
+
+	// Without the process, it falls back to our own directory
+	tracker.follow(43)
+	cwd, _ := os.Getwd()
+	if got := tracker.dir(); got != cwd {
+		t.Errorf("dir() for a missing process = %q, want %q", got, cwd)
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	tests := []struct {
+		dir, path, want string
+	}{
+		{"/repo", "/repo/src/a.go", "src/a.go"},
+		{"/repo/src", "/repo/src/a.go", "a.go"},
+		{"/repo/src", "/repo/docs/b.md", "/repo/docs/b.md"},
+		{"/repo", "/repository/a.go", "/repository/a.go"},
+		{"/repo", "/repo/..x/a.go", "..x/a.go"},
+		{"", "/repo/a.go", "/repo/a.go"},
+	}
+
+	for _, tt := range tests {
+		if got := relativeTo(tt.dir, tt.path); got != tt.want {
+			t.Errorf("relativeTo(%q, %q) = %q, want %q", tt.dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRootsOutside(t *testing.T) {
+	roots := []string{"/repo", "/repo/api", "/other"}
+	if got, want := rootsOutside("/repo", roots), []string{"/other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rootsOutside(/repo) = %v, want %v", got, want)
+	}
+	if got, want := rootsOutside("/repo/api", roots), []string{"/repo", "/other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rootsOutside(/repo/api) = %v, want %v", got, want)
+	}
+}
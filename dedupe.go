@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// defaultDedupeWindow is how long a rendered prompt is remembered, so saving
+// a file again with the same instruction still in it doesn't send it twice.
+// It is off unless --dedupe-window is given, as typing the same instruction
+// again is usually meant.
+const defaultDedupeWindow time.Duration = 0
+
+// promptDedupe remembers the prompts rendered recently, by hash
+type promptDedupe struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[[sha256.Size]byte]time.Time
+}
+
+// newPromptDedupe returns a dedupe remembering prompts for window, or nil if
+// window is zero
+func newPromptDedupe(window time.Duration) *promptDedupe {
+	if window <= 0 {
+		return nil
+	}
+	return &promptDedupe{window: window, seen: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// duplicate reports when prompt was last seen, if that was within the window,
+// and otherwise records it as seen at now. A nil dedupe never finds one.
+func (d *promptDedupe) duplicate(prompt string, now time.Time) (time.Time, bool) {
+	if d == nil {
+		return time.Time{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for hash, at := range d.seen {
+		if now.Sub(at) >= d.window {
+			delete(d.seen, hash)
+		}
+	}
+	hash := sha256.Sum256([]byte(prompt))
+	if at, ok := d.seen[hash]; ok {
+		return at, true
+	}
+	d.seen[hash] = now
+	return time.Time{}, false
+}
+
+// forget drops prompt, so that after a failed delivery it can be sent again
+func (d *promptDedupe) forget(prompt string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	delete(d.seen, sha256.Sum256([]byte(prompt)))
+	d.mu.Unlock()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptDedupe(t *testing.T) {
+	now := time.Now()
+	d := newPromptDedupe(time.Minute)
+	if _, dup := d.duplicate("fix it", now); dup {
+		t.Fatal("first prompt reported as a duplicate")
+	}
+	if at, dup := d.duplicate("fix it", now.Add(30*time.Second)); !dup || !at.Equal(now) {
+		t.Errorf("duplicate() within the window = %v, %v; want the first sighting", at, dup)
+	}
+	if _, dup := d.duplicate("fix it", now.Add(2*time.Minute)); dup {
+		t.Error("prompt still a duplicate after the window")
+	}
+
+	d.forget("fix it")
+	if _, dup := d.duplicate("fix it", now.Add(2*time.Minute)); dup {
+		t.Error("forgotten prompt reported as a duplicate")
+	}
+
+	disabled := newPromptDedupe(0)
+	for i := 0; i < 2; i++ {
+		if _, dup := disabled.duplicate("fix it", now); dup {
+			t.Error("a disabled dedupe found a duplicate")
+		}
+	}
+}
+
+func TestProcessSkipsDuplicatePrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "package p\n// ai! rename this\n"
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := make(chan promptRequest, 2)
+	p := newFileProcessor(&Config{DedupeWindow: time.Minute}, newPromptResolver(tmpl, nil, nil), prompts)
+
+	for i := 0; i < 2; i++ {
+		// The marker is written back, as when the user undoes Claude's edit
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		p.cooldown.forget(path)
+		p.process(path)
+	}
+	if len(prompts) != 1 {
+		t.Fatalf("sent %d prompts, want the duplicate skipped", len(prompts))
+	}
+	if got := readString(t, path); got != content {
+		t.Errorf("content after the duplicate = %q, want its marker put back", got)
+	}
+
+	// After a failed delivery, the same prompt may be sent again
+	(<-prompts).Restore()
+	if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	p.cooldown.forget(path)
+	p.process(path)
+	if len(prompts) != 1 {
+		t.Error("prompt not sent again after a failed delivery")
+	}
+}
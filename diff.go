@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// diffOp is one line of an edit script
+type diffOp struct {
+	kind byte // ' ' (unchanged), '-' (removed) or '+' (added)
+	text string
+}
+
+// diffLines computes a line edit script turning a into b. Common leading and
+// trailing lines are peeled off first, so the quadratic LCS only runs over the
+// changed region, which for marker removal is a handful of lines.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			ops = append(ops, diffOp{' ', midA[i]})
+			i++
+			j++
+		case i < len(midA) && (j == len(midB) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', midA[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', midB[j]})
+			j++
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// unifiedDiff renders the changes from oldContent to newContent as a unified
+// diff labelled with path. It returns an empty string when nothing changed.
+func unifiedDiff(path, oldContent, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+	ops := diffLines(strings.Split(oldContent, "\n"), strings.Split(newContent, "\n"))
+
+	// oldNo[i] and newNo[i] are the line numbers at which ops[i] sits
+	oldNo := make([]int, len(ops)+1)
+	newNo := make([]int, len(ops)+1)
+	oldNo[0], newNo[0] = 1, 1
+	for i, op := range ops {
+		oldNo[i+1], newNo[i+1] = oldNo[i], newNo[i]
+		if op.kind != '+' {
+			oldNo[i+1]++
+		}
+		if op.kind != '-' {
+			newNo[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", path, path)
+
+	// Emit a hunk for each run of changes plus its surrounding context,
+	// merging runs whose context would overlap.
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		end := i + 1
+		for j := end; j < len(ops) && j-end <= 2*diffContextLines; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+
+		hunkStart := max(i-diffContextLines, 0)
+		hunkEnd := min(end+diffContextLines, len(ops))
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n",
+			oldNo[hunkStart], oldNo[hunkEnd]-oldNo[hunkStart],
+			newNo[hunkStart], newNo[hunkEnd]-newNo[hunkStart])
+		for _, op := range ops[hunkStart:hunkEnd] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		i = hunkEnd
+	}
+
+	return out.String()
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "No changes",
+			old:  "a\nb",
+			new:  "a\nb",
+			want: "",
+		},
+		{
+			name: "Single changed line with context",
+			old:  "1\n2\n3\n4\n// fix ai!\n6\n7\n8\n9",
+			new:  "1\n2\n3\n4\n// fix\n6\n7\n8\n9",
+			want: "--- f.go\n+++ f.go\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-// fix ai!\n+// fix\n 6\n 7\n 8\n",
+		},
+		{
+			name: "Nearby changes merge into one hunk",
+			old:  "a ai!\nb\nc ai!",
+			new:  "a\nb\nc",
+			want: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n-a ai!\n+a\n b\n-c ai!\n+c\n",
+		},
+		{
+			name: "Distant changes get separate hunks",
+			old:  "x ai!\n1\n2\n3\n4\n5\n6\n7\ny ai!",
+			new:  "x\n1\n2\n3\n4\n5\n6\n7\ny",
+			want: "--- f.go\n+++ f.go\n@@ -1,4 +1,4 @@\n-x ai!\n+x\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-y ai!\n+y\n",
+		},
+		{
+			name: "Deleted line",
+			old:  "a\n// ai!\nb",
+			new:  "a\nb",
+			want: "--- f.go\n+++ f.go\n@@ -1,3 +1,2 @@\n a\n-// ai!\n b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f.go", tt.old, tt.new); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
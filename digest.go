@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DigestConfig configures --digest, under "digest" in the config file
+type DigestConfig struct {
+	// Schedule lists when held prompts are sent, as cron expressions
+	// ("minute hour day-of-month month day-of-week", in local time) or
+	// @hourly, @daily or @weekly
+	Schedule []string `json:"schedule"`
+	// Webhook is a URL the summary of each batch is POSTed to, as JSON
+	Webhook string `json:"webhook"`
+	// Command is run with the summary of each batch on stdin, e.g. to mail it
+	Command string `json:"command"`
+}
+
+// digestLogName is the log of batch summaries inside the state directory
+const digestLogName = "digest.log"
+
+// digestWebhookTimeout bounds how long posting a summary may take
+var digestWebhookTimeout = 10 * time.Second
+
+// cronAliases are the shorthand schedules accepted in place of an expression
+var cronAliases = map[string]string{
+	"@hourly": "0 * * * *",
+	"@daily":  "0 0 * * *",
+	"@weekly": "0 0 * * 0",
+}
+
+// cronSchedule is a parsed cron expression: the values each field allows
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool // The day fields were "*"
+}
+
+// parseCron parses a five-field cron expression. Fields take "*", numbers,
+// ranges ("1-5"), steps ("*/15", "8-18/2") and comma-separated lists; day of
+// week runs from 0 (Sunday) to 6, with 7 also meaning Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	if alias, ok := cronAliases[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q: want 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := [5]string{"minute", "hour", "day of month", "month", "day of week"}
+	var sets [5]map[int]bool
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s: %w", expr, names[i], err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField returns the values a cron field allows, within [lo, hi]
+func parseCronField(field string, lo, hi int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad step %q", stepPart)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("bad value %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("bad value %q", part)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matches reports whether the schedule fires in the minute of t. As in cron,
+// a day matches if either day field allows it when both are restricted.
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	domOK, dowOK := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny:
+		return dowOK
+	case c.dowAny:
+		return domOK
+	}
+	return domOK || dowOK
+}
+
+// next returns the first minute after t the schedule fires in, or the zero
+// time if it doesn't within a year (e.g. "0 0 31 2 *")
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(1, 0, 1); t.Before(limit); t = t.Add(time.Minute) {
+		if c.matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// digestPlan implements --digest: prompts are held and sent in batches on a
+// schedule, and a summary of each batch is logged and passed on
+type digestPlan struct {
+	schedules []*cronSchedule
+	webhook   string
+	command   string
+	logPath   string
+}
+
+// compileDigest checks the digest settings from the config file, which
+// --digest requires
+func compileDigest(fileConfig *FileConfig) (*digestPlan, error) {
+	if fileConfig == nil || fileConfig.Digest == nil || len(fileConfig.Digest.Schedule) == 0 {
+		return nil, fmt.Errorf("--digest needs a digest.schedule in the config file")
+	}
+	plan := &digestPlan{
+		webhook: strings.TrimSpace(fileConfig.Digest.Webhook),
+		command: strings.TrimSpace(fileConfig.Digest.Command),
+	}
+	for _, expr := range fileConfig.Digest.Schedule {
+		schedule, err := parseCron(expr)
+		if err != nil {
+			return nil, fmt.Errorf("digest.schedule: %w", err)
+		}
+		plan.schedules = append(plan.schedules, schedule)
+	}
+	return plan, nil
+}
+
+// startDigest makes dispatch hold prompts for the digest batches, when
+// --digest is set
+func startDigest(dispatch *dispatcher, config *Config) {
+	if config.Digest == nil {
+		return
+	}
+	dispatch.holding = true
+	go config.Digest.run(config, dispatch)
+}
+
+// next returns when the next batch is due after t, or the zero time if never
+func (g *digestPlan) next(t time.Time) time.Time {
+	var earliest time.Time
+	for _, schedule := range g.schedules {
+		if at := schedule.next(t); !at.IsZero() && (earliest.IsZero() || at.Before(earliest)) {
+			earliest = at
+		}
+	}
+	return earliest
+}
+
+// run sends the prompts dispatch holds at each scheduled time, for as long as
+// claudewatch runs
+func (g *digestPlan) run(config *Config, dispatch *dispatcher) {
+	for {
+		at := g.next(time.Now())
+		if at.IsZero() {
+			console.warn("claudewatch: the digest schedule never fires; held prompts won't be sent")
+			return
+		}
+		console.notice("claudewatch: holding prompts for the next digest batch at %s", at.Format("Mon Jan 2 15:04"))
+		time.Sleep(time.Until(at))
+
+		results := dispatch.deliverBatch()
+		if len(results) == 0 {
+			infoLog(config, "Digest batch at %s: nothing to send", at.Format("15:04"))
+			continue
+		}
+		g.report(config, results, at)
+	}
+}
+
+// batchResult is how the delivery of one prompt of a batch went
+type batchResult struct {
+	req promptRequest
+	err error
+}
+
+// digestSummary is the summary of a batch, as POSTed to the webhook. Text
+// holds the same summary as plain text, which chat webhooks display as is.
+type digestSummary struct {
+	Time    time.Time      `json:"time"`
+	Sent    int            `json:"sent"`
+	Failed  int            `json:"failed"`
+	Prompts []digestPrompt `json:"prompts"`
+	Text    string         `json:"text"`
+}
+
+// digestPrompt is one prompt in a digestSummary
+type digestPrompt struct {
+	File  string `json:"file,omitempty"` // Empty for a reset from a signal
+	Title string `json:"title"`          // The prompt's first line
+	Error string `json:"error,omitempty"`
+}
+
+// summarize builds the summary of a batch sent at
+func summarize(results []batchResult, at time.Time) digestSummary {
+	summary := digestSummary{Time: at}
+	var text strings.Builder
+	for _, result := range results {
+		prompt := digestPrompt{File: result.req.File, Title: firstLine(result.req.Prompt)}
+		status := "sent"
+		if result.err != nil {
+			prompt.Error = result.err.Error()
+			status = "FAILED"
+			summary.Failed++
+		} else {
+			summary.Sent++
+		}
+		summary.Prompts = append(summary.Prompts, prompt)
+
+		fmt.Fprintf(&text, "- %s", status)
+		if prompt.File != "" {
+			fmt.Fprintf(&text, " (%s)", prompt.File)
+		}
+		fmt.Fprintf(&text, ": %s\n", prompt.Title)
+		if prompt.Error != "" {
+			fmt.Fprintf(&text, "  %s\n", prompt.Error)
+		}
+	}
+	summary.Text = fmt.Sprintf("claudewatch digest %s: %d sent, %d failed\n\n%s", at.Format("2006-01-02 15:04"), summary.Sent, summary.Failed, text.String())
+	return summary
+}
+
+// report logs the summary of a batch and passes it to the webhook and
+// command. Failures to pass it on are warnings; the batch itself went out.
+func (g *digestPlan) report(config *Config, results []batchResult, at time.Time) {
+	summary := summarize(results, at)
+	console.notice("claudewatch: digest batch sent (%d sent, %d failed)", summary.Sent, summary.Failed)
+
+	if g.logPath == "" {
+		if stateDir, err := ensureStateDir(); err == nil {
+			g.logPath = filepath.Join(stateDir, digestLogName)
+		}
+	}
+	if g.logPath != "" {
+		if err := appendFile(g.logPath, summary.Text+"\n"); err != nil {
+			console.warn("Could not write the digest log: %v", err)
+		}
+	}
+
+	if g.webhook != "" {
+		infoLog(config, "Posting the digest summary to %s", g.webhook)
+		if err := postDigest(g.webhook, summary); err != nil {
+			console.warn("Could not post the digest summary: %v", err)
+		}
+	}
+	if g.command != "" {
+		infoLog(config, "Running digest command: %s", g.command)
+		cmd := exec.Command("sh", "-c", g.command)
+		cmd.Stdin = strings.NewReader(summary.Text)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			console.warn("Digest command %q failed: %v: %s", g.command, err, strings.TrimSpace(string(output)))
+		}
+	}
+}
+
+// postDigest POSTs summary to url as JSON
+func postDigest(url string, summary digestSummary) error {
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: digestWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return nil
+}
+
+// appendFile appends text to the file at path, creating it if needed
+func appendFile(path, text string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Friday, 10:17
+	from := time.Date(2026, 10, 16, 10, 17, 30, 0, time.Local)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 10, 18, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 10, 30, 0, 0, time.Local)},
+		{"@hourly", time.Date(2026, 10, 16, 11, 0, 0, 0, time.Local)},
+		{"@daily", time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)},
+		{"0 2 * * 1-5", time.Date(2026, 10, 19, 2, 0, 0, 0, time.Local)},
+		{"0 9 * * 7", time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local)},
+		{"30 8 1,20 * *", time.Date(2026, 10, 20, 8, 30, 0, 0, time.Local)},
+		// With both day fields restricted, either may match
+		{"0 0 1 * 6", time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := schedule.next(from); !got.Equal(tt.want) {
+			t.Errorf("next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileDigest(t *testing.T) {
+	if _, err := compileDigest(&FileConfig{}); err == nil {
+		t.Error("compileDigest without a schedule succeeded, want an error")
+	}
+	if _, err := compileDigest(&FileConfig{Digest: &DigestConfig{Schedule: []string{"0 25 * * *"}}}); err == nil {
+		t.Error("compileDigest with a bad schedule succeeded, want an error")
+	}
+
+	plan, err := compileDigest(&FileConfig{Digest: &DigestConfig{Schedule: []string{"0 22 * * *", "0 12 * * *"}}})
+	if err != nil {
+		t.Fatalf("compileDigest: %v", err)
+	}
+	from := time.Date(2026, 10, 16, 10, 0, 0, 0, time.Local)
+	if got := plan.next(from); got.Hour() != 12 {
+		t.Errorf("next batch at %v, want the earliest schedule's 12:00", got)
+	}
+}
+
+func TestDispatcherHoldsPromptsForBatch(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, holding: true}
+
+	d.enqueue(promptRequest{Prompt: "low", Priority: priorityLow})
+	d.enqueue(promptRequest{Prompt: "high", Priority: priorityHigh})
+	if err := d.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(primary.prompts) != 0 {
+		t.Fatalf("prompts sent before the batch: %q", primary.prompts)
+	}
+
+	d.paused = true
+	if results := d.deliverBatch(); len(results) != 0 {
+		t.Errorf("a batch while paused sent %d prompts", len(results))
+	}
+	d.paused = false
+
+	results := d.deliverBatch()
+	if len(results) != 2 || strings.Join(primary.prompts, ",") != "high,low" {
+		t.Errorf("batch sent %q, want high,low", primary.prompts)
+	}
+	if results := d.deliverBatch(); len(results) != 0 {
+		t.Errorf("second batch sent %d prompts, want none", len(results))
+	}
+}
+
+func TestDigestReport(t *testing.T) {
+	var posted digestSummary
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Errorf("decoding the posted summary: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	mailed := filepath.Join(dir, "mailed")
+	plan := &digestPlan{
+		webhook: server.URL,
+		command: "cat > " + mailed,
+		logPath: filepath.Join(dir, digestLogName),
+	}
+	results := []batchResult{
+		{req: promptRequest{Prompt: "Modify a.go. Address this\nmore", File: "a.go"}},
+		{req: promptRequest{Prompt: "Answer b.py", File: "b.py"}, err: errors.New("pty closed")},
+	}
+	plan.report(&Config{}, results, time.Date(2026, 10, 17, 2, 0, 0, 0, time.Local))
+
+	if posted.Sent != 1 || posted.Failed != 1 || len(posted.Prompts) != 2 || posted.Prompts[1].Error != "pty closed" {
+		t.Errorf("posted summary = %+v", posted)
+	}
+	text := readString(t, mailed)
+	for _, want := range []string{"1 sent, 1 failed", "- sent (a.go): Modify a.go. Address this\n", "- FAILED (b.py): Answer b.py\n  pty closed"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("summary %q doesn't contain %q", text, want)
+		}
+	}
+	if log := readString(t, plan.logPath); log != text+"\n" {
+		t.Errorf("digest log = %q, want the summary", log)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// What to do when an edit would land on top of uncommitted changes to other
+// files, as set by dirty_tree in the config file or --require-clean
+const (
+	dirtyTreeWarn  = "warn"  // Send the prompt, with a warning (the default)
+	dirtyTreeBlock = "block" // Leave the markers in place and send nothing
+	dirtyTreeOff   = "off"   // Don't check
+)
+
+// dirtyTreeMode returns what to do about a dirty working tree: block with
+// --require-clean, else the config file's dirty_tree, else warn
+func dirtyTreeMode(fileConfig *FileConfig, requireClean bool) (string, error) {
+	if requireClean {
+		return dirtyTreeBlock, nil
+	}
+	if fileConfig == nil || fileConfig.DirtyTree == "" {
+		return dirtyTreeWarn, nil
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(fileConfig.DirtyTree)); mode {
+	case dirtyTreeWarn, dirtyTreeBlock, dirtyTreeOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("dirty_tree: unknown setting %q (want warn, block or off)", fileConfig.DirtyTree)
+}
+
+// unrelatedChanges lists the uncommitted changes (staged, unstaged or
+// untracked) in the repository holding files, other than to files
+// themselves, by path relative to the top of the repository. claudewatch's
+// own state is left out. It is empty outside a repository.
+func unrelatedChanges(files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var roots gitRoots
+	root, err := roots.lookup(filepath.Dir(files[0]))
+	if err != nil || root == "" {
+		return nil, err
+	}
+	related := make(map[string]bool)
+	for _, file := range files {
+		if rel, ok := repoRelative(root, file); ok {
+			related[rel] = true
+		}
+	}
+
+	status, err := git(root, nil, "status", "--porcelain", "--untracked-files=normal")
+	if err != nil {
+		return nil, err
+	}
+	var changes []string
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		path := line[3:]
+		if _, to, renamed := strings.Cut(path, " -> "); renamed {
+			path = to
+		}
+		path = strings.Trim(path, `"`)
+		if related[path] || strings.HasPrefix(filepath.Base(path), stateDirName) {
+			continue
+		}
+		changes = append(changes, path)
+	}
+	return changes, nil
+}
+
+// repoRelative returns path relative to the repository at root, seeing
+// through symlinks on either side (such as /tmp on macOS)
+func repoRelative(root, path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// allowedOnTree checks the working tree before edit prompts rendered from
+// from are sent, warning about other uncommitted changes or, in block mode,
+// refusing to send. Questions don't edit, so they are always allowed.
+func (p *fileProcessor) allowedOnTree(from []pendingPrompt) bool {
+	mode := p.config.DirtyTree
+	if mode == "" || mode == dirtyTreeOff {
+		return true
+	}
+	var files []string
+	for _, pending := range from {
+		if claudewatch.IsEdit(pending.data.Type) {
+			files = append(files, pending.path)
+		}
+	}
+	if len(files) == 0 {
+		return true
+	}
+	changes, err := unrelatedChanges(files)
+	if err != nil {
+		warnLog(p.config, "Could not check the working tree: %v", err)
+		return true
+	}
+	if len(changes) == 0 {
+		return true
+	}
+
+	listed := strings.Join(changes, ", ")
+	if len(changes) > 5 {
+		listed = strings.Join(changes[:5], ", ") + fmt.Sprintf(" and %d more", len(changes)-5)
+	}
+	if mode == dirtyTreeBlock {
+		console.warn("Not sending %s: there are uncommitted changes to other files (%s); commit or stash them first", strings.Join(files, ", "), listed)
+		return false
+	}
+	console.warn("Claude's edits to %s will mix with uncommitted changes to other files (%s)", strings.Join(files, ", "), listed)
+	return true
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestDirtyTreeMode(t *testing.T) {
+	tests := []struct {
+		setting      string
+		requireClean bool
+		want         string
+		wantErr      bool
+	}{
+		{"", false, dirtyTreeWarn, false},
+		{"block", false, dirtyTreeBlock, false},
+		{" Off ", false, dirtyTreeOff, false},
+		{"off", true, dirtyTreeBlock, false},
+		{"sometimes", false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := dirtyTreeMode(&FileConfig{DirtyTree: tt.setting}, tt.requireClean)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("dirtyTreeMode(%q, %v) = %q, %v; want %q", tt.setting, tt.requireClean, got, err, tt.want)
+		}
+	}
+	if got, err := dirtyTreeMode(nil, false); got != dirtyTreeWarn || err != nil {
+		t.Errorf("dirtyTreeMode(nil) = %q, %v; want warn", got, err)
+	}
+}
+
+func TestUnrelatedChanges(t *testing.T) {
+	dir := gitRepo(t)
+	file := filepath.Join(dir, "main.go")
+
+	// The marker's own file doesn't count
+	writeTestFile(t, file, "package main\n\n// stripped\n")
+	if changes, err := unrelatedChanges([]string{file}); err != nil || len(changes) != 0 {
+		t.Errorf("unrelatedChanges with only the file changed = %v, %v; want none", changes, err)
+	}
+
+	// Other edits, untracked files and staged work do; claudewatch's state doesn't
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "mine\n")
+	writeTestFile(t, filepath.Join(dir, ".claudewatchdebug"), "Debug: x\n")
+	if err := os.MkdirAll(filepath.Join(dir, ".claudewatch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, ".claudewatch", "transcript.log"), "x\n")
+	changes, err := unrelatedChanges([]string{file})
+	if err != nil || !reflect.DeepEqual(changes, []string{"notes.txt"}) {
+		t.Errorf("unrelatedChanges = %v, %v; want [notes.txt]", changes, err)
+	}
+
+	p := &fileProcessor{config: &Config{DirtyTree: dirtyTreeBlock}}
+	edit := []pendingPrompt{{path: file, data: TemplateData{Type: claudewatch.TypeEdit}}}
+	question := []pendingPrompt{{path: file, data: TemplateData{Type: claudewatch.TypeQuestion}}}
+	if p.allowedOnTree(edit) {
+		t.Error("allowedOnTree let an edit through in block mode")
+	}
+	if !p.allowedOnTree(question) {
+		t.Error("allowedOnTree blocked a question")
+	}
+	p.config.DirtyTree = dirtyTreeWarn
+	if !p.allowedOnTree(edit) {
+		t.Error("allowedOnTree blocked an edit in warn mode")
+	}
+}
+
+func TestRefusedPromptIsNotDeduped(t *testing.T) {
+	dir := gitRepo(t)
+	file := filepath.Join(dir, "main.go")
+	notes := filepath.Join(dir, "notes.txt")
+	writeTestFile(t, notes, "mine\n")
+
+	prompts := make(chan promptRequest, 1)
+	p := newFileProcessor(&Config{DirtyTree: dirtyTreeBlock, DedupeWindow: time.Minute}, nil, prompts)
+	from := []pendingPrompt{{path: file, data: TemplateData{Type: claudewatch.TypeEdit}}}
+	restored := 0
+	restore := func() { restored++ }
+
+	p.queue(file, "use a map", nil, restore, nil, priorityNormal, from)
+	if restored != 1 || len(prompts) != 0 {
+		t.Fatalf("on a dirty tree: restored %d times, %d prompts queued; want the markers put back and nothing sent", restored, len(prompts))
+	}
+
+	// Once the tree is clean, saving again sends the same prompt
+	if err := os.Remove(notes); err != nil {
+		t.Fatal(err)
+	}
+	p.queue(file, "use a map", nil, restore, nil, priorityNormal, from)
+	if len(prompts) != 1 {
+		t.Errorf("the prompt refused on a dirty tree was skipped as a duplicate once the tree was clean")
+	}
+}
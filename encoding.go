@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// inputEncoding is how a rendered prompt is typed into an interactive CLI's
+// input box. Claude Code submits on Enter and treats some characters
+// specially, so a multi-paragraph prompt typed as-is can arrive as several
+// messages.
+type inputEncoding string
+
+const (
+	// encodingBracketedPaste wraps the prompt in bracketed-paste escapes so the
+	// CLI takes it as one pasted block, newlines included
+	encodingBracketedPaste inputEncoding = "bracketed-paste"
+	// encodingBackslashNewline types each newline as backslash-Enter, the CLI's
+	// keyboard convention for a line break that doesn't submit
+	encodingBackslashNewline inputEncoding = "backslash-newline"
+	// encodingSingleLine joins the prompt's lines with spaces
+	encodingSingleLine inputEncoding = "single-line"
+	// encodingRaw types the prompt exactly as rendered
+	encodingRaw inputEncoding = "raw"
+)
+
+// defaultInputEncoding is used unless the config file or --input-encoding says otherwise
+const defaultInputEncoding = encodingBracketedPaste
+
+// Bracketed paste start and end sequences
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// parseInputEncoding validates an encoding name
+func parseInputEncoding(name string) (inputEncoding, error) {
+	switch e := inputEncoding(strings.ToLower(strings.TrimSpace(name))); e {
+	case encodingBracketedPaste, encodingBackslashNewline, encodingSingleLine, encodingRaw:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown input encoding %q (want %s, %s, %s or %s)", name,
+		encodingBracketedPaste, encodingBackslashNewline, encodingSingleLine, encodingRaw)
+}
+
+// encode converts prompt into the keystrokes to type. The Enter that submits
+// the prompt is not included.
+func (e inputEncoding) encode(prompt string) string {
+	prompt = strings.ReplaceAll(prompt, "\r\n", "\n")
+	switch e {
+	case encodingBracketedPaste:
+		// An escape inside the prompt could end the paste early
+		return pasteStart + strings.ReplaceAll(prompt, "\x1b", "") + pasteEnd
+	case encodingBackslashNewline:
+		return strings.ReplaceAll(prompt, "\n", "\\\r")
+	case encodingSingleLine:
+		return strings.Join(strings.Fields(prompt), " ")
+	}
+	return prompt
+}
+
+// InputEncodingConfig selects the input encoding in the config file, by CLI version
+type InputEncodingConfig struct {
+	// Default is the encoding for versions not listed in Versions
+	Default string `json:"default"`
+
+	// Versions maps version prefixes (e.g. "1.0" for 1.0.x) to encodings.
+	// The longest matching prefix wins.
+	Versions map[string]string `json:"versions"`
+}
+
+// resolveInputEncoding picks the encoding to use. An explicit --input-encoding
+// wins; otherwise the config file's entry for the CLI's version (found with
+// version, only called when the config lists versions), then its default.
+func resolveInputEncoding(flagValue string, configured *InputEncodingConfig, version func() string) (inputEncoding, error) {
+	if flagValue != "" {
+		return parseInputEncoding(flagValue)
+	}
+	if configured == nil {
+		return defaultInputEncoding, nil
+	}
+
+	if len(configured.Versions) > 0 {
+		prefixes := make([]string, 0, len(configured.Versions))
+		for prefix := range configured.Versions {
+			prefixes = append(prefixes, prefix)
+		}
+		// Longest first, so "1.0.3" beats "1.0"
+		sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+		if v := version(); v != "" {
+			for _, prefix := range prefixes {
+				if versionHasPrefix(v, prefix) {
+					return parseInputEncoding(configured.Versions[prefix])
+				}
+			}
+		}
+	}
+
+	if configured.Default != "" {
+		return parseInputEncoding(configured.Default)
+	}
+	return defaultInputEncoding, nil
+}
+
+// versionHasPrefix reports whether version falls under prefix, component-wise:
+// "1.0" covers "1.0" and "1.0.17" but not "1.01"
+func versionHasPrefix(version, prefix string) bool {
+	return version == prefix || strings.HasPrefix(version, strings.TrimSuffix(prefix, ".")+".")
+}
+
+// versionPattern finds a dotted version number in --version output
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// cliVersion runs "command --version" and returns the version number it
+// reports, or an empty string if it can't be determined
+func cliVersion(command string) string {
+	out, err := exec.Command(command, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return versionPattern.FindString(string(out))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInputEncodingEncode(t *testing.T) {
+	prompt := "Fix this:\n\nLine 3: // use a map\r\n"
+	tests := []struct {
+		encoding inputEncoding
+		want     string
+	}{
+		{encodingBracketedPaste, "\x1b[200~Fix this:\n\nLine 3: // use a map\n\x1b[201~"},
+		{encodingBackslashNewline, "Fix this:\\\r\\\rLine 3: // use a map\\\r"},
+		{encodingSingleLine, "Fix this: Line 3: // use a map"},
+		{encodingRaw, "Fix this:\n\nLine 3: // use a map\n"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.encoding.encode(prompt); got != tt.want {
+			t.Errorf("%s.encode() = %q, want %q", tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestBracketedPasteDropsEscapes(t *testing.T) {
+	got := encodingBracketedPaste.encode("a\x1b[201~b")
+	if got != pasteStart+"a[201~b"+pasteEnd {
+		t.Errorf("encode() = %q, want the embedded paste end defused", got)
+	}
+}
+
+func TestParseInputEncoding(t *testing.T) {
+	if e, err := parseInputEncoding(" Bracketed-Paste "); err != nil || e != encodingBracketedPaste {
+		t.Errorf("parseInputEncoding() = %q, %v; want bracketed-paste", e, err)
+	}
+	if _, err := parseInputEncoding("base64"); err == nil {
+		t.Error("parseInputEncoding() accepted an unknown encoding")
+	}
+}
+
+func TestResolveInputEncoding(t *testing.T) {
+	versionCalls := 0
+	version := func(v string) func() string {
+		return func() string {
+			versionCalls++
+			return v
+		}
+	}
+	configured := &InputEncodingConfig{
+		Default:  "raw",
+		Versions: map[string]string{"0": "single-line", "0.2": "backslash-newline"},
+	}
+
+	tests := []struct {
+		name       string
+		flag       string
+		configured *InputEncodingConfig
+		version    string
+		want       inputEncoding
+	}{
+		{"built-in default", "", nil, "1.0.17", defaultInputEncoding},
+		{"flag wins", "single-line", configured, "0.2.9", encodingSingleLine},
+		{"longest version prefix", "", configured, "0.2.9", encodingBackslashNewline},
+		{"shorter version prefix", "", configured, "0.3.1", encodingSingleLine},
+		{"prefix is per component", "", configured, "0.25.0", encodingSingleLine},
+		{"unlisted version", "", configured, "1.0.17", encodingRaw},
+		{"unknown version", "", configured, "", encodingRaw},
+		{"config without default", "", &InputEncodingConfig{}, "1.0.17", defaultInputEncoding},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveInputEncoding(tt.flag, tt.configured, version(tt.version))
+		if err != nil || got != tt.want {
+			t.Errorf("%s: resolveInputEncoding() = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	versionCalls = 0
+	if _, err := resolveInputEncoding("", &InputEncodingConfig{Default: "raw"}, version("1.0")); err != nil || versionCalls != 0 {
+		t.Errorf("resolveInputEncoding() looked up the CLI version %d times without per-version settings", versionCalls)
+	}
+	if _, err := resolveInputEncoding("", &InputEncodingConfig{Versions: map[string]string{"1": "nope"}}, version("1.0")); err == nil {
+		t.Error("resolveInputEncoding() accepted an unknown encoding for a version")
+	}
+}
+
+func TestPTYBackendEncodesPrompt(t *testing.T) {
+	var pty bytes.Buffer
+	b := &ptyBackend{pty: &pty, config: &Config{InputEncoding: encodingBracketedPaste}}
+	if err := b.Send("one\n\ntwo"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got, want := pty.String(), pasteStart+"one\n\ntwo"+pasteEnd+"\r"; got != want {
+		t.Errorf("PTY received %q, want %q", got, want)
+	}
+}
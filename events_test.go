@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// chanBackend delivers prompts to a channel
+type chanBackend chan string
+
+func (b chanBackend) Name() string { return "chan" }
+
+func (b chanBackend) Send(prompt string) error {
+	b <- prompt
+	return nil
+}
+
+// startWatching runs the event loop over root, returning the watcher and the
+// channel prompts are delivered to. Everything is shut down when the test ends.
+func startWatching(t *testing.T, root string) (fileWatcher, chanBackend) {
+	t.Helper()
+	chdir(t, t.TempDir()) // The instruction pipe goes in the state directory
+	config := &Config{RootDirectories: []string{root}}
+	watcher, err := newFileWatcher(config)
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+	if err := watchDirectory(watcher, root, config, false); err != nil {
+		t.Fatalf("watchDirectory: %v", err)
+	}
+
+	delivered := make(chanBackend, 4)
+	prompts := make(chan promptRequest)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	processor := newFileProcessor(config, resolver, prompts)
+	dispatch := &dispatcher{primary: delivered}
+
+	done := make(chan struct{})
+	go func() {
+		watchAndDispatch(config, watcher, processor, dispatch, nil, prompts)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		watcher.Close()
+		close(prompts)
+		<-done
+	})
+	return watcher, delivered
+}
+
+// waitForPrompt returns the next prompt delivered, failing the test if none
+// arrives in time
+func waitForPrompt(t *testing.T, delivered chanBackend) string {
+	t.Helper()
+	select {
+	case prompt := <-delivered:
+		return prompt
+	case <-time.After(5 * time.Second):
+		t.Fatal("no prompt was sent")
+		return ""
+	}
+}
+
+func TestEventsChmodOnlySave(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "a.go")
+	if err := os.WriteFile(path, []byte("// fix this ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, delivered := startWatching(t, root)
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	if prompt := waitForPrompt(t, delivered); !strings.HasSuffix(prompt, "a.go") {
+		t.Errorf("prompt = %q, want one for a.go", prompt)
+	}
+}
+
+func TestEventsDirectoryMovedIn(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "pkg")
+	if err := os.MkdirAll(filepath.Join(outside, "sub"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "sub", "b.go"), []byte("// fix this ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	watcher, delivered := startWatching(t, root)
+
+	if err := os.Rename(outside, filepath.Join(root, "pkg")); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if prompt := waitForPrompt(t, delivered); !strings.HasSuffix(prompt, filepath.Join("pkg", "sub", "b.go")) {
+		t.Errorf("prompt = %q, want one for pkg/sub/b.go", prompt)
+	}
+
+	// Moving it out again stops the watches under the old name
+	if err := os.Rename(filepath.Join(root, "pkg"), filepath.Join(t.TempDir(), "gone")); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		watched := false
+		for _, path := range watcher.WatchList() {
+			if strings.HasPrefix(path, filepath.Join(root, "pkg")) {
+				watched = true
+			}
+		}
+		if !watched {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still watching %v after the directory moved away", watcher.WatchList())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventsFileReplacedByRename(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "c.go")
+	if err := os.WriteFile(path, []byte("package c\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, delivered := startWatching(t, root)
+
+	// Save the way Vim does without backupcopy: move the original aside,
+	// then write the new content under the original name
+	if err := os.Rename(path, path+"~"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("// fix this ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if prompt := waitForPrompt(t, delivered); !strings.HasSuffix(prompt, "c.go") {
+		t.Errorf("prompt = %q, want one for c.go", prompt)
+	}
+}
+
+func TestUnwatchTree(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "ab"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	watcher, err := newFileWatcher(&Config{})
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watchDirectory(watcher, root, &Config{}, false); err != nil {
+		t.Fatalf("watchDirectory: %v", err)
+	}
+
+	unwatchTree(watcher, filepath.Join(root, "a"))
+	got := strings.Join(watcher.WatchList(), ",")
+	if strings.Contains(got, filepath.Join(root, "a", "b")) || !strings.Contains(got, filepath.Join(root, "ab")) {
+		t.Errorf("watch list = %s, want a and a/b removed and ab kept", got)
+	}
+}
+
+func TestEventsDirectoryMovedWithinTree(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "sub"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	_, delivered := startWatching(t, root)
+
+	if err := os.Rename(filepath.Join(root, "a"), filepath.Join(root, "b")); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	// Files written under the new name afterwards are still seen
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "b", "sub", "x.go"), []byte("// fix this ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if prompt := waitForPrompt(t, delivered); !strings.HasSuffix(prompt, filepath.Join("b", "sub", "x.go")) {
+		t.Errorf("prompt = %q, want one for b/sub/x.go", prompt)
+	}
+}
+
+func TestEventsRootRemovedAndRecreated(t *testing.T) {
+	interval := rootPollInterval
+	rootPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { rootPollInterval = interval })
+
+	root := filepath.Join(t.TempDir(), "root")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	_, delivered := startWatching(t, root)
+
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "x.go"), []byte("// fix this ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if prompt := waitForPrompt(t, delivered); !strings.HasSuffix(prompt, "x.go") {
+		t.Errorf("prompt = %q, want one for x.go in the recreated root", prompt)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Events written to --event-socket
+const (
+	eventMarker = "marker" // A marker was found in a saved file
+	eventSent   = "sent"   // A prompt was typed into (or sent to) a session
+	eventIdle   = "idle"   // Claude has answered, and no prompt is waiting
+)
+
+// eventClientBuffer is how many events may wait for a slow client before it
+// is disconnected, so one stuck editor never holds up the others
+const eventClientBuffer = 256
+
+// editorEvent is one line of newline-delimited JSON on the event socket
+type editorEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+
+	// A marker event's marker, as it was in the file when it was saved
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	Text string `json:"text,omitempty"`
+	Type string `json:"type,omitempty"`
+
+	// A sent event's prompt number and markers, at the lines they are on
+	// once stripped
+	Prompt  int          `json:"prompt,omitempty"`
+	Markers []markerSite `json:"markers,omitempty"`
+}
+
+// markerSite is where a prompt's marker is, for editors to badge the line
+type markerSite struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// eventSocket implements --event-socket: a Unix socket editor plugins
+// connect to, which gets a line of JSON for every marker found, every prompt
+// sent, and every time Claude goes idle. Clients only listen; anything they
+// write is ignored. A nil *eventSocket emits nothing.
+type eventSocket struct {
+	path     string
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[net.Conn]chan []byte
+	closed  bool
+}
+
+// listenEventSocket creates the socket at path. A socket left behind by a
+// claudewatch that is gone is replaced; one still in use is an error.
+func listenEventSocket(path string) (*eventSocket, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &eventSocket{path: path, listener: listener, clients: make(map[net.Conn]chan []byte)}
+	go s.accept()
+	return s, nil
+}
+
+// accept adds each client that connects
+func (s *eventSocket) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Closed
+		}
+		queue := make(chan []byte, eventClientBuffer)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[conn] = queue
+		s.mu.Unlock()
+
+		go s.write(conn, queue)
+		go func() {
+			// Reading fails once the client hangs up
+			io.Copy(io.Discard, conn)
+			s.drop(conn)
+		}()
+	}
+}
+
+// write passes a client's events on to it until it goes away
+func (s *eventSocket) write(conn net.Conn, queue <-chan []byte) {
+	for line := range queue {
+		if _, err := conn.Write(line); err != nil {
+			s.drop(conn)
+			return
+		}
+	}
+}
+
+// drop disconnects a client
+func (s *eventSocket) drop(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if queue, ok := s.clients[conn]; ok {
+		delete(s.clients, conn)
+		close(queue)
+		conn.Close()
+	}
+}
+
+// emit sends event to every connected client
+func (s *eventSocket) emit(event editorEvent) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, queue := range s.clients {
+		select {
+		case queue <- line:
+		default:
+			// Too far behind to catch up
+			delete(s.clients, conn)
+			close(queue)
+			conn.Close()
+		}
+	}
+}
+
+// close disconnects every client and removes the socket
+func (s *eventSocket) close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.closed = true
+	for conn, queue := range s.clients {
+		delete(s.clients, conn)
+		close(queue)
+		conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.listener.Close()
+	if removeErr := os.Remove(s.path); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) && err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventSocketPath returns a socket path short enough for the platform's limit
+func eventSocketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "cwev")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "events.sock")
+}
+
+// connectEvents connects to the event socket and waits until the client is
+// registered, so no event emitted afterwards is missed
+func connectEvents(t *testing.T, s *eventSocket) *bufio.Reader {
+	t.Helper()
+	s.mu.Lock()
+	before := len(s.clients)
+	s.mu.Unlock()
+	conn, err := net.Dial("unix", s.path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, "the client to be registered", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.clients) > before
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return bufio.NewReader(conn)
+}
+
+// readEvent reads the next event from a client
+func readEvent(t *testing.T, r *bufio.Reader) editorEvent {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading an event: %v", err)
+	}
+	var event editorEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatalf("event %q isn't JSON: %v", line, err)
+	}
+	return event
+}
+
+func TestEventSocketBroadcasts(t *testing.T) {
+	s, err := listenEventSocket(eventSocketPath(t))
+	if err != nil {
+		t.Fatalf("listenEventSocket: %v", err)
+	}
+	defer s.close()
+
+	first := connectEvents(t, s)
+	s.emit(editorEvent{Event: eventMarker, File: "/src/main.go", Line: 3, Text: "// fix ai!", Type: "edit"}) // ai:ignore
+	second := connectEvents(t, s)
+	s.emit(editorEvent{Event: eventIdle})
+
+	if event := readEvent(t, first); event.Event != eventMarker || event.File != "/src/main.go" || event.Line != 3 || event.Time.IsZero() {
+		t.Errorf("first event = %+v, want the marker", event)
+	}
+	for _, r := range []*bufio.Reader{first, second} {
+		if event := readEvent(t, r); event.Event != eventIdle {
+			t.Errorf("event = %+v, want idle", event)
+		}
+	}
+}
+
+func TestEventSocketReplacesStaleSocket(t *testing.T) {
+	path := eventSocketPath(t)
+	s, err := listenEventSocket(path)
+	if err != nil {
+		t.Fatalf("listenEventSocket: %v", err)
+	}
+	if _, err := listenEventSocket(path); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second listenEventSocket = %v, want an in-use error", err)
+	}
+
+	// A socket file nobody listens on is left over from a crash
+	s.listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	s.listener.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("socket file gone: %v", err)
+	}
+	s, err = listenEventSocket(path)
+	if err != nil {
+		t.Fatalf("listenEventSocket over a stale socket: %v", err)
+	}
+	if err := s.close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still there after close: %v", err)
+	}
+
+	regular := filepath.Join(filepath.Dir(path), "file")
+	writeTestFile(t, regular, "not a socket")
+	if _, err := listenEventSocket(regular); err == nil {
+		t.Error("listenEventSocket replaced a regular file")
+	}
+}
+
+func TestEventSocketDropsSlowClient(t *testing.T) {
+	s, err := listenEventSocket(eventSocketPath(t))
+	if err != nil {
+		t.Fatalf("listenEventSocket: %v", err)
+	}
+	defer s.close()
+	connectEvents(t, s) // Never reads
+
+	for i := 0; i < eventClientBuffer*64; i++ {
+		s.emit(editorEvent{Event: eventIdle, Text: strings.Repeat("x", 512)})
+	}
+	waitFor(t, "the slow client to be dropped", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.clients) == 0
+	})
+}
+
+func TestDispatcherEmitsSentAndIdle(t *testing.T) {
+	s, err := listenEventSocket(eventSocketPath(t))
+	if err != nil {
+		t.Fatalf("listenEventSocket: %v", err)
+	}
+	defer s.close()
+	r := connectEvents(t, s)
+
+	d := &dispatcher{primary: &fakeBackend{name: "primary"}, events: s}
+	sites := []markerSite{{File: "/src/main.go", Line: 2, Text: "// fix ai!"}} // ai:ignore
+	if err := d.deliver(promptRequest{Prompt: "Fix it", File: "main.go", Sites: sites}); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+
+	event := readEvent(t, r)
+	if event.Event != eventSent || event.Prompt != 1 || len(event.Markers) != 1 || event.Markers[0] != sites[0] {
+		t.Errorf("event = %+v, want prompt 1 sent", event)
+	}
+	if event := readEvent(t, r); event.Event != eventIdle {
+		t.Errorf("event = %+v, want idle", event)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultExpandInstruction is what --expand-command is asked to do with a
+// rendered prompt, unless the config file sets expand_instruction
+const defaultExpandInstruction = `Rewrite the request below as a clear, specific instruction for a coding assistant working in this project. Keep every file path, line number and code excerpt exactly as given and don't change what is being asked; spell out what the terse instructions leave implicit. Reply with the rewritten request only.`
+
+// expandTimeout bounds how long --expand-command may take before the prompt
+// is sent as written
+var expandTimeout = 2 * time.Minute
+
+// expandInstruction returns the instruction sent to --expand-command ahead of each prompt
+func expandInstruction(fileConfig *FileConfig) string {
+	if fileConfig == nil || strings.TrimSpace(fileConfig.ExpandInstruction) == "" {
+		return defaultExpandInstruction
+	}
+	return strings.TrimSpace(fileConfig.ExpandInstruction)
+}
+
+// expandPrompt runs command (e.g. "claude -p --model haiku") with instruction
+// and prompt on stdin, returning its output as the expanded prompt
+func expandPrompt(command, instruction, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), expandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(instruction + "\n\n---\n\n" + prompt)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second // Don't wait on children still holding the output open
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%q timed out after %s", command, expandTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%q failed: %v: %s", command, err, firstLine(msg))
+		}
+		return "", fmt.Errorf("%q failed: %v", command, err)
+	}
+	expanded := strings.TrimSpace(string(out))
+	if expanded == "" {
+		return "", fmt.Errorf("%q printed nothing", command)
+	}
+	return expanded, nil
+}
+
+// expand passes prompt through --expand-command and returns what should be
+// sent. The prompt goes as written when the command fails or, with
+// --confirm-strip, when the user turns the expansion down.
+func (p *fileProcessor) expand(path, prompt string) string {
+	config := p.config
+	if config.ExpandCommand == "" {
+		return prompt
+	}
+
+	infoLog(config, "Expanding the prompt for %s with: %s", path, config.ExpandCommand)
+	expanded, err := expandPrompt(config.ExpandCommand, expandInstruction(config.FileConfig), prompt)
+	if err != nil {
+		console.warn("Could not expand the prompt for %s: %v; sending it as written", path, err)
+		return prompt
+	}
+
+	console.notice("Expanded prompt for %s:", path)
+	for _, line := range strings.Split(expanded, "\n") {
+		console.detail("%s", line)
+	}
+	if config.ConfirmStrip && p.confirm != nil && !p.confirm("Send the expanded prompt? (no sends the original)") {
+		debugLog(config, "Expanded prompt declined; sending the original")
+		return prompt
+	}
+	return expanded
+}
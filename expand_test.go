@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestExpandPrompt(t *testing.T) {
+	// The instruction comes first, then the prompt
+	got, err := expandPrompt("head -n 1", "Spell it out.", "fix this")
+	if err != nil {
+		t.Fatalf("expandPrompt: %v", err)
+	}
+	if got != "Spell it out." {
+		t.Errorf("first line of input = %q, want the instruction", got)
+	}
+	got, err = expandPrompt("tail -n 1 | tr a-z A-Z", "Spell it out.", "fix this\n")
+	if err != nil {
+		t.Fatalf("expandPrompt: %v", err)
+	}
+	if got != "FIX THIS" {
+		t.Errorf("expanded = %q, want %q", got, "FIX THIS")
+	}
+}
+
+func TestExpandPromptErrors(t *testing.T) {
+	if _, err := expandPrompt("echo quota exceeded >&2; exit 3", "", "p"); err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("failing command: err = %v, want its stderr", err)
+	}
+	if _, err := expandPrompt("cat >/dev/null", "", "p"); err == nil {
+		t.Error("silent command: err = nil, want an error")
+	}
+
+	old := expandTimeout
+	expandTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { expandTimeout = old })
+	if _, err := expandPrompt("sleep 5", "", "p"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow command: err = %v, want a timeout", err)
+	}
+}
+
+func TestExpandInstruction(t *testing.T) {
+	if got := expandInstruction(nil); got != defaultExpandInstruction {
+		t.Errorf("expandInstruction(nil) = %q, want the default", got)
+	}
+	if got := expandInstruction(&FileConfig{ExpandInstruction: " Be brief. "}); got != "Be brief." {
+		t.Errorf("expandInstruction = %q, want the configured one", got)
+	}
+}
+
+// expandedPrompt processes a file holding one marker and returns the prompt queued for it
+func expandedPrompt(t *testing.T, config *Config, confirm func(string) bool) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "a.go")
+	if err := os.WriteFile(path, []byte("// tests ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	p := newFileProcessor(config, resolver, prompts)
+	p.confirm = confirm
+
+	p.process(path)
+	if len(prompts) != 1 {
+		t.Fatalf("queued %d prompts, want 1", len(prompts))
+	}
+	// The expansion waits until the prompt is sent
+	req := <-prompts
+	if req.Prompt != "// tests" {
+		t.Errorf("queued prompt = %q, want it as rendered", req.Prompt)
+	}
+	return req.expanded()
+}
+
+func TestProcessExpandsPrompt(t *testing.T) {
+	config := &Config{ExpandCommand: "tail -n 1 | sed 's/tests/add table-driven tests/'"}
+	if got := expandedPrompt(t, config, nil); got != "// add table-driven tests" {
+		t.Errorf("prompt = %q, want the expansion", got)
+	}
+
+	// With --confirm-strip, declining the expansion sends the original
+	config.ConfirmStrip = true
+	asked := ""
+	decline := func(question string) bool { asked = question; return false }
+	if got := expandedPrompt(t, config, decline); got != "// tests" || asked == "" {
+		t.Errorf("prompt = %q (asked %q), want the original after declining", got, asked)
+	}
+
+	// A failed expansion sends the original too
+	config = &Config{ExpandCommand: "exit 1"}
+	if got := expandedPrompt(t, config, nil); got != "// tests" {
+		t.Errorf("prompt = %q, want the original when the command fails", got)
+	}
+}
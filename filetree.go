@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultFileTreeDepth is how many directory levels {{.FileTree}} lists below
+// the changed file's directory, unless file_tree_depth says otherwise
+const defaultFileTreeDepth = 2
+
+// fileTreeMaxEntries caps the entries {{.FileTree}} lists, so a prompt about a
+// file in a huge directory stays readable
+const fileTreeMaxEntries = 200
+
+// fileTreeDepth returns the depth of {{.FileTree}}: the config file's
+// file_tree_depth, else the default
+func fileTreeDepth(fileConfig *FileConfig) int {
+	if fileConfig != nil && fileConfig.FileTreeDepth != nil && *fileConfig.FileTreeDepth >= 0 {
+		return *fileConfig.FileTreeDepth
+	}
+	return defaultFileTreeDepth
+}
+
+// fileTree lists the directory holding changed, depth levels deep, as an
+// indented tree with directories ending in "/". Hidden and ignored entries
+// are left out, and changed is marked so Claude can place it.
+func fileTree(config *Config, changed string, depth int) string {
+	dir := filepath.Dir(changed)
+	var tree strings.Builder
+	fmt.Fprintf(&tree, "%s/\n", filepath.Base(dir))
+	listed := 0
+	omitted := 0
+
+	var walk func(dir string, level int)
+	walk = func(dir string, level int) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if config.skipsFile(path) {
+				continue
+			}
+			if ignored, _ := ShouldIgnorePathWithConfig(path, config); ignored {
+				continue
+			}
+			if listed >= fileTreeMaxEntries {
+				omitted++
+				continue
+			}
+			listed++
+
+			indent := strings.Repeat("  ", level+1)
+			switch {
+			case entry.IsDir():
+				fmt.Fprintf(&tree, "%s%s/\n", indent, entry.Name())
+				if level+1 < depth {
+					walk(path, level+1)
+				}
+			case path == changed:
+				fmt.Fprintf(&tree, "%s%s  (this file)\n", indent, entry.Name())
+			default:
+				fmt.Fprintf(&tree, "%s%s\n", indent, entry.Name())
+			}
+		}
+	}
+	if depth > 0 {
+		walk(dir, 0)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&tree, "  ... (%d more entries)\n", omitted)
+	}
+	return strings.TrimSuffix(tree.String(), "\n")
+}
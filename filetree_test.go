@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestFileTree(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pkg")
+	for _, name := range []string{"a.go", "b.go", ".hidden", "sub/c.go", "sub/deep/d.go", "vendor/v.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		writeTestFile(t, path, "package p\n")
+	}
+	config := &Config{IgnorePattern: regexp.MustCompile(`/vendor$`)}
+
+	got := fileTree(config, filepath.Join(dir, "b.go"), 2)
+	want := "pkg/\n  a.go\n  b.go  (this file)\n  sub/\n    c.go\n    deep/"
+	if got != want {
+		t.Errorf("fileTree(depth 2) =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := fileTree(config, filepath.Join(dir, "a.go"), 0); got != "pkg/" {
+		t.Errorf("fileTree(depth 0) = %q, want only the directory", got)
+	}
+}
+
+func TestFileTreeCapsEntries(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < fileTreeMaxEntries+5; i++ {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("f%03d", i)), "")
+	}
+	got := fileTree(&Config{}, filepath.Join(dir, "f000"), 1)
+	if !strings.HasSuffix(got, "... (5 more entries)") {
+		t.Errorf("fileTree() = %q, want the omitted entries counted", got)
+	}
+}
+
+func TestTemplateFileTreeIsBuiltOnUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("package p\n// ai! split this up\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tmpl := template.Must(template.New("prompt").Parse("{{.FileTree}}"))
+	prompts := make(chan promptRequest, 1)
+	newFileProcessor(&Config{FileTreeDepth: 1}, newPromptResolver(tmpl, nil, nil), prompts).process(path)
+
+	if req := <-prompts; !strings.Contains(req.Prompt, "f.go  (this file)") {
+		t.Errorf("prompt = %q, want the file tree", req.Prompt)
+	}
+	if got := (TemplateData{}).FileTree(); got != "" {
+		t.Errorf("FileTree() without a provider = %q, want empty", got)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// cliOptions is the command line of a watch session, as parsed by parseArgs
+type cliOptions struct {
+	logLevel           logLevel // From --log-level, or else --debug, -v or -vv
+	claudeCommand      string
+	prompt             *string // nil unless --prompt was given
+	preset             string
+	configPath         string
+	ignore             string
+	allowTemplateShell bool
+	confirmStrip       bool
+	pick               bool
+	contextLines       int
+	maxFileSizeKB      int // Negative unless --max-file-size was given
+	maxPerMinute       int
+	maxPerSession      int
+	dedupeWindow       time.Duration
+	cooldown           time.Duration
+	followSymlinks     bool
+	noBuiltinIgnores   bool
+	keepMarkers        bool
+	progressComments   bool
+	backup             bool
+	record             bool
+	sessionNotes       bool
+	digest             bool
+	batch              bool
+	holdWhileAnswering bool
+	coalesce           bool
+	gitCheckpoint      bool
+	autoCommit         bool
+	branchPerPrompt    bool
+	requireClean       bool
+	trackedOnly        bool
+	projectScope       bool
+	script             string
+	eventSocket        string
+	noClaude           bool
+	output             string
+	clipboard          bool
+	quiet              bool
+	showPrompt         bool
+	notifyFormat       string
+	logFile            string
+	logMaxSizeMB       int
+	logMaxAge          time.Duration
+	restartLimit       int // 0 unless --restart-on-exit was given
+	fallbackCommand    string
+	expandCommand      string
+	inputEncoding      string
+	attachPID          int
+	attachAuto         bool
+	tmuxTarget         string
+	reconnect          bool
+	watcherBackend     string
+
+	dirs       []string // Directories to watch, in the order given
+	claudeArgs []string // Everything after "--"
+}
+
+// parseArgs parses the command line of a watch session. Flags and the
+// directories to watch may be mixed; everything after "--" is passed to
+// Claude. An unknown flag or an argument that isn't a directory is an error,
+// rather than being passed to Claude, so typos don't go unnoticed.
+func parseArgs(args []string) (*cliOptions, error) {
+	opts := &cliOptions{}
+	fs := flag.NewFlagSet("claudewatch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard) // Errors are returned; --help is handled by printHelp
+	var debug, v, vv bool
+	var logLevelName string
+	fs.BoolVar(&debug, "debug", false, "")
+	fs.BoolVar(&v, "v", false, "")
+	fs.BoolVar(&vv, "vv", false, "")
+	fs.StringVar(&logLevelName, "log-level", "", "")
+	fs.StringVar(&opts.claudeCommand, "claude-command", "", "")
+	fs.Func("prompt", "", func(value string) error {
+		opts.prompt = &value
+		return nil
+	})
+	fs.StringVar(&opts.preset, "preset", "", "")
+	fs.StringVar(&opts.configPath, "config", "", "")
+	fs.StringVar(&opts.ignore, "ignore", "", "")
+	fs.BoolVar(&opts.allowTemplateShell, "allow-template-shell", false, "")
+	fs.BoolVar(&opts.confirmStrip, "confirm-strip", false, "")
+	fs.BoolVar(&opts.pick, "pick", false, "")
+	fs.IntVar(&opts.contextLines, "context", 0, "")
+	fs.IntVar(&opts.maxFileSizeKB, "max-file-size", -1, "")
+	fs.IntVar(&opts.maxPerMinute, "max-per-minute", 0, "")
+	fs.IntVar(&opts.maxPerSession, "max-per-session", 0, "")
+	fs.DurationVar(&opts.dedupeWindow, "dedupe-window", defaultDedupeWindow, "")
+	fs.DurationVar(&opts.cooldown, "cooldown", defaultCooldown, "")
+	fs.BoolVar(&opts.followSymlinks, "follow-symlinks", false, "")
+	fs.BoolVar(&opts.noBuiltinIgnores, "no-builtin-ignores", false, "")
+	fs.BoolVar(&opts.keepMarkers, "keep-markers", false, "")
+	fs.BoolVar(&opts.progressComments, "progress-comments", false, "")
+	fs.BoolVar(&opts.backup, "backup", false, "")
+	fs.BoolVar(&opts.record, "record", false, "")
+	fs.BoolVar(&opts.sessionNotes, "session-notes", false, "")
+	fs.BoolVar(&opts.digest, "digest", false, "")
+	fs.BoolVar(&opts.batch, "batch", false, "")
+	fs.BoolVar(&opts.holdWhileAnswering, "hold-while-answering", false, "")
+	fs.BoolVar(&opts.coalesce, "coalesce", false, "")
+	fs.BoolVar(&opts.gitCheckpoint, "git-checkpoint", false, "")
+	fs.BoolVar(&opts.autoCommit, "auto-commit", false, "")
+	fs.BoolVar(&opts.branchPerPrompt, "branch-per-instruction", false, "")
+	fs.BoolVar(&opts.requireClean, "require-clean", false, "")
+	fs.BoolVar(&opts.trackedOnly, "tracked-only", false, "")
+	fs.BoolVar(&opts.projectScope, "project-scope", false, "")
+	fs.StringVar(&opts.script, "script", "", "")
+	fs.StringVar(&opts.eventSocket, "event-socket", "", "")
+	fs.BoolVar(&opts.noClaude, "no-claude", false, "")
+	fs.StringVar(&opts.output, "output", "", "")
+	fs.BoolVar(&opts.clipboard, "clipboard", false, "")
+	fs.BoolVar(&opts.quiet, "quiet", false, "")
+	fs.BoolVar(&opts.showPrompt, "show-prompt", false, "")
+	fs.StringVar(&opts.notifyFormat, "notify-format", "", "")
+	fs.StringVar(&opts.logFile, "log-file", "", "")
+	fs.IntVar(&opts.logMaxSizeMB, "log-max-size", defaultLogMaxSizeMB, "")
+	fs.DurationVar(&opts.logMaxAge, "log-max-age", defaultLogMaxAge, "")
+	fs.Var(restartLimitFlag{&opts.restartLimit}, "restart-on-exit", "")
+	fs.StringVar(&opts.fallbackCommand, "fallback-command", "", "")
+	fs.StringVar(&opts.expandCommand, "expand-command", "", "")
+	fs.StringVar(&opts.inputEncoding, "input-encoding", "", "")
+	fs.IntVar(&opts.attachPID, "attach-pid", 0, "")
+	fs.BoolVar(&opts.attachAuto, "attach-auto", false, "")
+	fs.StringVar(&opts.tmuxTarget, "tmux-target", "", "")
+	fs.BoolVar(&opts.reconnect, "reconnect", false, "")
+	fs.StringVar(&opts.watcherBackend, "backend-watcher", watcherFsnotify, "")
+
+	// The flag package stops at the first positional argument, so parse
+	// again after each directory
+	rest := args
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return nil, err
+		}
+		parsed := rest[:len(rest)-fs.NArg()]
+		rest = fs.Args()
+		if len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			opts.claudeArgs = rest
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		if info, err := os.Stat(rest[0]); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%q is not a directory to watch (arguments for Claude go after \"--\")", rest[0])
+		}
+		opts.dirs = append(opts.dirs, rest[0])
+		rest = rest[1:]
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case err != nil:
+		case f.Name == "context" && opts.contextLines < 0:
+			err = fmt.Errorf("--context: %d is not a non-negative number", opts.contextLines)
+		case f.Name == "max-file-size" && opts.maxFileSizeKB < 0:
+			err = fmt.Errorf("--max-file-size: %d is not a non-negative number of KiB", opts.maxFileSizeKB)
+		case f.Name == "max-per-minute" && opts.maxPerMinute <= 0:
+			err = fmt.Errorf("--max-per-minute: %d is not a positive number of prompts", opts.maxPerMinute)
+		case f.Name == "max-per-session" && opts.maxPerSession <= 0:
+			err = fmt.Errorf("--max-per-session: %d is not a positive number of prompts", opts.maxPerSession)
+		case f.Name == "dedupe-window" && opts.dedupeWindow < 0:
+			err = fmt.Errorf("--dedupe-window: %s is negative", opts.dedupeWindow)
+		case f.Name == "cooldown" && opts.cooldown < 0:
+			err = fmt.Errorf("--cooldown: %s is negative", opts.cooldown)
+		case f.Name == "log-max-size" && opts.logMaxSizeMB < 0:
+			err = fmt.Errorf("--log-max-size: %d is not a non-negative number of MiB", opts.logMaxSizeMB)
+		case f.Name == "log-max-age" && opts.logMaxAge < 0:
+			err = fmt.Errorf("--log-max-age: %s is negative", opts.logMaxAge)
+		case (f.Name == "log-max-size" || f.Name == "log-max-age") && opts.logFile == "":
+			err = fmt.Errorf("--%s only applies with --log-file", f.Name)
+		case f.Name == "backend-watcher" && opts.watcherBackend != watcherFsnotify && opts.watcherBackend != watcherWatchman:
+			err = fmt.Errorf("--backend-watcher: unknown backend %q (want fsnotify or watchman)", opts.watcherBackend)
+		case f.Name == "attach-pid" && opts.attachPID <= 0:
+			err = fmt.Errorf("--attach-pid expects a process ID, got %d", opts.attachPID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.logLevel, err = verbosity(logLevelName, debug, v, vv); err != nil {
+		return nil, fmt.Errorf("--log-level: %w", err)
+	}
+	if opts.quiet && opts.notifyFormat != "" {
+		return nil, fmt.Errorf("--notify-format has no effect with --quiet")
+	}
+	if opts.output != "" && !opts.noClaude {
+		return nil, fmt.Errorf("--output only applies with --no-claude")
+	}
+	return opts, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	opts, err := parseArgs([]string{dir1, "--debug", "--claude-command", "/opt/claude", "--prompt", "{{.File}}", dir2, "--context=3", "--", "--model", "opus", dir1})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if opts.logLevel != levelDebug || opts.claudeCommand != "/opt/claude" || opts.prompt == nil || *opts.prompt != "{{.File}}" || opts.contextLines != 3 {
+		t.Errorf("flags = %+v", opts)
+	}
+	if !reflect.DeepEqual(opts.dirs, []string{dir1, dir2}) {
+		t.Errorf("dirs = %v, want %v", opts.dirs, []string{dir1, dir2})
+	}
+	if !reflect.DeepEqual(opts.claudeArgs, []string{"--model", "opus", dir1}) {
+		t.Errorf("claudeArgs = %v, want everything after --", opts.claudeArgs)
+	}
+	if opts.maxFileSizeKB != -1 {
+		t.Errorf("maxFileSizeKB = %d without --max-file-size, want -1", opts.maxFileSizeKB)
+	}
+	if opts.dedupeWindow != defaultDedupeWindow {
+		t.Errorf("dedupeWindow = %s without --dedupe-window, want %s", opts.dedupeWindow, defaultDedupeWindow)
+	}
+
+	opts, err = parseArgs(nil)
+	if err != nil || opts.prompt != nil || len(opts.dirs) != 0 || len(opts.claudeArgs) != 0 {
+		t.Errorf("parseArgs(nil) = %+v, %v; want no options", opts, err)
+	}
+}
+
+func TestParseArgsRestartOnExit(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"--restart-on-exit"}, defaultRestartLimit},
+		{[]string{"--restart-on-exit=7"}, 7},
+		{[]string{"--restart-on-exit=0"}, 0},
+	}
+	for _, tt := range tests {
+		opts, err := parseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("parseArgs(%q): %v", tt.args, err)
+		}
+		if opts.restartLimit != tt.want {
+			t.Errorf("parseArgs(%q) restart limit = %d, want %d", tt.args, opts.restartLimit, tt.want)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--prmopt", "x"}, "prmopt"},
+		{[]string{"--model", "opus"}, "model"},
+		{[]string{"no-such-dir"}, `"no-such-dir" is not a directory`},
+		{[]string{"--context", "-1"}, "--context"},
+		{[]string{"--max-file-size", "-5"}, "--max-file-size"},
+		{[]string{"--max-per-minute", "0"}, "--max-per-minute"},
+		{[]string{"--max-per-session", "-1"}, "--max-per-session"},
+		{[]string{"--dedupe-window", "-1s"}, "--dedupe-window"},
+		{[]string{"--cooldown", "-1s"}, "--cooldown"},
+		{[]string{"--attach-pid", "0"}, "--attach-pid"},
+		{[]string{"--backend-watcher", "inotify"}, "--backend-watcher"},
+		{[]string{"--context", "many"}, "context"},
+		{[]string{"--prompt"}, "prompt"},
+		{[]string{"--restart-on-exit=-1"}, "restart-on-exit"},
+		{[]string{"--restart-on-exit=often"}, "restart-on-exit"},
+		{[]string{"--output", "prompts.txt"}, "--no-claude"},
+		{[]string{"--log-max-size", "5"}, "--log-file"},
+		{[]string{"--log-level", "loud"}, "--log-level"},
+		{[]string{"--quiet", "--notify-format", "{{.File}}"}, "--quiet"},
+		{[]string{"--log-file", "cw.log", "--log-max-age", "-1h"}, "--log-max-age"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseArgs(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseArgs(%q) error = %v, want one mentioning %q", tt.args, err, tt.want)
+		}
+	}
+
+	if _, err := parseArgs([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("parseArgs(-h) error = %v, want flag.ErrHelp", err)
+	}
+}
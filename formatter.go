@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFormatters are the formatters and linters that commonly rewrite a
+// file straight after it is saved, by name of their executable or script
+var defaultFormatters = []string{
+	"prettierd", "prettier", "eslint_d", "eslint", "biome", "dprint",
+	"blackd", "black", "ruff", "autopep8", "isort",
+	"gofmt", "gofumpt", "goimports", "rustfmt", "clang-format",
+	"stylua", "rubocop", "php-cs-fixer", "shfmt",
+}
+
+// defaultFormatterSettleMS is how long a change waits for a formatter's write
+// while one is running, unless formatter_settle_ms says otherwise
+const defaultFormatterSettleMS = 750
+
+// formatterGracePeriod is how long a formatter counts as running after it was
+// last seen. Formatters run on save are gone again within a poll or two.
+var formatterGracePeriod = 5 * time.Second
+
+// formatterActivity tracks whether an on-save formatter is running. While one
+// is, changed files are given longer to settle, so they are scanned after the
+// formatter has rewritten them: prompts then carry the formatted line text and
+// line numbers.
+type formatterActivity struct {
+	names  map[string]bool
+	settle time.Duration
+
+	mu       sync.Mutex
+	lastSeen time.Time
+	lastName string
+}
+
+// compileFormatters sets up formatter detection from the config file. It
+// returns nil when formatter_settle_ms is 0, so no processes are polled.
+func compileFormatters(fileConfig *FileConfig) *formatterActivity {
+	settleMS := defaultFormatterSettleMS
+	if fileConfig != nil && fileConfig.FormatterSettleMS != nil {
+		settleMS = *fileConfig.FormatterSettleMS
+	}
+	if settleMS <= 0 {
+		return nil
+	}
+	f := &formatterActivity{names: make(map[string]bool), settle: time.Duration(settleMS) * time.Millisecond}
+	for _, name := range defaultFormatters {
+		f.names[name] = true
+	}
+	if fileConfig != nil {
+		for _, name := range fileConfig.Formatters {
+			f.names[strings.TrimSpace(name)] = true
+		}
+	}
+	return f
+}
+
+// formatterName returns the formatter a process command line runs, either
+// directly or as a script run by an interpreter, or an empty string
+func (f *formatterActivity) formatterName(cmdline []string) string {
+	if len(cmdline) == 0 {
+		return ""
+	}
+	name := func(arg string) string {
+		base := filepath.Base(arg)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if n := filepath.Base(cmdline[0]); f.names[n] {
+		return n
+	}
+	switch name(cmdline[0]) {
+	case "node", "bun", "deno", "python", "python3", "ruby", "php":
+		for _, arg := range cmdline[1:] {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if n := name(arg); f.names[n] {
+				return n
+			}
+			break
+		}
+	}
+	return ""
+}
+
+// poll looks through the running processes once, recording when a formatter was seen
+func (f *formatterActivity) poll(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, err := readCmdline(root, pid)
+		if err != nil {
+			continue
+		}
+		if name := f.formatterName(cmdline); name != "" {
+			f.mu.Lock()
+			f.lastSeen, f.lastName = time.Now(), name
+			f.mu.Unlock()
+		}
+	}
+}
+
+// run polls for formatters every buildPollInterval, for as long as claudewatch runs
+func (f *formatterActivity) run(config *Config) {
+	debugLog(config, "Polling processes for on-save formatters (settling changes for %s while one runs)", f.settle)
+	for {
+		f.poll(procRoot)
+		time.Sleep(buildPollInterval)
+	}
+}
+
+// settleDelay returns how long a change should wait for a formatter's write,
+// and the formatter's name, or 0 if none is running. It is 0 on a nil tracker.
+func (f *formatterActivity) settleDelay() (time.Duration, string) {
+	if f == nil {
+		return 0, ""
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lastName == "" || time.Since(f.lastSeen) > formatterGracePeriod {
+		return 0, ""
+	}
+	return f.settle, f.lastName
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompileFormatters(t *testing.T) {
+	zero, ms := 0, 300
+	if f := compileFormatters(&FileConfig{FormatterSettleMS: &zero}); f != nil {
+		t.Error("formatter_settle_ms 0 still polls for formatters")
+	}
+	f := compileFormatters(nil)
+	if f == nil || f.settle != defaultFormatterSettleMS*time.Millisecond {
+		t.Fatalf("compileFormatters(nil) = %+v, want the default settle delay", f)
+	}
+	f = compileFormatters(&FileConfig{FormatterSettleMS: &ms, Formatters: []string{"mylint"}})
+	if f.settle != 300*time.Millisecond || !f.names["mylint"] || !f.names["prettierd"] {
+		t.Errorf("compileFormatters() = %+v, want the configured delay and extra formatters", f)
+	}
+}
+
+func TestFormatterName(t *testing.T) {
+	f := compileFormatters(nil)
+	tests := []struct {
+		cmdline []string
+		want    string
+	}{
+		{[]string{"/usr/local/bin/prettierd", "--stdio"}, "prettierd"},
+		{[]string{"node", "/home/me/.npm/bin/eslint_d.js", "start"}, "eslint_d"},
+		{[]string{"/usr/bin/python3.11", "-m", "black", "f.py"}, "black"},
+		{[]string{"/usr/bin/python3", "/usr/bin/blackd"}, "blackd"},
+		{[]string{"node", "server.js", "prettier"}, ""},
+		{[]string{"vim", "main.go"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := f.formatterName(tt.cmdline); got != tt.want {
+			t.Errorf("formatterName(%q) = %q, want %q", tt.cmdline, got, tt.want)
+		}
+	}
+}
+
+func TestFormatterActivitySettleDelay(t *testing.T) {
+	f := compileFormatters(nil)
+	root := t.TempDir()
+	fakeProc(t, root, 100, os.Getuid(), "/dev/pts/1", []string{"/usr/bin/zsh"}, nil)
+	f.poll(root)
+	if settle, _ := f.settleDelay(); settle != 0 {
+		t.Errorf("settleDelay() = %s with no formatter running, want 0", settle)
+	}
+
+	fakeProc(t, root, 101, os.Getuid(), "/dev/pts/1", []string{"prettierd", "--stdio"}, nil)
+	f.poll(root)
+	if settle, name := f.settleDelay(); settle != f.settle || name != "prettierd" {
+		t.Errorf("settleDelay() = %s, %q; want %s for prettierd", settle, name, f.settle)
+	}
+
+	// Once the formatter has been gone for the grace period, changes settle as usual
+	old := formatterGracePeriod
+	formatterGracePeriod = 0
+	t.Cleanup(func() { formatterGracePeriod = old })
+	time.Sleep(time.Millisecond)
+	if settle, _ := f.settleDelay(); settle != 0 {
+		t.Errorf("settleDelay() = %s after the formatter went away, want 0", settle)
+	}
+
+	var none *formatterActivity
+	if settle, _ := none.settleDelay(); settle != 0 {
+		t.Error("nil tracker returned a settle delay")
+	}
+}
+
+func TestScanSchedulerWaitsForFormatter(t *testing.T) {
+	f := &formatterActivity{settle: 10 * testSettleDelay, lastSeen: time.Now(), lastName: "prettierd"}
+	s := newScanScheduler(testSettleDelay)
+	s.formatters = f
+	start := time.Now()
+	s.schedule("/repo/app.ts")
+
+	receivePath(t, s)
+	if waited := time.Since(start); waited < f.settle {
+		t.Errorf("scan ran after %s, before the formatter settle delay of %s", waited, f.settle)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention defaults, used unless the config file sets history_keep_days or
+// transcript_max_mb (0 disables the limit)
+const (
+	defaultHistoryKeepDays = 30
+	defaultTranscriptMaxMB = 50
+)
+
+// pruneInterval is how often a running claudewatch prunes the state directory
+const pruneInterval = time.Hour
+
+// retentionPolicy bounds how much the state directory keeps
+type retentionPolicy struct {
+	KeepDays         int   // Delete backups and logs not modified in this many days; 0 keeps them forever
+	TranscriptMaxLen int64 // Trim the oldest transcript lines beyond this many bytes; 0 lets it grow
+}
+
+// retentionFromConfig returns the retention policy configured in fileConfig,
+// falling back to the defaults for settings it doesn't have
+func retentionFromConfig(fileConfig *FileConfig) retentionPolicy {
+	keepDays, maxMB := defaultHistoryKeepDays, defaultTranscriptMaxMB
+	if fileConfig != nil {
+		if fileConfig.HistoryKeepDays != nil {
+			keepDays = *fileConfig.HistoryKeepDays
+		}
+		if fileConfig.TranscriptMaxMB != nil {
+			maxMB = *fileConfig.TranscriptMaxMB
+		}
+	}
+	return retentionPolicy{KeepDays: keepDays, TranscriptMaxLen: int64(maxMB) << 20}
+}
+
+// expiredStateFiles lists the files in stateDir not modified in keepDays
+// days. The transcript and the history database are never listed; they are
+// trimmed instead.
+func expiredStateFiles(stateDir string, keepDays int, now time.Time) ([]string, error) {
+	if keepDays <= 0 {
+		return nil, nil
+	}
+	cutoff := now.AddDate(0, 0, -keepDays)
+	transcriptPath := filepath.Join(stateDir, transcriptFileName)
+	historyPath := filepath.Join(stateDir, historyFileName) // With its journal
+
+	var expired []string
+	err := filepath.WalkDir(stateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == transcriptPath || strings.HasPrefix(path, historyPath) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while we were walking
+		}
+		if info.ModTime().Before(cutoff) {
+			expired = append(expired, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// pruneStateDir applies policy to stateDir and returns the paths it removed.
+// The transcript is trimmed from the front rather than removed, keeping the
+// newest output.
+func pruneStateDir(stateDir string, policy retentionPolicy, now time.Time) ([]string, error) {
+	expired, err := expiredStateFiles(stateDir, policy.KeepDays, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	dirs := make(map[string]bool)
+	for _, path := range expired {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed = append(removed, path)
+		for dir := filepath.Dir(path); dir != stateDir && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	// Remove directories left empty, deepest first
+	emptied := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		emptied = append(emptied, dir)
+	}
+	sort.Slice(emptied, func(i, j int) bool { return len(emptied[i]) > len(emptied[j]) })
+	for _, dir := range emptied {
+		_ = os.Remove(dir) // Fails harmlessly if the directory isn't empty
+	}
+
+	if policy.KeepDays > 0 {
+		if err := pruneHistory(filepath.Join(stateDir, historyFileName), now.AddDate(0, 0, -policy.KeepDays)); err != nil {
+			return removed, err
+		}
+	}
+
+	if policy.TranscriptMaxLen > 0 {
+		err := trimFileHead(filepath.Join(stateDir, transcriptFileName), policy.TranscriptMaxLen)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// pruneHistory deletes the history entries recorded before cutoff, if there
+// is a history database at path
+func pruneHistory(path string, cutoff time.Time) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	history, err := openHistory(path)
+	if err != nil {
+		return err
+	}
+	defer history.close()
+	_, err = history.prune(cutoff)
+	return err
+}
+
+// trimFileHead drops whole lines from the start of path until it is at most
+// maxLen bytes. The file is rewritten in place, so a writer holding it open
+// in append mode keeps appending to it.
+func trimFileHead(path string, maxLen int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() <= maxLen {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	keep := content[int64(len(content))-maxLen:]
+	// Start at a line boundary, unless that would drop everything
+	for i, b := range keep {
+		if b == '\n' {
+			if i+1 < len(keep) {
+				keep = keep[i+1:]
+			}
+			break
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(keep); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pruneStateDirPeriodically prunes the state directory now and then every
+// pruneInterval, reporting problems to the debug log. A state directory that
+// doesn't exist yet is skipped. It never returns.
+func pruneStateDirPeriodically(config *Config, stateDir string, policy retentionPolicy) {
+	for {
+		removed, err := pruneStateDir(stateDir, policy, time.Now())
+		if err != nil {
+			warnLog(config, "Pruning %s: %v", stateDir, err)
+		}
+		for _, path := range removed {
+			debugLog(config, "Pruned %s", path)
+		}
+		time.Sleep(pruneInterval)
+	}
+}
+
+// runClean implements "claudewatch clean": it deletes the state directory,
+// or with --expired only what the retention settings would prune. It returns
+// the process exit code.
+func runClean(args []string) int {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+	expired := flags.Bool("expired", false, "Only remove what history_keep_days and transcript_max_mb would prune")
+	dryRun := flags.Bool("dry-run", false, "List what would be removed without removing it")
+	configPath := flags.String("config", "", "Read retention settings from this file instead of the nearest .claudewatch.json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: claudewatch clean [--expired] [--dry-run] [--config PATH]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Remove the logs, transcripts and backups claudewatch keeps in "+stateDirName+".")
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if _, err := os.Stat(stateDirName); errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("Nothing to clean: no %s directory here\n", stateDirName)
+		return 0
+	}
+
+	if *expired {
+		if *configPath == "" {
+			*configPath = findConfigFile(".")
+		}
+		var fileConfig *FileConfig
+		if *configPath != "" {
+			var err error
+			if fileConfig, err = LoadFileConfig(*configPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config file: %v\n", err)
+				return 2
+			}
+		}
+		policy := retentionFromConfig(fileConfig)
+		if *dryRun {
+			expiredFiles, err := expiredStateFiles(stateDirName, policy.KeepDays, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", stateDirName, err)
+				return 1
+			}
+			for _, path := range expiredFiles {
+				fmt.Printf("Would remove %s\n", path)
+			}
+			transcriptPath := filepath.Join(stateDirName, transcriptFileName)
+			if info, err := os.Stat(transcriptPath); err == nil && policy.TranscriptMaxLen > 0 && info.Size() > policy.TranscriptMaxLen {
+				fmt.Printf("Would trim %s to %d MB\n", transcriptPath, policy.TranscriptMaxLen>>20)
+			}
+			return 0
+		}
+		removed, err := pruneStateDir(stateDirName, policy, time.Now())
+		for _, path := range removed {
+			fmt.Printf("Removed %s\n", path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error pruning %s: %v\n", stateDirName, err)
+			return 1
+		}
+		return 0
+	}
+
+	if *dryRun {
+		_ = filepath.WalkDir(stateDirName, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				fmt.Printf("Would remove %s\n", path)
+			}
+			return nil
+		})
+		return 0
+	}
+	if err := os.RemoveAll(stateDirName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", stateDirName, err)
+		return 1
+	}
+	fmt.Printf("Removed %s\n", stateDirName)
+	return 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAged creates path with content and sets its modification time to age ago
+func writeAged(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRetentionFromConfig(t *testing.T) {
+	if got := retentionFromConfig(nil); got.KeepDays != defaultHistoryKeepDays || got.TranscriptMaxLen != defaultTranscriptMaxMB<<20 {
+		t.Errorf("retentionFromConfig(nil) = %+v, want the defaults", got)
+	}
+
+	zero, two := 0, 2
+	got := retentionFromConfig(&FileConfig{HistoryKeepDays: &zero, TranscriptMaxMB: &two})
+	if got.KeepDays != 0 || got.TranscriptMaxLen != 2<<20 {
+		t.Errorf("retentionFromConfig() = %+v, want keep forever and a 2 MB transcript", got)
+	}
+}
+
+func TestPruneStateDir(t *testing.T) {
+	stateDir := t.TempDir()
+	day := 24 * time.Hour
+	oldBackup := filepath.Join(stateDir, backupDirName, "src", "a.go@20260101T000000.000000000")
+	newBackup := filepath.Join(stateDir, backupDirName, "b.go@20260301T000000.000000000")
+	oldLog := filepath.Join(stateDir, "fallback.log")
+	transcript := filepath.Join(stateDir, transcriptFileName)
+	writeAged(t, oldBackup, "a", 10*day)
+	writeAged(t, newBackup, "b", day)
+	writeAged(t, oldLog, "log", 10*day)
+	writeAged(t, transcript, "line one\nline two\nline three\n", 10*day)
+
+	removed, err := pruneStateDir(stateDir, retentionPolicy{KeepDays: 7, TranscriptMaxLen: 16}, time.Now())
+	if err != nil {
+		t.Fatalf("pruneStateDir: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("removed %v, want the old backup and log", removed)
+	}
+	if exists(oldBackup) || exists(oldLog) || exists(filepath.Dir(oldBackup)) {
+		t.Error("old files (or the directory they left empty) were kept")
+	}
+	if !exists(newBackup) {
+		t.Error("recent backup was pruned")
+	}
+	if got := readString(t, transcript); got != "line three\n" {
+		t.Errorf("transcript = %q, want only the newest whole lines", got)
+	}
+}
+
+func TestPruneStateDirKeepsEverythingWhenDisabled(t *testing.T) {
+	stateDir := t.TempDir()
+	oldLog := filepath.Join(stateDir, "be.log")
+	writeAged(t, oldLog, strings.Repeat("x\n", 100), 1000*24*time.Hour)
+
+	if _, err := pruneStateDir(stateDir, retentionPolicy{}, time.Now()); err != nil {
+		t.Fatalf("pruneStateDir: %v", err)
+	}
+	if !exists(oldLog) {
+		t.Error("pruneStateDir() removed a file with retention disabled")
+	}
+	if _, err := pruneStateDir(filepath.Join(stateDir, "missing"), retentionPolicy{KeepDays: 1, TranscriptMaxLen: 1}, time.Now()); err != nil {
+		t.Errorf("pruneStateDir() on a missing directory = %v, want nil", err)
+	}
+}
+
+func TestTrimFileHeadKeepsAppending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t.log")
+	if err := os.WriteFile(path, []byte("aaaa\nbbbb\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	appender, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer appender.Close()
+
+	if err := trimFileHead(path, 6); err != nil {
+		t.Fatalf("trimFileHead: %v", err)
+	}
+	if _, err := appender.WriteString("cccc\n"); err != nil {
+		t.Fatalf("WriteString: %v", err)
+	}
+	if got := readString(t, path); got != "bbbb\ncccc\n" {
+		t.Errorf("file = %q, want the trimmed content followed by the new line", got)
+	}
+}
+
+func TestRunClean(t *testing.T) {
+	chdir(t, t.TempDir())
+	if code := runClean(nil); code != 0 {
+		t.Errorf("runClean() without a state directory = %d, want 0", code)
+	}
+
+	writeAged(t, filepath.Join(stateDirName, "fallback.log"), "old", 60*24*time.Hour)
+	writeAged(t, filepath.Join(stateDirName, backupDirName, "f.go@20260301T000000.000000000"), "new", time.Hour)
+
+	if code := runClean([]string{"--expired", "--dry-run"}); code != 0 || !exists(filepath.Join(stateDirName, "fallback.log")) {
+		t.Errorf("runClean(--expired --dry-run) = %d and removed files, want 0 and nothing removed", code)
+	}
+	if code := runClean([]string{"--expired"}); code != 0 {
+		t.Fatalf("runClean(--expired) = %d, want 0", code)
+	}
+	if exists(filepath.Join(stateDirName, "fallback.log")) || !exists(filepath.Join(stateDirName, backupDirName)) {
+		t.Error("runClean(--expired) should remove only the expired log")
+	}
+
+	if code := runClean(nil); code != 0 || exists(stateDirName) {
+		t.Errorf("runClean() = %d, want 0 and the state directory removed", code)
+	}
+}
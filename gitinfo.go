@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// gitInfoMaxBytes caps {{.GitDiff}} and {{.GitStatus}}, so a file rewritten
+// wholesale (or a tree full of generated files) doesn't swamp the prompt
+const gitInfoMaxBytes = 32 * 1024
+
+// fileGitDiff is the uncommitted change to path relative to HEAD, as a
+// unified diff, for {{.GitDiff}}. It is empty for a file outside a
+// repository, an untracked file, or one without changes.
+func fileGitDiff(path string) string {
+	dir, name := filepath.Split(path)
+	diff, err := git(dir, nil, "diff", "--no-color", "--no-ext-diff", "HEAD", "--", name)
+	if err != nil {
+		return ""
+	}
+	return capGitInfo(diff)
+}
+
+// repoGitStatus is the short status of the repository holding path, for
+// {{.GitStatus}}: one line per changed or untracked file, with paths
+// relative to the top of the repository. It is empty outside a repository.
+func repoGitStatus(path string) string {
+	status, err := git(filepath.Dir(path), nil, "-c", "status.relativePaths=false", "status", "--short", "--untracked-files=normal", "--", ":/")
+	if err != nil {
+		return ""
+	}
+	return capGitInfo(status)
+}
+
+// capGitInfo cuts text down to gitInfoMaxBytes at a line boundary
+func capGitInfo(text string) string {
+	if len(text) <= gitInfoMaxBytes {
+		return text
+	}
+	cut := strings.LastIndexByte(text[:gitInfoMaxBytes], '\n')
+	if cut < 0 {
+		cut = gitInfoMaxBytes
+	}
+	return fmt.Sprintf("%s\n... (%d more bytes)", text[:cut], len(text)-cut)
+}
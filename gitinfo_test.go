@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateGitInfo(t *testing.T) {
+	dir := gitRepo(t)
+	file := filepath.Join(dir, "main.go")
+	writeTestFile(t, file, "package main\n\nfunc main() {}\n")
+	if err := os.MkdirAll(filepath.Join(dir, "pkg"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "pkg", "new.go"), "package pkg\n")
+
+	diff := fileGitDiff(file)
+	if !strings.Contains(diff, "+func main() {}") || !strings.Contains(diff, "--- a/main.go") {
+		t.Errorf("fileGitDiff = %q, want the change to main.go", diff)
+	}
+	if diff := fileGitDiff(filepath.Join(dir, "pkg", "new.go")); diff != "" {
+		t.Errorf("fileGitDiff of an untracked file = %q, want nothing", diff)
+	}
+
+	// Paths are relative to the top of the repository, wherever the file is
+	status := repoGitStatus(filepath.Join(dir, "pkg", "new.go"))
+	if status != " M main.go\n?? pkg/" {
+		t.Errorf("repoGitStatus = %q", status)
+	}
+
+	// Templates only run git when they use the fields
+	calls := 0
+	data := TemplateData{File: file, gitDiff: func() string { calls++; return fileGitDiff(file) }}
+	var out strings.Builder
+	template.Must(template.New("").Parse("{{.File}}")).Execute(&out, data)
+	if calls != 0 {
+		t.Errorf("git ran %d times for a template without {{.GitDiff}}", calls)
+	}
+	out.Reset()
+	template.Must(template.New("").Parse("{{.GitDiff}}|{{.GitStatus}}")).Execute(&out, data)
+	if calls != 1 || !strings.Contains(out.String(), "+func main() {}") || !strings.HasSuffix(out.String(), "|") {
+		t.Errorf("template output = %q after %d calls", out.String(), calls)
+	}
+}
+
+func TestTemplateGitInfoOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	file := filepath.Join(dir, "notes.txt")
+	writeTestFile(t, file, "x\n")
+	if diff, status := fileGitDiff(file), repoGitStatus(file); diff != "" || status != "" {
+		t.Errorf("outside a repository: diff %q, status %q; want nothing", diff, status)
+	}
+}
+
+func TestCapGitInfo(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	text := strings.Repeat(line, gitInfoMaxBytes/len(line)+10)
+	got := capGitInfo(text)
+	if len(got) > gitInfoMaxBytes+100 || !strings.Contains(got, "more bytes)") {
+		t.Errorf("capGitInfo kept %d bytes, ending %q", len(got), got[len(got)-40:])
+	}
+	if capGitInfo("short\n") != "short\n" {
+		t.Error("capGitInfo changed short text")
+	}
+}
@@ -7,7 +7,19 @@ toolchain go1.24.2
 require (
 	github.com/creack/pty v1.1.24
 	github.com/fsnotify/fsnotify v1.7.0
+	go.starlark.net v0.0.0-20250318223901-d9371fef63fe
 	golang.org/x/term v0.31.0
+	modernc.org/sqlite v1.34.5
 )
 
-require golang.org/x/sys v0.32.0 // indirect
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.32.0 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+)
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTimeSpec parses a --since/--until value: either a duration back from
+// now (e.g. "90m", "2h", or in days "2d") or an absolute time (RFC 3339,
+// "2006-01-02 15:04", or a bare date)
+func parseTimeSpec(spec string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		return now.Add(-d), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(spec, "d")); err == nil && strings.HasSuffix(spec, "d") && days >= 0 {
+		return now.AddDate(0, 0, -days), nil
+	}
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use a duration like 2h or 2d, or a time like 2006-01-02 15:04)", spec)
+}
+
+// runGrep implements "claudewatch grep": it searches the recorded session
+// transcript and prints matching lines. It returns the process exit code,
+// following grep's convention of 1 for no matches and 2 for errors.
+func runGrep(args []string) int {
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	since := fs.String("since", "", "Only show output after this time or duration ago (e.g. 2h)")
+	until := fs.String("until", "", "Only show output before this time or duration ago")
+	dispatch := fs.Int("dispatch", -1, "Only show output that followed this dispatch number")
+	ignoreCase := fs.Bool("i", false, "Match case-insensitively")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch grep [options] PATTERN")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Search the session transcript recorded with --record.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	expr := fs.Arg(0)
+	if *ignoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing pattern: %v\n", err)
+		return 2
+	}
+
+	filter := transcriptFilter{Pattern: pattern, Dispatch: *dispatch}
+	now := time.Now()
+	if *since != "" {
+		if filter.Since, err = parseTimeSpec(*since, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+			return 2
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseTimeSpec(*until, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --until: %v\n", err)
+			return 2
+		}
+	}
+
+	path := filepath.Join(stateDirName, transcriptFileName)
+	matches, err := searchTranscript(path, filter)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "No transcript at %s; start claudewatch with --record to record one\n", path)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error reading transcript: %v\n", err)
+		}
+		return 2
+	}
+
+	for _, entry := range matches {
+		fmt.Printf("%s [#%d] %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Dispatch, entry.Text)
+	}
+	if len(matches) == 0 {
+		return 1
+	}
+	return 0
+}
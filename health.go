@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// healthPingInterval is how often a session claudewatch doesn't run itself
+// is checked for still being reachable
+var healthPingInterval = 5 * time.Second
+
+// pinger is a backend that can check whether its session is still reachable
+type pinger interface {
+	ping() error
+}
+
+// reconnector is a backend that can find its session again once it is gone
+type reconnector interface {
+	reconnect() error
+}
+
+// monitorHealth pings dispatch's main session every healthPingInterval until
+// stop is closed. While it can't be reached, prompts are held; with
+// reconnect, the session is looked for again on each ping, and the held
+// prompts are sent once it is back. Without reconnect, an unreachable
+// session fails over to the fallback command if there is one.
+func monitorHealth(config *Config, dispatch *dispatcher, reconnect bool, stop <-chan struct{}) {
+	target, ok := dispatch.primary.(pinger)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(healthPingInterval)
+	defer ticker.Stop()
+
+	down := false
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := target.ping()
+		if err != nil {
+			warnLog(config, "Health ping of %s failed: %v", dispatch.primary.Name(), err)
+			if !reconnect && dispatch.failover(fmt.Sprintf("%s is unreachable: %v", dispatch.primary.Name(), err)) {
+				return
+			}
+			if !down {
+				down = true
+				dispatch.setUnavailable(true)
+				console.warn("claudewatch: %s is unreachable (%v); holding prompts", dispatch.primary.Name(), err)
+			}
+			if r, ok := dispatch.primary.(reconnector); ok && reconnect {
+				if err = r.reconnect(); err != nil {
+					warnLog(config, "Reconnecting failed: %v", err)
+				}
+			}
+		}
+		if err == nil && down {
+			down = false
+			console.notice("claudewatch: %s is reachable again; sending held prompts", dispatch.primary.Name())
+			dispatch.setUnavailable(false)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyBackend is a backend whose session can be taken down and brought back
+type flakyBackend struct {
+	mu         sync.Mutex
+	down       bool
+	reconnects int
+	prompts    []string
+}
+
+func (b *flakyBackend) Name() string { return "flaky" }
+
+func (b *flakyBackend) Send(prompt string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prompts = append(b.prompts, prompt)
+	return nil
+}
+
+func (b *flakyBackend) ping() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errors.New("pane is dead")
+	}
+	return nil
+}
+
+func (b *flakyBackend) reconnect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reconnects++
+	return errors.New("not back yet")
+}
+
+func (b *flakyBackend) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *flakyBackend) sent() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.prompts...)
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMonitorHealthHoldsPromptsUntilReachable(t *testing.T) {
+	defer func(interval time.Duration) { healthPingInterval = interval }(healthPingInterval)
+	healthPingInterval = 5 * time.Millisecond
+
+	primary := &flakyBackend{down: true}
+	d := &dispatcher{primary: primary}
+	stop := make(chan struct{})
+	defer close(stop)
+	go monitorHealth(&Config{}, d, true, stop)
+
+	waitFor(t, "a reconnect attempt", func() bool {
+		primary.mu.Lock()
+		defer primary.mu.Unlock()
+		return primary.reconnects > 0
+	})
+	if err := d.submit(promptRequest{Prompt: "held"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if got := primary.sent(); len(got) != 0 {
+		t.Fatalf("sent %q while the session was unreachable", got)
+	}
+
+	primary.setDown(false)
+	waitFor(t, "the held prompt", func() bool { return len(primary.sent()) == 1 })
+}
+
+func TestMonitorHealthFailsOverWithoutReconnect(t *testing.T) {
+	defer func(interval time.Duration) { healthPingInterval = interval }(healthPingInterval)
+	healthPingInterval = 5 * time.Millisecond
+
+	primary := &flakyBackend{down: true}
+	d := &dispatcher{primary: primary, fallback: &fakeBackend{name: "fallback"}}
+	stop := make(chan struct{})
+	defer close(stop)
+	go monitorHealth(&Config{}, d, false, stop)
+
+	waitFor(t, "failover", func() bool { return d.current() == d.fallback })
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	if primary.reconnects != 0 {
+		t.Errorf("reconnect was tried %d times without --reconnect", primary.reconnects)
+	}
+}
+
+func TestAttachedBackendFindsClaudeAgain(t *testing.T) {
+	root := t.TempDir()
+	uid := os.Getuid()
+	fakeProc(t, root, 300, uid, "/dev/pts/9", []string{"claude"}, []string{"TMUX_PANE=%2"})
+	fakeProc(t, root, 301, uid, "/dev/pts/3", []string{"claude"}, []string{"TMUX_PANE=%4"})
+
+	b := &attachedBackend{proc: &claudeProcess{PID: 100, TTY: "/dev/pts/3", TmuxPane: "%4"}, config: &Config{}}
+	proc, err := b.findAgain(root)
+	if err != nil {
+		t.Fatalf("findAgain() error = %v", err)
+	}
+	if proc.PID != 301 {
+		t.Errorf("findAgain() = pid %d, want 301 in the same tmux pane", proc.PID)
+	}
+
+	b = &attachedBackend{proc: &claudeProcess{PID: 100, TTY: "/dev/pts/5"}, config: &Config{}}
+	if _, err := b.findAgain(root); err == nil {
+		t.Error("findAgain() attached to a Claude on another terminal")
+	}
+	b.config.AttachAuto = true
+	if _, err := b.findAgain(root); err == nil {
+		t.Error("findAgain() picked one of two candidates with --attach-auto")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Registers the "sqlite" database/sql driver
+)
+
+// historyFileName is the SQLite database in the state directory that keeps
+// every dispatched instruction, for "claudewatch history"
+const historyFileName = "history.db"
+
+// historyTimeLayout is how times are stored in the database: in UTC, with a
+// fixed width, so they sort and compare as text
+const historyTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// Outcomes of a dispatched instruction
+const (
+	outcomeSent      = "sent"      // Typed into (or run by) its session
+	outcomeFailed    = "failed"    // Its session couldn't take it; the markers were put back
+	outcomeCancelled = "cancelled" // A pre_send hook stopped it; the markers were put back
+)
+
+const historySchema = `
+CREATE TABLE IF NOT EXISTS instructions (
+	id          INTEGER PRIMARY KEY,
+	time        TEXT NOT NULL,
+	number      INTEGER NOT NULL,
+	session     TEXT NOT NULL,
+	file        TEXT NOT NULL,
+	instruction TEXT NOT NULL,
+	markers     TEXT NOT NULL,
+	prompt      TEXT NOT NULL,
+	outcome     TEXT NOT NULL,
+	error       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS instructions_time ON instructions (time);
+`
+
+// historyEntry is one dispatched instruction
+type historyEntry struct {
+	Time        time.Time
+	Number      int          // The prompt's number in its claudewatch session; 0 if cancelled before it got one
+	Session     string       // Name of the session it was sent to
+	File        string       // Absolute path of the file its markers were in; empty for "claudewatch send"
+	Instruction string       // The first marker's instruction
+	Markers     []markerSite // Where its markers were, with the text they had
+	Prompt      string       // The prompt as rendered
+	Outcome     string       // outcomeSent, outcomeFailed or outcomeCancelled
+	Error       string       // Why it failed or was cancelled
+}
+
+// instructionHistory records dispatched instructions in the history database
+type instructionHistory struct {
+	db   *sql.DB
+	path string
+}
+
+// openHistory opens (creating if need be) the history database at path
+func openHistory(path string) (*instructionHistory, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &instructionHistory{db: db, path: path}, nil
+}
+
+// openSessionHistory opens the history database in the state directory for a
+// watch session. Without one, instructions are still sent, only not
+// recorded; nil is returned after a warning.
+func openSessionHistory(config *Config) *instructionHistory {
+	stateDir, err := ensureStateDir()
+	if err == nil {
+		var history *instructionHistory
+		if history, err = openHistory(filepath.Join(stateDir, historyFileName)); err == nil {
+			debugLog(config, "Recording instructions in %s", history.path)
+			return history
+		}
+	}
+	console.warn("Not recording instruction history: %v", err)
+	return nil
+}
+
+// record adds entry to the history, warning if it can't
+func (h *instructionHistory) record(entry historyEntry) {
+	if h == nil {
+		return
+	}
+	markers, err := json.Marshal(entry.Markers)
+	if err == nil {
+		_, err = h.db.Exec(
+			`INSERT INTO instructions (time, number, session, file, instruction, markers, prompt, outcome, error)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.Time.UTC().Format(historyTimeLayout), entry.Number, entry.Session, entry.File,
+			entry.Instruction, string(markers), entry.Prompt, entry.Outcome, entry.Error)
+	}
+	if err != nil {
+		console.warn("Could not record prompt #%d in %s: %v", entry.Number, h.path, err)
+	}
+}
+
+// historyFilter selects history entries; zero fields don't filter
+type historyFilter struct {
+	Since time.Time
+	Until time.Time
+	File  string // An absolute path: entries for this file, or for files under this directory
+	Limit int    // Only the newest this many
+}
+
+// query returns the entries matching filter, oldest first
+func (h *instructionHistory) query(filter historyFilter) ([]historyEntry, error) {
+	var where []string
+	var args []interface{}
+	if !filter.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, filter.Since.UTC().Format(historyTimeLayout))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "time <= ?")
+		args = append(args, filter.Until.UTC().Format(historyTimeLayout))
+	}
+	if filter.File != "" {
+		where = append(where, "(file = ? OR substr(file, 1, ?) = ?)")
+		dir := strings.TrimSuffix(filter.File, string(filepath.Separator)) + string(filepath.Separator)
+		args = append(args, filter.File, len(dir), dir)
+	}
+	query := "SELECT time, number, session, file, instruction, markers, prompt, outcome, error FROM instructions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []historyEntry
+	for rows.Next() {
+		var entry historyEntry
+		var at, markers string
+		if err := rows.Scan(&at, &entry.Number, &entry.Session, &entry.File, &entry.Instruction, &markers, &entry.Prompt, &entry.Outcome, &entry.Error); err != nil {
+			return nil, err
+		}
+		if entry.Time, err = time.Parse(historyTimeLayout, at); err != nil {
+			return nil, fmt.Errorf("entry with time %q: %w", at, err)
+		}
+		if err := json.Unmarshal([]byte(markers), &entry.Markers); err != nil {
+			return nil, fmt.Errorf("entry from %s: markers: %w", at, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Newest were selected first, for the limit; list them oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// prune deletes the entries recorded before cutoff and returns how many
+func (h *instructionHistory) prune(cutoff time.Time) (int64, error) {
+	result, err := h.db.Exec("DELETE FROM instructions WHERE time < ?", cutoff.UTC().Format(historyTimeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// close closes the database
+func (h *instructionHistory) close() error {
+	if h == nil {
+		return nil
+	}
+	return h.db.Close()
+}
+
+// recordHistory records req in the history with the given outcome, as prompt
+// number n (0 for one that was never numbered). It is called with sendMu held.
+func (d *dispatcher) recordHistory(req promptRequest, n int, outcome string, err error) {
+	if d.history == nil || req.Reset {
+		return
+	}
+	entry := historyEntry{
+		Time:        time.Now(),
+		Number:      n,
+		Session:     d.current().Name(),
+		Instruction: req.Instruction,
+		Markers:     req.Sites,
+		Prompt:      req.Prompt,
+		Outcome:     outcome,
+	}
+	if req.Target != nil {
+		entry.Session = req.Target.Name()
+	}
+	if req.File != "" {
+		entry.File, _ = filepath.Abs(req.File)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	d.history.record(entry)
+}
+
+// runHistory implements "claudewatch history": it lists the instructions
+// recorded in the history database. It returns the process exit code.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	file := fs.String("file", "", "Only show instructions for this file, or for files under this directory")
+	since := fs.String("since", "", "Only show instructions sent after this time or duration ago (e.g. 2d)")
+	until := fs.String("until", "", "Only show instructions sent before this time or duration ago")
+	limit := fs.Int("n", 0, "Only show the newest N instructions")
+	verbose := fs.Bool("v", false, "Also show each instruction's markers and full prompt")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch history [options]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "List the instructions claudewatch has dispatched in this directory.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	filter := historyFilter{Limit: *limit}
+	now := time.Now()
+	var err error
+	if *since != "" {
+		if filter.Since, err = parseTimeSpec(*since, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+			return 2
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseTimeSpec(*until, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --until: %v\n", err)
+			return 2
+		}
+	}
+	if *file != "" {
+		if filter.File, err = filepath.Abs(*file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --file: %v\n", err)
+			return 2
+		}
+	}
+
+	path := filepath.Join(stateDirName, historyFileName)
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "No instruction history at %s; it is recorded as claudewatch sends prompts\n", path)
+		return 1
+	}
+	history, err := openHistory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	defer history.close()
+	entries, err := history.query(filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return 2
+	}
+
+	for _, entry := range entries {
+		fmt.Println(formatHistoryEntry(entry, *verbose))
+	}
+	return 0
+}
+
+// formatHistoryEntry formats entry for "claudewatch history": one line, or
+// with verbose its markers and prompt too
+func formatHistoryEntry(entry historyEntry, verbose bool) string {
+	file := entry.File
+	if file == "" {
+		file = "-" // Sent with "claudewatch send"
+	} else if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+	outcome := entry.Outcome
+	if entry.Error != "" {
+		outcome += " (" + entry.Error + ")"
+	}
+	number := "#-"
+	if entry.Number > 0 {
+		number = fmt.Sprintf("#%d", entry.Number)
+	}
+	line := fmt.Sprintf("%s %s %s %s: %s", entry.Time.Local().Format("2006-01-02 15:04:05"), number, file, outcome, entry.Instruction)
+	if !verbose {
+		return line
+	}
+
+	var out strings.Builder
+	out.WriteString(line + "\n")
+	out.WriteString("  Session: " + entry.Session + "\n")
+	for _, site := range entry.Markers {
+		fmt.Fprintf(&out, "  Line %d: %s\n", site.Line, strings.TrimSpace(site.Text))
+	}
+	for _, promptLine := range strings.Split(strings.TrimRight(entry.Prompt, "\n"), "\n") {
+		out.WriteString("    " + promptLine + "\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHistory opens a history database in a temporary directory
+func testHistory(t *testing.T) *instructionHistory {
+	t.Helper()
+	history, err := openHistory(filepath.Join(t.TempDir(), historyFileName))
+	if err != nil {
+		t.Fatalf("openHistory: %v", err)
+	}
+	t.Cleanup(func() { history.close() })
+	return history
+}
+
+func TestHistoryQuery(t *testing.T) {
+	history := testHistory(t)
+	day := 24 * time.Hour
+	now := time.Now()
+	sites := []markerSite{{File: "/src/a.go", Line: 3, Text: "// use a map ai!"}} // ai:ignore
+	for _, entry := range []historyEntry{
+		{Time: now.Add(-3 * day), Number: 1, File: "/src/a.go", Instruction: "old", Markers: sites, Outcome: outcomeSent},
+		{Time: now.Add(-time.Hour), Number: 2, File: "/src/lib/b.go", Instruction: "newer", Outcome: outcomeFailed, Error: "pty closed"},
+		{Time: now, Number: 3, File: "/src/ab.go", Instruction: "newest", Outcome: outcomeSent},
+	} {
+		history.record(entry)
+	}
+
+	instructions := func(filter historyFilter) string {
+		t.Helper()
+		entries, err := history.query(filter)
+		if err != nil {
+			t.Fatalf("query(%+v): %v", filter, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Instruction)
+		}
+		return strings.Join(got, ",")
+	}
+	tests := []struct {
+		filter historyFilter
+		want   string
+	}{
+		{historyFilter{}, "old,newer,newest"},
+		{historyFilter{Since: now.Add(-2 * day)}, "newer,newest"},
+		{historyFilter{Until: now.Add(-2 * day)}, "old"},
+		{historyFilter{File: "/src/a.go"}, "old"},
+		{historyFilter{File: "/src/lib"}, "newer"},
+		{historyFilter{File: "/src/"}, "old,newer,newest"},
+		{historyFilter{Limit: 2}, "newer,newest"},
+	}
+	for _, tt := range tests {
+		if got := instructions(tt.filter); got != tt.want {
+			t.Errorf("query(%+v) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+
+	entries, err := history.query(historyFilter{File: "/src/a.go"})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("query = %v, %v", entries, err)
+	}
+	if got := entries[0]; len(got.Markers) != 1 || got.Markers[0] != sites[0] || !got.Time.Equal(now.Add(-3*day).Truncate(time.Microsecond)) {
+		t.Errorf("entry = %+v, want its markers and time kept", got)
+	}
+
+	if n, err := history.prune(now.Add(-2 * day)); err != nil || n != 1 {
+		t.Errorf("prune = %d, %v; want the oldest entry removed", n, err)
+	}
+	if got := instructions(historyFilter{}); got != "newer,newest" {
+		t.Errorf("after prune = %s", got)
+	}
+}
+
+func TestDispatcherRecordsHistory(t *testing.T) {
+	history := testHistory(t)
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, history: history}
+
+	sites := []markerSite{{File: "/src/main.go", Line: 2, Text: "// use a map ai!"}} // ai:ignore
+	if err := d.deliver(promptRequest{Prompt: "Fix it", File: "main.go", Instruction: "use a map", Sites: sites}); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+	primary.err = errors.New("pty closed")
+	if err := d.deliver(promptRequest{Prompt: "Fix that", File: "main.go", Instruction: "and that"}); err == nil {
+		t.Fatal("deliver() to a failing backend succeeded")
+	}
+	old := resetSettleDelay
+	resetSettleDelay = 0
+	defer func() { resetSettleDelay = old }()
+	primary.err = nil
+	if err := d.deliver(promptRequest{Reset: true, Prompt: clearCommand}); err != nil {
+		t.Fatalf("deliver() of a reset = %v", err)
+	}
+	d.hooks = newSendHooks(&Config{FileConfig: &FileConfig{Hooks: &HooksConfig{PreSend: hookCommands{"exit 1"}}}})
+	if err := d.deliver(promptRequest{Prompt: "Fix more", Instruction: "more"}); err == nil {
+		t.Fatal("deliver() past a failing pre_send hook succeeded")
+	}
+
+	entries, err := history.query(historyFilter{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("recorded %+v, want 3 entries (resets aren't recorded)", entries)
+	}
+	abs, _ := filepath.Abs("main.go")
+	sent, failed, cancelled := entries[0], entries[1], entries[2]
+	if sent.Number != 1 || sent.Outcome != outcomeSent || sent.File != abs || sent.Session != "primary" || sent.Prompt != "Fix it" || len(sent.Markers) != 1 {
+		t.Errorf("sent entry = %+v", sent)
+	}
+	if failed.Number != 2 || failed.Outcome != outcomeFailed || failed.Error != "pty closed" {
+		t.Errorf("failed entry = %+v", failed)
+	}
+	if cancelled.Number != 0 || cancelled.Outcome != outcomeCancelled || cancelled.File != "" {
+		t.Errorf("cancelled entry = %+v", cancelled)
+	}
+}
+
+func TestFormatHistoryEntry(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	entry := historyEntry{
+		Time:        at,
+		Number:      4,
+		Session:     "interactive Claude",
+		File:        filepath.Join(cwd, "src", "a.go"),
+		Instruction: "use a map",
+		Markers:     []markerSite{{Line: 3, Text: "  // use a map ai!"}}, // ai:ignore
+		Prompt:      "Modify a.go\nLine 3",
+		Outcome:     outcomeFailed,
+		Error:       "pty closed",
+	}
+	want := "2026-03-01 10:00:00 #4 " + filepath.Join("src", "a.go") + " failed (pty closed): use a map"
+	if got := formatHistoryEntry(entry, false); got != want {
+		t.Errorf("formatHistoryEntry = %q, want %q", got, want)
+	}
+	verbose := formatHistoryEntry(entry, true)
+	for _, part := range []string{"Session: interactive Claude", "Line 3: // use a map ai!", "    Modify a.go\n    Line 3"} { // ai:ignore
+		if !strings.Contains(verbose, part) {
+			t.Errorf("verbose entry %q doesn't contain %q", verbose, part)
+		}
+	}
+
+	entry.Number, entry.File = 0, ""
+	if got := formatHistoryEntry(entry, false); !strings.HasPrefix(got, "2026-03-01 10:00:00 #- - failed") {
+		t.Errorf("entry without a number or file = %q", got)
+	}
+}
+
+func TestPruneStateDirTrimsHistory(t *testing.T) {
+	stateDir := t.TempDir()
+	path := filepath.Join(stateDir, historyFileName)
+	history, err := openHistory(path)
+	if err != nil {
+		t.Fatalf("openHistory: %v", err)
+	}
+	history.record(historyEntry{Time: time.Now().AddDate(0, 0, -10), Instruction: "old", Outcome: outcomeSent})
+	history.record(historyEntry{Time: time.Now(), Instruction: "new", Outcome: outcomeSent})
+	history.close()
+	old := time.Now().AddDate(0, 0, -10)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	if _, err := pruneStateDir(stateDir, retentionPolicy{KeepDays: 7}, time.Now()); err != nil {
+		t.Fatalf("pruneStateDir: %v", err)
+	}
+	history, err = openHistory(path)
+	if err != nil {
+		t.Fatalf("history database removed: %v", err)
+	}
+	defer history.close()
+	entries, err := history.query(historyFilter{})
+	if err != nil || len(entries) != 1 || entries[0].Instruction != "new" {
+		t.Errorf("entries after pruning = %+v, %v; want only the new one", entries, err)
+	}
+}
+
+func TestRunHistoryWithoutDatabase(t *testing.T) {
+	chdir(t, t.TempDir())
+	if code := runHistory(nil); code != 1 {
+		t.Errorf("runHistory without a database = %d, want 1", code)
+	}
+	if code := runHistory([]string{"--since", "soon"}); code != 2 {
+		t.Errorf("runHistory with a bad --since = %d, want 2", code)
+	}
+}
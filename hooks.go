@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HooksConfig lists shell commands run around each prompt sent to Claude
+type HooksConfig struct {
+	// PreSend commands run before a prompt is sent, in order; one that exits
+	// non-zero cancels the prompt and puts its markers back
+	PreSend hookCommands `json:"pre_send"`
+	// PostSend commands run once a prompt has been sent
+	PostSend hookCommands `json:"post_send"`
+}
+
+// hookCommands is a list of shell commands, written in the config file as
+// one string or a list of them
+type hookCommands []string
+
+// UnmarshalJSON accepts a single command as well as a list
+func (h *hookCommands) UnmarshalJSON(data []byte) error {
+	var command string
+	if err := json.Unmarshal(data, &command); err == nil {
+		*h = nil
+		if strings.TrimSpace(command) != "" {
+			*h = hookCommands{command}
+		}
+		return nil
+	}
+	var commands []string
+	if err := json.Unmarshal(data, &commands); err != nil {
+		return errors.New("hooks: want a command or a list of commands")
+	}
+	*h = commands
+	return nil
+}
+
+// hookTimeout bounds how long a hook command may run before it is killed,
+// which for a pre_send hook cancels the prompt
+var hookTimeout = 2 * time.Minute
+
+// sendHooks runs the hooks of the config file around each prompt. Commands
+// run with sh -c in claudewatch's directory, with the prompt's details in
+// the environment:
+//
+//	CLAUDEWATCH_HOOK           pre_send or post_send
+//	CLAUDEWATCH_FILE           the file the prompt is for (comma-separated when coalesced)
+//	CLAUDEWATCH_PROMPT         the prompt as rendered
+//	CLAUDEWATCH_INSTRUCTION    the first marker's instruction
+//	CLAUDEWATCH_PROMPT_NUMBER  the prompt's number this session (post_send only)
+type sendHooks struct {
+	config   *Config
+	preSend  []string
+	postSend []string
+}
+
+// newSendHooks returns the hooks of the config file, or nil if it has none
+func newSendHooks(config *Config) *sendHooks {
+	if config.FileConfig == nil || config.FileConfig.Hooks == nil {
+		return nil
+	}
+	hooks := config.FileConfig.Hooks
+	if len(hooks.PreSend) == 0 && len(hooks.PostSend) == 0 {
+		return nil
+	}
+	return &sendHooks{config: config, preSend: hooks.PreSend, postSend: hooks.PostSend}
+}
+
+// beforeSend runs the pre_send hooks for req, returning an error from the
+// first that fails, in which case req must not be sent
+func (h *sendHooks) beforeSend(req promptRequest) error {
+	env := hookEnv("pre_send", req)
+	for _, command := range h.preSend {
+		if err := h.run(command, env); err != nil {
+			return fmt.Errorf("pre_send hook %w", err)
+		}
+	}
+	return nil
+}
+
+// afterSend runs the post_send hooks for req, sent as prompt n. Failures
+// are only reported, as the prompt is on its way.
+func (h *sendHooks) afterSend(n int, req promptRequest) {
+	env := append(hookEnv("post_send", req), "CLAUDEWATCH_PROMPT_NUMBER="+strconv.Itoa(n))
+	for _, command := range h.postSend {
+		if err := h.run(command, env); err != nil {
+			console.warn("post_send hook %v", err)
+		}
+	}
+}
+
+// run runs one hook command with env added to claudewatch's environment
+func (h *sendHooks) run(command string, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	infoLog(h.config, "Running hook: %s", command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second // Don't wait on children still holding the output open
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%q timed out after %s", command, hookTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(output.String()); msg != "" {
+			return fmt.Errorf("%q failed: %v: %s", command, err, firstLine(msg))
+		}
+		return fmt.Errorf("%q failed: %v", command, err)
+	}
+	if msg := strings.TrimSpace(output.String()); msg != "" {
+		debugLog(h.config, "Hook %q printed: %s", command, msg)
+	}
+	return nil
+}
+
+// hookEnv is the environment describing req to a hook
+func hookEnv(hook string, req promptRequest) []string {
+	return []string{
+		"CLAUDEWATCH_HOOK=" + hook,
+		"CLAUDEWATCH_FILE=" + req.File,
+		"CLAUDEWATCH_PROMPT=" + req.Prompt,
+		"CLAUDEWATCH_INSTRUCTION=" + req.Instruction,
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHookCommandsUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want hookCommands
+	}{
+		{`{"pre_send": "make lint"}`, hookCommands{"make lint"}},
+		{`{"pre_send": ["a", "b"]}`, hookCommands{"a", "b"}},
+		{`{"pre_send": ""}`, nil},
+	}
+	for _, tt := range tests {
+		var hooks HooksConfig
+		if err := json.Unmarshal([]byte(tt.json), &hooks); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.json, err)
+			continue
+		}
+		if !reflect.DeepEqual(hooks.PreSend, tt.want) {
+			t.Errorf("Unmarshal(%s) = %q, want %q", tt.json, hooks.PreSend, tt.want)
+		}
+	}
+
+	var hooks HooksConfig
+	if err := json.Unmarshal([]byte(`{"pre_send": 3}`), &hooks); err == nil {
+		t.Error("Unmarshal of a number succeeded")
+	}
+}
+
+func TestNewSendHooksWithoutHooks(t *testing.T) {
+	for _, config := range []*Config{
+		{},
+		{FileConfig: &FileConfig{}},
+		{FileConfig: &FileConfig{Hooks: &HooksConfig{}}},
+	} {
+		if hooks := newSendHooks(config); hooks != nil {
+			t.Errorf("newSendHooks(%+v) = %+v, want nil", config.FileConfig, hooks)
+		}
+	}
+}
+
+func TestDispatcherRunsHooks(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "hooks.log")
+	config := &Config{FileConfig: &FileConfig{Hooks: &HooksConfig{
+		PreSend:  hookCommands{`echo "pre $CLAUDEWATCH_FILE $CLAUDEWATCH_INSTRUCTION" >> ` + log},
+		PostSend: hookCommands{`echo "post $CLAUDEWATCH_PROMPT_NUMBER $CLAUDEWATCH_PROMPT" >> ` + log},
+	}}}
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, hooks: newSendHooks(config)}
+
+	req := promptRequest{Prompt: "Fix it", File: "main.go", Instruction: "use a map"}
+	if err := d.deliver(req); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+	if len(primary.prompts) != 1 {
+		t.Errorf("primary got %d prompts, want 1", len(primary.prompts))
+	}
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := "pre main.go use a map\npost 1 Fix it\n"; string(got) != want {
+		t.Errorf("hooks wrote %q, want %q", got, want)
+	}
+
+	// Resets don't run hooks
+	if err := os.Remove(log); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	old := resetSettleDelay
+	resetSettleDelay = 0
+	defer func() { resetSettleDelay = old }()
+	if err := d.deliver(promptRequest{Reset: true}); err != nil {
+		t.Fatalf("deliver() of a reset = %v", err)
+	}
+	if _, err := os.Stat(log); err == nil {
+		t.Error("hooks ran for a reset")
+	}
+}
+
+func TestDispatcherPreSendHookCancels(t *testing.T) {
+	config := &Config{FileConfig: &FileConfig{Hooks: &HooksConfig{
+		PreSend:  hookCommands{"true", "echo not today >&2; exit 3"},
+		PostSend: hookCommands{"echo post >> " + filepath.Join(t.TempDir(), "post.log")},
+	}}}
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, hooks: newSendHooks(config)}
+
+	restored, done := 0, 0
+	req := promptRequest{
+		Prompt:  "Fix it",
+		File:    "main.go",
+		Restore: func() { restored++ },
+		Done:    func() { done++ },
+	}
+	err := d.deliver(req)
+	if err == nil || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("deliver() = %v, want the hook's failure", err)
+	}
+	if len(primary.prompts) != 0 {
+		t.Errorf("primary got %v, want nothing sent", primary.prompts)
+	}
+	if restored != 1 || done != 0 {
+		t.Errorf("restored %d times and done %d times, want 1 and 0", restored, done)
+	}
+	if d.count != 0 {
+		t.Errorf("count = %d, want a cancelled prompt not counted", d.count)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"container/list"
+	"path/filepath"
+	"sync"
+)
+
+// Bounds of the ignore cache: how many directories it remembers, and how many
+// names in each
+const (
+	ignoreCacheMaxDirs  = 256
+	ignoreCacheMaxNames = 256
+)
+
+// ignoreDecision is a memoized result of matching a path against the ignore rules
+type ignoreDecision struct {
+	ignore bool
+	reason string
+}
+
+// dirIgnoreRules are the ignore rules that apply to the files of one
+// directory, beyond the patterns that apply everywhere
+type dirIgnoreRules struct {
+	projectRoot     string         // Top of the project whose .claudewatchignore applies; "" for none
+	projectPatterns IgnorePatterns // The patterns of that .claudewatchignore
+}
+
+// ignoreDirEntry is what the ignore cache knows about one directory
+type ignoreDirEntry struct {
+	dir       string
+	rules     dirIgnoreRules
+	decisions map[string]ignoreDecision // By base name; at most ignoreCacheMaxNames
+}
+
+// ignoreCache memoizes ignore decisions per directory so event storms don't
+// re-run every ignore regex for each event. Each directory keeps the rules
+// that apply to it and the decisions made for its files. The least recently
+// used directory is dropped once ignoreCacheMaxDirs are cached, and the whole
+// cache is dropped whenever the ignore patterns are reloaded.
+type ignoreCache struct {
+	mu         sync.Mutex
+	dirs       map[string]*list.Element // Directory to its *ignoreDirEntry in lru
+	lru        *list.List               // Most recently used first
+	generation uint64                   // Bumped by invalidate, so decisions computed before it are not stored
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// ignoreCacheStats are the ignore cache's counters since startup
+type ignoreCacheStats struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64 // Directories dropped to stay within ignoreCacheMaxDirs
+	dirs      int    // Directories cached now
+}
+
+func newIgnoreCache() *ignoreCache {
+	return &ignoreCache{dirs: make(map[string]*list.Element), lru: list.New()}
+}
+
+// lookup returns the cached decision for path, matching it against the rules
+// of config and storing the result on a miss.
+func (c *ignoreCache) lookup(path string, config *Config) (bool, string) {
+	dir, base := filepath.Split(path)
+
+	c.mu.Lock()
+	var rules dirIgnoreRules
+	known := false
+	if elem, ok := c.dirs[dir]; ok {
+		c.lru.MoveToFront(elem)
+		entry := elem.Value.(*ignoreDirEntry)
+		if decision, ok := entry.decisions[base]; ok {
+			c.hits++
+			c.mu.Unlock()
+			return decision.ignore, decision.reason
+		}
+		rules, known = entry.rules, true
+	}
+	c.misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	if !known {
+		rules = ignoreRulesFor(path, config)
+	}
+	ignore, reason := matchIgnoreRules(path, config, rules)
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.store(dir, rules).add(base, ignoreDecision{ignore: ignore, reason: reason})
+	}
+	c.mu.Unlock()
+
+	return ignore, reason
+}
+
+// store returns the entry of dir, adding one with rules, and evicting the
+// least recently used directory if that makes too many, if there is none.
+// c.mu must be held.
+func (c *ignoreCache) store(dir string, rules dirIgnoreRules) *ignoreDirEntry {
+	if elem, ok := c.dirs[dir]; ok {
+		return elem.Value.(*ignoreDirEntry)
+	}
+	entry := &ignoreDirEntry{dir: dir, rules: rules, decisions: make(map[string]ignoreDecision)}
+	c.dirs[dir] = c.lru.PushFront(entry)
+	if c.lru.Len() > ignoreCacheMaxDirs {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.dirs, oldest.Value.(*ignoreDirEntry).dir)
+		c.evictions++
+	}
+	return entry
+}
+
+// add records the decision for name, unless the directory already holds as
+// many as it may
+func (e *ignoreDirEntry) add(name string, decision ignoreDecision) {
+	if len(e.decisions) < ignoreCacheMaxNames {
+		e.decisions[name] = decision
+	}
+}
+
+// invalidate drops every cached decision. Call it after the ignore rules change.
+func (c *ignoreCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirs = make(map[string]*list.Element)
+	c.lru.Init()
+	c.generation++
+}
+
+// stats returns the cache's counters since startup
+func (c *ignoreCache) stats() ignoreCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ignoreCacheStats{hits: c.hits, misses: c.misses, evictions: c.evictions, dirs: c.lru.Len()}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestIgnoreCacheMemoizesDecisions(t *testing.T) {
+	config := &Config{
+		IgnorePatterns: IgnorePatterns{regexp.MustCompile(`\.js$`)},
+		IgnoreCache:    newIgnoreCache(),
+	}
+
+	for i := 0; i < 3; i++ {
+		ignore, reason := ShouldIgnorePathWithConfig("/path/to/file.js", config)
+		if !ignore || reason != ".claudewatchignore pattern" {
+			t.Fatalf("ShouldIgnorePathWithConfig() = %v, %q; want true, %q", ignore, reason, ".claudewatchignore pattern")
+		}
+	}
+	if ignore, _ := ShouldIgnorePathWithConfig("/path/to/file.go", config); ignore {
+		t.Errorf("ShouldIgnorePathWithConfig(file.go) = true, want false")
+	}
+
+	stats := config.IgnoreCache.stats()
+	if stats.hits != 2 || stats.misses != 2 || stats.dirs != 1 {
+		t.Errorf("stats() = %+v; want 2 hits, 2 misses, 1 directory", stats)
+	}
+}
+
+func TestIgnoreCacheIsBounded(t *testing.T) {
+	config := &Config{
+		IgnorePatterns: IgnorePatterns{regexp.MustCompile(`\.js$`)},
+		IgnoreCache:    newIgnoreCache(),
+	}
+
+	for i := 0; i < ignoreCacheMaxDirs+10; i++ {
+		ShouldIgnorePathWithConfig(fmt.Sprintf("/dir%d/file.js", i), config)
+	}
+	for i := 0; i < ignoreCacheMaxNames+10; i++ {
+		ShouldIgnorePathWithConfig(fmt.Sprintf("/busy/file%d.js", i), config)
+	}
+
+	stats := config.IgnoreCache.stats()
+	if stats.dirs != ignoreCacheMaxDirs {
+		t.Errorf("%d directories cached, want at most %d", stats.dirs, ignoreCacheMaxDirs)
+	}
+	if stats.evictions != 11 {
+		t.Errorf("%d evictions, want 11", stats.evictions)
+	}
+	entry := config.IgnoreCache.dirs["/busy/"].Value.(*ignoreDirEntry)
+	if len(entry.decisions) != ignoreCacheMaxNames {
+		t.Errorf("%d decisions cached for /busy/, want at most %d", len(entry.decisions), ignoreCacheMaxNames)
+	}
+	// The first directory was the least recently used, so it went first
+	if _, ok := config.IgnoreCache.dirs["/dir0/"]; ok {
+		t.Errorf("/dir0/ is still cached, want it evicted")
+	}
+
+	// A name past the bound is still decided correctly
+	if ignore, _ := ShouldIgnorePathWithConfig("/busy/file9999.js", config); !ignore {
+		t.Errorf("ShouldIgnorePathWithConfig(/busy/file9999.js) = false, want true")
+	}
+}
+
+func TestIgnoreCacheInvalidatedOnReload(t *testing.T) {
+	root := t.TempDir()
+	ignoreFile := filepath.Join(root, ".claudewatchignore")
+	if err := os.WriteFile(ignoreFile, []byte(`\.js$`+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	config := &Config{RootDirectories: []string{root}, IgnoreCache: newIgnoreCache()}
+	loadAllIgnorePatterns(config)
+
+	path := filepath.Join(root, "file.js")
+	if ignore, _ := ShouldIgnorePathWithConfig(path, config); !ignore {
+		t.Fatalf("expected %s to be ignored before reload", path)
+	}
+
+	if err := os.WriteFile(ignoreFile, []byte(`\.ts$`+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	loadAllIgnorePatterns(config)
+
+	if ignore, _ := ShouldIgnorePathWithConfig(path, config); ignore {
+		t.Errorf("expected %s not to be ignored after reload (stale cache entry)", path)
+	}
+}
+
+func TestIsRootIgnoreFile(t *testing.T) {
+	root := t.TempDir()
+	config := &Config{RootDirectories: []string{root}}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"Root ignore file", filepath.Join(root, ".claudewatchignore"), true},
+		{"Nested ignore file", filepath.Join(root, "sub", ".claudewatchignore"), false},
+		{"Other file in root", filepath.Join(root, "main.go"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRootIgnoreFile(tt.path, config); got != tt.want {
+				t.Errorf("isRootIgnoreFile(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
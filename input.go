@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// inputRouter forwards the user's keystrokes to Claude, except while
+// claudewatch itself is asking a question, when they are kept for the asker
+// instead.
+type inputRouter struct {
+	mu     sync.Mutex
+	keys   *sync.Cond // Signaled when held grows or input closes
+	dest   io.Writer
+	asking bool   // True while a question is reading keys
+	held   []byte // Keys typed during a question and not read yet
+	closed bool   // True once the input is exhausted
+
+	hotkey   byte   // Key kept from Claude and handed to onHotkey instead
+	onHotkey func() // Called, on its own goroutine, when hotkey is pressed; nil for no hotkey
+}
+
+func newInputRouter(dest io.Writer) *inputRouter {
+	r := &inputRouter{dest: dest}
+	r.keys = sync.NewCond(&r.mu)
+	return r
+}
+
+// run copies src to the destination until src is exhausted, then fails any
+// question still waiting for a key
+func (r *inputRouter) run(src io.Reader) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			r.route(buf[:n])
+		}
+		if err != nil {
+			r.mu.Lock()
+			r.closed = true
+			r.keys.Broadcast()
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+// route delivers one chunk of input
+func (r *inputRouter) route(chunk []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.asking {
+		r.held = append(r.held, chunk...)
+		r.keys.Broadcast()
+		return
+	}
+	if r.onHotkey != nil && bytes.IndexByte(chunk, r.hotkey) >= 0 {
+		chunk = bytes.ReplaceAll(chunk, []byte{r.hotkey}, nil)
+		go r.onHotkey()
+	}
+	if len(chunk) > 0 {
+		_, _ = r.dest.Write(chunk)
+	}
+}
+
+// readKey waits for the user's next keypress and returns it, keeping it from
+// reaching Claude. ok is false once the input is closed. Keys keep being held
+// for the question until doneAsking.
+func (r *inputRouter) readKey() (key byte, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.asking = true
+	for len(r.held) == 0 && !r.closed {
+		r.keys.Wait()
+	}
+	if len(r.held) == 0 {
+		return 0, false
+	}
+	key = r.held[0]
+	r.held = r.held[1:]
+	return key, true
+}
+
+// doneAsking ends a question, passing on to Claude whatever was typed after
+// its answer
+func (r *inputRouter) doneAsking() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.asking = false
+	if len(r.held) > 0 {
+		_, _ = r.dest.Write(r.held)
+		r.held = nil
+	}
+}
+
+// confirm prints question to stderr and waits for a y/n answer. Anything other
+// than y or Y counts as no, as does closed input.
+func (r *inputRouter) confirm(question string) bool {
+	defer r.doneAsking()
+
+	console.ask(question + " [y/N]")
+	key, ok := r.readKey()
+	answer := ok && (key == 'y' || key == 'Y')
+	if answer {
+		console.answer("y")
+	} else {
+		console.answer("n")
+	}
+	return answer
+}
+
+// pickerKeys are the keys that toggle the items of a pick, in order
+const pickerKeys = "123456789abcdefghijklmnopqrstuvwxyz"
+
+// pick lists items under title, each with a checkbox, all checked, and lets
+// the user toggle them by their key (or all with *) until Enter. Esc (or
+// Ctrl-C, or q) unchecks everything instead. It returns which items are
+// checked; any past the last key stay checked. Closed input counts as Esc.
+func (r *inputRouter) pick(title string, items []string) []bool {
+	defer r.doneAsking()
+
+	checked := make([]bool, len(items))
+	for i := range checked {
+		checked[i] = true
+	}
+	console.notice("%s", title)
+	for i, item := range items {
+		console.detail("%s", pickLine(i, item, checked[i]))
+	}
+	console.detail("Press a key to toggle its marker, * to toggle all, Enter to send the checked ones, Esc to send none now")
+
+	for {
+		key, ok := r.readKey()
+		if !ok {
+			key = 0x1b
+		}
+		switch key {
+		case '\r', '\n':
+			return checked
+		case 0x1b, 0x03, 'q':
+			for i := range checked {
+				checked[i] = false
+			}
+			return checked
+		case '*':
+			all := true
+			for _, on := range checked {
+				all = all && on
+			}
+			for i := range checked {
+				checked[i] = !all
+			}
+			for i, item := range items {
+				console.detail("%s", pickLine(i, item, checked[i]))
+			}
+		default:
+			if i := strings.IndexByte(pickerKeys, key); i >= 0 && i < len(items) {
+				checked[i] = !checked[i]
+				console.detail("%s", pickLine(i, items[i], checked[i]))
+			}
+		}
+	}
+}
+
+// pickLine is item i of a pick as listed, with its key and checkbox
+func pickLine(i int, item string, checked bool) string {
+	box := "[ ]"
+	if checked {
+		box = "[x]"
+	}
+	key := " "
+	if i < len(pickerKeys) {
+		key = pickerKeys[i : i+1]
+	}
+	return key + " " + box + " " + item
+}
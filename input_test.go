@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// waitForQuestion waits until r is holding keys for a question
+func waitForQuestion(r *inputRouter) {
+	for {
+		r.mu.Lock()
+		asking := r.asking
+		r.mu.Unlock()
+		if asking {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInputRouterForwardsAndCaptures(t *testing.T) {
+	var dest bytes.Buffer
+	r := newInputRouter(&dest)
+
+	r.route([]byte("hello"))
+
+	answers := make(chan bool)
+	go func() { answers <- r.confirm("Go on?") }()
+	// Wait until the question is registered before typing the answer
+	waitForQuestion(r)
+	r.route([]byte("y"))
+	if answer := <-answers; !answer {
+		t.Errorf("confirm() = false, want true")
+	}
+
+	r.route([]byte(" world"))
+	if got := dest.String(); got != "hello world" {
+		t.Errorf("forwarded input = %q, want %q (answer must not reach Claude)", got, "hello world")
+	}
+}
+
+func TestInputRouterKeepsWholeChunk(t *testing.T) {
+	var dest bytes.Buffer
+	r := newInputRouter(&dest)
+
+	answers := make(chan bool)
+	go func() { answers <- r.confirm("Go on?") }()
+	waitForQuestion(r)
+	r.route([]byte("yes please"))
+	if answer := <-answers; !answer {
+		t.Errorf("confirm() = false, want true")
+	}
+	if got, want := dest.String(), "es please"; got != want {
+		t.Errorf("forwarded input = %q, want %q (typed after the answer)", got, want)
+	}
+}
+
+func TestInputRouterClosedInputFailsQuestions(t *testing.T) {
+	r := newInputRouter(io.Discard)
+	r.run(strings.NewReader(""))
+
+	done := make(chan bool)
+	go func() { done <- r.confirm("Go on?") }()
+	select {
+	case answer := <-done:
+		if answer {
+			t.Errorf("confirm() = true on closed input, want false")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("confirm() did not return on closed input")
+	}
+
+	if got := r.pick("2 markers", []string{"one", "two"}); got[0] || got[1] {
+		t.Errorf("pick() = %v on closed input, want nothing checked", got)
+	}
+}
+
+func TestApproveStrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+
+	tests := []struct {
+		name      string
+		content   string
+		answer    bool
+		wantAsked bool
+		want      bool
+	}{
+		{"Trivial removal is auto-approved", "// use a map ai!\n", false, false, true},
+		{"Mid-line marker asks and is approved", "// ai! use a map\n", true, true, true},
+		{"Mid-line marker asks and is declined", "// ai! use a map\n", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked := false
+			p := newFileProcessor(&Config{ConfirmStrip: true}, nil, nil)
+			p.confirm = func(question string) bool {
+				asked = true
+				if !strings.Contains(question, path) {
+					t.Errorf("question %q does not name the file", question)
+				}
+				return tt.answer
+			}
+
+			markers := defaultMarkerScanner.Scan(tt.content)
+			if got := p.approveStrip(path, tt.content, markers); got != tt.want {
+				t.Errorf("approveStrip() = %v, want %v", got, tt.want)
+			}
+			if asked != tt.wantAsked {
+				t.Errorf("asked = %v, want %v", asked, tt.wantAsked)
+			}
+		})
+	}
+}
+
+func TestProcessLeavesFileUntouchedWhenStripDeclined(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "// ai! use a map\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	prompts := make(chan promptRequest, 1)
+	p := newFileProcessor(&Config{ConfirmStrip: true}, nil, prompts)
+	p.confirm = func(string) bool { return false }
+	p.process(path)
+
+	got, _ := os.ReadFile(path)
+	if string(got) != content {
+		t.Errorf("file content = %q, want it unchanged", got)
+	}
+	if len(prompts) != 0 {
+		t.Errorf("a prompt was sent after the strip was declined")
+	}
+}
+
+func TestProcessSendsOnlyPickedMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	content := "package p\n// use a map ai!\nvar m []int\n// rename this ai!\nvar n int\n" // ai:ignore
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineNumber}}: {{.LineText}}\n{{end}}")), nil, nil)
+	p := newFileProcessor(&Config{PickMarkers: true}, resolver, prompts)
+	var items []string
+	p.pick = func(title string, listed []string) []bool {
+		items = listed
+		return []bool{true, false}
+	}
+	p.process(path)
+
+	if len(items) != 2 {
+		t.Fatalf("picker listed %q, want both markers", items)
+	}
+	if got, want := readString(t, path), "package p\n// use a map\nvar m []int\n// rename this ai!\nvar n int\n"; got != want { // ai:ignore
+		t.Errorf("content = %q, want only the picked marker stripped", got)
+	}
+	if req := <-prompts; req.Prompt != "2: // use a map\n" {
+		t.Errorf("prompt = %q, want only the picked marker", req.Prompt)
+	}
+
+	// The deferred marker waits for the file to be saved again
+	p.cooldown.forget(path)
+	p.process(path)
+	if len(prompts) != 0 {
+		t.Errorf("the deferred marker was sent before the file was saved again")
+	}
+}
+
+func TestInputRouterPick(t *testing.T) {
+	r := newInputRouter(io.Discard)
+	picked := make(chan []bool)
+	go func() { picked <- r.pick("2 markers", []string{"one", "two"}) }()
+	waitForQuestion(r)
+	r.route([]byte("1*2\r"))
+	// 1 unchecks the first, * checks both again, 2 unchecks the second
+	if got := <-picked; !got[0] || got[1] {
+		t.Errorf("pick() = %v, want [true false]", got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// instructionFifoName is the named pipe in the state directory that a
+// running session reads instructions from
+const instructionFifoName = "instructions.fifo"
+
+// sendRetryWindow is how long "claudewatch send" keeps trying while the
+// session is between two instructions and has the pipe closed
+var sendRetryWindow = time.Second
+
+// instructionFifo is the named pipe a session takes instructions from, as
+// written by "claudewatch send" or any other program. Each writer's text,
+// up to when it closes the pipe, is one instruction.
+type instructionFifo struct {
+	path  string
+	texts chan string
+}
+
+// openInstructionFifo creates the pipe in the state directory (or reuses the
+// one left by an earlier session) and starts reading instructions from it
+func openInstructionFifo(config *Config) (*instructionFifo, error) {
+	return openFifo(config, instructionFifoName)
+}
+
+// openFifo creates the named pipe called name in the state directory, or
+// reuses the one left by an earlier session, and starts reading from it
+func openFifo(config *Config, name string) (*instructionFifo, error) {
+	stateDir, err := ensureStateDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(stateDir, name)
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return nil, fmt.Errorf("%s exists and is not a named pipe", path)
+		}
+	} else if err := syscall.Mkfifo(path, 0o600); err != nil {
+		return nil, fmt.Errorf("creating %s: %w", path, err)
+	}
+
+	f := &instructionFifo{path: path, texts: make(chan string)}
+	go f.read(config)
+	debugLog(config, "Reading %s", path)
+	return f, nil
+}
+
+// read passes on each instruction written to the pipe. Opening the pipe
+// waits for a writer, and reading it ends when the writer closes it.
+func (f *instructionFifo) read(config *Config) {
+	for {
+		pipe, err := os.Open(f.path)
+		if err != nil {
+			warnLog(config, "Stopped reading instructions: %v", err)
+			return
+		}
+		data, err := io.ReadAll(pipe)
+		pipe.Close()
+		if err != nil {
+			console.warn("Could not read an instruction from %s: %v", f.path, err)
+			continue
+		}
+		if text := strings.TrimSpace(string(data)); text != "" {
+			f.texts <- text
+		}
+	}
+}
+
+// instructions returns the instructions read from the pipe; nil (which
+// never delivers) when there is no pipe
+func (f *instructionFifo) instructions() <-chan string {
+	if f == nil {
+		return nil
+	}
+	return f.texts
+}
+
+// close removes the pipe, so "claudewatch send" can tell no session is running
+func (f *instructionFifo) close() {
+	if f != nil {
+		os.Remove(f.path)
+	}
+}
+
+// instructionRequest is the prompt for an instruction from the pipe
+func instructionRequest(text string) promptRequest {
+	return promptRequest{Prompt: text, Instruction: firstLine(text)}
+}
+
+// runSend implements "claudewatch send": it writes an instruction to the
+// pipe of the session running in the current directory
+func runSend(args []string) int {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch send TEXT...")
+		fmt.Fprintln(fs.Output(), "       echo TEXT | claudewatch send")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Send an instruction to the claudewatch session running in this directory, as if")
+		fmt.Fprintln(fs.Output(), "it had been written in a marker. Without arguments, it is read from stdin.")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	text := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the instruction: %v\n", err)
+			return 1
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		fs.Usage()
+		return 2
+	}
+
+	path := filepath.Join(stateDirName, instructionFifoName)
+	if err := writeInstruction(path, text); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeInstruction writes text to the pipe at path. Opening it without
+// waiting fails at once when no session has it open for reading.
+func writeInstruction(path, text string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("no claudewatch session is running here (%s not found)", path)
+	}
+
+	deadline := time.Now().Add(sendRetryWindow)
+	var fd int
+	for {
+		fd, err = syscall.Open(path, syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		if err == nil {
+			break
+		}
+		// The session may be between two instructions, about to reopen it
+		if !errors.Is(err, syscall.ENXIO) || time.Now().After(deadline) {
+			if errors.Is(err, syscall.ENXIO) {
+				return fmt.Errorf("no claudewatch session is reading %s", path)
+			}
+			return fmt.Errorf("opening %s: %w", path, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Block on writes from here, so a long instruction isn't cut short
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	pipe := os.NewFile(uintptr(fd), path)
+	if _, err := io.WriteString(pipe, text); err != nil {
+		pipe.Close()
+		return fmt.Errorf("writing to %s: %w", path, err)
+	}
+	return pipe.Close()
+}
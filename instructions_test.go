@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInstructionFifoRoundTrip(t *testing.T) {
+	chdir(t, t.TempDir())
+	fifo, err := openInstructionFifo(&Config{})
+	if err != nil {
+		t.Fatalf("openInstructionFifo: %v", err)
+	}
+	defer fifo.close()
+
+	for _, text := range []string{"  add a --verbose flag\n", "first line\nsecond line"} {
+		if err := writeInstruction(fifo.path, text); err != nil {
+			t.Fatalf("writeInstruction: %v", err)
+		}
+		select {
+		case got := <-fifo.instructions():
+			if want := strings.TrimSpace(text); got != want {
+				t.Errorf("read %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no instruction read for %q", text)
+		}
+	}
+
+	if req := instructionRequest("first line\nsecond line"); req.Prompt != "first line\nsecond line" || req.Instruction != "first line" {
+		t.Errorf("instructionRequest = %+v", req)
+	}
+
+	fifo.close()
+	if _, err := os.Lstat(fifo.path); !os.IsNotExist(err) {
+		t.Errorf("pipe still there after close: %v", err)
+	}
+}
+
+func TestOpenInstructionFifoRefusesRegularFile(t *testing.T) {
+	chdir(t, t.TempDir())
+	if err := os.Mkdir(stateDirName, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	writeTestFile(t, filepath.Join(stateDirName, instructionFifoName), "not a pipe")
+	if _, err := openInstructionFifo(&Config{}); err == nil || !strings.Contains(err.Error(), "not a named pipe") {
+		t.Errorf("openInstructionFifo = %v, want a not-a-pipe error", err)
+	}
+}
+
+func TestWriteInstructionWithoutSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeInstruction(filepath.Join(dir, instructionFifoName), "hi"); err == nil || !strings.Contains(err.Error(), "no claudewatch session is running") {
+		t.Errorf("writeInstruction without a pipe = %v", err)
+	}
+
+	// A pipe left behind by a session that is gone has no reader
+	old := sendRetryWindow
+	sendRetryWindow = 50 * time.Millisecond
+	defer func() { sendRetryWindow = old }()
+	stale := filepath.Join(dir, instructionFifoName)
+	if err := syscall.Mkfifo(stale, 0o600); err != nil {
+		t.Fatalf("Mkfifo: %v", err)
+	}
+	if err := writeInstruction(stale, "hi"); err == nil || !strings.Contains(err.Error(), "no claudewatch session is reading") {
+		t.Errorf("writeInstruction to a stale pipe = %v", err)
+	}
+}
+
+func TestRunSendUsage(t *testing.T) {
+	chdir(t, t.TempDir())
+	if code := runSend([]string{"--bogus"}); code != 2 {
+		t.Errorf("runSend(--bogus) = %d, want 2", code)
+	}
+	if code := runSend([]string{"do", "it"}); code != 1 {
+		t.Errorf("runSend without a session = %d, want 1", code)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+// processKeeping runs a --keep-markers processor over path and returns the
+// prompts it queued
+func processKeeping(t *testing.T, p *fileProcessor, prompts chan promptRequest, path string) []promptRequest {
+	t.Helper()
+	p.cooldown.forget(path) // Skip the cooldown between saves
+	p.process(path)
+
+	var got []promptRequest
+	for {
+		select {
+		case req := <-prompts:
+			got = append(got, req)
+		default:
+			return got
+		}
+	}
+}
+
+func TestKeepMarkersLeavesFileUntouched(t *testing.T) {
+	content := "// use a map ai!\n"
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	prompts := make(chan promptRequest, 4)
+	p := newFileProcessor(&Config{KeepMarkers: true}, resolver, prompts)
+
+	got := processKeeping(t, p, prompts, path)
+	if len(got) != 1 || got[0].Prompt != "// use a map ai!" {
+		t.Fatalf("prompts = %+v, want one prompt with the marker line as written", got)
+	}
+	if readString(t, path) != content {
+		t.Errorf("file was modified with --keep-markers")
+	}
+}
+
+func TestKeepMarkersSendsEachMarkerOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineText}};{{end}}")), nil, nil)
+	prompts := make(chan promptRequest, 4)
+	p := newFileProcessor(&Config{KeepMarkers: true}, resolver, prompts)
+
+	write("// use a map ai!\n")
+	if got := processKeeping(t, p, prompts, path); len(got) != 1 {
+		t.Fatalf("first save sent %d prompts, want 1", len(got))
+	}
+
+	// Unrelated edits, and lines shifting the marker down, don't resend it
+	write("package main\n\n// use a map ai!\nvar x = 1\n")
+	if got := processKeeping(t, p, prompts, path); len(got) != 0 {
+		t.Errorf("resaving sent %+v, want nothing", got)
+	}
+
+	// A new marker is sent on its own
+	write("// use a map ai!\n// add logging ai!\n")
+	if got := processKeeping(t, p, prompts, path); len(got) != 1 || got[0].Prompt != "// add logging ai!;" {
+		t.Errorf("adding a marker sent %+v, want only the new marker", got)
+	}
+
+	// A marker that was removed and then added back is sent again
+	write("// add logging ai!\n")
+	processKeeping(t, p, prompts, path)
+	write("// use a map ai!\n// add logging ai!\n")
+	if got := processKeeping(t, p, prompts, path); len(got) != 1 || got[0].Prompt != "// use a map ai!;" {
+		t.Errorf("re-adding a marker sent %+v, want it sent again", got)
+	}
+}
+
+func TestKeepMarkersResendsAfterFailedDelivery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// use a map ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	prompts := make(chan promptRequest, 4)
+	p := newFileProcessor(&Config{KeepMarkers: true}, resolver, prompts)
+
+	got := processKeeping(t, p, prompts, path)
+	if len(got) != 1 {
+		t.Fatalf("got %d prompts, want 1", len(got))
+	}
+	d := &dispatcher{primary: &fakeBackend{name: "primary", err: errors.New("pty closed")}}
+	_ = d.submit(got[0])
+
+	if got := processKeeping(t, p, prompts, path); len(got) != 1 {
+		t.Errorf("next save after a failed delivery sent %d prompts, want 1", len(got))
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation defaults for --log-file
+const (
+	defaultLogMaxSizeMB = 10             // --log-max-size
+	defaultLogMaxAge    = 24 * time.Hour // --log-max-age
+	logKeepFiles        = 5              // Rotated logs kept next to the current one
+)
+
+// ansiEscape matches the color codes console messages may carry
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// rotatingLog is the --log-file: debug output and claudewatch's runtime
+// messages, each line timestamped. Once the file grows past maxSize bytes or
+// has been written for maxAge, it is renamed to PATH.1 (shifting older ones
+// to PATH.2 and so on, keeping logKeepFiles of them) and a new one started,
+// so a session left running for days doesn't fill the disk.
+type rotatingLog struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	started time.Time
+	maxSize int64         // 0 for no size limit
+	maxAge  time.Duration // 0 for no age limit
+	midLine bool          // The last write didn't end its line
+	now     func() time.Time
+}
+
+// openRotatingLog appends to the log at path, rotating it first if it is
+// already over its limits. An existing log's age is taken from its last
+// modification, as when it was started isn't known.
+func openRotatingLog(path string, maxSize int64, maxAge time.Duration) (*rotatingLog, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &rotatingLog{path: abs, maxSize: maxSize, maxAge: maxAge, now: time.Now}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the current log file, rotating it away if it's due
+func (l *rotatingLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size, l.started = file, info.Size(), l.now()
+	if l.size > 0 {
+		l.started = info.ModTime()
+		if l.due(0) {
+			return l.rotate()
+		}
+	}
+	return nil
+}
+
+// setLimits changes when the log is rotated; the log is opened before the
+// command line is fully parsed, with the defaults
+func (l *rotatingLog) setLimits(maxSize int64, maxAge time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxSize, l.maxAge = maxSize, maxAge
+}
+
+// due reports whether the log should be rotated before n more bytes are
+// written to it. An empty log is never rotated.
+func (l *rotatingLog) due(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+	return (l.maxSize > 0 && l.size+int64(n) > l.maxSize) || (l.maxAge > 0 && l.now().Sub(l.started) >= l.maxAge)
+}
+
+// rotate shifts the rotated logs along, dropping the oldest, moves the
+// current log to PATH.1 and starts a new one
+func (l *rotatingLog) rotate() error {
+	l.file.Close()
+	os.Remove(rotatedLogPath(l.path, logKeepFiles))
+	for n := logKeepFiles - 1; n >= 1; n-- {
+		os.Rename(rotatedLogPath(l.path, n), rotatedLogPath(l.path, n+1))
+	}
+	renameErr := os.Rename(l.path, rotatedLogPath(l.path, 1))
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size, l.started = file, info.Size(), l.now()
+	if renameErr != nil {
+		return fmt.Errorf("rotating %s: %w", l.path, renameErr)
+	}
+	return nil
+}
+
+// rotatedLogPath names the nth rotated copy of the log at path
+func rotatedLogPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Write appends p to the log, starting each line with a timestamp. Blank
+// lines, which only space messages out on the terminal, are left out.
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// Rotate between lines, never in the middle of one
+	lineStart := !l.midLine
+	var out strings.Builder
+	stamp := l.now().Format("2006-01-02 15:04:05.000 ")
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line == "" || (!l.midLine && line == "\n") {
+			continue
+		}
+		if !l.midLine {
+			out.WriteString(stamp)
+		}
+		out.WriteString(line)
+		l.midLine = !strings.HasSuffix(line, "\n")
+	}
+	if out.Len() == 0 {
+		return len(p), nil
+	}
+
+	if lineStart && l.due(out.Len()) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "claudewatch: %v\n", err)
+		}
+	}
+	n, err := l.file.WriteString(out.String())
+	l.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// close closes the log
+func (l *rotatingLog) close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// isLogFile reports whether path is the log at logPath or one of its rotated
+// copies
+func isLogFile(path, logPath string) bool {
+	if logPath == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if abs == logPath {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(abs, logPath+".")
+	if !ok || suffix == "" {
+		return false
+	}
+	return strings.Trim(suffix, "0123456789") == ""
+}
+
+// earlyLogFlags finds the log level (--debug, -v, -vv, --log-level) and
+// --log-file on the command line before it is fully parsed, so that
+// diagnostics from parsing it are logged too. Only arguments before "--"
+// count; a bad --log-level is left for the full parse to report.
+func earlyLogFlags(args []string) (level logLevel, logPath string) {
+	var debug, v, vv bool
+	var levelName string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		on := !hasValue || value == "true" || value == "1"
+		switch name {
+		case "debug":
+			debug = on
+		case "v":
+			v = on
+		case "vv":
+			vv = on
+		case "log-file", "log-level":
+			if !hasValue && i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+			if name == "log-file" {
+				logPath = value
+			} else {
+				levelName = value
+			}
+		}
+	}
+	level, err := verbosity(levelName, debug, v, vv)
+	if err != nil {
+		level = levelOff
+	}
+	return level, logPath
+}
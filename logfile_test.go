@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingLogTimestampsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cw.log")
+	l, err := openRotatingLog(path, 0, 0)
+	if err != nil {
+		t.Fatalf("openRotatingLog: %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local) }
+	for _, text := range []string{"\n[File change detected: a.go]\n", "Remove markers? [y/N] ", "n\n", "one\ntwo\n"} {
+		if _, err := l.Write([]byte(text)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	l.close()
+
+	stamp := "2026-03-01 10:00:00.000 "
+	want := stamp + "[File change detected: a.go]\n" + stamp + "Remove markers? [y/N] n\n" + stamp + "one\n" + stamp + "two\n"
+	if got := readString(t, path); got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+}
+
+func TestRotatingLogRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cw.log")
+	l, err := openRotatingLog(path, 100, 0)
+	if err != nil {
+		t.Fatalf("openRotatingLog: %v", err)
+	}
+	defer l.close()
+	line := strings.Repeat("x", 40) + "\n" // 65 bytes with its timestamp
+	for i := 0; i < logKeepFiles+3; i++ {
+		l.Write([]byte(line))
+	}
+
+	for n := 1; n <= logKeepFiles; n++ {
+		if !exists(rotatedLogPath(path, n)) {
+			t.Errorf("%s missing", rotatedLogPath(path, n))
+		}
+	}
+	if exists(rotatedLogPath(path, logKeepFiles+1)) {
+		t.Errorf("more than %d rotated logs kept", logKeepFiles)
+	}
+	for _, p := range []string{path, rotatedLogPath(path, 1)} {
+		if got := strings.Count(readString(t, p), "\n"); got != 1 {
+			t.Errorf("%s has %d lines, want 1", p, got)
+		}
+	}
+}
+
+func TestRotatingLogRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cw.log")
+	writeTestFile(t, path, "yesterday\n")
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+
+	l, err := openRotatingLog(path, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("openRotatingLog: %v", err)
+	}
+	defer l.close()
+	if got := readString(t, rotatedLogPath(path, 1)); got != "yesterday\n" {
+		t.Errorf("rotated log = %q, want the stale log rotated on open", got)
+	}
+
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	l.Write([]byte("first\n"))
+	now = now.Add(30 * time.Minute)
+	l.Write([]byte("second\n"))
+	if exists(rotatedLogPath(path, 2)) {
+		t.Fatal("log rotated before it was an hour old")
+	}
+	now = now.Add(31 * time.Minute)
+	l.Write([]byte("third\n"))
+	if got := readString(t, rotatedLogPath(path, 1)); !strings.Contains(got, "first") || !strings.Contains(got, "second") {
+		t.Errorf("rotated log = %q, want the first hour's lines", got)
+	}
+	if got := readString(t, path); !strings.HasSuffix(got, "third\n") || strings.Contains(got, "second") {
+		t.Errorf("log = %q, want only the newest line", got)
+	}
+}
+
+func TestIsLogFile(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "cw.log")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{logPath, true},
+		{logPath + ".1", true},
+		{logPath + ".12", true},
+		{logPath + ".bak", false},
+		{logPath + ".", false},
+		{filepath.Join(dir, "cw.go"), false},
+	}
+	for _, tt := range tests {
+		if got := isLogFile(tt.path, logPath); got != tt.want {
+			t.Errorf("isLogFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if isLogFile(logPath, "") {
+		t.Error("isLogFile without a log = true")
+	}
+}
+
+func TestEarlyLogFlags(t *testing.T) {
+	tests := []struct {
+		args    []string
+		level   logLevel
+		logPath string
+	}{
+		{nil, levelOff, ""},
+		{[]string{"--debug", "src"}, levelDebug, ""},
+		{[]string{"--log-file", "cw.log", "--debug"}, levelDebug, "cw.log"},
+		{[]string{"-log-file=cw.log"}, levelOff, "cw.log"},
+		{[]string{"--debug=false", "--log-file"}, levelOff, ""},
+		{[]string{"-v"}, levelInfo, ""},
+		{[]string{"-vv", "-v"}, levelDebug, ""},
+		{[]string{"-v", "--log-level", "trace"}, levelTrace, ""},
+		{[]string{"--log-level=loud"}, levelOff, ""},
+		{[]string{"--", "--debug", "--log-file", "cw.log"}, levelOff, ""},
+		{[]string{"debug", "log-file"}, levelOff, ""},
+	}
+	for _, tt := range tests {
+		level, logPath := earlyLogFlags(tt.args)
+		if level != tt.level || logPath != tt.logPath {
+			t.Errorf("earlyLogFlags(%q) = %s, %q; want %s, %q", tt.args, level, logPath, tt.level, tt.logPath)
+		}
+	}
+}
+
+func TestConsoleWriterCopiesToLog(t *testing.T) {
+	var out, log bytes.Buffer
+	c := newConsoleWriter(&out, true, env(map[string]string{"TERM": "xterm"}))
+	c.logTo(&log)
+	c.warn("held")
+	c.detail("Line %d", 3)
+
+	if got := out.String(); got != ansiYellow+"[held]"+ansiReset+"\r\n  Line 3\r\n" {
+		t.Errorf("terminal output = %q", got)
+	}
+	if got := log.String(); got != "[held]\n  Line 3\n" {
+		t.Errorf("log = %q, want it uncolored with LF line endings", got)
+	}
+}
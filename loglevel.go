@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// logLevel is how much goes to the debug log. Each level includes the
+// messages of the levels after it.
+type logLevel int
+
+const (
+	levelOff   logLevel = iota // Nothing is logged
+	levelTrace                 // Every directory considered and file event received
+	levelDebug                 // Settings, skipped files, marker removals, commands run (--debug, -vv)
+	levelInfo                  // Prompts queued and sent, checkpoints, branches, restarts (-v)
+	levelWarn                  // Only things that went wrong
+)
+
+// logLevelNames are the --log-level names, indexed by level
+var logLevelNames = []string{"off", "trace", "debug", "info", "warn"}
+
+func (l logLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("logLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// prefix starts each line logged at the level
+func (l logLevel) prefix() string {
+	name := l.String()
+	return strings.ToUpper(name[:1]) + name[1:] + ": "
+}
+
+// parseLogLevel parses a --log-level name
+func parseLogLevel(name string) (logLevel, error) {
+	for level, levelName := range logLevelNames {
+		if level != int(levelOff) && strings.EqualFold(name, levelName) {
+			return logLevel(level), nil
+		}
+	}
+	return levelOff, fmt.Errorf("unknown log level %q (want trace, debug, info or warn)", name)
+}
+
+// verbosity works out the log level from the command line: --log-level if
+// given, else -vv or --debug for debug and -v for info
+func verbosity(logLevelName string, debug, v, vv bool) (logLevel, error) {
+	switch {
+	case logLevelName != "":
+		return parseLogLevel(logLevelName)
+	case vv, debug:
+		return levelDebug, nil
+	case v:
+		return levelInfo, nil
+	}
+	return levelOff, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerbosity(t *testing.T) {
+	tests := []struct {
+		name         string
+		debug, v, vv bool
+		want         logLevel
+		wantErr      bool
+	}{
+		{"", false, false, false, levelOff, false},
+		{"", true, false, false, levelDebug, false},
+		{"", false, true, false, levelInfo, false},
+		{"", false, true, true, levelDebug, false},
+		{"WARN", false, false, false, levelWarn, false},
+		{"trace", true, true, false, levelTrace, false},
+		{"off", false, false, false, levelOff, true},
+		{"loud", false, false, false, levelOff, true},
+	}
+	for _, tt := range tests {
+		got, err := verbosity(tt.name, tt.debug, tt.v, tt.vv)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("verbosity(%q, %v, %v, %v) = %s, %v; want %s", tt.name, tt.debug, tt.v, tt.vv, got, err, tt.want)
+		}
+	}
+}
+
+func TestLogAtFiltersByLevel(t *testing.T) {
+	var out bytes.Buffer
+	config := &Config{LogLevel: levelInfo, DebugOut: &out}
+	traceLog(config, "Watching directory: %s", "src")
+	debugLog(config, "Using config file: %s", ".claudewatch.json")
+	infoLog(config, "Queueing prompt for %s", "a.go")
+	warnLog(config, "Health ping failed")
+
+	want := "Info: Queueing prompt for a.go\nWarn: Health ping failed\n"
+	if got := out.String(); got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	config.LogLevel = levelOff
+	warnLog(config, "Health ping failed")
+	if out.Len() != 0 {
+		t.Errorf("logged %q with logging off", out.String())
+	}
+}
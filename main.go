@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -14,8 +16,8 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/fsnotify/fsnotify"
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
 	"golang.org/x/term"
 )
 
@@ -28,22 +30,156 @@ type Config struct {
 	PromptTemplate   *template.Template // Template for the prompt when a file changes
 	IgnorePattern    *regexp.Regexp     // Pattern to ignore files when watching
 	IgnorePatterns   IgnorePatterns     // Patterns from .claudewatchignore file
-	Debug            bool               // Enable debug output
+	IgnoreCache      *ignoreCache       // Memoized ignore decisions, reset when patterns reload
+	LogLevel         logLevel           // How much goes to the debug log (--debug, -v, -vv, --log-level)
 	DebugOut         io.Writer          // Destination for debug output (.claudewatchdebug)
 	DebugPath        string             // Absolute path of the debug output file
+	ConfigPath       string             // Path of the .claudewatch.json in use, if any
+	FileConfig       *FileConfig        // Settings loaded from ConfigPath
+	FallbackCommand  string             // Headless command that takes over if the interactive Claude exits
+	ContextLines     int                // Lines of surrounding code to capture above/below each marker
+	FileTreeDepth    int                // Directory levels {{.FileTree}} lists
+	ConfirmStrip     bool               // Show the marker removal diff and ask before writing it
+	PickMarkers      bool               // Ask which of several markers in a change to send now (--pick)
+	Record           bool               // Record Claude's output to .claudewatch/transcript.log
+	Preset           string             // Name of the prompt preset selected with --preset
+	AttachPID        int                // PID of a running Claude CLI to type prompts into (--attach-pid)
+	AttachAuto       bool               // Find a running Claude CLI to attach to (--attach-auto)
+	TmuxTarget       string             // tmux pane of a running Claude CLI to send prompts to (--tmux-target)
+	Backup           bool               // Save each file to .claudewatch/backups before stripping its markers
+	KeepMarkers      bool               // Never modify watched files; send each marker once instead of stripping it
+	InputEncoding    inputEncoding      // How prompts are typed into Claude's input box
+	MaxFileSize      int64              // Files larger than this many bytes aren't scanned for markers; 0 scans any size
+	FollowSymlinks   bool               // Watch directories reached through symlinks
+	WatchEditorTemps bool               // Watch editors' temp files too (--no-builtin-ignores)
+	PriorityRules    []priorityRule     // Default dispatch priority by path, from the config file
+	ExpandCommand    string             // Headless command that rewrites each prompt before it is sent
+	ProgressComments bool               // Mark marker sites with a comment while their prompt is in flight
+	SessionNotes     bool               // Keep a work log of dispatched prompts in .claudewatch/SESSION_NOTES.md
+	Builds           *buildActivity     // Running builds whose output is ignored, from build_ignore in the config file
+	Formatters       *formatterActivity // Running on-save formatters, whose rewrites changes wait for
+	Submit           *submitSequence    // How a typed prompt is submitted; nil uses defaultSubmit
+	Digest           *digestPlan        // With --digest, when held prompts are sent; nil sends them right away
+	Batch            bool               // Hold prompts until the batch is flushed with Ctrl-] or claudewatch flush (--batch)
+	HoldSaves        bool               // Scan files saved while Claude is answering once it is done (--hold-while-answering)
+	RestartLimit     int                // Times Claude is relaunched after exiting (--restart-on-exit)
+	Reconnect        bool               // Wait for an attached Claude to come back after it goes away
+	MaxPerMinute     int                // Prompts sent per minute at most (--max-per-minute); 0 for no limit
+	MaxPerSession    int                // Prompts sent per session at most (--max-per-session); 0 for no limit
+	DedupeWindow     time.Duration      // How long an identical prompt isn't sent again (--dedupe-window); 0 always sends
+	Cooldown         time.Duration      // How long changes to a file are ignored after it is processed (--cooldown); 0 processes every change
+	Coalesce         *template.Template // With --coalesce, renders the edits of files saved together as one prompt
+	WatcherBackend   string             // How files are watched (--backend-watcher): fsnotify or watchman
+	GitCheckpoint    bool               // Snapshot the repository to refs/claudewatch/checkpoints before each prompt
+	AutoCommit       bool               // Commit Claude's changes once it has answered each prompt
+	BranchPerPrompt  bool               // Check out a new branch named from the instruction before each prompt
+	DirtyTree        string             // What to do about uncommitted changes to other files: warn, block or off
+	TrackedOnly      bool               // Only scan files git tracks (--tracked-only)
+	ProjectScope     bool               // Scope prompts to the project (go.mod, package.json, ...) of the changed file
+	Projects         *projectIndex      // With --project-scope, the project each file is in
+	Script           *promptScript      // With --script, decides each prompt's text and target
+	Events           *eventSocket       // With --event-socket, where editors hear about markers and prompts
+	NoClaude         bool               // Write prompts out instead of sending them to Claude (--no-claude)
+	OutputPath       string             // With --no-claude, the file prompts are appended to; empty for stdout
+	Clipboard        *clipboard         // With --clipboard, where each prompt is copied
+	Log              *rotatingLog       // With --log-file, where debug output and runtime messages are written
+	Quiet            bool               // Don't announce detected changes (--quiet)
+	ShowPrompts      bool               // Print each prompt to the console before it is sent (--show-prompt)
+	NotifyFormat     *template.Template // With --notify-format, renders the announcement of a detected change
+
+	// Scanner finds and strips markers, as the config file sets it up; nil
+	// uses the default markers and comment syntaxes
+	Scanner *claudewatch.Scanner
+
+	// Namespaces routes namespaced markers (e.g. be-ai!) to their template
+	// and session, keyed by namespace
+	Namespaces map[string]*namespaceRoute
+}
+
+// attaching reports whether prompts go to a Claude CLI that is already
+// running (--attach-pid, --attach-auto or --tmux-target)
+func (c *Config) attaching() bool {
+	return c.AttachPID != 0 || c.AttachAuto || c.TmuxTarget != ""
+}
+
+// defaultMarkerScanner finds the default markers, for a Config without a
+// Scanner
+var defaultMarkerScanner, _ = claudewatch.NewScanner(claudewatch.ScannerOptions{})
+
+// markerScanner returns the Scanner that finds and strips markers
+func (c *Config) markerScanner() *claudewatch.Scanner {
+	if c.Scanner == nil {
+		return defaultMarkerScanner
+	}
+	return c.Scanner
+}
+
+// skipsFile reports whether path is a hidden or special file, or an editor's
+// temp file unless --no-builtin-ignores watches those
+func (c *Config) skipsFile(path string) bool {
+	return claudewatch.IsHiddenFile(path) || (!c.WatchEditorTemps && claudewatch.IsEditorTempFile(path))
 }
 
 // GetDefaultPromptTemplate returns the default template for prompts ai:ignore
 func GetDefaultPromptTemplate() (*template.Template, error) {
 	templateText := `Modify {{.File}}. Address the feedback in the following comments:
 
-{{range .Markers}}Line {{.LineNumber}}: {{.LineText}}
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{if .Region}}Applies to lines {{.RegionStart}}-{{.RegionEnd}}:
+{{.Region}}
+
+{{end}}{{if .Context}}Surrounding code:
+{{.Context}}
+
+{{end}}{{end}}{{if .ReadOnly}}
+{{.File}} is read-only, so do not try to edit it. Describe the changes that would address the feedback instead.
+{{end}}
+{{if .ProjectRoot}}For the scope of this instruction, do not modify any files outside the project in {{.ProjectRoot}}. However, if modifying files outside it would be necessary to fully address the feedback, stop, explain your reasoning, and wait for further instruction.{{else}}For the scope of this instruction, do not modify any other files. However, if modifying other files would be necessary to fully address the feedback, stop, explain your reasoning, and wait for further instruction.{{end}}
+
+Once your editing task is complete, stop and await instruction.`
+
+	return parsePromptTemplate(templateText)
+}
+
+// GetDefaultQuestionTemplate returns the default template for question (ai?) markers ai:ignore
+func GetDefaultQuestionTemplate() (*template.Template, error) {
+	templateText := `Answer the questions asked in the following comments in {{.File}}:
+
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{if .Region}}Applies to lines {{.RegionStart}}-{{.RegionEnd}}:
+{{.Region}}
+
+{{end}}{{if .Context}}Surrounding code:
+{{.Context}}
+
+{{end}}{{end}}
+Do not modify any files. Once you have answered, stop and await instruction.`
+
+	return parsePromptTemplate(templateText)
+}
+
+// GetDefaultTodoTemplate returns the default template for TODO(ai): and FIXME(ai): markers ai:ignore
+func GetDefaultTodoTemplate() (*template.Template, error) {
+	templateText := `Modify {{.File}}. Resolve the TODO and FIXME comments left for you below; each has had its TODO(ai): or FIXME(ai): removed. Once one is done, delete what is left of its comment:
+
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{if .Region}}Applies to lines {{.RegionStart}}-{{.RegionEnd}}:
+{{.Region}}
+
+{{end}}{{if .Context}}Surrounding code:
+{{.Context}}
+
+{{end}}{{end}}{{if .ReadOnly}}
+{{.File}} is read-only, so do not try to edit it. Describe the changes that would resolve the comments instead.
 {{end}}
-For the scope of this instruction, do not modify any other files. However, if modifying other files would be necessary to fully address the feedback, stop, explain your reasoning, and wait for further instruction.
+{{if .ProjectRoot}}For the scope of this instruction, do not modify any files outside the project in {{.ProjectRoot}}. However, if modifying files outside it would be necessary to fully resolve the comments, stop, explain your reasoning, and wait for further instruction.{{else}}For the scope of this instruction, do not modify any other files. However, if modifying other files would be necessary to fully resolve the comments, stop, explain your reasoning, and wait for further instruction.{{end}}
 
 Once your editing task is complete, stop and await instruction.`
 
-	return template.New("prompt").Parse(templateText)
+	return parsePromptTemplate(templateText)
 }
 
 // loadPromptTemplate reads and parses a .claudewatchprompt file.
@@ -52,38 +188,88 @@ func loadPromptTemplate(path string) (*template.Template, error) {
 	if err != nil {
 		return nil, err
 	}
-	return template.New("prompt").Parse(string(content))
+	return parsePromptTemplate(string(content))
 }
 
 // promptResolver picks the prompt template for a changed file. Unless a prompt
-// was supplied explicitly (override), it finds the nearest .claudewatchprompt to
-// the file's directory, caching the result per directory so the filesystem walk
-// happens at most once per directory.
+// was supplied explicitly (override), it uses the template configured for the
+// marker type if one is set, then the template configured for the file's
+// extension, or else finds the nearest .claudewatchprompt to the file's
+// directory, caching the result per directory so the filesystem walk happens
+// at most once per directory. Without a prompt file, questions and TODO
+// markers get their built-in templates.
 type promptResolver struct {
-	defaultTmpl *template.Template
-	override    *template.Template
-	debugOut    io.Writer
-	mu          sync.Mutex
-	cache       map[string]*template.Template
+	defaultTmpl  *template.Template
+	override     *template.Template
+	byMarkerType map[string]*template.Template // Keyed by marker type, e.g. "question"; only marker_templates from the config file
+	builtins     map[string]*template.Template // Built-in templates by marker type, for types with their own
+	byTag        map[string]*template.Template // Keyed by marker tag, e.g. "test"
+	byExtension  map[string]*template.Template // Keyed by normalized extension, e.g. ".go"
+	debugOut     io.Writer
+	mu           sync.Mutex
+	cache        map[string]*template.Template // The nearest prompt file's template by directory, nil if there is none
 }
 
 func newPromptResolver(defaultTmpl, override *template.Template, debugOut io.Writer) *promptResolver {
 	return &promptResolver{
 		defaultTmpl: defaultTmpl,
 		override:    override,
+		builtins:    builtinMarkerTypeTemplates(),
 		debugOut:    debugOut,
 		cache:       make(map[string]*template.Template),
 	}
 }
 
-// resolve returns the prompt template to use for the file at filePath.
+// builtinMarkerTypeTemplates returns the built-in question and TODO templates,
+// keyed by marker type
+func builtinMarkerTypeTemplates() map[string]*template.Template {
+	return map[string]*template.Template{
+		claudewatch.TypeQuestion: template.Must(GetDefaultQuestionTemplate()),
+		claudewatch.TypeTodo:     template.Must(GetDefaultTodoTemplate()),
+	}
+}
+
+// resolve returns the prompt template to use for edit markers in the file at filePath.
 func (r *promptResolver) resolve(filePath string) *template.Template {
+	return r.resolveFor(filePath, claudewatch.TypeEdit)
+}
+
+// resolveTagged returns the prompt template to use for markers of markerType
+// carrying tag in the file at filePath: the tag's template, unless --prompt
+// overrides it, or else as for untagged markers.
+func (r *promptResolver) resolveTagged(filePath, markerType, tag string) *template.Template {
+	if tmpl, ok := r.byTag[tag]; ok && r.override == nil {
+		return tmpl
+	}
+	return r.resolveFor(filePath, markerType)
+}
+
+// resolveFor returns the prompt template to use for markers of markerType in the file at filePath.
+func (r *promptResolver) resolveFor(filePath, markerType string) *template.Template {
 	if r.override != nil {
 		return r.override
 	}
 
-	dir := filepath.Dir(filePath)
+	if tmpl, ok := r.byMarkerType[markerType]; ok {
+		return tmpl
+	}
+
+	if tmpl, ok := r.byExtension[extensionOf(filePath)]; ok {
+		return tmpl
+	}
 
+	if tmpl := r.promptFileTemplate(filepath.Dir(filePath)); tmpl != nil {
+		return tmpl
+	}
+	if tmpl, ok := r.builtins[markerType]; ok {
+		return tmpl
+	}
+	return r.defaultTmpl
+}
+
+// promptFileTemplate returns the template of the nearest .claudewatchprompt to
+// dir, or nil if there is none
+func (r *promptResolver) promptFileTemplate(dir string) *template.Template {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -91,7 +277,7 @@ func (r *promptResolver) resolve(filePath string) *template.Template {
 		return cached
 	}
 
-	tmpl := r.defaultTmpl
+	var tmpl *template.Template
 	if promptPath := findPromptFile(dir); promptPath != "" {
 		if parsed, err := loadPromptTemplate(promptPath); err == nil {
 			tmpl = parsed
@@ -111,35 +297,189 @@ func (r *promptResolver) resolve(filePath string) *template.Template {
 
 // Template data structure
 type TemplateData struct {
-	File    string             // Absolute path of the file that changed
-	Markers []AIMarkerLocation // Locations of AI markers with line numbers
+	File    string               // Absolute path of the file that changed
+	Type    string               // Type of the markers in this prompt: "edit" or "question"
+	Tag     string               // Tag of the markers in this prompt (e.g. "test" for ai!test), empty if untagged
+	Markers []claudewatch.Marker // Locations of AI markers with line numbers
+
+	ReadOnly bool // The file can't be written, so its markers were left in place
+
+	ProjectRoot string // With --project-scope, the top of the file's project; otherwise empty
+
+	NotesFile string // Path of the session notes file with --session-notes, otherwise empty
+
+	fileTree  func() string      // Builds FileTree, only for templates that use it
+	gitDiff   func() string      // Runs git for GitDiff, only for templates that use it
+	gitStatus func() string      // Runs git for GitStatus, only for templates that use it
+	project   func() ProjectInfo // Looks up Project, only for templates that use it
+}
+
+// FileTree lists the directory of the changed file, for {{.FileTree}}
+func (d TemplateData) FileTree() string {
+	if d.fileTree == nil {
+		return ""
+	}
+	return d.fileTree()
+}
+
+// GitDiff is the file's uncommitted change relative to HEAD, for {{.GitDiff}}
+func (d TemplateData) GitDiff() string {
+	if d.gitDiff == nil {
+		return ""
+	}
+	return d.gitDiff()
+}
+
+// GitStatus is the short git status of the file's repository, for {{.GitStatus}}
+func (d TemplateData) GitStatus() string {
+	if d.gitStatus == nil {
+		return ""
+	}
+	return d.gitStatus()
+}
+
+// Project describes the changed file's repository and project (its root,
+// branch and name, and the time), for {{.Project}}
+func (d TemplateData) Project() ProjectInfo {
+	if d.project == nil {
+		return ProjectInfo{}
+	}
+	return d.project()
+}
+
+// logAt writes a message to the debug log if the log level includes level
+func logAt(config *Config, level logLevel, format string, args ...interface{}) {
+	if config.LogLevel != levelOff && level >= config.LogLevel && config.DebugOut != nil {
+		fmt.Fprintf(config.DebugOut, level.prefix()+format+"\n", args...)
+	}
 }
 
 // Helper function to print debug messages
 func debugLog(config *Config, format string, args ...interface{}) {
-	if config.Debug && config.DebugOut != nil {
-		fmt.Fprintf(config.DebugOut, "Debug: "+format+"\n", args...)
-	}
+	logAt(config, levelDebug, format, args...)
+}
+
+// traceLog logs the fine detail of watching, one message per directory or event
+func traceLog(config *Config, format string, args ...interface{}) {
+	logAt(config, levelTrace, format, args...)
+}
+
+// infoLog logs what claudewatch does with prompts: queueing, sending, checkpoints
+func infoLog(config *Config, format string, args ...interface{}) {
+	logAt(config, levelInfo, format, args...)
+}
+
+// warnLog logs something that went wrong but was handled
+func warnLog(config *Config, format string, args ...interface{}) {
+	logAt(config, levelWarn, format, args...)
 }
 
 // printHelp displays the usage information
 func printHelp() {
 	fmt.Println("Usage: claudewatch [options] [directory...] [-- claude_arguments]")
+	fmt.Println("       claudewatch grep [--since T] [--until T] [--dispatch N] [-i] PATTERN")
+	fmt.Println("       claudewatch restore [--list] [--at TIMESTAMP] FILE")
+	fmt.Println("       claudewatch clean [--expired] [--dry-run]")
+	fmt.Println("       claudewatch selftest [-v]")
+	fmt.Println("       claudewatch config export [-o FILE] [DIR]")
+	fmt.Println("       claudewatch config import [--dry-run] [--keep-local] BUNDLE [DIR]")
+	fmt.Println("       claudewatch config show [options] [directory...] [-- claude_arguments]")
+	fmt.Println("       claudewatch send TEXT...")
+	fmt.Println("       claudewatch scan [--ignore REGEX] [--config FILE] [directory...]")
+	fmt.Println("       claudewatch history [--file PATH] [--since T] [--until T] [-n N] [-v]")
+	fmt.Println("       claudewatch flush")
+	fmt.Println("       claudewatch check-ignore [--dir DIR] [--ignore REGEX] [--project-scope] PATH...")
 	fmt.Println("")
 	fmt.Println("A transparent wrapper for the Claude CLI that watches file changes and")
 	fmt.Println("automatically sends AI-directed instructions to Claude.")
 	fmt.Println("")
 	fmt.Println("Options:")
 	fmt.Println("  -h, --help       Show this help message and exit")
-	fmt.Println("  --debug          Enable debug output (appended to .claudewatchdebug in the current directory)")
+	fmt.Println("  --debug          Enable debug output (appended to .claudewatchdebug in the current directory, or to the --log-file)")
+	fmt.Println("  -v, -vv          Log prompts as they are queued and sent (-v), or everything --debug logs (-vv)")
+	fmt.Println("  --log-level LEVEL")
+	fmt.Println("                   How much to log: trace (every directory and file event), debug, info (prompt dispatch) or warn")
+	fmt.Println("  --claude-command PATH")
+	fmt.Println("                   Run this Claude CLI binary (a wrapper script, a pinned version, ...) instead of looking up claude in PATH")
 	fmt.Println("  --prompt TEXT    Customize the prompt template (use {{.File}} for file path and {{.Markers}} for the detected markers with line numbers)")
+	fmt.Println("  --config PATH    Read settings from PATH instead of the nearest .claudewatch.json")
+	fmt.Println("  --preset NAME    Use a named prompt preset for every file (built in: " + strings.Join(presetNames(nil), ", ") + "; more can be defined in the config file)")
 	fmt.Println("  --ignore REGEX   Ignore files matching this regex pattern when watching")
-	fmt.Println("  --               Everything after this marker is passed directly to Claude")
+	fmt.Println("  --allow-template-shell")
+	fmt.Println("                   Enable the {{shell \"cmd\"}} template helper, which embeds a command's output in the prompt")
+	fmt.Println("  --confirm-strip  Show a diff of each marker removal and ask before writing it (trivial removals are auto-approved)")
+	fmt.Println("  --pick           When a change has several markers, choose which to send now; the rest stay in the file until it is saved again")
+	fmt.Println("  --context N      Include N lines above and below each marker in the prompt ({{.Context}} on each marker)")
+	fmt.Println("  --max-per-minute N")
+	fmt.Println("                   Send at most N prompts a minute; the rest wait in the queue (guards against save loops)")
+	fmt.Println("  --max-per-session N")
+	fmt.Println("                   Send at most N prompts in this session; the rest are held and their markers put back on exit")
+	fmt.Println("  --dedupe-window D")
+	fmt.Println("                   Don't send a prompt identical to one sent within this long, putting its markers back (e.g. 5m; off by default)")
+	fmt.Println("  --cooldown D     Ignore changes to a file for this long after it is processed, for editors and formatters that write twice (default 1s; 0 to process every change)")
+	fmt.Println("  --script FILE    Pass each prompt through the prompt(ctx) function of a Starlark script, which can rewrite it or pick its session")
+	fmt.Println("  --event-socket PATH")
+	fmt.Println("                   Write newline-delimited JSON events (marker found, prompt sent, idle) to a Unix socket for editor plugins")
+	fmt.Println("  --no-claude      Don't start Claude: write each rendered prompt to stdout, followed by a blank line, for other tools to use")
+	fmt.Println("  --output FILE    With --no-claude, append the prompts to FILE instead of writing them to stdout")
+	fmt.Println("  --clipboard      Also copy each prompt to the clipboard (pbcopy, wl-copy, xclip or xsel); with --no-claude, copy it instead of writing it out")
+	fmt.Println("  --quiet          Don't print the [File change detected: ...] banner and marker lines (warnings and errors still show)")
+	fmt.Println("  --show-prompt    Print each rendered prompt to stderr, dimmed in a box, right before it is sent")
+	fmt.Println("  --notify-format TEMPLATE")
+	fmt.Println("                   Print this Go template instead of the banner when markers are found (e.g. '» {{.File}} ({{len .Markers}})')")
+	fmt.Println("  --log-file PATH  Append claudewatch's messages (and with --debug, its debug output) to PATH, timestamped, rotating it as it grows")
+	fmt.Println("  --log-max-size MB")
+	fmt.Println("                   Rotate the --log-file once it is larger than this many MiB (default 10; 0 for no limit); 5 old logs are kept")
+	fmt.Println("  --log-max-age D  Rotate the --log-file once it has been written for this long (default 24h; 0 for no limit)")
+	fmt.Println("  --project-scope  In a monorepo, let Claude edit anywhere in the changed file's project (nearest go.mod, package.json or Cargo.toml) and use the project's .claudewatchignore")
+	fmt.Println("  --tracked-only   Only scan files tracked by git, leaving out build output, virtualenvs and caches")
+	fmt.Println("  --follow-symlinks")
+	fmt.Println("                   Also watch directories reached through symlinks (each directory is watched once, so link cycles are safe)")
+	fmt.Println("  --no-builtin-ignores")
+	fmt.Println("                   Watch editors' temp files (Vim swap files, JetBrains and VS Code atomic-save files, Emacs backups) like any other")
+	fmt.Println("  --backend-watcher NAME")
+	fmt.Println("                   How files are watched: fsnotify (default) or watchman, which uses a running Watchman daemon for huge trees")
+	fmt.Println("  --max-file-size KB")
+	fmt.Println("                   Don't scan files larger than this many KiB for markers (default 1024; 0 for no limit)")
+	fmt.Println("  --keep-markers   Never modify watched files: leave markers in place and send each one only once")
+	fmt.Println("  --progress-comments")
+	fmt.Println("                   While a prompt is in flight, leave a [claudewatch: in progress #N] comment where its markers were")
+	fmt.Println("  --backup         Save each file to .claudewatch/backups before removing its markers (recover with claudewatch restore)")
+	fmt.Println("  --session-notes  Log each dispatched prompt to .claudewatch/SESSION_NOTES.md ({{.NotesFile}} in templates)")
+	fmt.Println("  --git-checkpoint Before each prompt, snapshot the repository to refs/claudewatch/checkpoints, to diff or roll back what Claude did")
+	fmt.Println("  --auto-commit    Once Claude has answered a prompt, commit its changes with the instructions as the message")
+	fmt.Println("  --branch-per-instruction")
+	fmt.Println("                   Before each prompt, check out a new branch named from its instruction (claudewatch/handle-errors-in-foo); requires --auto-commit")
+	fmt.Println("  --require-clean  Don't send edits while other files have uncommitted changes (dirty_tree in the config file; warns by default)")
+	fmt.Println("  --coalesce       Send the edits of files saved together as one prompt, through a multi-file template")
+	fmt.Println("  --digest         Hold prompts and send them in batches on the schedule in the config file's digest settings")
+	fmt.Println("  --batch          Hold prompts until you press Ctrl-] (or run claudewatch flush), then send them as one prompt")
+	fmt.Println("  --hold-while-answering")
+	fmt.Println("                   Don't scan files saved while Claude is answering; scan them once its output has been quiet for 3 seconds")
+	fmt.Println("  --record         Record Claude's output (ANSI-stripped) to .claudewatch/transcript.log for claudewatch grep")
+	fmt.Println("  --restart-on-exit[=N]")
+	fmt.Println("                   Relaunch Claude if it exits or crashes, up to N times (default 3), resuming the prompt queue")
+	fmt.Println("  --fallback-command CMD")
+	fmt.Println("                   Headless command (e.g. \"claude -p\") that receives prompts on stdin if the interactive Claude exits; output is logged to .claudewatch/fallback.log")
+	fmt.Println("  --expand-command CMD")
+	fmt.Println("                   Headless command (e.g. \"claude -p --model haiku\") that rewrites each prompt into a clearer instruction before it is sent; with --confirm-strip you approve each rewrite")
+	fmt.Println("  --input-encoding NAME")
+	fmt.Println("                   How prompts are typed into Claude: bracketed-paste (default), backslash-newline, single-line or raw")
+	fmt.Println("  --attach-pid PID Type prompts into the terminal of an already running Claude CLI instead of starting one")
+	fmt.Println("  --attach-auto    Like --attach-pid, for the only Claude CLI you are running")
+	fmt.Println("  --tmux-target PANE")
+	fmt.Println("                   Send prompts with tmux send-keys to the Claude CLI running in this tmux pane (e.g. work:1.0) instead of starting one")
+	fmt.Println("  --reconnect      When attached, hold prompts while Claude is gone and reattach when it is started again")
+	fmt.Println("  --               Everything after this marker is passed directly to Claude; unknown options before it are an error")
 	fmt.Println("")
 	fmt.Println("Features:")
-	fmt.Println("  - Add '" + strings.Join(supportedAIMarkers, "', '") + "' at the end of a comment to trigger Claude to process that instruction") // ai:ignore
-	fmt.Println("  - Add 'ai:ignore' in a comment line before or on the same line as an instruction marker to skip processing it")                  // ai:ignore
+	fmt.Println("  - Add '" + strings.Join(claudewatch.SupportedMarkers(), "', '") + "' at the end of a comment to trigger Claude to process that instruction") // ai:ignore
+	fmt.Println("  - Add 'ai:ignore' in a comment line before or on the same line as an instruction marker to skip processing it")                              // ai:ignore
+	fmt.Println("  - Put 'ai:ignore-start' and 'ai:ignore-end' comments around a block to skip every marker in it")                                             // ai:ignore
+	fmt.Println("  - Add an 'ai:ignore-file' comment in the first 10 lines of a file to skip every marker in it")                                               // ai:ignore
 	fmt.Println("  - Create a .claudewatchignore file with one regex pattern per line to exclude files from being watched")
+	fmt.Println("  - Send SIGUSR1 to pause/resume dispatching and SIGUSR2 to rescan every watched file (configurable under \"signals\" in .claudewatch.json)")
+	fmt.Println("  - Run 'claudewatch send TEXT' (or write to .claudewatch/instructions.fifo) to queue an instruction without a marker")
 	fmt.Println("  - Place a .claudewatchprompt file at or above the run directory to override the default prompt (nearest wins; --prompt still takes precedence)")
 	fmt.Println("")
 	fmt.Println("Examples:")
@@ -153,10 +493,118 @@ func printHelp() {
 	os.Exit(0)
 }
 
+// loadAllIgnorePatterns (re)loads the .claudewatchignore patterns from every
+// watched root, replacing any previously loaded set and invalidating cached
+// ignore decisions.
+func loadAllIgnorePatterns(config *Config) {
+	var patterns IgnorePatterns
+	for _, root := range config.RootDirectories {
+		ignorePatterns, loadErr := LoadIgnorePatterns(root)
+		if loadErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Error loading .claudewatchignore in %s: %v\n", root, loadErr)
+			continue
+		}
+		if ignorePatterns != nil {
+			patterns = append(patterns, ignorePatterns...)
+			debugLog(config, "Loaded %d patterns from %s/.claudewatchignore", len(ignorePatterns), root)
+		}
+	}
+	config.IgnorePatterns = patterns
+	if config.IgnoreCache != nil {
+		config.IgnoreCache.invalidate()
+	}
+}
+
+// isRootIgnoreFile reports whether path is the .claudewatchignore file of one of the watched roots
+func isRootIgnoreFile(path string, config *Config) bool {
+	if filepath.Base(path) != ignoreFileName {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range config.RootDirectories {
+		if rootAbs, err := filepath.Abs(root); err == nil && filepath.Join(rootAbs, ignoreFileName) == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// logStats writes end-of-session statistics to the log
+func logStats(config *Config) {
+	if config.IgnoreCache != nil {
+		stats := config.IgnoreCache.stats()
+		hitRate := 0.0
+		if lookups := stats.hits + stats.misses; lookups > 0 {
+			hitRate = 100 * float64(stats.hits) / float64(lookups)
+		}
+		infoLog(config, "Ignore cache: %d hits, %d misses (%.0f%% hit rate), %d directories cached, %d evicted",
+			stats.hits, stats.misses, hitRate, stats.dirs, stats.evictions)
+	}
+}
+
+// rootPollInterval is how often a watched root directory that was removed or
+// moved away is looked for again
+var rootPollInterval = time.Second
+
+// watchedRoot returns the root directory, as given on the command line, that
+// path names, or an empty string if it is none of them
+func watchedRoot(config *Config, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for _, root := range config.RootDirectories {
+		if rootAbs, err := filepath.Abs(root); err == nil && rootAbs == abs {
+			return root
+		}
+	}
+	return ""
+}
+
+// awaitRoot waits for root, removed or moved away, to be a directory again
+// and then sends it on back, unless stop is closed first
+func awaitRoot(root string, back chan<- string, stop <-chan struct{}) {
+	ticker := time.NewTicker(rootPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if info, err := os.Stat(root); err == nil && info.IsDir() {
+				select {
+				case back <- root:
+				case <-stop:
+				}
+				return
+			}
+		}
+	}
+}
+
+// unwatchTree stops watching dir and every directory below it. Paths that
+// aren't watched, or whose watch the backend already dropped, are ignored.
+func unwatchTree(watcher fileWatcher, dir string) {
+	prefix := dir + string(filepath.Separator)
+	for _, path := range watcher.WatchList() {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			_ = watcher.Remove(path)
+		}
+	}
+}
+
 // watchDirectory adds a directory and its subdirectories to the watcher
 // Returns true if the directory was added, false if it was skipped
-func watchDirectory(watcher *fsnotify.Watcher, dirPath string, config *Config, skipRoot bool) error {
-	debugLog(config, "Considering path for watching: %s", dirPath)
+func watchDirectory(watcher fileWatcher, dirPath string, config *Config, skipRoot bool) error {
+	return watchDirectoryOnce(watcher, dirPath, config, skipRoot, &dirVisits{})
+}
+
+// watchDirectoryOnce is watchDirectory, skipping directories already in visits
+func watchDirectoryOnce(watcher fileWatcher, dirPath string, config *Config, skipRoot bool, visits *dirVisits) error {
+	traceLog(config, "Considering path for watching: %s", dirPath)
 
 	// Get directory info
 	info, err := os.Stat(dirPath)
@@ -168,24 +616,30 @@ func watchDirectory(watcher *fsnotify.Watcher, dirPath string, config *Config, s
 		return nil
 	}
 
+	// With --follow-symlinks, a link back into the tree would loop forever
+	if !visits.enter(info) {
+		traceLog(config, "Skipping directory already watched through another path: %s", dirPath)
+		return filepath.SkipDir
+	}
+
 	// Root directory check
 	name := info.Name()
 
 	// Skip hidden directories (but not . or .. directory references)
-	if IsHiddenOrSpecialFile(dirPath) {
-		debugLog(config, "Skipping hidden directory: %s", dirPath)
+	if config.skipsFile(dirPath) {
+		traceLog(config, "Skipping hidden directory: %s", dirPath)
 		return filepath.SkipDir
 	}
 
 	// Skip .git directories
 	if name == ".git" || strings.Contains(dirPath, "/.git/") {
-		debugLog(config, "Skipping git directory: %s", dirPath)
+		traceLog(config, "Skipping git directory: %s", dirPath)
 		return filepath.SkipDir
 	}
 
 	// Check if directory should be ignored based on patterns
 	if shouldIgnore, reason := ShouldIgnorePathWithConfig(dirPath, config); shouldIgnore {
-		debugLog(config, "Skipping directory due to %s: %s", reason, dirPath)
+		traceLog(config, "Skipping directory due to %s: %s", reason, dirPath)
 		return filepath.SkipDir
 	}
 
@@ -195,49 +649,64 @@ func watchDirectory(watcher *fsnotify.Watcher, dirPath string, config *Config, s
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error watching directory %s: %v\n", dirPath, err)
 		} else {
-			debugLog(config, "Watching directory: %s", dirPath)
+			traceLog(config, "Watching directory: %s", dirPath)
 		}
 	}
+	if watcher.recursive() {
+		return nil
+	}
 
 	// Walk subdirectories
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	walkRootPath := walkRoot(dirPath)
+	err = filepath.Walk(walkRootPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Skip the root directory (already processed)
-		if path == dirPath {
+		if path == walkRootPath {
+			return nil
+		}
+
+		// Symlinked directories are only walked with --follow-symlinks
+		if followsSymlink(config, path, info) {
+			if err := watchDirectoryOnce(watcher, path, config, false, visits); err != nil && err != filepath.SkipDir {
+				warnLog(config, "Error watching symlinked directory %s: %v", path, err)
+			}
 			return nil
 		}
 
 		if !info.IsDir() {
 			return nil
 		}
+		if !visits.enter(info) {
+			return filepath.SkipDir
+		}
 
 		// Skip hidden directories
-		if IsHiddenOrSpecialFile(path) {
-			debugLog(config, "Skipping hidden subdirectory: %s", path)
+		if config.skipsFile(path) {
+			traceLog(config, "Skipping hidden subdirectory: %s", path)
 			return filepath.SkipDir
 		}
 
 		// Skip .git directories
 		if info.Name() == ".git" || strings.Contains(path, "/.git/") {
-			debugLog(config, "Skipping git subdirectory: %s", path)
+			traceLog(config, "Skipping git subdirectory: %s", path)
 			return filepath.SkipDir
 		}
 
 		// Check if subdirectory should be ignored
 		if shouldIgnore, reason := ShouldIgnorePathWithConfig(path, config); shouldIgnore {
-			debugLog(config, "Skipping subdirectory due to %s: %s", reason, path)
+			traceLog(config, "Skipping subdirectory due to %s: %s", reason, path)
 			return filepath.SkipDir
 		}
 
 		// Add the subdirectory to the watcher
 		err = watcher.Add(path)
 		if err != nil {
-			debugLog(config, "Error watching subdirectory %s: %v", path, err)
+			warnLog(config, "Error watching subdirectory %s: %v", path, err)
 		} else {
-			debugLog(config, "Watching subdirectory: %s", path)
+			traceLog(config, "Watching subdirectory: %s", path)
 		}
 
 		return nil
@@ -247,6 +716,32 @@ func watchDirectory(watcher *fsnotify.Watcher, dirPath string, config *Config, s
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "grep":
+			os.Exit(runGrep(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		case "clean":
+			os.Exit(runClean(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		case "send":
+			os.Exit(runSend(os.Args[2:]))
+		case "scan":
+			os.Exit(runScan(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "flush":
+			os.Exit(runFlush(os.Args[2:]))
+		case "check-ignore":
+			os.Exit(runCheckIgnore(os.Args[2:]))
+		}
+	}
+
 	// Check for help flag
 	for _, arg := range os.Args[1:] {
 		if arg == "-h" || arg == "--help" || arg == "help" {
@@ -266,27 +761,37 @@ func main() {
 		ClaudeCommand:    "claude",
 		ClaudeArgs:       []string{},
 		RootDirectories:  nil,
-		AICommentPattern: markerPattern, // Using pattern from util.go
+		AICommentPattern: defaultMarkerScanner.MarkerPattern(),
 		PromptTemplate:   tmpl,
-		IgnorePattern:    nil,   // Default to not ignoring any files
-		IgnorePatterns:   nil,   // Will be loaded from .claudewatchignore
-		Debug:            false, // Debug mode off by default
+		IgnorePattern:    nil,      // Default to not ignoring any files
+		IgnorePatterns:   nil,      // Will be loaded from .claudewatchignore
+		LogLevel:         levelOff, // Nothing logged by default
+		IgnoreCache:      newIgnoreCache(),
 	}
 
-	// Detect --debug up front (before the full parse) so diagnostics from
-	// argument parsing are captured too. When set, append them to a
-	// .claudewatchdebug file in the current directory instead of the terminal,
-	// where Claude's full-screen TUI would otherwise clobber them.
-	for _, arg := range os.Args[1:] {
-		if arg == "--" {
-			break
+	// Detect the log level and --log-file up front (before the full parse)
+	// so diagnostics from argument parsing are captured too. Debug output is
+	// appended to the log file, or else to a .claudewatchdebug file in the
+	// current directory, instead of the terminal, where Claude's full-screen
+	// TUI would otherwise clobber it.
+	level, logPath := earlyLogFlags(os.Args[1:])
+	config.LogLevel = level
+	if logPath != "" {
+		logFile, openErr := openRotatingLog(logPath, defaultLogMaxSizeMB<<20, defaultLogMaxAge)
+		if openErr != nil {
+			fmt.Fprintf(os.Stderr, "Error opening log file %s: %v\n", logPath, openErr)
+			os.Exit(1)
 		}
-		if arg == "--debug" {
-			config.Debug = true
-			break
+		defer logFile.close()
+		config.Log = logFile
+		console.logTo(logFile)
+		fmt.Fprintf(logFile, "=== claudewatch session started %s ===\n", time.Now().Format(time.RFC3339))
+		if config.LogLevel != levelOff {
+			config.DebugOut = logFile
+			config.DebugPath = logFile.path
 		}
-	}
-	if config.Debug {
+		fmt.Fprintf(os.Stderr, "claudewatch: logging to %s\n", logFile.path)
+	} else if config.LogLevel != levelOff {
 		debugPath, absErr := filepath.Abs(".claudewatchdebug")
 		if absErr != nil {
 			debugPath = ".claudewatchdebug"
@@ -300,79 +805,216 @@ func main() {
 		config.DebugOut = debugFile
 		config.DebugPath = debugPath
 		fmt.Fprintf(debugFile, "\n=== claudewatch debug session started %s ===\n", time.Now().Format(time.RFC3339))
-		fmt.Fprintf(os.Stderr, "claudewatch: --debug enabled, appending debug output to %s\n", debugPath)
+		fmt.Fprintf(os.Stderr, "claudewatch: logging at %s level, appending debug output to %s\n", config.LogLevel, debugPath)
 	}
 
 	// Starting message that will only be shown in debug mode
 	debugLog(&config, "Starting claudewatch...")
 
 	// Parse command line arguments
-	args := os.Args[1:]
-	var claudeArgs []string
+	opts, parseErr := parseArgs(os.Args[1:])
+	if errors.Is(parseErr, flag.ErrHelp) {
+		printHelp()
+	}
+	if parseErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\nRun 'claudewatch --help' for usage.\n", parseErr)
+		os.Exit(2)
+	}
+	claudeArgs := opts.claudeArgs
 	promptFromFlag := false
+	inputEncodingFlag := opts.inputEncoding
+	maxFileSizeKB := opts.maxFileSizeKB
 
-	// Process arguments
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-
-		// Check for "--" separator (everything after goes to Claude)
-		if arg == "--" {
-			if i+1 < len(args) {
-				claudeArgs = args[i+1:]
-			}
-			break
+	if opts.logLevel != levelOff {
+		config.LogLevel = opts.logLevel
+		infoLog(&config, "Logging at %s level", config.LogLevel)
+	}
+	if opts.prompt != nil {
+		// Parsed once the config file's partials are known
+		promptFromFlag = true
+		debugLog(&config, "Using custom prompt template: %s", *opts.prompt)
+		debugLog(&config, "Note: Make sure your template contains {{.Markers}} for line numbers")
+	}
+	if opts.preset != "" {
+		config.Preset = opts.preset
+		debugLog(&config, "Using prompt preset: %s", config.Preset)
+	}
+	if opts.configPath != "" {
+		config.ConfigPath = opts.configPath
+		debugLog(&config, "Using config file: %s", config.ConfigPath)
+	}
+	if opts.ignore != "" {
+		pattern, err := regexp.Compile(opts.ignore)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ignore pattern: %v\n", err)
+			os.Exit(1)
 		}
-
-		// Check for --debug flag
-		if arg == "--debug" {
-			config.Debug = true
-			debugLog(&config, "Debug mode enabled")
-			continue
+		config.IgnorePattern = pattern
+		debugLog(&config, "Using ignore pattern: %s", opts.ignore)
+	}
+	if opts.allowTemplateShell {
+		allowTemplateShell = true
+		debugLog(&config, "Template shell helper enabled")
+	}
+	if opts.confirmStrip {
+		config.ConfirmStrip = true
+		debugLog(&config, "Confirming marker removals before writing")
+	}
+	if opts.pick {
+		config.PickMarkers = true
+		debugLog(&config, "Asking which markers to send when a change has several")
+	}
+	if opts.contextLines > 0 {
+		config.ContextLines = opts.contextLines
+		debugLog(&config, "Including %d lines of context around markers", opts.contextLines)
+	}
+	if opts.maxPerMinute > 0 || opts.maxPerSession > 0 {
+		config.MaxPerMinute, config.MaxPerSession = opts.maxPerMinute, opts.maxPerSession
+		debugLog(&config, "Limiting prompts to %d per minute and %d per session (0 is unlimited)", opts.maxPerMinute, opts.maxPerSession)
+	}
+	config.DedupeWindow = opts.dedupeWindow
+	config.Cooldown = opts.cooldown
+	if opts.projectScope {
+		config.ProjectScope = true
+		config.Projects = newProjectIndex(&config)
+		debugLog(&config, "Scoping prompts to the project of each file")
+	}
+	if opts.script != "" {
+		script, err := loadPromptScript(opts.script)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading script: %v\n", err)
+			os.Exit(1)
 		}
-
-		// Check for --prompt flag
-		if arg == "--prompt" {
-			if i+1 < len(args) {
-				customTemplate := args[i+1]
-				tmpl, err := template.New("prompt").Parse(customTemplate)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error parsing custom prompt template: %v\n", err)
-					os.Exit(1)
-				}
-				config.PromptTemplate = tmpl
-				promptFromFlag = true
-				debugLog(&config, "Using custom prompt template: %s", customTemplate)
-				debugLog(&config, "Note: Make sure your template contains {{.Markers}} for line numbers")
-				i++ // Skip the next argument (the template)
-				continue
-			}
+		config.Script = script
+		debugLog(&config, "Routing prompts through script: %s", opts.script)
+	}
+	if opts.eventSocket != "" {
+		events, err := listenEventSocket(opts.eventSocket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating event socket: %v\n", err)
+			os.Exit(1)
 		}
-
-		// Check for --ignore flag
-		if arg == "--ignore" {
-			if i+1 < len(args) {
-				ignorePattern := args[i+1]
-				pattern, err := regexp.Compile(ignorePattern)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error parsing ignore pattern: %v\n", err)
-					os.Exit(1)
-				}
-				config.IgnorePattern = pattern
-				debugLog(&config, "Using ignore pattern: %s", ignorePattern)
-				i++ // Skip the next argument (the pattern)
-				continue
-			}
+		defer events.close()
+		config.Events = events
+		debugLog(&config, "Writing editor events to %s", opts.eventSocket)
+	}
+	if config.Log != nil {
+		config.Log.setLimits(int64(opts.logMaxSizeMB)<<20, opts.logMaxAge)
+		debugLog(&config, "Rotating %s at %d MiB or after %s", config.Log.path, opts.logMaxSizeMB, opts.logMaxAge)
+	}
+	if opts.quiet {
+		config.Quiet = true
+		debugLog(&config, "Not announcing detected changes")
+	}
+	if opts.showPrompt {
+		config.ShowPrompts = true
+		debugLog(&config, "Printing each prompt before it is sent")
+	}
+	if opts.notifyFormat != "" {
+		tmpl, err := parseNotifyFormat(opts.notifyFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing --notify-format: %v\n", err)
+			os.Exit(1)
 		}
-
-		// Check if arg is a directory to watch (multiple directories allowed)
-		if fileInfo, statErr := os.Stat(arg); statErr == nil && fileInfo.IsDir() {
-			config.RootDirectories = append(config.RootDirectories, arg)
-			debugLog(&config, "Watching directory: %s", arg)
-			continue
+		config.NotifyFormat = tmpl
+		debugLog(&config, "Announcing detected changes with: %s", opts.notifyFormat)
+	}
+	if opts.noClaude {
+		config.NoClaude = true
+		config.OutputPath = opts.output
+		debugLog(&config, "Writing prompts out instead of starting Claude")
+	}
+	if opts.clipboard {
+		clip, err := newClipboard()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --clipboard: %v\n", err)
+			os.Exit(1)
 		}
-
-		// If we get here, this is an argument to pass to Claude
-		claudeArgs = append(claudeArgs, arg)
+		config.Clipboard = clip
+		debugLog(&config, "Copying prompts to the clipboard with %s", strings.Join(clip.command, " "))
+	}
+	if opts.trackedOnly {
+		config.TrackedOnly = true
+		debugLog(&config, "Only scanning files tracked by git")
+	}
+	if opts.followSymlinks {
+		config.FollowSymlinks = true
+		debugLog(&config, "Following symlinked directories")
+	}
+	if opts.noBuiltinIgnores {
+		config.WatchEditorTemps = true
+		debugLog(&config, "Watching editors' temp files")
+	}
+	if opts.keepMarkers {
+		config.KeepMarkers = true
+		debugLog(&config, "Leaving markers in watched files")
+	}
+	if opts.progressComments {
+		config.ProgressComments = true
+		debugLog(&config, "Marking marker sites while prompts are in flight")
+	}
+	if opts.backup {
+		config.Backup = true
+		debugLog(&config, "Backing up files before removing markers")
+	}
+	if opts.sessionNotes {
+		config.SessionNotes = true
+	}
+	if opts.gitCheckpoint {
+		config.GitCheckpoint = true
+		debugLog(&config, "Recording a git checkpoint before each prompt")
+	}
+	if opts.autoCommit {
+		config.AutoCommit = true
+		debugLog(&config, "Committing Claude's changes after each prompt")
+	}
+	if opts.holdWhileAnswering {
+		config.HoldSaves = true
+		debugLog(&config, "Holding files saved while Claude is answering")
+	}
+	if opts.branchPerPrompt {
+		config.BranchPerPrompt = true
+		debugLog(&config, "Checking out a branch for each instruction")
+	}
+	if opts.record {
+		config.Record = true
+		debugLog(&config, "Recording session transcript")
+	}
+	if opts.fallbackCommand != "" {
+		config.FallbackCommand = opts.fallbackCommand
+		debugLog(&config, "Using fallback command: %s", config.FallbackCommand)
+	}
+	config.ExpandCommand = opts.expandCommand
+	if inputEncodingFlag != "" {
+		debugLog(&config, "Using input encoding: %s", inputEncodingFlag)
+	}
+	if opts.restartLimit > 0 {
+		config.RestartLimit = opts.restartLimit
+		debugLog(&config, "Restarting Claude up to %d times if it exits", opts.restartLimit)
+	}
+	if opts.attachPID != 0 {
+		config.AttachPID = opts.attachPID
+		debugLog(&config, "Attaching to Claude process %d", opts.attachPID)
+	}
+	if opts.attachAuto {
+		config.AttachAuto = true
+		debugLog(&config, "Attaching to a running Claude process")
+	}
+	if opts.tmuxTarget != "" {
+		config.TmuxTarget = opts.tmuxTarget
+		debugLog(&config, "Attaching to Claude in tmux pane %s", opts.tmuxTarget)
+	}
+	if opts.reconnect {
+		config.Reconnect = true
+		debugLog(&config, "Reattaching to Claude when it comes back")
+	}
+	config.WatcherBackend = opts.watcherBackend
+	if config.WatcherBackend != watcherFsnotify {
+		debugLog(&config, "Watching files through %s", config.WatcherBackend)
+	}
+	for _, dir := range opts.dirs {
+		config.RootDirectories = append(config.RootDirectories, dir)
+		debugLog(&config, "Watching directory: %s", dir)
 	}
 
 	// Set Claude arguments
@@ -381,35 +1023,312 @@ func main() {
 		debugLog(&config, "Passing arguments to Claude: %v", config.ClaudeArgs)
 	}
 
+	// An attached Claude was started elsewhere: there is nothing to pass
+	// arguments to and no output of ours to record
+	if config.TmuxTarget != "" && (config.AttachPID != 0 || config.AttachAuto) {
+		fmt.Fprintf(os.Stderr, "Error: --tmux-target cannot be used with --attach-pid or --attach-auto\n")
+		os.Exit(1)
+	}
+	if config.attaching() {
+		if len(claudeArgs) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: Claude arguments %v cannot be used when attaching to a running Claude\n", claudeArgs)
+			os.Exit(1)
+		}
+		if config.Record {
+			fmt.Fprintf(os.Stderr, "Error: --record cannot be used when attaching to a running Claude\n")
+			os.Exit(1)
+		}
+		if config.RestartLimit > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --restart-on-exit cannot be used when attaching to a running Claude\n")
+			os.Exit(1)
+		}
+		if config.AutoCommit {
+			fmt.Fprintf(os.Stderr, "Error: --auto-commit cannot be used when attaching to a running Claude, whose answers can't be watched\n")
+			os.Exit(1)
+		}
+		if config.HoldSaves {
+			fmt.Fprintf(os.Stderr, "Error: --hold-while-answering cannot be used when attaching to a running Claude, whose answers can't be watched\n")
+			os.Exit(1)
+		}
+	}
+
+	// Without Claude there is nothing to pass arguments to, record, relaunch
+	// or fall back from, and no answers to wait for
+	if config.NoClaude {
+		var conflict string
+		switch {
+		case len(claudeArgs) > 0:
+			conflict = fmt.Sprintf("Claude arguments %v", claudeArgs)
+		case config.attaching():
+			conflict = "--attach-pid, --attach-auto and --tmux-target"
+		case config.Record:
+			conflict = "--record"
+		case config.RestartLimit > 0:
+			conflict = "--restart-on-exit"
+		case config.FallbackCommand != "":
+			conflict = "--fallback-command"
+		case config.AutoCommit:
+			conflict = "--auto-commit"
+		case config.HoldSaves:
+			conflict = "--hold-while-answering"
+		}
+		if conflict != "" {
+			fmt.Fprintf(os.Stderr, "Error: %s cannot be used with --no-claude\n", conflict)
+			os.Exit(1)
+		}
+	}
+
+	if config.Reconnect && !config.attaching() {
+		fmt.Fprintf(os.Stderr, "Error: --reconnect only applies with --attach-pid, --attach-auto or --tmux-target\n")
+		os.Exit(1)
+	}
+
+	// --keep-markers promises to leave watched files alone
+	if config.ProgressComments && config.KeepMarkers {
+		fmt.Fprintf(os.Stderr, "Error: --progress-comments cannot be used with --keep-markers\n")
+		os.Exit(1)
+	}
+
+	// Without --auto-commit, what Claude did for one instruction would be
+	// carried over, uncommitted, onto the next instruction's branch
+	if config.BranchPerPrompt && !config.AutoCommit {
+		fmt.Fprintf(os.Stderr, "Error: --branch-per-instruction requires --auto-commit, so each instruction's changes are committed to its own branch\n")
+		os.Exit(1)
+	}
+
 	// Default to watching the current directory if none were specified
 	if len(config.RootDirectories) == 0 {
 		config.RootDirectories = []string{"."}
 	}
 
+	// Load the config file: an explicit --config, else the nearest .claudewatch.json
+	if config.ConfigPath == "" {
+		config.ConfigPath = findConfigFile(".")
+	}
+	if config.ConfigPath != "" {
+		fileConfig, loadErr := LoadFileConfig(config.ConfigPath)
+		if loadErr != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config file: %v\n", loadErr)
+			os.Exit(1)
+		}
+		config.FileConfig = fileConfig
+		debugLog(&config, "Loaded config file %s", config.ConfigPath)
+	}
+	if err := setTemplatePartials(config.FileConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing config file templates: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.prompt != nil {
+		tmpl, err := parsePromptTemplate(*opts.prompt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing custom prompt template: %v\n", err)
+			os.Exit(1)
+		}
+		config.PromptTemplate = tmpl
+	}
+
+	// An explicit --claude-command or claude_command is run as given; otherwise
+	// "claude" is looked up, falling back to its alternative names
+	claudeCommandSet := false
+	if opts.claudeCommand != "" {
+		config.ClaudeCommand = opts.claudeCommand
+		claudeCommandSet = true
+	} else if config.FileConfig != nil && strings.TrimSpace(config.FileConfig.ClaudeCommand) != "" {
+		config.ClaudeCommand = strings.TrimSpace(config.FileConfig.ClaudeCommand)
+		claudeCommandSet = true
+	}
+	if claudeCommandSet {
+		debugLog(&config, "Using Claude command: %s", config.ClaudeCommand)
+	}
+
+	// Keep logs, backups and the transcript from growing without bound
+	go pruneStateDirPeriodically(&config, stateDirName, retentionFromConfig(config.FileConfig))
+
+	// Skip files too large to be worth scanning
+	config.MaxFileSize = maxFileSize(maxFileSizeKB, config.FileConfig)
+	config.FileTreeDepth = fileTreeDepth(config.FileConfig)
+	debugLog(&config, "Scanning files up to %d bytes (0 = no limit)", config.MaxFileSize)
+
+	// Pick how prompts are typed into Claude. Per-version settings in the
+	// config file need the CLI's version, which is only looked up then.
+	var encodingConfig *InputEncodingConfig
+	if config.FileConfig != nil {
+		encodingConfig = config.FileConfig.InputEncoding
+	}
+	encoding, encodingErr := resolveInputEncoding(inputEncodingFlag, encodingConfig, func() string {
+		version := cliVersion(config.ClaudeCommand)
+		debugLog(&config, "Claude CLI version: %q", version)
+		return version
+	})
+	if encodingErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", encodingErr)
+		os.Exit(1)
+	}
+	config.InputEncoding = encoding
+
+	// How the typed prompt is then submitted
+	config.Submit, err = compileSubmit(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+	debugLog(&config, "Typing prompts with %s input encoding", encoding)
+
+	// A --preset acts like --prompt, with the template looked up by name
+	if config.Preset != "" {
+		if promptFromFlag {
+			fmt.Fprintf(os.Stderr, "Error: --prompt and --preset cannot be used together\n")
+			os.Exit(1)
+		}
+		var userPresets map[string]string
+		if config.FileConfig != nil {
+			userPresets = config.FileConfig.Presets
+		}
+		presetTmpl, presetErr := loadPreset(config.Preset, userPresets)
+		if presetErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", presetErr)
+			os.Exit(1)
+		}
+		config.PromptTemplate = presetTmpl
+		promptFromFlag = true
+	}
+
 	// Build the prompt resolver. When --prompt is given it wins for every file;
-	// otherwise the nearest .claudewatchprompt to each changed file is used,
-	// discovered per change and cached per directory.
+	// otherwise a template configured for the file's extension is used, then
+	// the nearest .claudewatchprompt to each changed file, discovered per change
+	// and cached per directory.
 	var promptOverride *template.Template
 	if promptFromFlag {
 		promptOverride = config.PromptTemplate
 	}
 	resolver := newPromptResolver(config.PromptTemplate, promptOverride, config.DebugOut)
+	extensionTemplates, err := compileExtensionTemplates(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing config file templates: %v\n", err)
+		os.Exit(1)
+	}
+	resolver.byExtension = extensionTemplates
+	resolver.byMarkerType, err = compileMarkerTypeTemplates(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing config file templates: %v\n", err)
+		os.Exit(1)
+	}
+	resolver.byTag, err = compileTagTemplates(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing config file templates: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.coalesce {
+		config.Coalesce, err = compileMultiFileTemplate(config.FileConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing config file templates: %v\n", err)
+			os.Exit(1)
+		}
+		debugLog(&config, "Coalescing the edits of files saved together")
+	}
 
-	// Load ignore patterns from .claudewatchignore in each watched root
-	for _, root := range config.RootDirectories {
-		ignorePatterns, loadErr := LoadIgnorePatterns(root)
-		if loadErr != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Error loading .claudewatchignore in %s: %v\n", root, loadErr)
-			continue
+	// Namespaced markers (e.g. be-ai!) route to their own template and session
+	if config.FileConfig != nil && len(config.FileConfig.Namespaces) > 0 {
+		stateDir, stateErr := ensureStateDir()
+		if stateErr != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", stateDirName, stateErr)
+			os.Exit(1)
 		}
-		if ignorePatterns != nil {
-			config.IgnorePatterns = append(config.IgnorePatterns, ignorePatterns...)
-			debugLog(&config, "Loaded %d patterns from %s/.claudewatchignore", len(ignorePatterns), root)
+		config.Namespaces, err = buildNamespaceRoutes(config.FileConfig.Namespaces, stateDir, &config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in config file namespaces: %v\n", err)
+			os.Exit(1)
+		}
+		debugLog(&config, "Marker namespaces: %v", sortedKeys(config.Namespaces))
+	}
+	config.Scanner, err = newMarkerScanner(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+	config.AICommentPattern = config.Scanner.MarkerPattern()
+	if config.FileConfig != nil && config.FileConfig.TodoMarkers {
+		debugLog(&config, "Treating TODO(ai): and FIXME(ai): comments as markers")
+	}
+	if tags := markerTags(config.FileConfig); len(tags) > 0 {
+		debugLog(&config, "Marker tags: %v", tags)
+	}
+
+	if config.FileConfig != nil && config.FileConfig.SessionNotes {
+		config.SessionNotes = true
+	}
+
+	// Prompts can be rewritten by a quick headless model before they are sent
+	if config.ExpandCommand == "" && config.FileConfig != nil {
+		config.ExpandCommand = strings.TrimSpace(config.FileConfig.ExpandCommand)
+	}
+	if config.ExpandCommand != "" {
+		debugLog(&config, "Expanding prompts with: %s", config.ExpandCommand)
+	}
+
+	// With --digest, prompts are held and sent in scheduled batches
+	if opts.digest {
+		config.Digest, err = compileDigest(config.FileConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		debugLog(&config, "Holding prompts for digest batches")
+	}
+
+	// With --batch, prompts are held until the user flushes them
+	if opts.batch {
+		if opts.digest {
+			fmt.Fprintln(os.Stderr, "Error: --batch and --digest can't be used together")
+			os.Exit(1)
 		}
+		config.Batch = true
+		debugLog(&config, "Holding prompts until the batch is flushed")
 	}
 
+	// Edits on top of other uncommitted work are warned about or refused
+	config.DirtyTree, err = dirtyTreeMode(config.FileConfig, opts.requireClean)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Queue prompts for some paths ahead of (or behind) the rest
+	config.PriorityRules, err = compilePriorityRules(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load ignore patterns from .claudewatchignore in each watched root
+	loadAllIgnorePatterns(&config)
+
+	// Build output is ignored while its build runs
+	config.Builds, err = compileBuildIgnoreRules(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+	if config.Builds != nil {
+		go config.Builds.run(&config)
+	}
+
+	// Changes wait for on-save formatters to rewrite the file before a scan
+	config.Formatters = compileFormatters(config.FileConfig)
+	if config.Formatters != nil {
+		go config.Formatters.run(&config)
+	}
+
+	// SIGUSR1/SIGUSR2 quick actions
+	signalActions, err := resolveSignalActions(configSignals(config.FileConfig))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		os.Exit(1)
+	}
+	debugLog(&config, "Signal actions: %s", describeSignalActions(signalActions))
+
 	// Create a new file watcher
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := newFileWatcher(&config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating file watcher: %v\n", err)
 		os.Exit(1)
@@ -424,8 +1343,25 @@ func main() {
 		}
 	}
 
+	// With --attach-pid, --attach-auto or --tmux-target, prompts are typed
+	// into a Claude CLI that is already running instead of one started here
+	if config.attaching() {
+		runAttached(&config, watcher, resolver, signalActions)
+		return
+	}
+
+	// With --no-claude, prompts are written out for something else to use
+	if config.NoClaude {
+		runStandalone(&config, watcher, resolver, signalActions)
+		return
+	}
+
 	// Debug: Check if Claude executable exists
 	path, err := exec.LookPath(config.ClaudeCommand)
+	if err != nil && claudeCommandSet {
+		fmt.Fprintf(os.Stderr, "Error: Claude command %q not found: %v\n", config.ClaudeCommand, err)
+		os.Exit(1)
+	}
 	if err != nil {
 		debugLog(&config, "Claude command not found in PATH: %v", err)
 		debugLog(&config, "Searching for claude-cli or anthropic alternatives...")
@@ -445,27 +1381,54 @@ func main() {
 	}
 
 	// Create a channel for file change prompts
-	promptChan := make(chan string)
+	promptChan := make(chan promptRequest)
+
+	// claudewatch exits with Claude's status. The deferred exit runs after the
+	// cleanup deferred below, so from here on errors set exitCode and return.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 
 	// Start Claude process with PTY
 	debugLog(&config, "Starting Claude with command: %s %v using PTY", config.ClaudeCommand, config.ClaudeArgs)
-	claudeCmd := exec.Command(config.ClaudeCommand, config.ClaudeArgs...)
-
-	// Start the command with a pty
-	ptyMaster, err := pty.Start(claudeCmd)
-	if err != nil {
+	claude := &ptySession{command: config.ClaudeCommand, args: config.ClaudeArgs}
+	if err := claude.start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting Claude with PTY: %v\n", err)
 		os.Exit(1)
 	}
 	// Make sure to close the pty at the end
-	defer ptyMaster.Close()
+	defer claude.close()
+
+	// Relative paths in prompts are resolved against Claude's working directory
+	claudeCwd.follow(claude.pid())
+	warnCwdDrift(&config)
+
+	// Prompts go to the PTY, or to the fallback command once Claude is gone
+	dispatch := &dispatcher{
+		primary:    &ptyBackend{pty: claude, config: &config},
+		preamble:   resetPreamble(config.FileConfig),
+		budget:     newPromptBudget(config.MaxPerMinute, config.MaxPerSession),
+		checkpoint: newGitCheckpoints(&config),
+		branches:   newBranchSwitcher(&config),
+		hooks:      newSendHooks(&config),
+		events:     config.Events,
+		history:    openSessionHistory(&config),
+		clipboard:  config.Clipboard,
+		echo:       config.ShowPrompts,
+	}
+	setFallback(dispatch, &config)
+	startDigest(dispatch, &config)
+	startBatch(dispatch, &config)
 
 	// Handle pty size
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGWINCH)
 	go func() {
 		for range ch {
-			if err := pty.InheritSize(os.Stdin, ptyMaster); err != nil {
+			if err := claude.resize(); err != nil {
 				fmt.Fprintf(os.Stderr, "Error resizing pty: %s\n", err)
 			}
 		}
@@ -477,196 +1440,415 @@ func main() {
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error setting terminal to raw mode: %v\n", err)
-		os.Exit(1)
+		exitCode = 1
+		return
 	}
 	defer func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }() // Best effort
 
 	// Create waitgroup to manage goroutines
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(1)
 
-	// Goroutine to copy stdin to the pty and the pty to stdout
-	go func() {
-		defer wg.Done()
-		// Copy stdin to the pty
-		go func() { io.Copy(ptyMaster, os.Stdin) }()
-		// Copy the pty to stdout
-		io.Copy(os.Stdout, ptyMaster)
-	}()
+	// Keystrokes go to Claude unless claudewatch is asking a question
+	input := newInputRouter(claude)
+	if config.Batch {
+		input.hotkey = batchKey
+		input.onHotkey = func() { releaseBatch(&config, dispatch, "Ctrl-]") }
+	}
+
+	// Claude's output is watched to tell when it has answered a prompt
+	activity := &outputActivity{}
+	dispatch.activity = activity
+
+	// With --record, Claude's output is also appended to the transcript
+	var output io.Writer = io.MultiWriter(os.Stdout, activity)
+	var transcript *transcriptRecorder
+	if config.Record {
+		stateDir, stateErr := ensureStateDir()
+		if stateErr != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", stateDirName, stateErr)
+			exitCode = 1
+			return
+		}
+		transcriptFile, openErr := os.OpenFile(filepath.Join(stateDir, transcriptFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if openErr != nil {
+			fmt.Fprintf(os.Stderr, "Error opening transcript: %v\n", openErr)
+			exitCode = 1
+			return
+		}
+		defer transcriptFile.Close()
+		transcript = newTranscriptRecorder(transcriptFile)
+		output = io.MultiWriter(os.Stdout, activity, transcript)
+		dispatch.transcript = transcript
+	}
+
+	// Copy stdin to the pty; the pty is copied to stdout while Claude runs
+	go input.run(os.Stdin)
+
+	// With --progress-comments, marker sites are marked until Claude answers
+	var progress *progressTracker
+	if config.ProgressComments {
+		progress = newProgressTracker(config.markerScanner())
+	}
+
+	// With --session-notes, each prompt gets an entry in the work log
+	notes := openSessionNotes(&config)
 
 	// Goroutine to handle file change prompts
 	go func() {
 		defer wg.Done()
 
 		// Start the file watcher
-		processedFiles := make(map[string]time.Time)
+		processor := newFileProcessor(&config, resolver, promptChan)
+		processor.confirm = input.confirm
+		processor.pick = input.pick
+		processor.progress = progress
+		processor.notes = notes
+		watchAndDispatch(&config, watcher, processor, dispatch, signalActions, promptChan)
+	}()
 
-		// Monitor files for changes
-		go func() {
-			for {
+	// Wait for Claude to finish. With --restart-on-exit it is relaunched,
+	// holding prompts until the new session has started up. SIGINT and
+	// SIGTERM sent to claudewatch are passed on to Claude, which is then
+	// neither restarted nor failed over from.
+	quit := false
+	for restarts := 0; ; restarts++ {
+		forwarded, err := claude.run(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Claude process ended with error: %v\n", err)
+		}
+		exitCode = exitStatus(err)
+		if forwarded != nil {
+			infoLog(&config, "Claude exited after %s was passed on to it", forwarded)
+			quit = true
+			break
+		}
+		if restarts >= config.RestartLimit {
+			break
+		}
+		dispatch.setUnavailable(true)
+		if !awaitRestart(func() { _ = term.Restore(int(os.Stdin.Fd()), oldState) }, func() { _, _ = term.MakeRaw(int(os.Stdin.Fd())) }, restarts+1, config.RestartLimit) {
+			quit = true
+			break
+		}
+		if err := claude.start(); err != nil {
+			console.errorf("Error restarting Claude: %v", err)
+			break
+		}
+		infoLog(&config, "Restarted Claude (pid %d)", claude.pid())
+		claudeCwd.follow(claude.pid())
+		go func(started time.Time) {
+			activity.waitQuiet(started, answerQuietPeriod)
+			dispatch.setUnavailable(false)
+		}(time.Now())
+	}
+	dispatch.setUnavailable(false)
+
+	// With a fallback configured, keep watching and dispatch headlessly until
+	// the user interrupts us
+	if !quit && dispatch.failover("Claude exited") {
+		_ = term.Restore(int(os.Stdin.Fd()), oldState)
+		fmt.Fprintf(os.Stderr, "claudewatch: still watching; press Ctrl-C to stop\n")
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		signal.Stop(stop)
+	}
+
+	// Close the prompt channel and wait for goroutines to finish
+	close(promptChan)
+	wg.Wait()
+
+	// Prompts still held by a pause will never be sent; put their markers back
+	dispatch.abandon()
+	progress.removeAll()
+	dispatch.history.close()
+
+	logStats(&config)
+}
+
+// watchAndDispatch runs the event loop: it schedules scans of changed files,
+// handles the quick-action signals and sends the resulting prompts through
+// dispatch until prompts is closed.
+func watchAndDispatch(config *Config, watcher fileWatcher, processor *fileProcessor, dispatch *dispatcher, signalActions map[syscall.Signal]string, prompts chan promptRequest) {
+	// Prompts are delivered on a goroutine of their own, which is also woken
+	// to release those held while paused or waiting for the session
+	queued := make(chan struct{}, 1)
+	dispatch.setDelivery(queued)
+
+	// Map quick-action signals onto the dispatcher and the event loop
+	rescanRequests := make(chan struct{}, 1)
+	actionSignals := make(chan os.Signal, 1)
+	signal.Notify(actionSignals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range actionSignals {
+			switch signalActions[sig.(syscall.Signal)] {
+			case signalActionPause:
+				if dispatch.togglePause() {
+					console.notice("claudewatch: dispatching paused (%s); prompts will be held", sig)
+				} else {
+					console.notice("claudewatch: dispatching resumed (%s)", sig)
+				}
+			case signalActionReset:
+				console.notice("claudewatch: clearing Claude's context (%s)", sig)
+				prompts <- promptRequest{Prompt: clearCommand, Reset: true}
+			case signalActionFlush:
+				go releaseBatch(config, dispatch, sig.String())
+			case signalActionRescan:
 				select {
-				case event, ok := <-watcher.Events:
-					if !ok {
-						return
-					}
+				case rescanRequests <- struct{}{}:
+				default: // A rescan is already pending
+				}
+			}
+		}
+	}()
+	scheduler := newScanScheduler(renameSettleDelay)
+	scheduler.formatters = config.Formatters
 
-					// Never react to writes to our own debug log, and never log
-					// this skip either: logging it would write to the debug file,
-					// triggering another event and looping forever. This check must
-					// stay first, before any debugLog call in this case.
-					if config.DebugPath != "" {
-						if abs, absErr := filepath.Abs(event.Name); absErr == nil && abs == config.DebugPath {
-							continue
-						}
-					}
+	// With --hold-while-answering, files saved while Claude answers wait for it
+	var hold *answerHold
+	if config.HoldSaves {
+		hold = newAnswerHold(dispatch.activity)
+	}
 
-					debugLog(&config, "Received event: %s (op: %s)", event.Name, event.Op)
+	// Take instructions written to the named pipe as well as from markers
+	fifo, err := openInstructionFifo(config)
+	if err != nil {
+		console.warn("Not reading instructions from %s: %v", filepath.Join(stateDirName, instructionFifoName), err)
+	}
+	defer fifo.close()
 
-					// Process write events and create events
-					if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
-						// Check if the file/directory exists
-						fileInfo, err := os.Stat(event.Name)
-						if err != nil {
-							continue
-						}
+	// With --batch, "claudewatch flush" sends the held prompts
+	var flushes *instructionFifo
+	if config.Batch {
+		if flushes, err = openFifo(config, flushFifoName); err != nil {
+			console.warn("claudewatch flush won't work: %v", err)
+		}
+		defer flushes.close()
+	}
 
-						// Handle directory creation separately
-						if fileInfo.IsDir() && event.Has(fsnotify.Create) {
-							debugLog(&config, "New directory created: %s", event.Name)
+	// A root directory that is removed or moved away is watched again once
+	// it is back
+	rootsBack := make(chan string)
+	awaiting := make(map[string]bool)
+	stopped := make(chan struct{})
 
-							// Try to watch the new directory and its subdirectories
-							err = watchDirectory(watcher, event.Name, &config, false)
+	// Monitor files for changes
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case event, ok := <-watcher.events():
+				if !ok {
+					return
+				}
 
-							if err != nil {
-								if err == filepath.SkipDir {
-									debugLog(&config, "Directory skipped: %s", event.Name)
-								} else {
-									debugLog(&config, "Error watching new directory: %v", err)
-								}
-							}
+				// A watch dropped along with its directory can still report
+				// an event, with no name; it is about nothing we watch
+				if event.Name == "" {
+					continue
+				}
+
+				// Never react to writes to our own debug log, and never log
+				// this skip either: logging it would write to the debug file,
+				// triggering another event and looping forever. This check must
+				// stay first, before any debugLog call in this case.
+				if config.DebugPath != "" {
+					if abs, absErr := filepath.Abs(event.Name); absErr == nil && abs == config.DebugPath {
+						continue
+					}
+				}
+				if config.Log != nil && isLogFile(event.Name, config.Log.path) {
+					continue
+				}
+
+				traceLog(config, "Received event: %s (op: %s)", event.Name, event.Op)
+
+				// Edits to a root .claudewatchignore take effect immediately
+				if isRootIgnoreFile(event.Name, config) && !event.Has(fsnotify.Chmod) {
+					debugLog(config, "Reloading ignore patterns after change to %s", event.Name)
+					loadAllIgnorePatterns(config)
+					continue
+				}
+
+				// So do changes to a project's ignore file, and new projects
+				if config.Projects != nil && isProjectFile(event.Name) && !event.Has(fsnotify.Chmod) {
+					debugLog(config, "Looking up projects again after change to %s", event.Name)
+					config.Projects.refresh(filepath.Dir(event.Name))
+					if config.IgnoreCache != nil {
+						config.IgnoreCache.invalidate()
+					}
+				}
 
+				// A path renamed or removed before its scan settled was an
+				// intermediate step (e.g. an editor's temp file); its content
+				// is scanned under the destination name instead. A directory
+				// that moved away stops being watched, as its watch would keep
+				// reporting events under the old path.
+				replaced := false
+				if event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+					if scheduler.cancel(event.Name) {
+						debugLog(config, "Dropped pending scans of renamed/removed path: %s", event.Name)
+					}
+					processor.scans.forget(event.Name)
+					processor.cooldown.forget(event.Name)
+					processor.hashes.forget(event.Name)
+					unwatchTree(watcher, event.Name)
+
+					// A root that went away is looked for until it is back
+					if root := watchedRoot(config, event.Name); root != "" && !awaiting[root] {
+						if _, err := os.Stat(root); err != nil {
+							console.warn("Watched directory %s was removed or moved away; watching for it to come back", root)
+							awaiting[root] = true
+							go awaitRoot(root, rootsBack, stopped)
 							continue
 						}
+					}
+
+					// Some platforms report a file replaced by a rename only as
+					// a rename of the file it replaced. If something is at the
+					// path again, treat it as new.
+					if _, err := os.Lstat(event.Name); err != nil {
+						continue
+					}
+					debugLog(config, "Path replaced: %s", event.Name)
+					replaced = true
+				}
+
+				// Process writes, creations and replacements. Chmod counts too:
+				// some editors and network filesystems report a save only as a
+				// change of attributes.
+				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Chmod) || replaced {
+					// Check if the file/directory exists
+					fileInfo, err := os.Stat(event.Name)
+					if err != nil {
+						continue
+					}
 
-						// Skip hidden and special files
-						if IsHiddenOrSpecialFile(event.Name) {
-							debugLog(&config, "Skipping hidden or special file: %s", event.Name)
+					// Handle directory creation separately
+					if fileInfo.IsDir() {
+						if !event.Has(fsnotify.Create) && !replaced {
 							continue
 						}
-
-						// Check if file should be ignored based on patterns
-						if shouldIgnore, reason := ShouldIgnorePathWithConfig(event.Name, &config); shouldIgnore {
-							debugLog(&config, "Skipping file due to %s: %s", reason, event.Name)
+						if linkInfo, err := os.Lstat(event.Name); err == nil && linkInfo.Mode()&os.ModeSymlink != 0 && !config.FollowSymlinks {
+							traceLog(config, "Not following symlinked directory: %s", event.Name)
 							continue
 						}
-						debugLog(&config, "Watching file: %s", event.Name)
+						debugLog(config, "New directory created: %s", event.Name)
 
-						// Skip files processed recently
-						now := time.Now()
-						if lastProcessed, exists := processedFiles[event.Name]; exists {
-							if now.Sub(lastProcessed) < time.Second {
-								continue
-							}
-						}
-						processedFiles[event.Name] = now
+						// Try to watch the new directory and its subdirectories
+						err = watchDirectory(watcher, event.Name, config, false)
 
-						// Check if file contains AI comments
-						content, err := os.ReadFile(event.Name)
 						if err != nil {
+							if err == filepath.SkipDir {
+								traceLog(config, "Directory skipped: %s", event.Name)
+							} else {
+								warnLog(config, "Error watching new directory: %v", err)
+							}
 							continue
 						}
 
-						markers := findActiveAIMarkers(string(content))
-						if len(markers) > 0 {
-							absPath, err := filepath.Abs(event.Name)
-							if err != nil {
-								continue
-							}
-
-							// Store original markers for logging
-							originalMarkers := make([]AIMarkerLocation, len(markers))
-							copy(originalMarkers, markers)
+						// A directory moved into the tree may already hold
+						// files with markers; they never get events of their own.
+						// One a build is writing is left to it.
+						if building, build := config.Builds.ignores(event.Name); building {
+							debugLog(config, "Not scanning %s while %q is running", event.Name, build)
+							continue
+						}
+						walkTree(config, event.Name, scheduler.schedule)
+						continue
+					}
 
-							// Log file change before processing
-							fmt.Fprintf(os.Stderr, "\r\n[File change detected: %s - sending to Claude]\r\n", event.Name)
-							for _, marker := range originalMarkers {
-								fmt.Fprintf(os.Stderr, "  Line %d: %s\r\n", marker.LineNumber, marker.LineText)
-							}
+					// Skip hidden and special files
+					if config.skipsFile(event.Name) {
+						traceLog(config, "Skipping hidden or special file: %s", event.Name)
+						continue
+					}
 
-							// Remove AI markers from the file and get updated markers
-							debugLog(&config, "Removing AI markers from file: %s", event.Name)
-							updatedMarkers, err := removeAIMarkersFromFile(event.Name, markers)
-							if err != nil {
-								fmt.Fprintf(os.Stderr, "Error removing AI markers: %v\n", err)
-								continue
-							}
-							debugLog(&config, "AI markers successfully removed from file")
-
-							// Log the updated markers for debugging
-							if config.Debug {
-								for i, marker := range updatedMarkers {
-									debugLog(&config, "  Original: Line %d: %s", originalMarkers[i].LineNumber, originalMarkers[i].LineText)
-									debugLog(&config, "  Updated:  Line %d: %s", marker.LineNumber, marker.LineText)
-								}
-							}
+					// Check if file should be ignored based on patterns
+					if shouldIgnore, reason := ShouldIgnorePathWithConfig(event.Name, config); shouldIgnore {
+						traceLog(config, "Skipping file due to %s: %s", reason, event.Name)
+						continue
+					}
+					if building, build := config.Builds.ignores(event.Name); building {
+						debugLog(config, "Skipping build output while %q is running: %s", build, event.Name)
+						continue
+					}
+					traceLog(config, "Watching file: %s", event.Name)
 
-							// Prepare the template data with the updated markers
-							data := TemplateData{
-								File:    absPath,
-								Markers: updatedMarkers,
-							}
+					// Scan once the file's rename chain has settled
+					scheduler.schedule(event.Name)
+				}
 
-							// Execute the template (resolved per file, cached per dir)
-							promptTmpl := resolver.resolve(absPath)
-							var promptBuf strings.Builder
-							err = promptTmpl.Execute(&promptBuf, data)
-							if err != nil {
-								fmt.Fprintf(os.Stderr, "Error executing prompt template: %v\n", err)
-								continue
-							}
+			case path := <-scheduler.ready:
+				if hold.holds(path) {
+					debugLog(config, "Holding %s until Claude has answered", path)
+					continue
+				}
+				if processor.coalesce != nil {
+					processor.processAll(collectReady(path, scheduler.ready))
+				} else {
+					processor.process(path)
+				}
 
-							// Send the generated prompt to the channel for processing
-							promptChan <- promptBuf.String()
-						}
+			case <-hold.answered():
+				paths := hold.release()
+				console.notice("claudewatch: Claude has answered; scanning %d file(s) saved meanwhile", len(paths))
+				if processor.coalesce != nil {
+					processor.processAll(paths)
+				} else {
+					for _, path := range paths {
+						processor.process(path)
 					}
+				}
 
-				case err, ok := <-watcher.Errors:
-					if !ok {
-						return
-					}
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			case root := <-rootsBack:
+				delete(awaiting, root)
+				console.notice("claudewatch: %s is back; watching it again", root)
+				if err := watchDirectory(watcher, root, config, false); err != nil {
+					console.warn("Could not watch %s again: %v", root, err)
+					continue
 				}
-			}
-		}()
-
-		// Process prompts from file changes
-		for prompt := range promptChan {
-			// Write prompt to Claude's stdin
-			debugLog(&config, "Writing prompt to Claude's PTY")
-			_, err := ptyMaster.Write([]byte(prompt))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing prompt to Claude's PTY: %v\r\n", err)
-			}
+				walkTree(config, root, scheduler.schedule)
+
+			case <-rescanRequests:
+				console.notice("claudewatch: rescanning watched files")
+				walkWatchedFiles(config, processor.process)
 
-			// Add a delay to ensure prompt is fully processed
-			time.Sleep(300 * time.Millisecond)
+			case <-flushes.instructions():
+				go releaseBatch(config, dispatch, "claudewatch flush")
 
-			// Try just Carriage Return (ASCII 13)
-			debugLog(&config, "Sending Carriage Return (ASCII 13) only")
-			_, err = ptyMaster.Write([]byte{13})
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error sending CR to Claude's PTY: %v\r\n", err)
+			case text := <-fifo.instructions():
+				console.notice("claudewatch: queueing an instruction from %s", instructionFifoName)
+				infoLog(config, "Instruction from %s: %s", fifo.path, text)
+				prompts <- instructionRequest(text)
+
+			case err, ok := <-watcher.errs():
+				if !ok {
+					return
+				}
+				console.errorf("Error: %v", err)
 			}
 		}
 	}()
 
-	// Wait for Claude to finish
-	err = claudeCmd.Wait()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Claude process ended with error: %v\n", err)
+	// Queue prompts from file changes as they arrive, so that those waiting
+	// while an earlier one is typed go out in priority order
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		for range queued {
+			if err := dispatch.flush(); err != nil {
+				console.errorf("Error sending prompt: %v", err)
+				warnLog(config, "Error sending prompt: %v", err)
+			}
+		}
+	}()
+	for req := range prompts {
+		dispatch.enqueue(req)
+		dispatch.release()
 	}
-
-	// Close the prompt channel and wait for goroutines to finish
-	close(promptChan)
-	wg.Wait()
+	dispatch.setDelivery(nil)
+	close(queued)
+	<-delivered
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestProcessRoutesQuestionsToQuestionTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// use a map ai!\n// why is this slow ai?\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	byType, err := compileMarkerTypeTemplates(nil)
+	if err != nil {
+		t.Fatalf("compileMarkerTypeTemplates: %v", err)
+	}
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.Type}}: edit {{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	resolver.byMarkerType = byType
+
+	prompts := make(chan promptRequest, 2)
+	newFileProcessor(&Config{}, resolver, prompts).process(path)
+	close(prompts)
+
+	var got []string
+	for req := range prompts {
+		got = append(got, req.Prompt)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d prompts, want one edit and one question prompt", len(got))
+	}
+	if got[0] != "edit: edit // use a map" {
+		t.Errorf("edit prompt = %q", got[0])
+	}
+	if !strings.Contains(got[1], "Do not modify any files") || !strings.Contains(got[1], "// why is this slow") {
+		t.Errorf("question prompt = %q, want the built-in question template", got[1])
+	}
+}
+
+func TestProcessRoutesTodoMarkersToTodoTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// TODO(ai): use a map\n// tidy this ai!\n"), 0o644); err != nil { // ai:ignore
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	byType, err := compileMarkerTypeTemplates(nil)
+	if err != nil {
+		t.Fatalf("compileMarkerTypeTemplates: %v", err)
+	}
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.Type}}: {{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	resolver.byMarkerType = byType
+
+	prompts := make(chan promptRequest, 2)
+	newFileProcessor(&Config{Scanner: mustMarkerScanner(t, &FileConfig{TodoMarkers: true})}, resolver, prompts).process(path)
+	close(prompts)
+
+	var got []string
+	for req := range prompts {
+		got = append(got, req.Prompt)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d prompts, want one edit and one TODO prompt", len(got))
+	}
+	if !strings.Contains(got[0], "Resolve the TODO and FIXME comments") || !strings.Contains(got[0], "Line 1: // use a map") {
+		t.Errorf("TODO prompt = %q, want the built-in TODO template", got[0])
+	}
+	if got[1] != "edit: // tidy this" {
+		t.Errorf("edit prompt = %q", got[1])
+	}
+}
+
+func TestCompileMarkerTypeTemplates(t *testing.T) {
+	templates, err := compileMarkerTypeTemplates(&FileConfig{
+		MarkerTemplates: map[string]string{claudewatch.TypeQuestion: "Q: {{.File}}"},
+	})
+	if err != nil {
+		t.Fatalf("compileMarkerTypeTemplates: %v", err)
+	}
+	if got := render(t, templates[claudewatch.TypeQuestion], "f.go"); got != "Q: f.go" {
+		t.Errorf("question template rendered %q, want the configured template", got)
+	}
+	if _, ok := templates[claudewatch.TypeTodo]; ok {
+		t.Error("TODO template set without configuration; the built-in one should come after normal resolution")
+	}
+	if _, ok := templates[claudewatch.TypeEdit]; ok {
+		t.Error("edit template set without configuration; edits should use normal resolution")
+	}
+
+	if _, err := compileMarkerTypeTemplates(&FileConfig{MarkerTemplates: map[string]string{"ai!": "x"}}); err == nil {
+		t.Error("compileMarkerTypeTemplates() accepted an unknown marker type")
+	}
+}
+
+func TestPromptResolverBuiltinMarkerTypeTemplatesComeLast(t *testing.T) {
+	dir := t.TempDir()
+	withPrompt := filepath.Join(dir, "prompted")
+	if err := os.Mkdir(withPrompt, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(withPrompt, promptFileName), []byte("prompt file: {{.Type}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("default")), nil, nil)
+	resolver.byExtension = map[string]*template.Template{".py": template.Must(parsePromptTemplate("python: {{.Type}}"))}
+
+	tests := []struct {
+		name       string
+		path       string
+		markerType string
+		want       string
+	}{
+		{"Extension template", filepath.Join(dir, "f.py"), claudewatch.TypeQuestion, "python: question"},
+		{"Prompt file", filepath.Join(withPrompt, "f.go"), claudewatch.TypeTodo, "prompt file: todo"},
+		{"Built-in question template", filepath.Join(dir, "f.go"), claudewatch.TypeQuestion, "Answer the questions"},
+		{"Built-in TODO template", filepath.Join(dir, "f.go"), claudewatch.TypeTodo, "Resolve the TODO and FIXME comments"},
+		{"Default template", filepath.Join(dir, "f.go"), claudewatch.TypeEdit, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := resolver.resolveFor(tt.path, tt.markerType)
+			var out strings.Builder
+			if err := tmpl.Execute(&out, TemplateData{File: tt.path, Type: tt.markerType}); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("resolveFor(%s, %s) rendered %q, want it to contain %q", tt.path, tt.markerType, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptResolverOverrideBeatsMarkerTypeTemplate(t *testing.T) {
+	override := template.Must(parsePromptTemplate("override"))
+	resolver := newPromptResolver(override, override, nil)
+	resolver.byMarkerType = map[string]*template.Template{
+		claudewatch.TypeQuestion: template.Must(parsePromptTemplate("question")),
+	}
+
+	if got := render(t, resolver.resolveFor("/tmp/f.go", claudewatch.TypeQuestion), "/tmp/f.go"); got != "override" {
+		t.Errorf("resolveFor() rendered %q, want the --prompt override", got)
+	}
+}
+
+func TestProcessRoutesTaggedMarkersToTagTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// use a map ai!\n// cover the error path ai!test\n// and the empty input ai!test\n"), 0o644); err != nil { // ai:ignore
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	fileConfig := &FileConfig{Tags: map[string]string{"Test": "{{.Tag}}:{{range .Markers}} {{.LineText}}{{end}}"}}
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.Type}}:{{range .Markers}} {{.LineText}}{{end}}")), nil, nil)
+	var err error
+	if resolver.byTag, err = compileTagTemplates(fileConfig); err != nil {
+		t.Fatalf("compileTagTemplates: %v", err)
+	}
+
+	prompts := make(chan promptRequest, 2)
+	newFileProcessor(&Config{Scanner: mustMarkerScanner(t, fileConfig)}, resolver, prompts).process(path)
+	close(prompts)
+
+	var got []string
+	for req := range prompts {
+		got = append(got, req.Prompt)
+	}
+	want := []string{"edit: // use a map", "test: // cover the error path // and the empty input"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("prompts = %q, want %q", got, want)
+	}
+
+	// --prompt still wins
+	resolver.override = template.Must(parsePromptTemplate("override"))
+	if got := render(t, resolver.resolveTagged("/tmp/f.go", claudewatch.TypeEdit, "test"), "/tmp/f.go"); got != "override" {
+		t.Errorf("resolveTagged() with --prompt rendered %q, want the override", got)
+	}
+}
+
+func TestMarkerTagsFromConfig(t *testing.T) {
+	tags := markerTags(&FileConfig{Tags: map[string]string{"test": "t", "doc": "d"}})
+	if strings.Join(tags, ",") != "doc,test" {
+		t.Errorf("markerTags() = %v, want doc and test", tags)
+	}
+	if _, err := compileTagTemplates(&FileConfig{Tags: map[string]string{"test": "{{.Nope"}}); err == nil {
+		t.Error("compileTagTemplates() accepted a template that doesn't parse")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// NamespaceConfig configures where markers addressed to a namespace (e.g.
+// "be-ai!" for namespace "be") are sent and how their prompt is phrased
+type NamespaceConfig struct {
+	Template string `json:"template"` // Prompt template text; empty uses the normal template resolution
+	Command  string `json:"command"`  // Headless command acting as the namespace's session; empty uses the main Claude session
+}
+
+// namespaceRoute is the resolved template and session for one namespace
+type namespaceRoute struct {
+	tmpl   *template.Template // nil uses the normal template resolution
+	target backend            // nil uses the main Claude session
+}
+
+// buildNamespaceRoutes compiles the namespace configuration. Each headless
+// session gets a dispatcher of its own, which fails over to --fallback-command
+// like the main session does, and logs its output to <stateDir>/<namespace>.log.
+func buildNamespaceRoutes(namespaces map[string]NamespaceConfig, stateDir string, config *Config) (map[string]*namespaceRoute, error) {
+	routes := make(map[string]*namespaceRoute)
+	for name, nsConfig := range namespaces {
+		route := &namespaceRoute{}
+		if nsConfig.Template != "" {
+			tmpl, err := parsePromptTemplate(nsConfig.Template)
+			if err != nil {
+				return nil, fmt.Errorf("template for namespace %q: %w", name, err)
+			}
+			route.tmpl = tmpl
+		}
+		if nsConfig.Command != "" {
+			target := &dispatcher{primary: &headlessBackend{
+				command: nsConfig.Command,
+				logPath: filepath.Join(stateDir, strings.ToLower(name)+".log"),
+				config:  config,
+			}}
+			if config.FallbackCommand != "" {
+				target.fallback = &headlessBackend{
+					command: config.FallbackCommand,
+					logPath: filepath.Join(stateDir, "fallback.log"),
+					config:  config,
+				}
+			}
+			route.target = target
+		}
+		routes[strings.ToLower(name)] = route
+	}
+	return routes, nil
+}
+
+// markerGroup is a set of markers from one file that share a namespace,
+// marker type and tag, and so are rendered into a single prompt
+type markerGroup struct {
+	Namespace string
+	Type      string
+	Tag       string
+	Markers   []claudewatch.Marker
+}
+
+// groupMarkers splits markers by namespace, type and tag, preserving their
+// order. Groups are returned in order of first appearance.
+func groupMarkers(markers []claudewatch.Marker) []markerGroup {
+	var groups []markerGroup
+	index := make(map[[3]string]int)
+	for _, marker := range markers {
+		key := [3]string{marker.Namespace, marker.Type, marker.Tag}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, markerGroup{Namespace: marker.Namespace, Type: marker.Type, Tag: marker.Tag})
+		}
+		groups[i].Markers = append(groups[i].Markers, marker)
+	}
+	return groups
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestGroupMarkers(t *testing.T) {
+	markers := []claudewatch.Marker{
+		{LineNumber: 1, Namespace: "fe", Type: claudewatch.TypeEdit},
+		{LineNumber: 2, Type: claudewatch.TypeEdit},
+		{LineNumber: 3, Namespace: "fe", Type: claudewatch.TypeEdit},
+		{LineNumber: 4, Namespace: "fe", Type: claudewatch.TypeQuestion},
+	}
+
+	groups := groupMarkers(markers)
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3: %+v", len(groups), groups)
+	}
+	if groups[0].Namespace != "fe" || groups[0].Type != claudewatch.TypeEdit || len(groups[0].Markers) != 2 || groups[0].Markers[1].LineNumber != 3 {
+		t.Errorf("groups[0] = %+v, want fe edit markers on lines 1 and 3", groups[0])
+	}
+	if groups[1].Namespace != "" || len(groups[1].Markers) != 1 {
+		t.Errorf("groups[1] = %+v, want the plain marker on line 2", groups[1])
+	}
+	if groups[2].Namespace != "fe" || groups[2].Type != claudewatch.TypeQuestion {
+		t.Errorf("groups[2] = %+v, want the fe question on line 4", groups[2])
+	}
+}
+
+func TestProcessRoutesNamespacedMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.go")
+	if err := os.WriteFile(path, []byte("// add pagination be-ai!\n// fix typo ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	beSession := &fakeBackend{name: "be"}
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("main: {{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	prompts := make(chan promptRequest, 2)
+	config := &Config{
+		Scanner: mustMarkerScanner(t, &FileConfig{Namespaces: map[string]NamespaceConfig{"be": {}}}),
+		Namespaces: map[string]*namespaceRoute{
+			"be": {tmpl: template.Must(parsePromptTemplate("be: {{range .Markers}}{{.LineText}}{{end}}")), target: beSession},
+		},
+	}
+	p := newFileProcessor(config, resolver, prompts)
+
+	p.process(path)
+	close(prompts)
+
+	var got []promptRequest
+	for req := range prompts {
+		got = append(got, req)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d prompts, want 2", len(got))
+	}
+	if got[0].Prompt != "be: // add pagination" || got[0].Target != beSession {
+		t.Errorf("first prompt = %+v, want the be template sent to the be session", got[0])
+	}
+	if got[1].Prompt != "main: // fix typo" || got[1].Target != nil {
+		t.Errorf("second prompt = %+v, want the main template sent to the main session", got[1])
+	}
+}
+
+func TestNamespaceSessionFailsOver(t *testing.T) {
+	stateDir := t.TempDir()
+	config := &Config{FallbackCommand: "cat >/dev/null"}
+	routes, err := buildNamespaceRoutes(map[string]NamespaceConfig{"be": {Command: "exit 1"}}, stateDir, config)
+	if err != nil {
+		t.Fatalf("buildNamespaceRoutes: %v", err)
+	}
+
+	target := routes["be"].target
+	if err := target.Send("add pagination"); err != nil {
+		t.Fatalf("Send() = %v, want the fallback to take the prompt", err)
+	}
+	if got, want := target.Name(), "fallback (cat >/dev/null)"; got != want {
+		t.Errorf("Name() = %q after failing over, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// notesFileName is the session notes file inside the state directory
+const notesFileName = "SESSION_NOTES.md"
+
+// sessionNotes implements --session-notes: a running work log in
+// .claudewatch/SESSION_NOTES.md, with an entry for each prompt dispatched and
+// an outcome slot that templates can ask Claude to fill in via {{.NotesFile}}
+type sessionNotes struct {
+	mu   sync.Mutex
+	path string
+	n    int // Entries written this session
+}
+
+// openSessionNotes starts this session's section of the notes file when
+// --session-notes or session_notes is set. It returns nil otherwise.
+func openSessionNotes(config *Config) *sessionNotes {
+	if !config.SessionNotes {
+		return nil
+	}
+	stateDir, err := ensureStateDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", stateDirName, err)
+		os.Exit(1)
+	}
+	notes := &sessionNotes{path: filepath.Join(stateDir, notesFileName)}
+	if err := notes.appendText(fmt.Sprintf("## Session started %s\n\n", time.Now().Format("2006-01-02 15:04"))); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", notes.path, err)
+		os.Exit(1)
+	}
+	debugLog(config, "Keeping session notes in %s", notes.path)
+	return notes
+}
+
+// filePath returns the path of the notes file, or an empty string on a nil
+// tracker, so {{.NotesFile}} is empty without --session-notes
+func (n *sessionNotes) filePath() string {
+	if n == nil {
+		return ""
+	}
+	return n.path
+}
+
+// record appends an entry for a prompt with markers from file. It does
+// nothing on a nil tracker.
+func (n *sessionNotes) record(file, markerType string, markers []claudewatch.Marker) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.n++
+
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "### %d. %s in %s (%s)\n\n", n.n, markerType, file, time.Now().Format("15:04:05"))
+	for _, marker := range markers {
+		fmt.Fprintf(&entry, "- Line %d: %s\n", marker.LineNumber, strings.TrimSpace(marker.LineText))
+	}
+	entry.WriteString("\nOutcome:\n\n")
+	return n.appendTextLocked(entry.String())
+}
+
+// appendText appends text to the notes file
+func (n *sessionNotes) appendText(text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.appendTextLocked(text)
+}
+
+// appendTextLocked is appendText with n.mu held
+func (n *sessionNotes) appendTextLocked(text string) error {
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
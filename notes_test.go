@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestSessionNotes(t *testing.T) {
+	chdir(t, t.TempDir())
+	if notes := openSessionNotes(&Config{}); notes != nil {
+		t.Fatal("openSessionNotes() without --session-notes returned a tracker")
+	}
+
+	notes := openSessionNotes(&Config{SessionNotes: true})
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("package p\n\n// use a map ai!\n// why? ai?\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 2)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("Log to {{.NotesFile}}")), nil, nil)
+	p := newFileProcessor(&Config{}, resolver, prompts)
+	p.notes = notes
+	p.process(path)
+
+	if req := <-prompts; req.Prompt != "Log to "+notes.filePath() {
+		t.Errorf("prompt = %q, want {{.NotesFile}} to be the notes path", req.Prompt)
+	}
+	if notes.filePath() != filepath.Join(mustAbs(t, stateDirName), notesFileName) {
+		t.Errorf("notes file = %s", notes.filePath())
+	}
+	got := readString(t, notes.filePath())
+	for _, want := range []string{
+		"## Session started ",
+		"### 1. edit in " + path,
+		"- Line 3: // use a map ai!\n\nOutcome:\n",
+		"### 2. question in " + path,
+		"- Line 4: // why? ai?\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("notes are missing %q:\n%s", want, got)
+		}
+	}
+
+	var none *sessionNotes
+	if none.filePath() != "" || none.record(path, "edit", nil) != nil {
+		t.Error("nil notes tracker did something")
+	}
+}
+
+func mustAbs(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatalf("Abs: %v", err)
+	}
+	return abs
+}
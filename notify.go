@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// changeNotice is what a --notify-format template is rendered with
+type changeNotice struct {
+	File    string               // The changed file, as the watcher reported it
+	Markers []claudewatch.Marker // Its active markers: .LineNumber, .LineText and .Type on each
+}
+
+// parseNotifyFormat parses a --notify-format template. It has the same
+// helpers as prompt templates.
+func parseNotifyFormat(text string) (*template.Template, error) {
+	return parsePromptTemplate(text)
+}
+
+// announceChange tells the user that markers were found in path and are
+// being sent: by default a banner with a line per marker, with
+// --notify-format whatever its template renders, and with --quiet nothing
+func announceChange(c *consoleWriter, config *Config, path string, markers []claudewatch.Marker) {
+	switch {
+	case config.Quiet:
+		infoLog(config, "File change detected: %s (%d markers)", path, len(markers))
+	case config.NotifyFormat != nil:
+		var out strings.Builder
+		if err := config.NotifyFormat.Execute(&out, changeNotice{File: path, Markers: markers}); err != nil {
+			c.warn("Could not render --notify-format for %s: %v", path, err)
+			return
+		}
+		if text := strings.TrimRight(out.String(), "\n"); text != "" {
+			c.write(text + "\n")
+		}
+	default:
+		c.notice("File change detected: %s - sending to Claude", path)
+		for _, marker := range markers {
+			c.detail("Line %d: %s", marker.LineNumber, marker.LineText)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestAnnounceChange(t *testing.T) {
+	markers := []claudewatch.Marker{
+		{LineNumber: 3, LineText: "// use a map ai!", Type: claudewatch.TypeEdit}, // ai:ignore
+		{LineNumber: 9, LineText: "// why? ai?", Type: claudewatch.TypeQuestion},  // ai:ignore
+	}
+	format, err := parseNotifyFormat(`» {{.File}}: {{len .Markers}} markers{{range .Markers}} {{.LineNumber}}{{end}}` + "\n")
+	if err != nil {
+		t.Fatalf("parseNotifyFormat: %v", err)
+	}
+	tests := []struct {
+		name   string
+		config *Config
+		want   string
+	}{
+		{"default", &Config{}, "\n[File change detected: a.go - sending to Claude]\n  Line 3: // use a map ai!\n  Line 9: // why? ai?\n"}, // ai:ignore
+		{"quiet", &Config{Quiet: true}, ""},
+		{"format", &Config{NotifyFormat: format}, "» a.go: 2 markers 3 9\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		c := newConsoleWriter(&out, false, env(nil))
+		announceChange(c, tt.config, "a.go", markers)
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: printed %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnnounceChangeBadFormat(t *testing.T) {
+	format, err := parseNotifyFormat(`{{.Missing}}`)
+	if err != nil {
+		t.Fatalf("parseNotifyFormat: %v", err)
+	}
+	var out bytes.Buffer
+	announceChange(newConsoleWriter(&out, false, env(nil)), &Config{NotifyFormat: format}, "a.go", nil)
+	if got := out.String(); !strings.Contains(got, "Could not render --notify-format for a.go") {
+		t.Errorf("printed %q, want a warning", got)
+	}
+
+	if _, err := parseNotifyFormat(`{{.File`); err == nil {
+		t.Error("parseNotifyFormat accepted an unclosed action")
+	}
+}
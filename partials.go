@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"text/template"
+	"text/template/parse"
+)
+
+// templatePartials holds the config file's partials, which every prompt
+// template parsed after setTemplatePartials can include with
+// {{template "name" .}}. It is nil when there are none.
+var templatePartials *template.Template
+
+// setTemplatePartials parses the partials in the config file for the prompt
+// templates parsed from then on. A partial may include other partials; one
+// that includes a partial that isn't defined is an error.
+func setTemplatePartials(fileConfig *FileConfig) error {
+	templatePartials = nil
+	if fileConfig == nil || len(fileConfig.Partials) == 0 {
+		return nil
+	}
+
+	partials := template.New("partials").Funcs(libraryFuncs).Funcs(promptFuncs)
+	for _, name := range sortedKeys(fileConfig.Partials) {
+		if name == "" || name == promptTemplateName {
+			return fmt.Errorf("partials: %q can't be used as a partial's name", name)
+		}
+		if _, err := partials.New(name).Parse(fileConfig.Partials[name]); err != nil {
+			return fmt.Errorf("partial %q: %w", name, err)
+		}
+	}
+	for _, name := range sortedKeys(fileConfig.Partials) {
+		if err := checkTemplateCalls(partials.Lookup(name)); err != nil {
+			return fmt.Errorf("partial %q: %w", name, err)
+		}
+	}
+	templatePartials = partials
+	return nil
+}
+
+// checkTemplateCalls returns an error if tmpl includes a template that is
+// neither a partial nor defined in tmpl itself, which would otherwise only
+// fail once a prompt is rendered
+func checkTemplateCalls(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if name, ok := undefinedCall(tmpl, t.Tree.Root); ok {
+			return fmt.Errorf("template %q is not defined (define it under \"partials\" in the config file)", name)
+		}
+	}
+	return nil
+}
+
+// undefinedCall finds a {{template}} action under node naming a template
+// that tmpl doesn't have
+func undefinedCall(tmpl *template.Template, node parse.Node) (string, bool) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return "", false
+		}
+		for _, n := range node.Nodes {
+			if name, ok := undefinedCall(tmpl, n); ok {
+				return name, true
+			}
+		}
+	case *parse.TemplateNode:
+		if tmpl.Lookup(node.Name) == nil {
+			return node.Name, true
+		}
+	case *parse.IfNode:
+		return undefinedBranchCall(tmpl, &node.BranchNode)
+	case *parse.RangeNode:
+		return undefinedBranchCall(tmpl, &node.BranchNode)
+	case *parse.WithNode:
+		return undefinedBranchCall(tmpl, &node.BranchNode)
+	}
+	return "", false
+}
+
+func undefinedBranchCall(tmpl *template.Template, node *parse.BranchNode) (string, bool) {
+	if name, ok := undefinedCall(tmpl, node.List); ok {
+		return name, true
+	}
+	return undefinedCall(tmpl, node.ElseList)
+}
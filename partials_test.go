@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// usePartials sets the partials of fileConfig for the rest of the test
+func usePartials(t *testing.T, partials map[string]string) error {
+	t.Helper()
+	t.Cleanup(func() { templatePartials = nil })
+	return setTemplatePartials(&FileConfig{Partials: partials})
+}
+
+func TestPartialsIncludedInTemplates(t *testing.T) {
+	err := usePartials(t, map[string]string{
+		"footer": `{{template "scope" .}} Stop when done.`,
+		"scope":  `Only edit {{.File | base}}.`,
+	})
+	if err != nil {
+		t.Fatalf("setTemplatePartials() = %v", err)
+	}
+
+	fileConfig := &FileConfig{Tags: map[string]string{"test": `Add tests for {{.File}}. {{template "footer" .}}`}}
+	templates, err := compileTagTemplates(fileConfig)
+	if err != nil {
+		t.Fatalf("compileTagTemplates() = %v", err)
+	}
+	var out strings.Builder
+	if err := templates["test"].Execute(&out, TemplateData{File: "/src/a.go"}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if want := "Add tests for /src/a.go. Only edit a.go. Stop when done."; out.String() != want {
+		t.Errorf("rendered %q, want %q", out.String(), want)
+	}
+
+	// A template can still define its own, and parsing it leaves the
+	// partials as they were
+	tmpl, err := parsePromptTemplate(`{{define "scope"}}Anywhere.{{end}}{{template "scope"}}`)
+	if err != nil {
+		t.Fatalf("parsePromptTemplate() with its own define = %v", err)
+	}
+	out.Reset()
+	if err := tmpl.Execute(&out, nil); err != nil || out.String() != "Anywhere." {
+		t.Errorf("rendered %q, %v; want its own definition", out.String(), err)
+	}
+	if templatePartials.Lookup("scope").Tree.Root.String() != "Only edit {{.File | base}}." {
+		t.Errorf("a template's define changed the partial")
+	}
+}
+
+func TestUndefinedPartial(t *testing.T) {
+	if err := usePartials(t, map[string]string{"footer": "Stop."}); err != nil {
+		t.Fatalf("setTemplatePartials() = %v", err)
+	}
+	_, err := parsePromptTemplate(`{{if .ReadOnly}}{{else}}{{template "fotter" .}}{{end}}`)
+	if err == nil || !strings.Contains(err.Error(), `"fotter" is not defined`) {
+		t.Errorf("parsePromptTemplate() with a misspelled partial = %v, want an error naming it", err)
+	}
+
+	if err := usePartials(t, map[string]string{"footer": `{{template "missing"}}`}); err == nil {
+		t.Error("setTemplatePartials() with a partial including a missing one succeeded")
+	}
+	if err := usePartials(t, map[string]string{"prompt": "x"}); err == nil {
+		t.Error(`setTemplatePartials() with a partial named "prompt" succeeded`)
+	}
+	if err := usePartials(t, map[string]string{"footer": "{{.File"}); err == nil || !strings.Contains(err.Error(), `partial "footer"`) {
+		t.Errorf("setTemplatePartials() with a bad partial = %v, want an error naming it", err)
+	}
+	if templatePartials != nil {
+		t.Error("a failed setTemplatePartials() left partials set")
+	}
+}
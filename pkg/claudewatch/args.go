@@ -0,0 +1,55 @@
+package claudewatch
+
+import "strings"
+
+// argListPattern is the source of a marker's argument list: "(key=value)",
+// or several pairs separated by commas, directly after the token
+const argListPattern = `\([ \t]*[a-z][\w-]*[ \t]*=[^()]*\)`
+
+// markerArgs returns the arguments in parentheses after the first marker
+// token on line, as in "ai!(model=opus, lines=+3)", or nil if it has none.
+// Keys are lowercased; values keep their case. A pair without an "=" is
+// left out.
+func (s *Scanner) markerArgs(line string) map[string]string {
+	folded := foldLine(line)
+	var match []int
+	for _, sub := range s.argsPattern.FindAllStringSubmatchIndex(folded.text, -1) {
+		if s.boundedBefore(folded.text, sub[0]) {
+			match = sub
+			break
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	list := line[folded.offsets[match[2]]:folded.offsets[match[3]]]
+	list = strings.TrimSuffix(strings.TrimPrefix(list, "("), ")")
+
+	args := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			continue
+		}
+		args[key] = strings.TrimSpace(value)
+	}
+	return args
+}
+
+// removeMarkerArgs removes the argument list following a marker token, so
+// the token is then removed like any other
+func (s *Scanner) removeMarkerArgs(line string) string {
+	folded := foldLine(line)
+	var spans [][]int
+	for _, sub := range s.argsPattern.FindAllStringSubmatchIndex(folded.text, -1) {
+		if !s.boundedBefore(folded.text, sub[0]) {
+			continue
+		}
+		spans = append(spans, []int{sub[2], sub[3]})
+	}
+	if spans == nil {
+		return line
+	}
+	return removeFoldedSpans(line, folded, spans)
+}
@@ -0,0 +1,52 @@
+package claudewatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkerArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want map[string]string
+	}{
+		{"No arguments", "// use a map ai!", nil},
+		{"One argument", "// switch to table-driven tests ai!(model=opus)", map[string]string{"model": "opus"}},
+		{"Several arguments", "// fix this AI!(Model=Sonnet-4, lines=+3)", map[string]string{"model": "Sonnet-4", "lines": "+3"}},
+		{"Question", "# why? ai?(model=haiku)", map[string]string{"model": "haiku"}},
+		{"Pair without a value", "// fix ai!(model=, effort=high)", map[string]string{"model": "", "effort": "high"}},
+		{"Not attached to the token", "// fix ai! (model=opus)", nil},
+		{"Not key=value", "// fix ai!(soon)", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers := defaultScanner.Scan(tt.line)
+			if len(markers) != 1 {
+				t.Fatalf("FindMarkers found %d markers, want 1", len(markers))
+			}
+			if !reflect.DeepEqual(markers[0].Args, tt.want) {
+				t.Errorf("Args = %v, want %v", markers[0].Args, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripMarkerArgs(t *testing.T) {
+	content := "// switch to table-driven tests ai!(model=opus)\n// ai!(model=opus, lines=+1)\nx := 1\n" // ai:ignore
+	markers := defaultScanner.Scan(content)
+	updated, stripped, err := defaultScanner.StripMarkers(content, markers)
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "// switch to table-driven tests\nx := 1\n"; updated != want {
+		t.Errorf("StripMarkers() = %q, want %q", updated, want)
+	}
+	if stripped[1].RegionStart != 2 || stripped[1].RegionEnd != 2 || stripped[1].Args["model"] != "opus" {
+		t.Errorf("stripped marker = %+v, want its region and arguments kept", stripped[1])
+	}
+	if !defaultScanner.IsTrivialStrip("// switch to table-driven tests ai!(model=opus)", "// switch to table-driven tests") {
+		t.Error("removing a trailing marker with arguments isn't trivial")
+	}
+}
@@ -0,0 +1,88 @@
+package claudewatch
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenSpans returns the [start, end) span of each marker token in folded
+// text that stands on its own: preceded by the start of the line,
+// whitespace, a comment leader, punctuation or a namespace prefix ("be-"),
+// and followed by the end of the line, whitespace, the end of a comment, an
+// argument list or a tag. A token inside a longer word, as "ai!" is in
+// "chai!" or "ai?" in "ai?foo", is not a marker.
+func (s *Scanner) tokenSpans(text string) [][]int {
+	var spans [][]int
+	for pos := 0; pos < len(text); {
+		loc := s.markerPattern.FindStringIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if s.boundedBefore(text, start) && s.boundedAfter(text, end) {
+			spans = append(spans, []int{start, end})
+			pos = end
+			continue
+		}
+		// A shorter or later token may still start inside this one
+		_, size := utf8.DecodeRuneInString(text[start:])
+		pos = start + size
+	}
+	return spans
+}
+
+// firstToken returns the first marker token in folded text that stands on
+// its own (see tokenSpans), or an empty string if there is none
+func (s *Scanner) firstToken(text string) string {
+	spans := s.tokenSpans(text)
+	if spans == nil {
+		return ""
+	}
+	return text[spans[0][0]:spans[0][1]]
+}
+
+// boundedBefore reports whether a token starting at start in folded text
+// begins at a boundary: the start of the line, whitespace, the end of a
+// comment leader (so a comment can start with the token, with no space
+// between), punctuation, or the dash after one of the scanner's namespaces.
+// A dash, an underscore or a quote doesn't count: a quoted token is written
+// about, not addressed to Claude.
+func (s *Scanner) boundedBefore(text string, start int) bool {
+	if start == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(text[:start])
+	switch {
+	case unicode.IsSpace(r), s.leaderBefore.MatchString(text[:start]):
+		return true
+	case r == '-':
+		return s.namespaceBefore != nil && s.namespaceBefore.MatchString(text[:start])
+	case r == '_' || strings.ContainsRune("\"'`", r):
+		return false
+	}
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// commentClosers end a comment right after a token, as in "/* fix ai!*/" ai:ignore
+// or a docstring's closing quotes
+var commentClosers = []string{"*/", "-->", `"""`, "'''"}
+
+// boundedAfter reports whether a token ending at end in folded text is
+// followed by a boundary: the end of the line, whitespace, the end of a
+// comment, an argument list or one of the scanner's tags
+func (s *Scanner) boundedAfter(text string, end int) bool {
+	if end == len(text) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(text[end:])
+	if unicode.IsSpace(r) || r == '(' {
+		return true
+	}
+	for _, closer := range commentClosers {
+		if strings.HasPrefix(text[end:], closer) {
+			return true
+		}
+	}
+	return s.tagAfter != nil && s.tagAfter.MatchString(text[end:])
+}
@@ -0,0 +1,66 @@
+package claudewatch
+
+import "testing"
+
+func TestMarkerTokenBoundaries(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Namespaces: []string{"be"}, Tags: []string{"test"}})
+
+	tests := []struct {
+		name   string
+		line   string
+		marker bool
+	}{
+		{"Token at the end", "// use a map ai!", true},
+		{"Token starting the comment", "# ai! use a map", true},
+		{"Token between words", "// use ai! a map", true},
+		{"Token with arguments", "// use a map ai!(model=opus)", true},
+		{"Token with a tag", "// cover this ai!test", true},
+		{"Namespaced token", "// add an index be-ai!", true},
+		{"Token closing a block comment", "/* use a map ai!*/", true},
+		{"Token right after the comment leader", "//ai! fix this", true},
+		{"Token right after a hash", "#ai! x", true},
+		{"Token after punctuation", "// do it:ai!", true},
+		{"Token after an underscore", "// my_ai! helper", false},
+		{"Quoted token", `// write "ai!" to ask`, false},
+		{"Token ending a word", "// chai! is tea", false},
+		{"Token starting a word", "// ai!foo", false},
+		{"Token running into an unknown tag", "// ai!testing", false},
+		{"Unknown namespace", "// wasabi-ai!", false},
+		{"Token in a string", `x := "total ai!"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(s.Scan(tt.line)) == 1; got != tt.marker {
+				t.Errorf("Scan(%q) found a marker = %v, want %v", tt.line, got, tt.marker)
+			}
+		})
+	}
+}
+
+func TestMarkerTokenAfterCustomLeader(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{CommentSyntaxes: []string{"--"}})
+	if got := len(s.Scan("--ai! add an index\n")); got != 1 {
+		t.Errorf("Scan found %d markers right after a -- leader, want 1", got)
+	}
+	if got := len(s.Scan("-- not-ai! here\n")); got != 0 {
+		t.Errorf("Scan found %d markers after a dash, want 0", got)
+	}
+}
+
+func TestStripLeavesWordsWithTokensAlone(t *testing.T) {
+	content := "// the chai! stall, not ai!foo, needs a map ai!\n"
+	want := "// the chai! stall, not ai!foo, needs a map\n"
+	updated, _, err := defaultScanner.StripMarkers(content, defaultScanner.Scan(content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if updated != want {
+		t.Errorf("StripMarkers() = %q, want %q", updated, want)
+	}
+	if !defaultScanner.IsTrivialStrip("// needs a map ai!", "// needs a map") {
+		t.Error("removing a trailing marker isn't trivial")
+	}
+	if defaultScanner.IsTrivialStrip("// a chai!", "// a ch") {
+		t.Error("cutting a token off the end of a word is trivial")
+	}
+}
@@ -0,0 +1,51 @@
+package claudewatch
+
+import "strings"
+
+// commentRun returns the index of the first line of the comment the marker
+// on lines[index] ends: the comment lines directly above a marker on a
+// comment line of its own carry on its instruction, as long as they are
+// written with the same comment syntax and indentation, say something, and
+// hold no marker or directive of their own. It returns index when there
+// are none.
+func (s *Scanner) commentRun(lines []string, index int) int {
+	line := lines[index]
+	if !s.commentLine.MatchString(line) {
+		return index
+	}
+	leader, indent := s.CommentLeader(line), indentation(line)
+	start := index
+	for i := index - 1; i >= 0; i-- {
+		above := lines[i]
+		if !s.commentLine.MatchString(above) || s.CommentLeader(above) != leader || indentation(above) != indent ||
+			s.emptyCommentLine.MatchString(above) || s.MayHoldMarker(above) ||
+			foldedMatch(blockStartRegex, above) || foldedMatch(blockEndRegex, above) || foldedMatch(priorityRegex, above) {
+			break
+		}
+		start = i
+	}
+	return start
+}
+
+// indentation returns the whitespace line starts with
+func indentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// withComment fills in the comment a marker found on lines[index] ends, if
+// it runs over more than the marker's line
+func (s *Scanner) withComment(marker Marker, lines []string, index int) Marker {
+	if start := s.commentRun(lines, index); start < index {
+		marker.CommentStart = start + 1
+		marker.Comment = strings.Join(lines[start:index+1], "\n")
+	}
+	return marker
+}
+
+// CommentEnd is the last line of the marker's Comment, or 0 without one
+func (m Marker) CommentEnd() int {
+	if m.CommentStart == 0 {
+		return 0
+	}
+	return m.CommentStart + strings.Count(m.Comment, "\n")
+}
@@ -0,0 +1,75 @@
+package claudewatch
+
+import "testing"
+
+func TestFindMarkersMergesCommentLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		start   int    // CommentStart of the last marker
+		comment string // Its Comment
+	}{
+		{"Lines above carry on the instruction", "x\n// Use a map here,\n// keyed by name. ai!\n", 2, "// Use a map here,\n// keyed by name. ai!"},
+		{"Marker on a line of its own", "# Split this\n# into two functions\n# ai!\n", 1, "# Split this\n# into two functions\n# ai!"},
+		{"Block comment lines", "/*\n * Rename this\n * ai!\n */\n", 2, " * Rename this\n * ai!"},
+		{"Code above", "x := 1\n// fix ai!\n", 0, ""},
+		{"Trailing comment", "// note\nx := 1 // fix ai!\n", 0, ""},
+		{"Empty comment line above", "// note\n//\n// fix ai!\n", 0, ""},
+		{"Other comment syntax", "# note\n// fix ai!\n", 0, ""},
+		{"Other indentation", "// note\n\t// fix ai!\n", 0, ""},
+		{"Earlier marker", "// one ai!\n// more on two\n// two ai!\n", 2, "// more on two\n// two ai!"},
+		{"Directive above", "// ai:reset\n// fix ai!\n", 0, ""},
+		{"Block start above", "// ai:block-start\n// fix ai!\n", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers := defaultScanner.Scan(tt.content)
+			if len(markers) == 0 {
+				t.Fatal("no markers found")
+			}
+			m := markers[len(markers)-1]
+			if m.CommentStart != tt.start || m.Comment != tt.comment {
+				t.Errorf("comment = %d %q, want %d %q", m.CommentStart, m.Comment, tt.start, tt.comment)
+			}
+		})
+	}
+}
+
+func TestFindMarkersCommentRunStopsAtIgnore(t *testing.T) {
+	// The ai:ignore lapses at the comment after it, which starts the run
+	markers := defaultScanner.Scan("// ai:ignore\n// about\n// this ai!\n")
+	if len(markers) != 1 || markers[0].CommentStart != 2 {
+		t.Errorf("markers = %+v, want one whose comment starts after the ai:ignore", markers)
+	}
+}
+
+func TestStripMarkersUpdatesComment(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		want       string
+		start, end int
+		comment    string
+	}{
+		{"Marker at the end of the last line", "x\n// Use a map,\n// keyed by name ai!\n", "x\n// Use a map,\n// keyed by name\n", 2, 3, "// Use a map,\n// keyed by name"},
+		{"Marker line deleted", "// ai!\n// Use a map,\n// keyed by name\n// ai!\ny\n", "// Use a map,\n// keyed by name\ny\n", 1, 2, "// Use a map,\n// keyed by name"},
+		{"Last line deleted", "x\n// Use a map,\n// keyed by name\n// ai!\n", "x\n// Use a map,\n// keyed by name\n", 2, 3, "// Use a map,\n// keyed by name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, markers, err := defaultScanner.StripMarkers(tt.content, defaultScanner.Scan(tt.content))
+			if err != nil {
+				t.Fatalf("StripMarkers: %v", err)
+			}
+			if updated != tt.want {
+				t.Errorf("StripMarkers = %q, want %q", updated, tt.want)
+			}
+			m := markers[len(markers)-1]
+			if m.CommentStart != tt.start || m.CommentEnd() != tt.end || m.Comment != tt.comment {
+				t.Errorf("comment = %d-%d %q, want %d-%d %q", m.CommentStart, m.CommentEnd(), m.Comment, tt.start, tt.end, tt.comment)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Package claudewatch is the marker detection engine behind the claudewatch
+// command, for Go programs that want to act on "ai!" and "ai?" comments
+// themselves, such as sending them to an internal LLM gateway instead of a
+// Claude session.
+//
+// A Scanner finds and strips markers in file content (ScanFile also reads
+// Python docstrings, given the file's name). ScannerOptions configure it,
+// with other tokens, comment syntaxes, namespaces, tags or ignore directive;
+// the zero value finds the default markers. Each Scanner has its own
+// configuration, so several can be used at once:
+//
+//	s, err := claudewatch.NewScanner(claudewatch.ScannerOptions{
+//		Tokens:          []string{"@llm", "@llm?"},
+//		CommentSyntaxes: []string{"--"},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	updated, markers, err := s.Strip(content)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+// A Watcher watches
+// directory trees and calls back with the markers of each file saved:
+//
+//	w := claudewatch.NewWatcher(claudewatch.Options{Strip: true}, ".")
+//	w.OnMarkers(func(file string, markers []claudewatch.Marker) {
+//		for _, m := range markers {
+//			fmt.Printf("%s:%d: %s\n", file, m.LineNumber, m.LineText)
+//		}
+//	})
+//	if err := w.Start(); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer w.Stop()
+package claudewatch
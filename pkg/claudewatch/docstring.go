@@ -0,0 +1,86 @@
+package claudewatch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// pythonExtensions are the extensions of the files whose docstrings are
+// searched for markers (see Scanner.ScanFile)
+var pythonExtensions = map[string]bool{".py": true, ".pyi": true, ".pyw": true}
+
+// ScanFile returns the active markers in content, the contents of the file
+// at path, as Scan does, with the comment syntaxes ForFile adds for it and
+// those of the file's language that aren't found everywhere:
+//
+//   - In a Python file, a string in triple quotes (three double or three
+//     single quotes) that starts a line, as a docstring or a string used as
+//     a block comment does, is read as a comment. Strings assigned or passed
+//     somewhere are left alone.
+//   - In an HTML, JSX, TSX, Vue or Svelte file, <!-- --> and {/* */}
+//     comments count.
+func (s *Scanner) ScanFile(path, content string) []Marker {
+	ext := strings.ToLower(filepath.Ext(path))
+	return s.ForFile(path).scan(content, fileSyntax{docstrings: pythonExtensions[ext], markup: markupExtensions[ext]})
+}
+
+// pythonDocstringLines reports which of lines are in a docstring: lines
+// that open, continue or close a triple-quoted string which starts its
+// line (after any string prefix such as r or f). Triple quotes in a "#"
+// comment or after a quote of the other kind are not told apart; it is a
+// line-based reading, not a Python tokenizer.
+func pythonDocstringLines(lines []string) []bool {
+	in := make([]bool, len(lines))
+	quote := ""  // The triple quote of the string open at this point, if any
+	doc := false // Whether the open string is a docstring
+	for i, line := range lines {
+		if quote != "" && doc {
+			in[i] = true
+		}
+		rest := line
+		for {
+			if quote != "" {
+				end := strings.Index(rest, quote)
+				if end < 0 {
+					break
+				}
+				rest, quote = rest[end+3:], ""
+				continue
+			}
+			start, q := firstTripleQuote(rest)
+			if start < 0 {
+				break
+			}
+			before := strings.TrimSpace(rest[:start])
+			if strings.Contains(before, "#") {
+				break
+			}
+			doc = rest == line && isStringPrefix(before)
+			if doc {
+				in[i] = true
+			}
+			rest, quote = rest[start+3:], q
+		}
+	}
+	return in
+}
+
+// firstTripleQuote returns where the first triple quote in text is and
+// which it is, or -1 if there is none
+func firstTripleQuote(text string) (int, string) {
+	double, single := strings.Index(text, `"""`), strings.Index(text, `'''`)
+	switch {
+	case double < 0 && single < 0:
+		return -1, ""
+	case single < 0 || (double >= 0 && double < single):
+		return double, `"""`
+	default:
+		return single, `'''`
+	}
+}
+
+// isStringPrefix reports whether text is empty or a Python string prefix
+// such as r, b or rf
+func isStringPrefix(text string) bool {
+	return len(text) <= 2 && strings.Trim(strings.ToLower(text), "rbuf") == ""
+}
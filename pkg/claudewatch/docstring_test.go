@@ -0,0 +1,44 @@
+package claudewatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPythonDocstringLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []bool
+	}{
+		{"Block", []string{`"""Summary.`, `More.`, `"""`, `x = 1`}, []bool{true, true, true, false}},
+		{"One line", []string{`    '''Summary.'''`, `x = 1`}, []bool{true, false}},
+		{"Prefix", []string{`r"""Raw \d`, `"""`}, []bool{true, true}},
+		{"Assigned", []string{`x = """`, `text`, `"""`, `"""doc"""`}, []bool{false, false, false, true}},
+		{"Other quote inside", []string{`"""It's '''quoted'''`, `still`, `"""`}, []bool{true, true, true}},
+		{"In a comment", []string{`# """`, `x = 1`}, []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pythonDocstringLines(tt.lines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pythonDocstringLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindMarkersInFileReadsPythonDocstrings(t *testing.T) {
+	content := "def f():\n    \"\"\"Return the total.\n\n    Cache the result ai!\n    \"\"\"\n"
+	if markers := defaultScanner.ScanFile("pkg/f.py", content); len(markers) != 1 || markers[0].LineNumber != 4 {
+		t.Errorf("ScanFile(.py) = %+v, want the marker in the docstring", markers)
+	}
+	if markers := defaultScanner.ScanFile("pkg/f.kt", content); len(markers) != 0 {
+		t.Errorf("ScanFile(.kt) = %+v, want no markers outside Python", markers)
+	}
+
+	ignored := "\"\"\"\nai:ignore\nnot this one ai!\n\"\"\"\n"
+	if markers := defaultScanner.ScanFile("f.py", ignored); len(markers) != 0 {
+		t.Errorf("ScanFile() = %+v, want ai:ignore honored in docstrings", markers)
+	}
+}
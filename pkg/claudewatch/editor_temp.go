@@ -0,0 +1,52 @@
+package claudewatch
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IsEditorTempFile checks if a file is one of the temp files editors leave
+// next to the files they edit: Emacs auto-save and lock files, Vim swap
+// files, JetBrains and VS Code atomic-save files and the like
+func IsEditorTempFile(filePath string) bool {
+	return isEditorTemp(filepath.Base(filePath))
+}
+
+// vimSwapExtensions are the extensions of Vim's swap files: .swp, then .swo
+// and so on when one is taken, and .swx when Vim tests a directory
+var vimSwapExtensions = []string{".swp", ".swo", ".swn", ".swx"}
+
+// jetBrainsTempSuffixes end the files JetBrains IDEs write and move aside
+// during a safe write
+var jetBrainsTempSuffixes = []string{"___jb_tmp___", "___jb_old___"}
+
+// vsCodeTempSuffix ends the file VS Code writes before renaming it over the
+// original in an atomic save
+const vsCodeTempSuffix = ".vsctmp"
+
+// isEditorTemp checks if a filename is a temp file of one of the editors
+// claudewatch knows
+func isEditorTemp(filename string) bool {
+	if isEmacsTemp(filename) || isVimTemp(filename) {
+		return true
+	}
+	for _, suffix := range jetBrainsTempSuffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(filename, vsCodeTempSuffix)
+}
+
+// isVimTemp checks if a filename is a Vim swap file, or the numbered file
+// (4913, then 5036 and so on) Vim creates to check it may write a directory
+func isVimTemp(filename string) bool {
+	for _, ext := range vimSwapExtensions {
+		if strings.HasSuffix(filename, ext) && len(filename) > len(ext) {
+			return true
+		}
+	}
+	n, err := strconv.Atoi(filename)
+	return err == nil && n >= 4913 && (n-4913)%123 == 0
+}
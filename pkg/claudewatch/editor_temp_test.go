@@ -0,0 +1,44 @@
+package claudewatch
+
+import "testing"
+
+func TestIsEditorTemp(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     bool
+	}{
+		{"Emacs auto-save file", "#main.go#", true},
+		{"Vim swap file", "main.go.swp", true},
+		{"Second Vim swap file", "main.go.swo", true},
+		{"Vim write test file", "4913", true},
+		{"Next Vim write test file", "5036", true},
+		{"Other number", "4914", false},
+		{"JetBrains temp file", "main.go___jb_tmp___", true},
+		{"JetBrains old file", "main.go___jb_old___", true},
+		{"VS Code atomic-save file", "main.go.vsctmp", true},
+		{"Regular file", "main.go", false},
+		{"Extension only", ".swp", false},
+		{"Similar extension", "query.sql", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEditorTemp(tt.filename); got != tt.want {
+				t.Errorf("isEditorTemp(%q) = %v, want %v", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsHiddenFileLeavesEditorTemps(t *testing.T) {
+	if IsHiddenFile("/src/main.go.swp") {
+		t.Error("IsHiddenFile(main.go.swp) = true, want editor temp files left to IsEditorTempFile")
+	}
+	if !IsEditorTempFile("/src/main.go.swp") {
+		t.Error("IsEditorTempFile(main.go.swp) = false")
+	}
+	if !IsHiddenFile("/src/.main.go.swp") {
+		t.Error("IsHiddenFile(.main.go.swp) = false, want hidden files still skipped")
+	}
+}
@@ -0,0 +1,171 @@
+package claudewatch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// binarySniffLen is how many bytes are inspected to decide whether content is binary
+const binarySniffLen = 8000
+
+// LooksBinary reports whether data, judged by its first binarySniffLen bytes,
+// is binary rather than text: it contains a NUL byte, or more than a tenth of
+// it is invalid UTF-8 or control characters. ESC is allowed, as colored
+// command output is full of it.
+func LooksBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+
+	suspicious := 0
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			if !utf8.FullRune(data[i:]) {
+				// A character cut off at the end of the sample
+				i = len(data)
+				continue
+			}
+			suspicious++
+		case r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != '\f' && r != 0x1b:
+			suspicious++
+		}
+		i += size
+	}
+	return suspicious*10 > len(data)
+}
+
+// ReadScannable reads path so it can be scanned for markers. A file larger
+// than maxSize bytes (when maxSize is positive) is skipped without being
+// read, and one whose first block looks binary is skipped without reading
+// the rest; skip says why. Both return no content and no error.
+func ReadScannable(path string, maxSize int64) (content []byte, skip string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return nil, fmt.Sprintf("%d bytes is over the %d byte limit", info.Size(), maxSize), nil
+	}
+
+	head := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	head = head[:n]
+	if LooksBinary(head) {
+		return nil, "looks binary", nil
+	}
+
+	// The file may have grown since it was stat'ed; don't read past the limit
+	var rest io.Reader = f
+	if maxSize > 0 {
+		rest = io.LimitReader(f, maxSize-int64(n)+1)
+	}
+	tail, err := io.ReadAll(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	if maxSize > 0 && int64(n+len(tail)) > maxSize {
+		return nil, fmt.Sprintf("grew past the %d byte limit", maxSize), nil
+	}
+	return append(head, tail...), "", nil
+}
+
+// WriteFileAtomic replaces the content of path so that readers, and a crash
+// part way through, see either the old content or the new, never a truncated
+// file. The data is written to a hidden temporary file in the same directory,
+// synced, and renamed over path. An existing file keeps its permission bits;
+// perm is used for a new one. A symlink is followed and its target replaced.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+
+	// The leading dot keeps the watcher from treating the temporary file as
+	// a change of its own
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".claudewatch-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // Fails harmlessly once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Set the mode explicitly: CreateTemp uses 0600 and the umask applies
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// IsHiddenOrSpecialFile checks if a file is a hidden file, a special file, or an editor's temp file
+// (see IsHiddenFile and IsEditorTempFile)
+func IsHiddenOrSpecialFile(filePath string) bool {
+	return IsHiddenFile(filePath) || IsEditorTempFile(filePath)
+}
+
+// IsHiddenFile checks if a file is a hidden file or a special file. It properly handles directory
+// reference "." (not considered special) but treats ".." as special
+func IsHiddenFile(filePath string) bool {
+	// Get the base filename
+	baseName := filepath.Base(filePath)
+
+	// Parent directory reference is treated as special (we don't want to watch outside the root)
+	if baseName == ".." {
+		return true
+	}
+
+	// Check if it's a hidden file (starts with a dot)
+	// but exclude current directory "."
+	return strings.HasPrefix(baseName, ".") && baseName != "."
+}
+
+// isEmacsTemp checks if a filename is an Emacs temporary file
+func isEmacsTemp(filename string) bool {
+	// Emacs auto-save files: #filename#
+	if strings.HasPrefix(filename, "#") && strings.HasSuffix(filename, "#") {
+		return true
+	}
+
+	// Emacs backup files: filename~
+	if strings.HasSuffix(filename, "~") {
+		return true
+	}
+
+	// Emacs lock files: .#filename
+	if strings.HasPrefix(filename, ".#") {
+		return true
+	}
+
+	return false
+}
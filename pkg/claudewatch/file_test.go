@@ -0,0 +1,113 @@
+package claudewatch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readString returns the content of path, failing the test if it can't be read
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(content)
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"empty", "", false},
+		{"source", "package main\n\nfunc main() {}\n", false},
+		{"unicode", "// naïve café 中文\n", false},
+		{"colored output", "\x1b[31merror\x1b[0m: x\n\x1b[33mwarning\x1b[0m: y\n", false},
+		{"NUL byte", "PK\x03\x04\x00\x00", true},
+		{"invalid UTF-8", "\xff\xfe\xfd\xfc\x80\x81 ab", true},
+		{"control characters", "\x01\x02\x03\x04\x05abc", true},
+		{"rune cut off at the end", strings.Repeat("a", binarySniffLen-1) + "é", false},
+	}
+
+	for _, tt := range tests {
+		if got := LooksBinary([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: LooksBinary() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadScannable(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	text := write("a.go", "// fix this ai!\n")
+	if content, skip, err := ReadScannable(text, 1024); err != nil || skip != "" || string(content) != "// fix this ai!\n" {
+		t.Errorf("ReadScannable(text) = %q, %q, %v; want the content", content, skip, err)
+	}
+
+	big := write("big.go", strings.Repeat("// padding\n", 200))
+	if content, skip, err := ReadScannable(big, 1024); err != nil || skip == "" || content != nil {
+		t.Errorf("ReadScannable(big) = %d bytes, %q, %v; want it skipped", len(content), skip, err)
+	}
+	if _, skip, _ := ReadScannable(big, 0); skip != "" {
+		t.Errorf("ReadScannable(big) without a limit skipped it: %s", skip)
+	}
+
+	binary := write("logo.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR // ai!")
+	if _, skip, err := ReadScannable(binary, 0); err != nil || skip != "looks binary" {
+		t.Errorf("ReadScannable(binary) = %q, %v; want it skipped as binary", skip, err)
+	}
+
+	if _, _, err := ReadScannable(filepath.Join(dir, "missing.go"), 0); err == nil {
+		t.Error("ReadScannable() of a missing file returned no error")
+	}
+}
+
+func TestWriteFileAtomicFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.go")
+	link := filepath.Join(dir, "link.go")
+	if err := os.WriteFile(target, []byte("old"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlink: %v", err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new"), 0o644); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link was replaced by a regular file")
+	}
+	if got := readString(t, target); got != "new" {
+		t.Errorf("target = %q, want the new content", got)
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("target mode changed, want -rw-------")
+	}
+}
+
+func TestWriteFileAtomicNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.txt")
+	if err := WriteFileAtomic(path, []byte("hello"), 0o640); err != nil {
+		t.Fatalf("WriteFileAtomic: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 || readString(t, path) != "hello" {
+		t.Errorf("new file = %v %q, want -rw-r----- \"hello\"", info.Mode().Perm(), readString(t, path))
+	}
+}
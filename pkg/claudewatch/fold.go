@@ -0,0 +1,98 @@
+package claudewatch
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// foldRune maps r to the form markers are matched in. Regexp's (?i) only
+// applies simple case folding, so markers typed with fullwidth characters
+// (ＡＩ！) or with Turkish dotted/dotless I (İ, ı) would otherwise slip through.
+func foldRune(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E: // Fullwidth ASCII variants
+		r -= 0xFEE0
+	case r == 0x3000: // Ideographic space
+		r = ' '
+	case r == 'İ' || r == 'ı':
+		r = 'i'
+	}
+	return unicode.ToLower(r)
+}
+
+// foldedLine is a line normalized with foldRune, along with the byte offset
+// in the original line of each folded byte, so matches found in the folded
+// text can be mapped back and removed from the original.
+type foldedLine struct {
+	text    string
+	offsets []int // offsets[i] is the original offset of folded byte i; offsets[len(text)] is len(original)
+}
+
+// foldLine folds every rune of line
+func foldLine(line string) foldedLine {
+	var text strings.Builder
+	offsets := make([]int, 0, len(line)+1)
+	for i, r := range line {
+		if r == utf8.RuneError {
+			// Keep invalid bytes as they are so offsets stay aligned
+			if _, size := utf8.DecodeRuneInString(line[i:]); size == 1 {
+				text.WriteByte(line[i])
+				offsets = append(offsets, i)
+				continue
+			}
+		}
+		folded := foldRune(r)
+		n, _ := text.WriteRune(folded)
+		for j := 0; j < n; j++ {
+			offsets = append(offsets, i)
+		}
+	}
+	offsets = append(offsets, len(line))
+	return foldedLine{text: text.String(), offsets: offsets}
+}
+
+// foldedMatch reports whether pattern matches line once folded
+func foldedMatch(pattern *regexp.Regexp, line string) bool {
+	return pattern.MatchString(foldLine(line).text)
+}
+
+// removeFoldedSpans deletes from line the original text behind each [start,
+// end) span of its folded form. Spans must be sorted and non-overlapping.
+func removeFoldedSpans(line string, folded foldedLine, spans [][]int) string {
+	var out strings.Builder
+	last := 0
+	for _, span := range spans {
+		start, end := folded.offsets[span[0]], folded.offsets[span[1]]
+		out.WriteString(line[last:start])
+		last = end
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+// removeMarkerTokens removes every marker token from line, matching in folded
+// form. A marker between two words takes the whitespace after it along, so
+// "// ai! fix this" becomes "// fix this" rather than leaving a double space. ai:ignore
+func (s *Scanner) removeMarkerTokens(line string) string {
+	folded := foldLine(line)
+	spans := s.tokenSpans(folded.text)
+	if spans == nil {
+		return line
+	}
+	for _, span := range spans {
+		if span[0] > 0 && !isBlank(folded.text[span[0]-1]) {
+			continue
+		}
+		for span[1] < len(folded.text) && isBlank(folded.text[span[1]]) {
+			span[1]++
+		}
+	}
+	return removeFoldedSpans(line, folded, spans)
+}
+
+// isBlank reports whether b is a space or tab
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t'
+}
@@ -0,0 +1,104 @@
+package claudewatch
+
+import "testing"
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"// fix this AI!", "// fix this ai!"},
+		{"// fix this ＡＩ！", "// fix this ai!"},
+		{"// why？ ａｉ？", "// why? ai?"},
+		{"// İstanbul aİ!", "// istanbul ai!"},
+		{"# bozuk kod ıa", "# bozuk kod ia"},
+		{"//　ai!", "// ai!"},
+	}
+
+	for _, tt := range tests {
+		if got := foldLine(tt.line).text; got != tt.want {
+			t.Errorf("foldLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFoldLineKeepsInvalidBytesAligned(t *testing.T) {
+	line := "// \xff ai!"
+	folded := foldLine(line)
+	if folded.text != line {
+		t.Fatalf("foldLine(%q) = %q, want the line unchanged", line, folded.text)
+	}
+	if len(folded.offsets) != len(folded.text)+1 || folded.offsets[len(folded.text)] != len(line) {
+		t.Errorf("offsets = %v, want one per folded byte plus the end", folded.offsets)
+	}
+}
+
+func TestHasAIMarkerFoldsUnicode(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"// use a map ＡＩ！", true},
+		{"// use a map aİ!", true},
+		{"// use a map Aı?", true},
+		{"// ！ＡＩ rename this", true},
+		{"// ＡＩ is fine here", false},
+	}
+
+	for _, tt := range tests {
+		if got := defaultScanner.hasAIMarker(tt.line); got != tt.want {
+			t.Errorf("hasAIMarker(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFindActiveAIMarkersFoldsUnicode(t *testing.T) {
+	content := "// ａｉ：ｉｇｎｏｒｅ\n// skip this ai!\n// explain this ＡＩ？\n"
+	markers := defaultScanner.Scan(content)
+	if len(markers) != 1 {
+		t.Fatalf("found %d markers, want only the question: %+v", len(markers), markers)
+	}
+	if markers[0].LineNumber != 3 || markers[0].Token != "ai?" || markers[0].Type != TypeQuestion {
+		t.Errorf("marker = %+v, want an ai? question on line 3", markers[0])
+	}
+}
+
+func TestRemoveAIMarkersFoldsUnicode(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"// use a map ＡＩ！", "// use a map"},
+		{"// İstanbul: handle timezones aİ!", "// İstanbul: handle timezones"},
+		{"// ！ａｉ rename ünïcödé here", "// rename ünïcödé here"},
+		{"x := 1 // 中文 ai? 中文", "x := 1 // 中文 中文"},
+	}
+
+	for _, tt := range tests {
+		updated, _, err := defaultScanner.StripMarkers(tt.content, defaultScanner.Scan(tt.content))
+		if err != nil {
+			t.Fatalf("StripMarkers(%q): %v", tt.content, err)
+		}
+		if updated != tt.want {
+			t.Errorf("StripMarkers(%q) = %q, want %q", tt.content, updated, tt.want)
+		}
+	}
+}
+
+func TestStripNamespacePrefixesFoldsUnicode(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Namespaces: []string{"be"}})
+
+	line := "// add pagination ＢＥ-ＡＩ！"
+	if got := s.markerNamespace(line); got != "be" {
+		t.Errorf("markerNamespace(%q) = %q, want \"be\"", line, got)
+	}
+	if got := s.removeMarkerTokens(s.stripNamespacePrefixes(line)); got != "// add pagination " {
+		t.Errorf("stripped line = %q, want the namespace and marker removed", got)
+	}
+}
+
+func TestIsTrivialStripFoldsUnicode(t *testing.T) {
+	if !defaultScanner.IsTrivialStrip("// use a map ＡＩ！", "// use a map") {
+		t.Error("IsTrivialStrip() = false for a trailing fullwidth marker")
+	}
+}
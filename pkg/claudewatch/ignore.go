@@ -0,0 +1,40 @@
+package claudewatch
+
+// IgnoreFileLines is how far into a file the ignore-file directive
+// (ai:ignore-file by default) is looked for
+const IgnoreFileLines = 10
+
+// ignoresFile reports whether one of the first IgnoreFileLines lines is a
+// comment holding the ignore-file directive, which keeps every marker and
+// directive in the file from being found
+func (s *Scanner) ignoresFile(lines []string) bool {
+	for _, line := range lines[:min(len(lines), IgnoreFileLines)] {
+		if s.isComment(line) && foldedMatch(s.ignoreFileRegex, line) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredRegions reports which of lines lie in an ignored region: from a
+// comment holding the ignore-start directive (ai:ignore-start by default)
+// through the next comment holding the ignore-end directive, or to the end
+// of the file if there is none. Markers and directives in a region, on its
+// first and last lines too, are not found.
+func (s *Scanner) ignoredRegions(lines []string) []bool {
+	ignored := make([]bool, len(lines))
+	inRegion := false
+	for i, line := range lines {
+		switch {
+		case !inRegion && s.isComment(line) && foldedMatch(s.ignoreStartRegex, line):
+			inRegion = true
+			ignored[i] = true
+		case inRegion:
+			ignored[i] = true
+			if s.isComment(line) && foldedMatch(s.ignoreEndRegex, line) {
+				inRegion = false
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,73 @@
+package claudewatch
+
+import "testing"
+
+func TestIgnoredRegions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []int // Lines of the markers found
+	}{
+		{"Region", "// a ai!\n// ai:ignore-start\n// b ai!\nx := \"// c ai?\"\n// ai:ignore-end\n// d ai!\n", []int{1, 6}},
+		{"Markers on the directive lines", "// ai:ignore-start ai!\n// b ai!\n// AI:IGNORE-END ai!\n// d ai!\n", []int{4}},
+		{"No end", "// a ai!\n# ai:ignore-start\n# b ai!\n\n# c ai!\n", []int{1}},
+		{"Two regions", "// ai:ignore-start\n// a ai!\n// ai:ignore-end\n// b ai!\n// ai:ignore-start\n// c ai!\n// ai:ignore-end\n", []int{4}},
+		{"Region directive doesn't ignore the next marker", "// ai:ignore-end\n// a ai!\n", []int{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers := defaultScanner.Scan(tt.content)
+			var got []int
+			for _, marker := range markers {
+				got = append(got, marker.LineNumber)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("markers on lines %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("markers on lines %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestIgnoredRegionsSkipResets(t *testing.T) {
+	content := "// ai:ignore-start\n// ai:reset\n// ai:ignore-end\n// ai:reset\n"
+	if resets := defaultScanner.ScanResets(content); len(resets) != 1 || resets[0].LineNumber != 4 {
+		t.Errorf("ScanResets() = %+v, want only the reset on line 4", resets)
+	}
+}
+
+func TestIgnoredRegionsWithCustomDirective(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{IgnoreDirective: "llm:skip"})
+	content := "// llm:skip-start\n// a ai!\n// llm:skip-end\n// b ai!\n"
+	if markers := s.Scan(content); len(markers) != 1 || markers[0].LineNumber != 4 {
+		t.Errorf("Scan() = %+v, want only the marker on line 4", markers)
+	}
+}
+
+func TestIgnoreFileDirective(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int // Markers found
+	}{
+		{"First line", "// ai:ignore-file\n// a ai!\n// ai:reset\n", 0},
+		{"After a header", "#!/bin/sh\n# Fixtures for the marker tests\n# AI:IGNORE-FILE\necho '# a ai!'\n", 0},
+		{"Past the first lines", "package a\n\n\n\n\n\n\n\n\n\n// ai:ignore-file\n// a ai!\n", 1},
+		{"Not the plain directive", "// ai:ignore\n// a ai!\n// b ai!\n", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := len(defaultScanner.Scan(tt.content)) + len(defaultScanner.ScanResets(tt.content))
+			if found != tt.want {
+				t.Errorf("found %d markers and resets, want %d", found, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package claudewatch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// supportedMarkers contains all the supported AI markers
+var supportedMarkers = []string{"ai!", "!ai", "ai?"}
+
+// Directives that can't be configured
+var (
+	resetRegex    = regexp.MustCompile(`(?i)ai:reset\b`)
+	priorityRegex = regexp.MustCompile(`(?i)ai:priority=(high|normal|low)\b`)
+)
+
+// SupportedMarkers returns the marker tokens that are recognized, in lower case
+func SupportedMarkers() []string {
+	return append([]string(nil), supportedMarkers...)
+}
+
+// markerAlternation returns tokens as an escaped regex alternation, longest
+// first so "@llm" doesn't shadow "@llm?"
+func markerAlternation(tokens []string) string {
+	escapedMarkers := make([]string, len(tokens))
+	for i, marker := range tokens {
+		escapedMarkers[i] = regexp.QuoteMeta(marker)
+	}
+	sort.SliceStable(escapedMarkers, func(i, j int) bool { return len(escapedMarkers[i]) > len(escapedMarkers[j]) })
+	return strings.Join(escapedMarkers, "|")
+}
+
+// hasAIMarker checks if a line contains any AI marker. Lines are folded
+// first (see foldRune) so fullwidth and Turkish-cased markers still match.
+func (s *Scanner) hasAIMarker(line string) bool {
+	return s.firstToken(foldLine(line).text) != ""
+}
+
+// hasIgnoreDirective checks if a line contains the ignore directive (and not
+// only one of the region directives)
+func (s *Scanner) hasIgnoreDirective(line string) bool {
+	return foldedMatch(s.ignoreNextRegex, line)
+}
+
+// hasResetDirective checks if a line contains the reset directive
+func hasResetDirective(line string) bool {
+	return foldedMatch(resetRegex, line)
+}
+
+// isComment checks if a line starts with a comment marker
+func (s *Scanner) isComment(line string) bool {
+	return s.commentStart.MatchString(line)
+}
+
+// CommentLeader returns the comment syntax (such as "//" or "#") of the
+// first comment on line, or an empty string if it has none
+func (s *Scanner) CommentLeader(line string) string {
+	return strings.TrimSpace(s.commentStart.FindString(line))
+}
+
+// Marker is a line holding an AI marker, or an ai:reset directive
+type Marker struct {
+	LineNumber int
+	LineText   string
+	Context    string // Surrounding lines (with line numbers), when the caller fills it in
+	Namespace  string // Namespace the marker is addressed to (e.g. "be" for be-ai!), empty for plain markers
+	Token      string // The marker token as written, lowercased (e.g. "ai?")
+	Tag        string // Tag following the token, lowercased (e.g. "test" for ai!test), empty if none
+	Type       string // TypeEdit, TypeQuestion, TypeTodo or TypeReset
+	Priority   string // Level named by an ai:priority= directive on the line, empty if none
+
+	// Args are the key=value pairs in parentheses right after the marker
+	// token, as in "ai!(model=opus)" or "ai!(model=opus, lines=+3)"; nil
+	// if it has none. Keys are lowercased. "lines" names a region (see
+	// RegionStart); what other keys mean is up to the caller.
+	Args map[string]string
+
+	// RegionStart and RegionEnd are the first and last line of the code the
+	// marker applies to, given with (lines=+N) or an ai:block-start and
+	// ai:block-end pair; both are 0 if it names no region
+	RegionStart int
+	RegionEnd   int
+	Region      string // The region's lines (with line numbers), when the caller fills it in
+
+	// CommentStart is the first line of the comment the marker ends, when
+	// the comment lines directly above the marker's carry on its
+	// instruction (see Scanner.Scan); 0 when the marker's line says it all.
+	// Comment holds those lines through the marker's, as in the file.
+	CommentStart int
+	Comment      string
+}
+
+// Marker types. "ai?" asks a question; the other markers request an edit.
+// "TODO(ai):" and "FIXME(ai):" comments, when a Scanner is set to find them,
+// request an edit too but are told apart, so they can have their own
+// template. An ai:reset directive is carried along with the markers as a
+// reset.
+const (
+	TypeEdit     = "edit"
+	TypeQuestion = "question"
+	TypeTodo     = "todo"
+	TypeReset    = "reset"
+)
+
+// markerTokenAndType returns the first marker token on line (lowercased) and the type of marker it is
+func (s *Scanner) markerTokenAndType(line string) (string, string) {
+	token := s.firstToken(foldLine(line).text)
+	if s.todo[token] {
+		return token, TypeTodo
+	}
+	if strings.HasSuffix(token, "?") {
+		return token, TypeQuestion
+	}
+	return token, TypeEdit
+}
+
+// markerPriority returns the level named by the ai:priority= directive on
+// line, or an empty string if there is none
+func markerPriority(line string) string {
+	match := priorityRegex.FindStringSubmatch(foldLine(line).text)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// Scan returns the active (not ignored) markers in content, in the order
+// they appear. An instruction written over several comment lines, with the
+// marker at the end of the last, is found as one marker on that line, with
+// the whole comment in its Comment.
+func (s *Scanner) Scan(content string) []Marker {
+	return s.scan(content, fileSyntax{})
+}
+
+// fileSyntax is what kind of comments a file has besides the scanner's
+type fileSyntax struct {
+	docstrings bool // Python docstrings
+	markup     bool // HTML <!-- --> and JSX {/* */} comments
+}
+
+// scan returns the active markers in content, counting the comments syntax
+// allows for too
+func (s *Scanner) scan(content string, syntax fileSyntax) []Marker {
+	lines, _ := SplitLines(content)
+	if s.ignoresFile(lines) {
+		return nil
+	}
+	var markers []Marker
+
+	ignoreNextAI := false
+	ignored := s.ignoredRegions(lines)
+	var docLines, markupLines []bool
+	if syntax.docstrings {
+		docLines = pythonDocstringLines(lines)
+	}
+	if syntax.markup {
+		markupLines = markupCommentLines(lines)
+	}
+
+	for i, line := range lines {
+		lineNumber := i + 1 // Line numbers start from 1
+
+		if ignored[i] {
+			ignoreNextAI = false
+			continue
+		}
+
+		comment := s.isComment(line) || (docLines != nil && docLines[i]) || (markupLines != nil && markupLines[i])
+		if comment && s.hasIgnoreDirective(line) && s.hasAIMarker(line) {
+			continue
+		}
+
+		if comment && s.hasIgnoreDirective(line) && !s.hasAIMarker(line) {
+			ignoreNextAI = true
+			continue
+		}
+
+		// Check if this line contains an AI marker
+		if comment && s.hasAIMarker(line) {
+			if ignoreNextAI {
+				// This AI marker is ignored
+				ignoreNextAI = false // Reset for the next marker
+			} else {
+				// Found an active AI marker
+				token, markerType := s.markerTokenAndType(line)
+				regionStart, regionEnd := s.markerRegion(lines, i)
+				markers = append(markers, s.withComment(Marker{
+					LineNumber:  lineNumber,
+					LineText:    line,
+					Namespace:   s.markerNamespace(line),
+					Token:       token,
+					Tag:         s.markerTag(line),
+					Type:        markerType,
+					Priority:    markerPriority(line),
+					Args:        s.markerArgs(line),
+					RegionStart: regionStart,
+					RegionEnd:   regionEnd,
+				}, lines, i))
+			}
+		} else {
+			// If we see any non-AI line after an ai:ignore line, the ignore is no longer active
+			// This ensures that ai:ignore only applies to the very next line with an AI marker
+			ignoreNextAI = false
+		}
+	}
+
+	return markers
+}
+
+// MayHoldMarker reports whether line holds one of the scanner's markers, or
+// an ignore or ai:reset directive, comment or not. Content with no such line
+// has no markers, which lets a caller rule out changes quickly.
+func (s *Scanner) MayHoldMarker(line string) bool {
+	folded := foldLine(line).text
+	return s.markerPattern.MatchString(folded) || s.ignoreRegex.MatchString(folded) || resetRegex.MatchString(folded)
+}
+
+// ScanResets returns the comment lines in content holding an ai:reset
+// directive, as markers of type TypeReset. A directive on a line that also
+// holds a marker doesn't count.
+func (s *Scanner) ScanResets(content string) []Marker {
+	lines, _ := SplitLines(content)
+	if s.ignoresFile(lines) {
+		return nil
+	}
+	var directives []Marker
+	ignored := s.ignoredRegions(lines)
+	for i, line := range lines {
+		if !ignored[i] && s.isComment(line) && hasResetDirective(line) && !s.hasAIMarker(line) {
+			directives = append(directives, Marker{
+				LineNumber: i + 1,
+				LineText:   line,
+				Token:      "ai:reset",
+				Type:       TypeReset,
+			})
+		}
+	}
+	return directives
+}
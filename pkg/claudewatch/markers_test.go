@@ -1,4 +1,4 @@
-package main
+package claudewatch
 
 import (
 	"testing"
@@ -225,8 +225,8 @@ func TestHasActiveAIMarkers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := hasActiveAIMarkers(tt.content); got != tt.want {
-				t.Errorf("hasActiveAIMarkers() = %v, want %v for content:\n%s", got, tt.want, tt.content)
+			if got := len(defaultScanner.Scan(tt.content)) > 0; got != tt.want {
+				t.Errorf("Scan() found markers = %v, want %v for content:\n%s", got, tt.want, tt.content)
 			}
 		})
 	}
@@ -274,25 +274,65 @@ func TestFindActiveAIMarkers(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			markers := findActiveAIMarkers(tt.content)
+			markers := defaultScanner.Scan(tt.content)
 
 			// Check count
 			if got := len(markers); got != tt.want {
-				t.Errorf("findActiveAIMarkers() returned %v markers, want %v for content:\n%s", got, tt.want, tt.content)
+				t.Errorf("Scan() returned %v markers, want %v for content:\n%s", got, tt.want, tt.content)
 			}
 
 			// Check line numbers if we have markers
 			if len(markers) > 0 {
 				for i, marker := range markers {
 					if i >= len(tt.lines) {
-						t.Errorf("findActiveAIMarkers() returned more markers than expected")
+						t.Errorf("Scan() returned more markers than expected")
 						break
 					}
 					if marker.LineNumber != tt.lines[i] {
-						t.Errorf("findActiveAIMarkers() marker %d has line number %d, want %d", i, marker.LineNumber, tt.lines[i])
+						t.Errorf("Scan() marker %d has line number %d, want %d", i, marker.LineNumber, tt.lines[i])
 					}
 				}
 			}
 		})
 	}
 }
+
+func TestMarkerTokenAndType(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantToken string
+		wantType  string
+	}{
+		{"// use a map ai!", "ai!", TypeEdit},
+		{"# refactor this !AI", "!ai", TypeEdit},
+		{"// why is this here AI?", "ai?", TypeQuestion},
+	}
+
+	for _, tt := range tests {
+		token, markerType := defaultScanner.markerTokenAndType(tt.line)
+		if token != tt.wantToken || markerType != tt.wantType {
+			t.Errorf("markerTokenAndType(%q) = %q, %q; want %q, %q", tt.line, token, markerType, tt.wantToken, tt.wantType)
+		}
+	}
+}
+
+func TestMayHoldMarker(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"// use a map ai!", true},
+		{`s := "fix ai!"`, true}, // Not a comment, but adding // would make it a marker
+		{"// ai:ignore", true},
+		{"# ai:reset", true},
+		{"// ＡＩ！ fullwidth", true},
+		{"func main() { wait() }", false},
+		{"// said it again", false},
+	}
+
+	for _, tt := range tests {
+		if got := defaultScanner.MayHoldMarker(tt.line); got != tt.want {
+			t.Errorf("MayHoldMarker(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package claudewatch
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markupExtensions are the extensions of the files whose HTML and JSX
+// comments are searched for markers (see Scanner.ScanFile)
+var markupExtensions = map[string]bool{
+	".html": true, ".htm": true, ".jsx": true, ".tsx": true, ".vue": true, ".svelte": true,
+}
+
+// markupCommentStart matches the opening of an HTML or JSX comment
+var markupCommentStart = regexp.MustCompile(`<!--|\{/\*`)
+
+// markupEmptyComments are the sources of empty HTML and JSX comments, left
+// when a comment held nothing but its marker
+var markupEmptyComments = []string{`<!--[ \t]*-->`, `\{/\*[ \t]*\*/\}`}
+
+// markupCommentLines reports which of lines hold an HTML or JSX comment or
+// part of one, as an HTML comment's lines between "<!--" and "-->" do
+func markupCommentLines(lines []string) []bool {
+	in := make([]bool, len(lines))
+	open := false // Inside an HTML comment left open by an earlier line
+	for i, line := range lines {
+		in[i] = open || markupCommentStart.MatchString(line)
+		rest := line
+		for {
+			if open {
+				end := strings.Index(rest, "-->")
+				if end < 0 {
+					break
+				}
+				rest, open = rest[end+len("-->"):], false
+				continue
+			}
+			start := strings.Index(rest, "<!--")
+			if start < 0 {
+				break
+			}
+			rest, open = rest[start+len("<!--"):], true
+		}
+	}
+	return in
+}
@@ -0,0 +1,43 @@
+package claudewatch
+
+import "testing"
+
+func TestFindMarkersInFileReadsMarkupComments(t *testing.T) {
+	content := "<template>\n  <!-- improve accessibility here ai! -->\n  <button>{/* label this ai? */}</button>\n</template>\n"
+
+	for _, path := range []string{"index.html", "App.vue", "Card.jsx", "Card.tsx", "Page.svelte"} {
+		markers := defaultScanner.ScanFile(path, content)
+		if len(markers) != 2 || markers[0].LineNumber != 2 || markers[1].Type != TypeQuestion {
+			t.Errorf("ScanFile(%s) = %+v, want the markers on lines 2 and 3", path, markers)
+		}
+	}
+	if markers := defaultScanner.ScanFile("notes.txt", content); len(markers) != 1 || markers[0].LineNumber != 3 {
+		t.Errorf("ScanFile(notes.txt) = %+v, want only the /* */ comment", markers)
+	}
+}
+
+func TestStripMarkupComments(t *testing.T) {
+	content := "<ul>\n  <!-- ai! -->\n  <li>a</li> <!-- ai! -->\n  {/* AI! */}\n  <!-- use a list ai! -->\n</ul>\n" // ai:ignore
+	updated, stripped, err := defaultScanner.StripMarkers(content, defaultScanner.ScanFile("list.jsx", content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "<ul>\n  <li>a</li>\n  <!-- use a list -->\n</ul>\n"; updated != want {
+		t.Errorf("StripMarkers() = %q, want %q", updated, want)
+	}
+	if len(stripped) != 4 || !defaultScanner.IsEmptyComment(stripped[0].LineText) || !defaultScanner.IsEmptyComment(stripped[2].LineText) {
+		t.Errorf("stripped markers = %+v, want the empty comments deleted", stripped)
+	}
+}
+
+func TestMarkupCommentLines(t *testing.T) {
+	lines := []string{"<p>", "<!--", "  note ai!", "-->", "<p>a</p> <!-- b --> c", "{/* d */}", "<!-- e --> <!--", "f", "-->"}
+	want := []bool{false, true, true, true, true, true, true, true, true}
+	got := markupCommentLines(lines)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("markupCommentLines() = %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package claudewatch
+
+// markerNamespace returns the namespace a marker line is addressed to, or an
+// empty string for plain markers
+func (s *Scanner) markerNamespace(line string) string {
+	if s.namespacePattern == nil {
+		return ""
+	}
+	match := s.namespacePattern.FindStringSubmatch(foldLine(line).text)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// stripNamespacePrefixes removes namespace prefixes in front of markers,
+// leaving the bare marker for the normal removal to strip
+func (s *Scanner) stripNamespacePrefixes(line string) string {
+	if s.namespacePattern == nil {
+		return line
+	}
+	folded := foldLine(line)
+	var spans [][]int
+	for _, sub := range s.namespacePattern.FindAllStringSubmatchIndex(folded.text, -1) {
+		// Remove the namespace and its dash, keeping the boundary character
+		// that preceded it and the marker that follows
+		spans = append(spans, []int{sub[2], sub[4]})
+	}
+	return removeFoldedSpans(line, folded, spans)
+}
@@ -0,0 +1,53 @@
+package claudewatch
+
+import "testing"
+
+func TestMarkerNamespace(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Namespaces: []string{"be", "fe"}})
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"// add pagination be-ai!", "be"},
+		{"// fix the layout FE-ai?", "fe"},
+		{"# be-!ai tighten validation", "be"},
+		{"// plain marker ai!", ""},
+		{"// unknown namespace ops-ai!", ""},
+		{"// word ending in a namespace safe-ai!", ""},
+	}
+
+	for _, tt := range tests {
+		if got := s.markerNamespace(tt.line); got != tt.want {
+			t.Errorf("markerNamespace(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFindActiveAIMarkersSetsNamespace(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Namespaces: []string{"be"}})
+
+	markers := s.Scan("// one be-ai!\n// two ai!")
+	if len(markers) != 2 {
+		t.Fatalf("found %d markers, want 2", len(markers))
+	}
+	if markers[0].Namespace != "be" || markers[1].Namespace != "" {
+		t.Errorf("namespaces = %q, %q; want \"be\", \"\"", markers[0].Namespace, markers[1].Namespace)
+	}
+}
+
+func TestRemoveAIMarkersStripsNamespacePrefix(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Namespaces: []string{"be"}})
+
+	content := "// add pagination be-ai!\n// handle errors ai!"
+	updated, markers, err := s.StripMarkers(content, s.Scan(content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "// add pagination\n// handle errors"; updated != want {
+		t.Errorf("updated content = %q, want %q", updated, want)
+	}
+	if markers[0].Namespace != "be" {
+		t.Errorf("updated marker lost its namespace: %+v", markers[0])
+	}
+}
@@ -0,0 +1,53 @@
+package claudewatch
+
+import "strings"
+
+// LineEnding records how a file ends its lines, so that content split into
+// lines can be joined back without changing them
+type LineEnding struct {
+	newline string // "\r\n" if every line ends that way, otherwise "\n"
+	final   bool   // Whether the last line is terminated
+}
+
+// SplitLines splits content into lines without their line endings. A
+// trailing newline doesn't start an extra, empty line. "\r" is only treated
+// as part of the line ending when every line ends in "\r\n"; in a file with
+// mixed endings it is left on its lines, so joining reproduces them exactly.
+func SplitLines(content string) ([]string, LineEnding) {
+	ending := LineEnding{newline: "\n", final: strings.HasSuffix(content, "\n")}
+	if ending.final {
+		content = content[:len(content)-1]
+	}
+
+	lines := strings.Split(content, "\n")
+	crlf := strings.Count(content, "\n") > 0 || ending.final
+	for i, line := range lines {
+		terminated := i < len(lines)-1 || ending.final
+		if terminated && !strings.HasSuffix(line, "\r") {
+			crlf = false
+			break
+		}
+	}
+	if crlf {
+		ending.newline = "\r\n"
+		for i := range lines {
+			if i < len(lines)-1 || ending.final {
+				lines[i] = strings.TrimSuffix(lines[i], "\r")
+			}
+		}
+	}
+	return lines, ending
+}
+
+// Join puts lines back together with the line ending of the file they were
+// split from
+func (e LineEnding) Join(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	content := strings.Join(lines, e.newline)
+	if e.final {
+		content += e.newline
+	}
+	return content
+}
@@ -0,0 +1,63 @@
+package claudewatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		content string
+		lines   []string
+		ending  LineEnding
+	}{
+		{"", []string{""}, LineEnding{"\n", false}},
+		{"a\nb\n", []string{"a", "b"}, LineEnding{"\n", true}},
+		{"a\nb", []string{"a", "b"}, LineEnding{"\n", false}},
+		{"a\r\nb\r\n", []string{"a", "b"}, LineEnding{"\r\n", true}},
+		{"a\r\nb", []string{"a", "b"}, LineEnding{"\r\n", false}},
+		{"a\r\nb\n", []string{"a\r", "b"}, LineEnding{"\n", true}},
+		{"a\r", []string{"a\r"}, LineEnding{"\n", false}},
+	}
+
+	for _, tt := range tests {
+		lines, ending := SplitLines(tt.content)
+		if !reflect.DeepEqual(lines, tt.lines) || ending != tt.ending {
+			t.Errorf("SplitLines(%q) = %q, %+v; want %q, %+v", tt.content, lines, ending, tt.lines, tt.ending)
+		}
+		if got := ending.Join(lines); got != tt.content {
+			t.Errorf("join(SplitLines(%q)) = %q, want the content unchanged", tt.content, got)
+		}
+	}
+}
+
+func TestRemoveAIMarkersKeepsLineEndings(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"a\r\n// fix this ai!\r\nb // x ai!\r\n// ai!\r\nend", "a\r\n// fix this\r\nb // x\r\nend"},
+		{"a\r\n// fix this ai!\r\n", "a\r\n// fix this\r\n"},
+		{"a\n// fix this ai!", "a\n// fix this"},
+		{"a\n// ai!\n", "a\n"},
+		{"// ai!\n", ""},
+	}
+
+	for _, tt := range tests {
+		markers := defaultScanner.Scan(tt.content)
+		updated, _, err := defaultScanner.StripMarkers(tt.content, markers)
+		if err != nil {
+			t.Fatalf("StripMarkers(%q): %v", tt.content, err)
+		}
+		if updated != tt.want {
+			t.Errorf("StripMarkers(%q) = %q, want %q", tt.content, updated, tt.want)
+		}
+	}
+}
+
+func TestFindActiveAIMarkersCRLF(t *testing.T) {
+	markers := defaultScanner.Scan("x\r\n// fix this ai!\r\n")
+	if len(markers) != 1 || markers[0].LineText != "// fix this ai!" || markers[0].LineNumber != 2 {
+		t.Errorf("markers = %+v, want line 2 without its carriage return", markers)
+	}
+}
@@ -0,0 +1,52 @@
+package claudewatch
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Region directives. A marker written as "ai!(lines=+N)" (an argument; see
+// Marker.Args) applies to the N lines below it. A marker whose comment holds ai:block-start, or that is
+// directly followed by an ai:block-start comment, applies to the lines
+// between that comment and the next ai:block-end comment.
+var (
+	blockStartRegex = regexp.MustCompile(`(?i)ai:block-start\b`)
+	blockEndRegex   = regexp.MustCompile(`(?i)ai:block-end\b`)
+	linesArgRegex   = regexp.MustCompile(`^\+?(\d+)$`)
+)
+
+// markerRegion returns the first and last line numbers of the code the
+// marker on lines[index] applies to, or zeros if it names no region
+func (s *Scanner) markerRegion(lines []string, index int) (int, int) {
+	line := foldLine(lines[index]).text
+	if arg, ok := s.markerArgs(lines[index])["lines"]; ok {
+		match := linesArgRegex.FindStringSubmatch(arg)
+		if match == nil {
+			return 0, 0
+		}
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n == 0 || index+1 >= len(lines) {
+			return 0, 0
+		}
+		return index + 2, min(index+1+n, len(lines))
+	}
+
+	start := -1 // Index of the ai:block-start comment
+	switch {
+	case blockStartRegex.MatchString(line):
+		start = index
+	case index+1 < len(lines) && s.isComment(lines[index+1]) && foldedMatch(blockStartRegex, lines[index+1]) && !s.hasAIMarker(lines[index+1]):
+		start = index + 1
+	default:
+		return 0, 0
+	}
+	for i := start + 1; i < len(lines); i++ {
+		if s.isComment(lines[i]) && foldedMatch(blockEndRegex, lines[i]) {
+			if i == start+1 {
+				return 0, 0 // Nothing between the two
+			}
+			return start + 2, i
+		}
+	}
+	return 0, 0
+}
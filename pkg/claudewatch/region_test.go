@@ -0,0 +1,73 @@
+package claudewatch
+
+import (
+	"testing"
+)
+
+func TestMarkerRegions(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		start, end int
+	}{
+		{"No region", "// fix ai!\na\n", 0, 0},
+		{"Lines below", "// fix ai!(lines=+2)\na\nb\nc\n", 2, 3},
+		{"Lines without a plus", "// fix AI!(lines=2)\na\nb\nc\n", 2, 3},
+		{"Lines past the end", "x\n// fix ai?(lines=+10)\na\nb", 3, 4},
+		{"Zero lines", "// fix ai!(lines=+0)\na\n", 0, 0},
+		{"Argument not on the marker", "// fix ai! (lines=+2)\na\nb\n", 0, 0},
+		{"Block on the marker line", "// ai! extract this ai:block-start\na\nb\n// ai:block-end\nc\n", 2, 3},
+		{"Block on the next line", "// ai! extract this\n# AI:BLOCK-START\na\n// ai:block-end\n", 3, 3},
+		{"Block not next to the marker", "// ai! extract this\nx\n// ai:block-start\na\n// ai:block-end\n", 0, 0},
+		{"Block without an end", "// ai! extract this\n// ai:block-start\na\n", 0, 0},
+		{"Empty block", "// ai! extract this\n// ai:block-start\n// ai:block-end\n", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers := defaultScanner.Scan(tt.content)
+			if len(markers) != 1 {
+				t.Fatalf("FindMarkers found %d markers, want 1", len(markers))
+			}
+			if markers[0].RegionStart != tt.start || markers[0].RegionEnd != tt.end {
+				t.Errorf("region = %d-%d, want %d-%d", markers[0].RegionStart, markers[0].RegionEnd, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestStripMarkersRegions(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		want       string
+		start, end int
+	}{
+		{"Argument is removed", "// fix ai!(lines=+1)\na\n", "// fix\na\n", 2, 2},
+		{"Deleted marker moves the region up", "x\n// ai!(lines=+2)\na\nb\n", "x\na\nb\n", 2, 3},
+		{"Deleted line inside the region", "// fix ai!(lines=+3)\na\n// ai!\nb\n", "// fix\na\nb\n", 2, 3},
+		{"Block comments stay", "// ai!\n// ai:block-start\na\n// ai:block-end\n", "// ai:block-start\na\n// ai:block-end\n", 2, 2},
+		{"Block start on the marker line stays", "// fix ai! ai:block-start\na\n// ai:block-end\n", "// fix ai:block-start\na\n// ai:block-end\n", 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, markers, err := defaultScanner.StripMarkers(tt.content, defaultScanner.Scan(tt.content))
+			if err != nil {
+				t.Fatalf("StripMarkers: %v", err)
+			}
+			if updated != tt.want {
+				t.Errorf("StripMarkers(%q) = %q, want %q", tt.content, updated, tt.want)
+			}
+			if markers[0].RegionStart != tt.start || markers[0].RegionEnd != tt.end {
+				t.Errorf("region = %d-%d, want %d-%d", markers[0].RegionStart, markers[0].RegionEnd, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestIsTrivialStripWithRegion(t *testing.T) {
+	if !defaultScanner.IsTrivialStrip("// fix this ai!(lines=+3)", "// fix this") {
+		t.Error("removing a trailing marker with a region isn't trivial")
+	}
+}
@@ -0,0 +1,232 @@
+package claudewatch
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultCommentSyntaxes are the comment leaders a marker's line must hold
+// unless ScannerOptions says otherwise
+var defaultCommentSyntaxes = []string{"//", "#", "/*", "*"}
+
+// DefaultCommentSyntaxes returns the comment leaders a Scanner recognizes
+// when ScannerOptions.CommentSyntaxes is nil
+func DefaultCommentSyntaxes() []string {
+	return append([]string(nil), defaultCommentSyntaxes...)
+}
+
+// defaultIgnoreDirective is the directive that keeps the next marker from
+// being found, unless ScannerOptions says otherwise
+const defaultIgnoreDirective = "ai:ignore"
+
+// ScannerOptions configure a Scanner. The zero value finds the supported
+// markers in "//", "#", "/*" and "*" comments.
+type ScannerOptions struct {
+	// Tokens are the marker tokens to find, matched without regard to case;
+	// nil uses SupportedMarkers. A token ending in "?" asks a question, and
+	// any other requests an edit.
+	Tokens []string
+	// CommentSyntaxes are the comment leaders (such as "//" or "--") a line
+	// must hold for its marker to count; nil uses "//", "#", "/*" and "*"
+	CommentSyntaxes []string
+	// FileCommentSyntaxes are more comment leaders for files with the given
+	// extensions (such as ".sql"), on top of CommentSyntaxes. They apply to
+	// ScanFile and to the Scanner ForFile returns.
+	FileCommentSyntaxes map[string][]string
+	// IgnoreDirective, in a comment on its own line or on a marker's line,
+	// keeps the next marker (or that one) from being found; empty uses
+	// "ai:ignore". The directive followed by "-start" and "-end" keeps every
+	// marker between the two from being found, and followed by "-file" in
+	// the first IgnoreFileLines lines, every marker in the file.
+	IgnoreDirective string
+	// Namespaces are the prefixes recognized in front of markers, so
+	// "be-ai!" is found with Namespace "be" when "be" is listed
+	Namespaces []string
+	// Tags are the words recognized directly after a marker token, so
+	// "ai!test" is found with Tag "test" when "test" is listed
+	Tags []string
+	// TodoMarkers also finds "TODO(ai):" and "FIXME(ai):" comments, as
+	// markers of TypeTodo
+	TodoMarkers bool
+}
+
+// Scanner finds and strips markers in file content. Its methods are safe to
+// call from several goroutines at once.
+type Scanner struct {
+	tokens []string
+	todo   map[string]bool // Tokens that make TypeTodo markers
+
+	// byExtension holds the Scanners for files with FileCommentSyntaxes, by
+	// extension
+	byExtension map[string]*Scanner
+
+	markerPattern    *regexp.Regexp // Any of the tokens
+	trailingPattern  *regexp.Regexp // A token, with any argument list, ending a line, capturing the token
+	argsPattern      *regexp.Regexp // A token followed by an argument list, capturing the list
+	namespacePattern *regexp.Regexp // A namespace prefix in front of a token, or nil without namespaces
+	tagPattern       *regexp.Regexp // A token followed by a tag, capturing the tag, or nil without tags
+	namespaceBefore  *regexp.Regexp // A namespace prefix and its dash ending the text, or nil without namespaces
+	tagAfter         *regexp.Regexp // A tag starting the text, up to a boundary, or nil without tags
+	ignoreRegex      *regexp.Regexp // The ignore directive, or any directive starting with it
+	ignoreNextRegex  *regexp.Regexp // The ignore directive alone, not ai:ignore-start or the like
+	ignoreStartRegex *regexp.Regexp
+	ignoreEndRegex   *regexp.Regexp
+	ignoreFileRegex  *regexp.Regexp
+	commentStart     *regexp.Regexp
+	commentLine      *regexp.Regexp // A line that starts with a comment
+	leaderBefore     *regexp.Regexp // A comment leader ending the text
+
+	// emptyCommentLine matches a line holding only an empty comment. A lone
+	// "/*" or "*/" is left alone, as it opens or closes a block comment.
+	emptyCommentLine *regexp.Regexp
+	// emptyTrailingComment matches an empty comment following code,
+	// capturing where the code ends
+	emptyTrailingComment *regexp.Regexp
+}
+
+// defaultScanner is the Scanner of the zero ScannerOptions, for a Watcher
+// given none
+var defaultScanner = mustNewScanner(ScannerOptions{})
+
+// NewScanner returns a Scanner configured by opts
+func NewScanner(opts ScannerOptions) (*Scanner, error) {
+	tokens := opts.Tokens
+	if tokens == nil {
+		tokens = supportedMarkers
+	}
+	syntaxes := opts.CommentSyntaxes
+	if syntaxes == nil {
+		syntaxes = defaultCommentSyntaxes
+	}
+	ignore := opts.IgnoreDirective
+	if ignore == "" {
+		ignore = defaultIgnoreDirective
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("no marker tokens")
+	}
+	if len(syntaxes) == 0 {
+		return nil, errors.New("no comment syntaxes")
+	}
+
+	s := &Scanner{}
+	for _, token := range tokens {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			return nil, errors.New("empty marker token")
+		}
+		s.tokens = append(s.tokens, token)
+	}
+	if opts.TodoMarkers {
+		s.todo = make(map[string]bool)
+		for _, token := range todoTokens {
+			s.tokens = append(s.tokens, token)
+			s.todo[token] = true
+		}
+	}
+	alternation := markerAlternation(s.tokens)
+	s.markerPattern = regexp.MustCompile(`(?i)(?:` + alternation + `)`)
+
+	// A tag, if there are any, comes between the token and its arguments
+	tag := ""
+	if len(opts.Tags) > 0 {
+		tags, err := tagAlternation(opts.Tags)
+		if err != nil {
+			return nil, err
+		}
+		tag = `(?:(?:` + tags + `)\b)?`
+		s.tagPattern = regexp.MustCompile(`(?i)(?:` + alternation + `)(` + tags + `)\b`)
+		s.tagAfter = regexp.MustCompile(`(?i)^(?:` + tags + `)(?:$|[\s(])`)
+	}
+	s.trailingPattern = regexp.MustCompile(`(?i)[ \t]*(` + alternation + `)` + tag + `(?:` + argListPattern + `)?[ \t]*$`)
+	s.argsPattern = regexp.MustCompile(`(?i)(?:` + alternation + `)` + tag + `(` + argListPattern + `)`)
+	quotedIgnore := regexp.QuoteMeta(strings.TrimSpace(ignore))
+	s.ignoreRegex = regexp.MustCompile(`(?i)` + quotedIgnore)
+	s.ignoreNextRegex = regexp.MustCompile(`(?i)` + quotedIgnore + `(?:[^\w-]|$)`)
+	s.ignoreStartRegex = regexp.MustCompile(`(?i)` + quotedIgnore + `-start\b`)
+	s.ignoreEndRegex = regexp.MustCompile(`(?i)` + quotedIgnore + `-end\b`)
+	s.ignoreFileRegex = regexp.MustCompile(`(?i)` + quotedIgnore + `-file\b`)
+
+	var leaders, bare, empties, trailing []string
+	for _, syntax := range syntaxes {
+		syntax = strings.TrimSpace(syntax)
+		if syntax == "" {
+			return nil, errors.New("empty comment syntax")
+		}
+		quoted := regexp.QuoteMeta(syntax)
+		leaders = append(leaders, `\s*`+quoted)
+		bare = append(bare, quoted)
+		switch syntax {
+		case "/*":
+			empties = append(empties, `/\*[ \t]*\*/`)
+			trailing = append(trailing, `/\*[ \t]*\*/`)
+		case "*":
+			// Only a line of its own, inside a block comment
+			empties = append(empties, quoted)
+		default:
+			empties = append(empties, `(?:`+quoted+`)+`)
+			trailing = append(trailing, `(?:`+quoted+`)+`)
+		}
+	}
+	// Empty HTML and JSX comments go too, whatever the syntaxes; markers
+	// are only found in them in markup files (see ScanFile)
+	empties = append(empties, markupEmptyComments...)
+	trailing = append(trailing, markupEmptyComments...)
+	s.commentStart = regexp.MustCompile(`(?:` + strings.Join(leaders, "|") + `)`)
+	s.commentLine = regexp.MustCompile(`^(?:` + strings.Join(leaders, "|") + `)`)
+	s.leaderBefore = regexp.MustCompile(`(?i)(?:` + strings.Join(bare, "|") + `)$`)
+	s.emptyCommentLine = regexp.MustCompile(`^[ \t]*(?:` + strings.Join(empties, "|") + `)[ \t]*$`)
+	s.emptyTrailingComment = regexp.MustCompile(`\S()[ \t]+(?:` + strings.Join(trailing, "|") + `)$`)
+
+	if len(opts.FileCommentSyntaxes) > 0 {
+		s.byExtension = make(map[string]*Scanner)
+		for ext, extra := range opts.FileCommentSyntaxes {
+			fileOpts := opts
+			fileOpts.CommentSyntaxes = append(append([]string(nil), syntaxes...), extra...)
+			fileOpts.FileCommentSyntaxes = nil
+			fileScanner, err := NewScanner(fileOpts)
+			if err != nil {
+				return nil, fmt.Errorf("comment syntaxes for %s: %w", ext, err)
+			}
+			s.byExtension[normalizeExtension(ext)] = fileScanner
+		}
+	}
+
+	if len(opts.Namespaces) > 0 {
+		escaped := make([]string, len(opts.Namespaces))
+		for i, name := range opts.Namespaces {
+			if strings.TrimSpace(name) == "" {
+				return nil, errors.New("empty namespace")
+			}
+			escaped[i] = regexp.QuoteMeta(name)
+		}
+		// Longest first, so "fe" doesn't shadow "safe" in "safe-ai!"
+		sort.Slice(escaped, func(i, j int) bool { return len(escaped[i]) > len(escaped[j]) })
+		s.namespacePattern = regexp.MustCompile(`(?i)(?:^|\s)(` + strings.Join(escaped, "|") + `)-(` + alternation + `)`)
+		s.namespaceBefore = regexp.MustCompile(`(?i)(?:^|\s)(?:` + strings.Join(escaped, "|") + `)-$`)
+	}
+	return s, nil
+}
+
+// mustNewScanner is NewScanner for options known to be valid
+func mustNewScanner(opts ScannerOptions) *Scanner {
+	s, err := NewScanner(opts)
+	if err != nil {
+		panic(fmt.Sprintf("claudewatch: %v", err))
+	}
+	return s
+}
+
+// Tokens returns the marker tokens the scanner finds, in lower case
+func (s *Scanner) Tokens() []string {
+	return append([]string(nil), s.tokens...)
+}
+
+// MarkerPattern returns a case-insensitive regex matching any of the
+// scanner's marker tokens
+func (s *Scanner) MarkerPattern() *regexp.Regexp {
+	return s.markerPattern
+}
@@ -0,0 +1,122 @@
+package claudewatch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScannerDefaultsMatchPackageFunctions(t *testing.T) {
+	s, err := NewScanner(ScannerOptions{})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	content := "package p\n// use a map ai!\n# why? ai?\n// ai:reset\n" // ai:ignore
+
+	if got, want := s.Scan(content), defaultScanner.Scan(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan = %+v, want %+v", got, want)
+	}
+	if got, want := s.ScanResets(content), defaultScanner.ScanResets(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanResets = %+v, want %+v", got, want)
+	}
+	if got := s.Tokens(); !reflect.DeepEqual(got, SupportedMarkers()) {
+		t.Errorf("Tokens() = %v, want %v", got, SupportedMarkers())
+	}
+}
+
+func TestScannerCustomOptions(t *testing.T) {
+	s, err := NewScanner(ScannerOptions{
+		Tokens:          []string{"@llm", "@llm?"},
+		CommentSyntaxes: []string{"--"},
+		IgnoreDirective: "llm:skip",
+		Namespaces:      []string{"db"},
+	})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	content := "select 1;\n" +
+		"-- add an index @LLM\n" +
+		"// not a comment here @llm\n" +
+		"-- llm:skip\n" +
+		"-- skipped @llm\n" +
+		"-- is this slow db-@llm?\n" +
+		"# the default ai!\n" // ai:ignore
+
+	markers := s.Scan(content)
+	if len(markers) != 2 {
+		t.Fatalf("Scan = %+v, want 2 markers", markers)
+	}
+	if m := markers[0]; m.LineNumber != 2 || m.Token != "@llm" || m.Type != TypeEdit {
+		t.Errorf("first marker = %+v, want the @llm edit on line 2", m)
+	}
+	if m := markers[1]; m.LineNumber != 6 || m.Token != "@llm?" || m.Type != TypeQuestion || m.Namespace != "db" {
+		t.Errorf("second marker = %+v, want the db question on line 6", m)
+	}
+
+	updated, stripped, err := s.Strip(content)
+	if err != nil {
+		t.Fatalf("Strip: %v", err)
+	}
+	want := "select 1;\n" +
+		"-- add an index\n" +
+		"// not a comment here @llm\n" +
+		"-- llm:skip\n" +
+		"-- skipped @llm\n" +
+		"-- is this slow\n" +
+		"# the default ai!\n" // ai:ignore
+	if updated != want {
+		t.Errorf("Strip content = %q, want %q", updated, want)
+	}
+	if len(stripped) != 2 || stripped[1].LineText != "-- is this slow" || stripped[1].LineNumber != 6 {
+		t.Errorf("Strip markers = %+v", stripped)
+	}
+
+	// The package-level functions keep their defaults
+	if markers := defaultScanner.Scan(content); len(markers) != 1 || markers[0].LineNumber != 7 {
+		t.Errorf("FindMarkers = %+v, want only the ai! on line 7", markers)
+	}
+}
+
+func TestScannerStripWithoutMarkers(t *testing.T) {
+	content := "package p\n"
+	updated, stripped, err := defaultScanner.Strip(content)
+	if updated != content || stripped != nil || err != nil {
+		t.Errorf("Strip = %q, %+v, %v; want the content unchanged", updated, stripped, err)
+	}
+}
+
+func TestNewScannerErrors(t *testing.T) {
+	for _, opts := range []ScannerOptions{
+		{Tokens: []string{}},
+		{Tokens: []string{" "}},
+		{CommentSyntaxes: []string{}},
+		{CommentSyntaxes: []string{"//", ""}},
+		{Namespaces: []string{""}},
+	} {
+		if _, err := NewScanner(opts); err == nil {
+			t.Errorf("NewScanner(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestWatcherScanner(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewScanner(ScannerOptions{Tokens: []string{"@llm"}})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	_, found := startWatcher(t, dir, Options{Scanner: s, Strip: true})
+
+	path := filepath.Join(dir, "f.go")
+	if err := os.WriteFile(path, []byte("package p\n// use a map @llm\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	markers := waitMarkers(t, found)
+	if len(markers) != 1 || markers[0].Token != "@llm" {
+		t.Errorf("markers = %+v, want the @llm marker", markers)
+	}
+	if got := readString(t, path); got != "package p\n// use a map\n" {
+		t.Errorf("file = %q, want the marker stripped", got)
+	}
+}
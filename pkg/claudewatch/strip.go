@@ -0,0 +1,192 @@
+package claudewatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IsEmptyComment reports whether line holds nothing but an empty comment in
+// one of the scanner's comment syntaxes, as a marker line does once
+// StripMarkers has removed its marker
+func (s *Scanner) IsEmptyComment(line string) bool {
+	return s.emptyCommentLine.MatchString(line)
+}
+
+// removeResetDirective removes every ai:reset directive from line, along with
+// the whitespace that follows it
+func removeResetDirective(line string) string {
+	return removeDirective(line, resetRegex)
+}
+
+// removePriorityDirective removes every ai:priority= directive from line,
+// along with the whitespace that follows it
+func removePriorityDirective(line string) string {
+	return removeDirective(line, priorityRegex)
+}
+
+// removeDirective removes every match of directive from line, along with the
+// whitespace that follows it
+func removeDirective(line string, directive *regexp.Regexp) string {
+	folded := foldLine(line)
+	spans := directive.FindAllStringIndex(folded.text, -1)
+	for _, span := range spans {
+		for span[1] < len(folded.text) && isBlank(folded.text[span[1]]) {
+			span[1]++
+		}
+	}
+	return removeFoldedSpans(line, folded, spans)
+}
+
+// Strip removes every marker and ai:reset directive in content, returning
+// the updated content and the markers removed, described as StripMarkers
+// describes them, or StripMarkers' error. Content with no markers comes back
+// unchanged.
+func (s *Scanner) Strip(content string) (string, []Marker, error) {
+	markers := append(s.ScanResets(content), s.Scan(content)...)
+	if len(markers) == 0 {
+		return content, nil, nil
+	}
+	return s.StripMarkers(content, markers)
+}
+
+// StripMarkers removes markers (as found by Scan or ScanResets) from
+// content. It returns the updated content and a copy of markers describing
+// it: LineText has the marker removed and LineNumber is where the line now
+// is. A comment left with nothing but the marker goes away entirely; its
+// marker keeps the empty comment as LineText (see IsEmptyComment) and the
+// number of the line that took its place, or of the last line when nothing
+// came after it. A marker's Comment, if it has one, is updated likewise.
+func (s *Scanner) StripMarkers(content string, markers []Marker) (string, []Marker, error) {
+	lines, ending := SplitLines(content)
+
+	// Create a new slice for the updated markers
+	updatedMarkers := make([]Marker, len(markers))
+	deleted := make(map[int]bool) // Indexes of lines left as empty comments
+	atEnd := make(map[int]bool)   // Markers whose deleted line had no line after it to take its place
+
+	// Process each marker by removing the AI marker text from the line
+	for i, marker := range markers {
+		if marker.LineNumber <= 0 || marker.LineNumber > len(lines) {
+			return "", nil, fmt.Errorf("invalid line number %d for content with %d lines", marker.LineNumber, len(lines))
+		}
+
+		lineIndex := marker.LineNumber - 1
+		line := lines[lineIndex]
+
+		// Find and remove all AI markers (and any namespace prefixes) from
+		// this line, or the directive from a reset
+		var updatedLine string
+		if marker.Type == TypeReset {
+			updatedLine = removeResetDirective(line)
+		} else {
+			updatedLine = removePriorityDirective(s.removeMarkerTokens(s.removeMarkerTags(s.stripNamespacePrefixes(s.removeMarkerArgs(line)))))
+		}
+
+		// A marker at the end of the line leaves trailing whitespace behind;
+		// strip it so we don't write trailing spaces back into the file.
+		updatedLine = strings.TrimRight(updatedLine, " \t")
+
+		// A comment that held nothing but the marker goes away entirely: a
+		// comment line is deleted, a trailing comment after code is dropped
+		if s.emptyCommentLine.MatchString(updatedLine) {
+			deleted[lineIndex] = true
+		} else if loc := s.emptyTrailingComment.FindStringSubmatchIndex(updatedLine); loc != nil {
+			updatedLine = updatedLine[:loc[2]]
+		}
+
+		// Update the line in the content
+		lines[lineIndex] = updatedLine
+
+		// Create updated marker with the AI marker removed from the text
+		updatedMarkers[i] = marker
+		updatedMarkers[i].LineText = updatedLine
+	}
+
+	// Drop the lines left as empty comments, and move each marker up past
+	// the deleted lines above it so its line number matches the content
+	// returned. A deleted marker ends up on the line that took its place, or
+	// the last line if it was at the end.
+	if len(deleted) > 0 {
+		shift := make([]int, len(lines)+1) // Lines deleted above each line, and in all
+		kept := lines[:0]
+		for i, line := range lines {
+			shift[i] = i - len(kept)
+			if !deleted[i] {
+				kept = append(kept, line)
+			}
+		}
+		shift[len(lines)] = len(lines) - len(kept)
+		lines = kept
+		for i := range updatedMarkers {
+			marker := &updatedMarkers[i]
+			marker.LineNumber -= shift[marker.LineNumber-1]
+			if marker.LineNumber > len(lines) {
+				marker.LineNumber = max(len(lines), 1)
+				atEnd[i] = true
+			}
+			if marker.RegionStart > 0 {
+				// The region keeps the lines it had, less any deleted
+				marker.RegionStart -= shift[marker.RegionStart-1]
+				marker.RegionEnd -= shift[marker.RegionEnd]
+				if marker.RegionEnd < marker.RegionStart {
+					marker.RegionStart, marker.RegionEnd = 0, 0
+				}
+			}
+			if marker.CommentStart > 0 {
+				marker.CommentStart -= shift[marker.CommentStart-1]
+			}
+		}
+	}
+
+	// A comment run over several lines reads as it does now, through the
+	// marker's line or, if that went, the line above it
+	for i := range updatedMarkers {
+		marker := &updatedMarkers[i]
+		if marker.CommentStart == 0 {
+			continue
+		}
+		end := marker.LineNumber
+		if deleted[markers[i].LineNumber-1] && !atEnd[i] {
+			end--
+		}
+		marker.Comment = strings.Join(lines[marker.CommentStart-1:end], "\n")
+	}
+	if err := s.checkLineNumbers(lines, updatedMarkers); err != nil {
+		return "", nil, err
+	}
+
+	// Join the lines back into content, keeping the file's line endings
+	updatedContent := ending.Join(lines)
+
+	return updatedContent, updatedMarkers, nil
+}
+
+// checkLineNumbers makes sure every stripped marker that wasn't deleted
+// names the line of lines holding its text, as a prompt built from the
+// markers must match the file Claude reads
+func (s *Scanner) checkLineNumbers(lines []string, markers []Marker) error {
+	for _, marker := range markers {
+		if s.emptyCommentLine.MatchString(marker.LineText) {
+			continue
+		}
+		if marker.LineNumber <= 0 || marker.LineNumber > len(lines) || lines[marker.LineNumber-1] != marker.LineText {
+			return fmt.Errorf("stripped marker %q doesn't match line %d", marker.LineText, marker.LineNumber)
+		}
+	}
+	return nil
+}
+
+// IsTrivialStrip reports whether turning oldLine into newLine only removed
+// one of the scanner's markers from the end of the line, leaving a comment
+// that still says something. Anything else (mid-line markers, comments left
+// empty) deserves a look before it is written.
+func (s *Scanner) IsTrivialStrip(oldLine, newLine string) bool {
+	folded := foldLine(oldLine)
+	loc := s.trailingPattern.FindStringSubmatchIndex(folded.text)
+	if loc == nil || !s.boundedBefore(folded.text, loc[2]) || oldLine[:folded.offsets[loc[0]]] != newLine {
+		return false
+	}
+	remaining := s.commentStart.ReplaceAllString(newLine, "")
+	return strings.TrimSpace(remaining) != ""
+}
@@ -0,0 +1,182 @@
+package claudewatch
+
+import (
+	"testing"
+)
+
+func TestRemoveAIMarkersFromContent(t *testing.T) {
+	// Sample content with AI markers
+	content := `package main
+
+// This is a normal comment
+func foo() {
+    // This should be refactored !ai
+    doSomething()
+
+    // ai! This needs better error handling
+    handleErrors()
+
+    // This should be optimized for performance AI!
+    computeData()
+}
+`
+
+	// Create markers at the lines with AI markers
+	markers := []Marker{
+		{LineNumber: 5, LineText: "    // This should be refactored !ai"},
+		{LineNumber: 8, LineText: "    // ai! This needs better error handling"},
+		{LineNumber: 11, LineText: "    // This should be optimized for performance AI!"},
+	}
+
+	// Expected content after removing markers
+	expectedContent := `package main
+
+// This is a normal comment
+func foo() {
+    // This should be refactored
+    doSomething()
+
+    // This needs better error handling
+    handleErrors()
+
+    // This should be optimized for performance
+    computeData()
+}
+`
+
+	// Expected markers after removal
+	expectedMarkers := []Marker{
+		{LineNumber: 5, LineText: "    // This should be refactored"},
+		{LineNumber: 8, LineText: "    // This needs better error handling"},
+		{LineNumber: 11, LineText: "    // This should be optimized for performance"},
+	}
+
+	// Call the function
+	updatedContent, updatedMarkers, err := defaultScanner.StripMarkers(content, markers)
+
+	// Check for errors
+	if err != nil {
+		t.Errorf("StripMarkers returned error: %v", err)
+	}
+
+	// Check if content was correctly updated
+	if updatedContent != expectedContent {
+		t.Errorf("StripMarkers content update failed.\nGot:\n%s\nExpected:\n%s",
+			updatedContent, expectedContent)
+	}
+
+	// Check if markers were correctly updated
+	for i, marker := range updatedMarkers {
+		if marker.LineNumber != expectedMarkers[i].LineNumber || marker.LineText != expectedMarkers[i].LineText {
+			t.Errorf("Marker %d mismatch.\nGot: %+v\nExpected: %+v", i, marker, expectedMarkers[i])
+		}
+	}
+}
+
+func TestRemoveAIMarkersFromContentWithInvalidLineNumber(t *testing.T) {
+	content := "line1\nline2\nline3"
+
+	// Create a marker with an invalid line number
+	markers := []Marker{
+		{LineNumber: 5, LineText: "This is beyond the content bounds"},
+	}
+
+	// Call the function
+	_, _, err := defaultScanner.StripMarkers(content, markers)
+
+	// We expect an error due to invalid line number
+	if err == nil {
+		t.Error("StripMarkers did not return error for invalid line number")
+	}
+}
+
+func TestRemoveAIMarkersCleansUpEmptyComments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Comment line left empty is deleted", "// Use a map here\n// ai!\nvar m []int", "// Use a map here\nvar m []int"},
+		{"Empty hash comment is deleted", "x = 1\n  # AI!  \ny = 2", "x = 1\ny = 2"},
+		{"Empty block comment is deleted", "a()\n/* ai! */\nb()", "a()\nb()"},
+		{"Block comment opener is kept", "/* ai!\n * details\n */", "/*\n * details\n */"},
+		{"Empty trailing comment is dropped", "x := compute() // ai!", "x := compute()"},
+		{"Trailing comment with text is kept", "x := compute() // cache this ai!", "x := compute() // cache this"},
+		{"Marker between words leaves one space", "# ai! handle\terrors", "# handle\terrors"},
+		{"Marker after a word keeps the space before the next", "// fix ai! now", "// fix now"},
+		{"URL before the comment is untouched", `u := "http://x" // ai!`, `u := "http://x"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, _, err := defaultScanner.StripMarkers(tt.content, defaultScanner.Scan(tt.content))
+			if err != nil {
+				t.Fatalf("StripMarkers: %v", err)
+			}
+			if updated != tt.want {
+				t.Errorf("StripMarkers(%q) = %q, want %q", tt.content, updated, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripMarkersLineNumbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []int // LineNumber of each marker after the strip
+	}{
+		{"Deleted line moves the markers below it up", "a\n// ai!\nb // fix ai!\nc // and ai!\n", []int{2, 2, 3}},
+		{"Adjacent markers", "// one ai!\n// two ai!\n// three ai!\n", []int{1, 2, 3}},
+		{"Adjacent deleted markers", "a\n// ai!\n// AI!\n# ai!\nb // fix ai!\n", []int{2, 2, 2, 2}},
+		{"Last line without a newline", "a\n// ai!\nb\n// fix ai!", []int{2, 3}},
+		{"Deleted last line without a newline", "a\n// fix ai!\n// ai!", []int{2, 2}},
+		{"Deleted last line", "a\nb\n// ai!\n", []int{2}},
+		{"CRLF", "a\r\n// ai!\r\n// fix ai!\r\n", []int{2, 2}},
+		{"Deletions around kept markers", "// ai!\nb // fix ai!\n// ai!\nc // and ai!\n", []int{1, 1, 2, 2}},
+		{"Kept marker after a run of deletions", "a\n// ai!\n# ai!\n// AI!\nb\n// fix ai!\n", []int{2, 2, 2, 3}},
+		{"Two markers on one line", "a\n// ai!\nb // fix ai! and ai!\n", []int{2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers := defaultScanner.Scan(tt.content)
+			updated, updatedMarkers, err := defaultScanner.StripMarkers(tt.content, markers)
+			if err != nil {
+				t.Fatalf("StripMarkers: %v", err)
+			}
+			lines, _ := SplitLines(updated)
+			for i, marker := range updatedMarkers {
+				if marker.LineNumber != tt.want[i] {
+					t.Errorf("marker %d (line %d) moved to line %d, want %d", i, markers[i].LineNumber, marker.LineNumber, tt.want[i])
+				}
+				if !defaultScanner.IsEmptyComment(marker.LineText) && lines[marker.LineNumber-1] != marker.LineText {
+					t.Errorf("marker %d says line %d is %q, but the stripped content has %q", i, marker.LineNumber, marker.LineText, lines[marker.LineNumber-1])
+				}
+			}
+		})
+	}
+}
+
+func TestIsTrivialStrip(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want bool
+	}{
+		{"Marker at end of comment", "    // use a map here ai!", "    // use a map here", true},
+		{"Marker at end with trailing space", "# fix this AI? ", "# fix this", true},
+		{"Marker at start of comment", "// ai! handle errors", "// handle errors", false},
+		{"Comment left empty", "// ai!", "", false},
+		{"Unexpected extra change", "// fix ai!", "// fixed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultScanner.IsTrivialStrip(tt.old, tt.new); got != tt.want {
+				t.Errorf("IsTrivialStrip(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
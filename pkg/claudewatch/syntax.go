@@ -0,0 +1,25 @@
+package claudewatch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ForFile returns the Scanner for the file at path: s, or a copy of it that
+// also recognizes the FileCommentSyntaxes for the file's extension
+func (s *Scanner) ForFile(path string) *Scanner {
+	if fileScanner, ok := s.byExtension[normalizeExtension(filepath.Ext(path))]; ok {
+		return fileScanner
+	}
+	return s
+}
+
+// normalizeExtension lowercases ext and ensures it starts with a dot, so
+// "sql", ".sql" and ".SQL" all name the same extension
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
@@ -0,0 +1,61 @@
+package claudewatch
+
+import "testing"
+
+func TestFileCommentSyntaxes(t *testing.T) {
+	scanner, err := NewScanner(ScannerOptions{FileCommentSyntaxes: map[string][]string{"sql": {"--"}, ".el": {";;"}}})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	sql := "SELECT 1;\n-- use a join ai!\n" // ai:ignore
+
+	if markers := scanner.ScanFile("query.sql", sql); len(markers) != 1 || markers[0].LineNumber != 2 {
+		t.Errorf("ScanFile(query.sql) = %+v, want the marker on line 2", markers)
+	}
+	if markers := scanner.ScanFile("QUERY.SQL", sql); len(markers) != 1 {
+		t.Errorf("ScanFile(QUERY.SQL) = %+v, want the extension matched case-insensitively", markers)
+	}
+	if markers := scanner.ScanFile("notes.txt", sql); len(markers) != 0 {
+		t.Errorf("ScanFile(notes.txt) = %+v, want no markers for another extension", markers)
+	}
+	if markers := scanner.ScanFile("init.el", ";; bind this key ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(init.el) = %+v, want one marker", markers)
+	}
+	if got := scanner.ForFile("main.go"); got != scanner {
+		t.Error("ForFile(main.go) returned a different scanner with no syntaxes for .go")
+	}
+}
+
+func TestFileCommentSyntaxesStrip(t *testing.T) {
+	scanner, err := NewScanner(ScannerOptions{FileCommentSyntaxes: map[string][]string{".sql": {"--"}}})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	content := "SELECT 1;\n-- ai!\nSELECT 2; -- ai!\nSELECT 3; -- use an index ai!\n" // ai:ignore
+	want := "SELECT 1;\nSELECT 2;\nSELECT 3; -- use an index\n"
+	sqlScanner := scanner.ForFile("query.sql")
+	got, _, err := sqlScanner.StripMarkers(content, sqlScanner.ScanFile("query.sql", content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if got != want {
+		t.Errorf("StripMarkers() = %q, want %q", got, want)
+	}
+}
+
+func TestCommentSyntaxes(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{
+		CommentSyntaxes:     []string{"//", "#", "/*", "*", "%"},
+		FileCommentSyntaxes: map[string][]string{".lua": {"--"}},
+	})
+
+	if markers := s.ScanFile("server.erl", "% handle timeouts ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(server.erl) = %+v, want the %% marker found in every file", markers)
+	}
+	if markers := s.ScanFile("init.lua", "-- cache this ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(init.lua) = %+v, want one marker", markers)
+	}
+	if markers := s.ScanFile("main.go", "// still found ai!\n"); len(markers) != 1 { // ai:ignore
+		t.Errorf("ScanFile(main.go) = %+v, want the other syntaxes kept", markers)
+	}
+}
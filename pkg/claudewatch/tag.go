@@ -0,0 +1,61 @@
+package claudewatch
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validTag matches the tags ScannerOptions.Tags accepts: a word, so it can't
+// run on into the text after it unnoticed
+var validTag = regexp.MustCompile(`^\w+$`)
+
+// tagAlternation returns tags as an escaped regex alternation, longest first
+// so "doc" doesn't shadow "docs"
+func tagAlternation(tags []string) (string, error) {
+	escaped := make([]string, len(tags))
+	for i, tag := range tags {
+		if !validTag.MatchString(tag) {
+			return "", fmt.Errorf("tag %q is not a single word", tag)
+		}
+		escaped[i] = regexp.QuoteMeta(strings.ToLower(tag))
+	}
+	sort.SliceStable(escaped, func(i, j int) bool { return len(escaped[i]) > len(escaped[j]) })
+	return strings.Join(escaped, "|"), nil
+}
+
+// markerTag returns the tag following the first marker token on line,
+// lowercased, or an empty string if it has none
+func (s *Scanner) markerTag(line string) string {
+	if s.tagPattern == nil {
+		return ""
+	}
+	text := foldLine(line).text
+	for _, sub := range s.tagPattern.FindAllStringSubmatchIndex(text, -1) {
+		if s.boundedBefore(text, sub[0]) {
+			return text[sub[2]:sub[3]]
+		}
+	}
+	return ""
+}
+
+// removeMarkerTags removes the tags following marker tokens, leaving the bare
+// token for the normal removal to strip
+func (s *Scanner) removeMarkerTags(line string) string {
+	if s.tagPattern == nil {
+		return line
+	}
+	folded := foldLine(line)
+	var spans [][]int
+	for _, sub := range s.tagPattern.FindAllStringSubmatchIndex(folded.text, -1) {
+		if !s.boundedBefore(folded.text, sub[0]) {
+			continue
+		}
+		spans = append(spans, []int{sub[2], sub[3]})
+	}
+	if spans == nil {
+		return line
+	}
+	return removeFoldedSpans(line, folded, spans)
+}
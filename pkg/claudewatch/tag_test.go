@@ -0,0 +1,52 @@
+package claudewatch
+
+import "testing"
+
+func TestMarkerTags(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Tags: []string{"test", "doc", "docs"}})
+
+	tests := []struct {
+		line string
+		tag  string
+		typ  string
+	}{
+		{"// cover the error path ai!test", "test", TypeEdit},
+		{"// explain the return values AI!Docs", "docs", TypeEdit},
+		{"// what does this cover? ai?test", "test", TypeQuestion},
+		{"# tighten this ai!doc(model=opus)", "doc", TypeEdit},
+		{"// untagged ai!", "", TypeEdit},
+	}
+	for _, tt := range tests {
+		markers := s.Scan(tt.line)
+		if len(markers) != 1 {
+			t.Fatalf("Scan(%q) found %d markers, want 1", tt.line, len(markers))
+		}
+		if markers[0].Tag != tt.tag || markers[0].Type != tt.typ {
+			t.Errorf("Scan(%q) = tag %q %s, want tag %q %s", tt.line, markers[0].Tag, markers[0].Type, tt.tag, tt.typ)
+		}
+	}
+}
+
+func TestStripMarkerTags(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{Tags: []string{"test"}})
+	content := "// cover the error path ai!test\n// ai!test(model=opus)\nx := 1 // and this one ai!test\n" // ai:ignore
+	updated, stripped, err := s.StripMarkers(content, s.Scan(content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "// cover the error path\nx := 1 // and this one\n"; updated != want {
+		t.Errorf("StripMarkers() = %q, want %q", updated, want)
+	}
+	if stripped[1].Args["model"] != "opus" {
+		t.Errorf("stripped marker = %+v, want its arguments kept", stripped[1])
+	}
+	if !s.IsTrivialStrip("// cover the error path ai!test", "// cover the error path") {
+		t.Error("removing a trailing tagged marker isn't trivial")
+	}
+}
+
+func TestNewScannerRejectsNonWordTags(t *testing.T) {
+	if _, err := NewScanner(ScannerOptions{Tags: []string{"two words"}}); err == nil {
+		t.Error("NewScanner() accepted a tag with a space")
+	}
+}
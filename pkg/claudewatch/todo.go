@@ -0,0 +1,10 @@
+package claudewatch
+
+// todoTokens are the TODO-style markers found with ScannerOptions.TodoMarkers
+var todoTokens = []string{"todo(ai):", "fixme(ai):"}
+
+// IsEdit reports whether markers of markerType ask for code to be changed:
+// edit and TODO markers do, questions and resets don't
+func IsEdit(markerType string) bool {
+	return markerType == TypeEdit || markerType == TypeTodo
+}
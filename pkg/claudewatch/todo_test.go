@@ -0,0 +1,53 @@
+package claudewatch
+
+import "testing"
+
+func TestFindTodoMarkers(t *testing.T) {
+	content := "package a\n// TODO(ai): use a map\n# fixme(AI): handle EOF\n// TODO: not for claudewatch\n// ai:ignore\n// TODO(ai): not this one\n// plain ai!\n" // ai:ignore
+
+	if markers := defaultScanner.Scan(content); len(markers) != 1 || markers[0].Type != TypeEdit {
+		t.Fatalf("Scan() without TODO markers = %+v, want only the ai! marker", markers)
+	}
+
+	markers := mustNewScanner(ScannerOptions{TodoMarkers: true}).Scan(content)
+	want := []struct {
+		line  int
+		token string
+		typ   string
+	}{
+		{2, "todo(ai):", TypeTodo},
+		{3, "fixme(ai):", TypeTodo},
+		{7, "ai!", TypeEdit},
+	}
+	if len(markers) != len(want) {
+		t.Fatalf("Scan() = %+v, want %d markers", markers, len(want))
+	}
+	for i, w := range want {
+		if markers[i].LineNumber != w.line || markers[i].Token != w.token || markers[i].Type != w.typ {
+			t.Errorf("marker %d = line %d %q %s, want line %d %q %s", i, markers[i].LineNumber, markers[i].Token, markers[i].Type, w.line, w.token, w.typ)
+		}
+	}
+}
+
+func TestStripTodoMarkers(t *testing.T) {
+	s := mustNewScanner(ScannerOptions{TodoMarkers: true})
+	content := "x := 1 // TODO(ai): use a constant\n// FIXME(ai):\ny := 2\n" // ai:ignore
+	updated, stripped, err := s.StripMarkers(content, s.Scan(content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "x := 1 // use a constant\ny := 2\n"; updated != want {
+		t.Errorf("StripMarkers() = %q, want %q", updated, want)
+	}
+	if len(stripped) != 2 || stripped[0].LineText != "x := 1 // use a constant" {
+		t.Errorf("stripped markers = %+v", stripped)
+	}
+}
+
+func TestIsEdit(t *testing.T) {
+	for markerType, want := range map[string]bool{TypeEdit: true, TypeTodo: true, TypeQuestion: false, TypeReset: false} {
+		if got := IsEdit(markerType); got != want {
+			t.Errorf("IsEdit(%q) = %v, want %v", markerType, got, want)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package claudewatch
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a file must go without changing before a
+// Watcher scans it, unless Options.Debounce says otherwise. Atomic-save
+// editors write a temp file and rename it over the target within a few
+// milliseconds; waiting lets the save settle so only the result is scanned.
+const DefaultDebounce = 100 * time.Millisecond
+
+// DefaultMaxFileSize is the size above which a Watcher doesn't scan files,
+// unless Options.MaxFileSize says otherwise
+const DefaultMaxFileSize = 1 << 20
+
+// Options configure a Watcher. The zero value scans with the defaults and
+// leaves the markers in the files.
+type Options struct {
+	// Debounce is how long a file must go unchanged before it is scanned;
+	// 0 uses DefaultDebounce
+	Debounce time.Duration
+	// MaxFileSize is the size in bytes above which files are skipped; 0 uses
+	// DefaultMaxFileSize and a negative size means no limit
+	MaxFileSize int64
+	// Strip removes the markers from a file before its callbacks are called,
+	// as the claudewatch command does, so the same markers aren't reported
+	// again on the next save
+	Strip bool
+	// Ignore, if set, is called for every file and directory under the roots;
+	// returning true skips it (and everything under a directory). Hidden and
+	// editor temp files are always skipped.
+	Ignore func(path string, isDir bool) bool
+	// Scanner, if set, finds and strips the markers; nil uses a Scanner of
+	// the zero ScannerOptions
+	Scanner *Scanner
+	// OnError, if set, is called with errors met while watching, such as a
+	// directory that can't be watched or a file that can't be stripped
+	OnError func(err error)
+}
+
+// Watcher watches directory trees for files with AI markers, calling its
+// OnMarkers callbacks with each file's markers. It is the detection engine
+// of the claudewatch command without the Claude session, so programs can
+// dispatch the markers wherever they like.
+type Watcher struct {
+	roots []string
+	opts  Options
+
+	mu        sync.Mutex
+	callbacks []func(file string, markers []Marker)
+	fsw       *fsnotify.Watcher
+	pending   map[string]*time.Timer // Debounce timers of changed files
+	held      map[string]bool        // Files changed while paused
+	paused    bool
+	stopped   bool
+
+	ready chan string   // Files whose debounce has run out
+	done  chan struct{} // Closed by Stop
+	wg    sync.WaitGroup
+}
+
+// NewWatcher returns a Watcher for the directory trees at roots. Nothing is
+// watched until Start is called.
+func NewWatcher(opts Options, roots ...string) *Watcher {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = DefaultMaxFileSize
+	}
+	return &Watcher{
+		roots:   roots,
+		opts:    opts,
+		pending: make(map[string]*time.Timer),
+		held:    make(map[string]bool),
+		ready:   make(chan string, 64),
+		done:    make(chan struct{}),
+	}
+}
+
+// OnMarkers adds a callback, called with the path of each changed file that
+// has markers and the markers as they were found, before any stripping. An
+// ai:reset directive in the file comes first, as a marker of type TypeReset.
+// Callbacks are called one at a time, in the order they were added.
+func (w *Watcher) OnMarkers(fn func(file string, markers []Marker)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// Start begins watching the roots. Files already holding markers aren't
+// reported until they change. A Watcher can only be started once.
+func (w *Watcher) Start() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fsw != nil || w.stopped {
+		return fmt.Errorf("watcher already started")
+	}
+	if len(w.roots) == 0 {
+		return fmt.Errorf("no directories to watch")
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, root := range w.roots {
+		if err := w.watchTree(fsw, root, false); err != nil {
+			fsw.Close()
+			return err
+		}
+	}
+	w.fsw = fsw
+
+	w.wg.Add(2)
+	go w.watchEvents(fsw)
+	go w.scanReady()
+	return nil
+}
+
+// Stop stops watching and waits for any callback in progress to return.
+// Changes that were still settling, or held while paused, are dropped.
+func (w *Watcher) Stop() error {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return nil
+	}
+	w.stopped = true
+	for path, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, path)
+	}
+	fsw := w.fsw
+	w.mu.Unlock()
+
+	close(w.done)
+	var err error
+	if fsw != nil {
+		err = fsw.Close()
+	}
+	w.wg.Wait()
+	return err
+}
+
+// Pause stops reporting markers. Files changed while paused are scanned once
+// Resume is called.
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = true
+}
+
+// Resume reports markers again, starting with the files changed while paused
+func (w *Watcher) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return
+	}
+	w.paused = false
+	for path := range w.held {
+		delete(w.held, path)
+		w.scheduleLocked(path)
+	}
+}
+
+// Paused reports whether the Watcher is paused
+func (w *Watcher) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+// ignored reports whether path is skipped: it is hidden or an editor temp
+// file, or Options.Ignore says so
+func (w *Watcher) ignored(path string, isDir bool) bool {
+	if IsHiddenOrSpecialFile(path) {
+		return true
+	}
+	return w.opts.Ignore != nil && w.opts.Ignore(path, isDir)
+}
+
+// watchTree adds dir and the directories under it to fsw. With scan, files
+// found along the way are scanned, as they may have been written before the
+// directory was watched.
+func (w *Watcher) watchTree(fsw *fsnotify.Watcher, dir string, scan bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The root must be watchable; anything below it is reported and skipped
+			if path == dir {
+				return err
+			}
+			w.reportError(err)
+			return nil
+		}
+		if path != dir && w.ignored(path, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if err := fsw.Add(path); err != nil {
+				if path == dir {
+					return err
+				}
+				w.reportError(fmt.Errorf("watching %s: %w", path, err))
+			}
+			return nil
+		}
+		if scan && entry.Type().IsRegular() {
+			w.schedule(path)
+		}
+		return nil
+	})
+}
+
+// watchEvents turns file system events into scans until the Watcher stops
+func (w *Watcher) watchEvents(fsw *fsnotify.Watcher) {
+	defer w.wg.Done()
+	for {
+		select {
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(fsw, event)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			w.reportError(err)
+		}
+	}
+}
+
+// handleEvent schedules a scan of a written file, and watches new directories
+func (w *Watcher) handleEvent(fsw *fsnotify.Watcher, event fsnotify.Event) {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+		return
+	}
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if w.ignored(event.Name, info.IsDir()) {
+		return
+	}
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) {
+			if err := w.watchTree(fsw, event.Name, true); err != nil {
+				w.reportError(fmt.Errorf("watching %s: %w", event.Name, err))
+			}
+		}
+		return
+	}
+	if info.Mode().IsRegular() {
+		w.schedule(event.Name)
+	}
+}
+
+// schedule (re)starts the debounce timer for path
+func (w *Watcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.scheduleLocked(path)
+}
+
+// scheduleLocked is schedule with w.mu held
+func (w *Watcher) scheduleLocked(path string) {
+	if w.stopped {
+		return
+	}
+	if timer, ok := w.pending[path]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(w.opts.Debounce, func() {
+		w.mu.Lock()
+		current := w.pending[path] == timer
+		if current {
+			delete(w.pending, path)
+		}
+		w.mu.Unlock()
+		if !current {
+			return
+		}
+		select {
+		case w.ready <- path:
+		case <-w.done:
+		}
+	})
+	w.pending[path] = timer
+}
+
+// scanReady scans files as their debounce runs out, until the Watcher stops
+func (w *Watcher) scanReady() {
+	defer w.wg.Done()
+	for {
+		select {
+		case path := <-w.ready:
+			w.scan(path)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// scan looks for markers in path, strips them if asked to, and calls the
+// callbacks. A file changed while paused is held until Resume.
+func (w *Watcher) scan(path string) {
+	w.mu.Lock()
+	if w.paused {
+		w.held[path] = true
+		w.mu.Unlock()
+		return
+	}
+	callbacks := append([]func(string, []Marker){}, w.callbacks...)
+	w.mu.Unlock()
+
+	maxSize := w.opts.MaxFileSize
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	content, skip, err := ReadScannable(path, maxSize)
+	if err != nil || skip != "" {
+		return
+	}
+	scanner := w.opts.Scanner
+	if scanner == nil {
+		scanner = defaultScanner
+	}
+	markers := append(scanner.ForFile(path).ScanResets(string(content)), scanner.ScanFile(path, string(content))...)
+	if len(markers) == 0 {
+		return
+	}
+
+	if w.opts.Strip {
+		updated, _, err := scanner.ForFile(path).StripMarkers(string(content), markers)
+		if err == nil {
+			err = WriteFileAtomic(path, []byte(updated), 0o644)
+		}
+		if err != nil {
+			w.reportError(fmt.Errorf("stripping markers from %s: %w", path, err))
+			return
+		}
+	}
+
+	for _, fn := range callbacks {
+		fn(path, markers)
+	}
+}
+
+// reportError passes err to Options.OnError, if set
+func (w *Watcher) reportError(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
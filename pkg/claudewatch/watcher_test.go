@@ -0,0 +1,153 @@
+package claudewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startWatcher starts a Watcher on dir that sends each callback's file and
+// markers to the returned channel
+func startWatcher(t *testing.T, dir string, opts Options) (*Watcher, <-chan []Marker) {
+	t.Helper()
+	if opts.Debounce == 0 {
+		opts.Debounce = 20 * time.Millisecond
+	}
+	w := NewWatcher(opts, dir)
+	found := make(chan []Marker, 10)
+	w.OnMarkers(func(file string, markers []Marker) { found <- markers })
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { w.Stop() })
+	return w, found
+}
+
+func waitMarkers(t *testing.T, found <-chan []Marker) []Marker {
+	t.Helper()
+	select {
+	case markers := <-found:
+		return markers
+	case <-time.After(5 * time.Second):
+		t.Fatal("no markers reported")
+		return nil
+	}
+}
+
+func expectNone(t *testing.T, found <-chan []Marker, why string) {
+	t.Helper()
+	select {
+	case markers := <-found:
+		t.Fatalf("markers reported %s: %+v", why, markers)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatcherReportsMarkers(t *testing.T) {
+	dir := t.TempDir()
+	_, found := startWatcher(t, dir, Options{})
+
+	path := filepath.Join(dir, "f.go")
+	if err := os.WriteFile(path, []byte("package p\n// use a map ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	markers := waitMarkers(t, found)
+	if len(markers) != 1 || markers[0].LineNumber != 2 || markers[0].Type != TypeEdit {
+		t.Errorf("markers = %+v, want the edit on line 2", markers)
+	}
+	if got := readString(t, path); got != "package p\n// use a map ai!\n" {
+		t.Errorf("file changed to %q without Strip", got)
+	}
+
+	// Hidden files are skipped
+	if err := os.WriteFile(filepath.Join(dir, ".f.go"), []byte("// ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	expectNone(t, found, "for a hidden file")
+}
+
+func TestWatcherStrip(t *testing.T) {
+	dir := t.TempDir()
+	_, found := startWatcher(t, dir, Options{Strip: true})
+
+	path := filepath.Join(dir, "f.py")
+	if err := os.WriteFile(path, []byte("x = 1  # why? ai?\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	markers := waitMarkers(t, found)
+	if len(markers) != 1 || markers[0].LineText != "x = 1  # why? ai?" {
+		t.Errorf("markers = %+v, want the marker as found", markers)
+	}
+	if got := readString(t, path); got != "x = 1  # why?\n" {
+		t.Errorf("stripped file = %q", got)
+	}
+	// The rewrite doesn't report anything further
+	expectNone(t, found, "after stripping")
+}
+
+func TestWatcherNewDirectory(t *testing.T) {
+	dir := t.TempDir()
+	_, found := startWatcher(t, dir, Options{
+		Ignore: func(path string, isDir bool) bool { return isDir && filepath.Base(path) == "vendor" },
+	})
+
+	// A file written straight after its directory is created is still found
+	sub := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "f.go"), []byte("// ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	waitMarkers(t, found)
+
+	vendor := filepath.Join(dir, "vendor")
+	if err := os.Mkdir(vendor, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vendor, "f.go"), []byte("// ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	expectNone(t, found, "in an ignored directory")
+}
+
+func TestWatcherPauseAndResume(t *testing.T) {
+	dir := t.TempDir()
+	w, found := startWatcher(t, dir, Options{})
+
+	w.Pause()
+	if !w.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "f.go"), []byte("// ai!\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	expectNone(t, found, "while paused")
+
+	w.Resume()
+	waitMarkers(t, found)
+}
+
+func TestWatcherLifecycle(t *testing.T) {
+	if err := NewWatcher(Options{}).Start(); err == nil {
+		t.Error("Start() with no roots succeeded")
+	}
+	if err := NewWatcher(Options{}, filepath.Join(t.TempDir(), "missing")).Start(); err == nil {
+		t.Error("Start() on a missing directory succeeded")
+	}
+
+	w := NewWatcher(Options{}, t.TempDir())
+	if err := w.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := w.Start(); err == nil {
+		t.Error("second Start() succeeded")
+	}
+	if err := w.Stop(); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+	if err := w.Stop(); err != nil {
+		t.Errorf("second Stop: %v", err)
+	}
+}
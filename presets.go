@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// builtinPresets are the prompt templates selectable with --preset. Presets
+// defined in the config file take precedence over these.
+var builtinPresets = map[string]string{
+	"strict-single-file": `Modify {{.File}}. Address the feedback in the following comments:
+
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{end}}
+Only modify {{.File}}. Do not create, modify, or delete any other file for any reason. If the feedback cannot be fully addressed within this file, make no changes, explain why, and wait for further instruction.
+
+Once your editing task is complete, stop and await instruction.`,
+
+	"explain-only": `Read {{.File}} and respond to the following comments:
+
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{end}}
+Do not modify any files. Explain the relevant code, answer any questions, and describe the changes you would recommend, then stop and await instruction.`,
+
+	"test-first": `Modify {{.File}}. Address the feedback in the following comments:
+
+{{range .Markers}}{{if .Comment}}Lines {{.CommentStart}}-{{.CommentEnd}}:
+{{.Comment}}{{else}}Line {{.LineNumber}}: {{.LineText}}{{end}}
+{{end}}
+Work test-first: before changing the implementation, write or update a test that captures the requested behavior and confirm that it fails. Then make the smallest change to {{.File}} that makes the test pass, and run the tests again. You may modify the corresponding test file; if any other file would need to change, stop, explain your reasoning, and wait for further instruction.
+
+Once your editing task is complete, stop and await instruction.`,
+}
+
+// presetNames returns the names of all available presets, sorted
+func presetNames(userPresets map[string]string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, presets := range []map[string]string{builtinPresets, userPresets} {
+		for name := range presets {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadPreset returns the parsed template for the named preset, preferring a
+// user-defined preset over a built-in one of the same name
+func loadPreset(name string, userPresets map[string]string) (*template.Template, error) {
+	text, ok := userPresets[name]
+	if !ok {
+		text, ok = builtinPresets[name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(presetNames(userPresets), ", "))
+	}
+
+	tmpl, err := parsePromptTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("preset %q: %w", name, err)
+	}
+	return tmpl, nil
+}
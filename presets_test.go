@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinPresetsParseAndRender(t *testing.T) {
+	for _, name := range presetNames(nil) {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := loadPreset(name, nil)
+			if err != nil {
+				t.Fatalf("loadPreset(%q): %v", name, err)
+			}
+			got := render(t, tmpl, "/repo/main.go")
+			if !strings.Contains(got, "/repo/main.go") || !strings.Contains(got, "Line 1: // fix") {
+				t.Errorf("preset %q rendered without the file or markers:\n%s", name, got)
+			}
+		})
+	}
+}
+
+func TestLoadPresetPrefersUserPreset(t *testing.T) {
+	user := map[string]string{
+		"explain-only": "custom: {{.File}}",
+		"mine":         "mine: {{.File}}",
+	}
+
+	tmpl, err := loadPreset("explain-only", user)
+	if err != nil {
+		t.Fatalf("loadPreset: %v", err)
+	}
+	if got := render(t, tmpl, "f.go"); got != "custom: f.go" {
+		t.Errorf("explain-only rendered %q, want the user-defined override", got)
+	}
+
+	if _, err := loadPreset("mine", user); err != nil {
+		t.Errorf("loadPreset(mine): %v", err)
+	}
+}
+
+func TestLoadPresetUnknownListsAvailable(t *testing.T) {
+	_, err := loadPreset("nope", map[string]string{"mine": "x"})
+	if err == nil {
+		t.Fatal("loadPreset(nope) error = nil")
+	}
+	for _, name := range []string{"mine", "strict-single-file", "explain-only", "test-first"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not list preset %q", err, name)
+		}
+	}
+}
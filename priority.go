@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// priority orders prompts waiting to be dispatched: higher goes first, and
+// prompts of equal priority go in the order they were rendered
+type priority int
+
+// Priority levels, as named in the config file and ai:priority= directives
+const (
+	priorityLow    priority = -1
+	priorityNormal priority = 0
+	priorityHigh   priority = 1
+)
+
+// priorityNames maps each level's name to its value
+var priorityNames = map[string]priority{
+	"low":    priorityLow,
+	"normal": priorityNormal,
+	"high":   priorityHigh,
+}
+
+func (p priority) String() string {
+	for name, level := range priorityNames {
+		if level == p {
+			return name
+		}
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// parsePriority looks up a priority level by name
+func parsePriority(name string) (priority, error) {
+	level, ok := priorityNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return priorityNormal, fmt.Errorf("unknown priority %q (want high, normal or low)", name)
+	}
+	return level, nil
+}
+
+// PriorityRule assigns a default priority to the markers in matching files
+type PriorityRule struct {
+	// Path is a directory ending in "/" (e.g. "hotfix/"), matching every file
+	// under it, or a glob matched against the path relative to the watched
+	// root. A glob without a "/" (e.g. "*.md") is also matched against the
+	// file name alone.
+	Path     string `json:"path"`
+	Priority string `json:"priority"` // "high", "normal" or "low"
+}
+
+// priorityRule is a PriorityRule with its level parsed
+type priorityRule struct {
+	path  string
+	level priority
+}
+
+// compilePriorityRules checks the priority rules from the config file
+func compilePriorityRules(fileConfig *FileConfig) ([]priorityRule, error) {
+	if fileConfig == nil {
+		return nil, nil
+	}
+	var rules []priorityRule
+	for i, rule := range fileConfig.Priorities {
+		pattern := filepath.ToSlash(strings.TrimSpace(rule.Path))
+		if pattern == "" {
+			return nil, fmt.Errorf("priorities[%d]: path is empty", i)
+		}
+		if _, err := filepath.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("priorities[%d]: bad path %q: %w", i, rule.Path, err)
+		}
+		level, err := parsePriority(rule.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("priorities[%d]: %w", i, err)
+		}
+		rules = append(rules, priorityRule{path: pattern, level: level})
+	}
+	return rules, nil
+}
+
+// matches reports whether the rule applies to rel, a slash-separated path
+// relative to a watched root
+func (r priorityRule) matches(rel string) bool {
+	if dir, ok := strings.CutSuffix(r.path, "/"); ok {
+		// A glob can't match across a "/", so compare as many leading
+		// directories as the rule names
+		parts := strings.Split(rel, "/")
+		depth := strings.Count(dir, "/") + 1
+		if len(parts) <= depth {
+			return false
+		}
+		matched, _ := filepath.Match(dir, strings.Join(parts[:depth], "/"))
+		return matched
+	}
+	if matched, _ := filepath.Match(r.path, rel); matched {
+		return true
+	}
+	if !strings.Contains(r.path, "/") {
+		matched, _ := filepath.Match(r.path, filepath.Base(rel))
+		return matched
+	}
+	return false
+}
+
+// pathPriority returns the priority of the first rule matching path, tried
+// relative to each watched root it lies in, or priorityNormal if none do
+func pathPriority(config *Config, path string) priority {
+	if len(config.PriorityRules) == 0 {
+		return priorityNormal
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return priorityNormal
+	}
+	for _, rule := range config.PriorityRules {
+		for _, root := range config.RootDirectories {
+			rel := relativeTo(absOrSelf(root), abs)
+			if filepath.IsAbs(rel) {
+				continue
+			}
+			if rule.matches(filepath.ToSlash(rel)) {
+				return rule.level
+			}
+		}
+	}
+	return priorityNormal
+}
+
+// absOrSelf returns the absolute form of path, or path itself if it can't be made absolute
+func absOrSelf(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// groupPriority returns the priority of a prompt for markers in path. The
+// highest ai:priority= override among the markers wins; without one, the
+// file's path rules decide.
+func groupPriority(config *Config, path string, markers []claudewatch.Marker) priority {
+	level, overridden := priorityLow, false
+	for _, marker := range markers {
+		if marker.Priority == "" {
+			continue
+		}
+		if named := priorityNames[marker.Priority]; !overridden || named > level {
+			level, overridden = named, true
+		}
+	}
+	if overridden {
+		return level
+	}
+	return pathPriority(config, path)
+}
+
+// promptQueue holds prompts waiting to be delivered, highest priority first
+type promptQueue []promptRequest
+
+// push adds req behind every queued prompt of the same or higher priority
+func (q *promptQueue) push(req promptRequest) {
+	i := sort.Search(len(*q), func(i int) bool { return (*q)[i].Priority < req.Priority })
+	*q = append(*q, promptRequest{})
+	copy((*q)[i+1:], (*q)[i:])
+	(*q)[i] = req
+}
+
+// pop removes and returns the first prompt in the queue
+func (q *promptQueue) pop() (promptRequest, bool) {
+	if len(*q) == 0 {
+		return promptRequest{}, false
+	}
+	req := (*q)[0]
+	*q = (*q)[1:]
+	return req, true
+}
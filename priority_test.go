@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestPriorityRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"hotfix/", "hotfix/a.go", true},
+		{"hotfix/", "hotfix/deep/b.go", true},
+		{"hotfix/", "hotfix", false},
+		{"hotfix/", "src/hotfix/a.go", false},
+		{"services/*/", "services/api/main.go", true},
+		{"services/*/", "services/main.go", false},
+		{"docs/*.md", "docs/guide.md", true},
+		{"docs/*.md", "docs/api/guide.md", false},
+		{"*.md", "docs/api/guide.md", true},
+		{"*_test.go", "pkg/a_test.go", true},
+	}
+
+	for _, tt := range tests {
+		rule := priorityRule{path: tt.pattern}
+		if got := rule.matches(tt.rel); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePriorityRules(t *testing.T) {
+	rules, err := compilePriorityRules(&FileConfig{Priorities: []PriorityRule{
+		{Path: "hotfix/", Priority: "high"},
+		{Path: "docs/", Priority: "Low"},
+	}})
+	if err != nil {
+		t.Fatalf("compilePriorityRules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].level != priorityHigh || rules[1].level != priorityLow {
+		t.Errorf("rules = %+v, want hotfix/ high and docs/ low", rules)
+	}
+
+	for _, bad := range []PriorityRule{
+		{Path: "docs/", Priority: "urgent"},
+		{Path: "", Priority: "high"},
+		{Path: "[docs/", Priority: "high"},
+	} {
+		if _, err := compilePriorityRules(&FileConfig{Priorities: []PriorityRule{bad}}); err == nil {
+			t.Errorf("compilePriorityRules(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPathPriority(t *testing.T) {
+	root := t.TempDir()
+	config := &Config{
+		RootDirectories: []string{root},
+		PriorityRules: []priorityRule{
+			{path: "hotfix/", level: priorityHigh},
+			{path: "docs/", level: priorityLow},
+			{path: "*.md", level: priorityHigh},
+		},
+	}
+
+	tests := map[string]priority{
+		"hotfix/fix.go":  priorityHigh,
+		"docs/guide.md":  priorityLow, // The first matching rule wins
+		"README.md":      priorityHigh,
+		"src/main.go":    priorityNormal,
+		"../elsewhere.c": priorityNormal,
+	}
+	for rel, want := range tests {
+		if got := pathPriority(config, filepath.Join(root, rel)); got != want {
+			t.Errorf("pathPriority(%s) = %s, want %s", rel, got, want)
+		}
+	}
+}
+
+func TestMarkerPriorityDirective(t *testing.T) {
+	content := "// fix this ai! ai:priority=high\n// and this AI:PRIORITY=Low ai!\n// then this ai!\n"
+	markers := defaultMarkerScanner.Scan(content)
+	if len(markers) != 3 {
+		t.Fatalf("found %d markers, want 3", len(markers))
+	}
+	for i, want := range []string{"high", "low", ""} {
+		if markers[i].Priority != want {
+			t.Errorf("marker %d Priority = %q, want %q", i+1, markers[i].Priority, want)
+		}
+	}
+
+	updated, _, err := defaultMarkerScanner.StripMarkers(content, markers)
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "// fix this\n// and this\n// then this\n"; updated != want {
+		t.Errorf("updated = %q, want %q", updated, want)
+	}
+}
+
+func TestGroupPriority(t *testing.T) {
+	config := &Config{
+		RootDirectories: []string{"/repo"},
+		PriorityRules:   []priorityRule{{path: "docs/", level: priorityLow}},
+	}
+	plain := claudewatch.Marker{}
+	high := claudewatch.Marker{Priority: "high"}
+	normal := claudewatch.Marker{Priority: "normal"}
+
+	if got := groupPriority(config, "/repo/docs/a.md", []claudewatch.Marker{plain}); got != priorityLow {
+		t.Errorf("without overrides = %s, want the path's low", got)
+	}
+	if got := groupPriority(config, "/repo/docs/a.md", []claudewatch.Marker{plain, normal}); got != priorityNormal {
+		t.Errorf("with a normal override = %s, want normal", got)
+	}
+	if got := groupPriority(config, "/repo/docs/a.md", []claudewatch.Marker{normal, high}); got != priorityHigh {
+		t.Errorf("with normal and high overrides = %s, want high", got)
+	}
+}
+
+func TestDispatcherDeliversByPriority(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+
+	d.togglePause()
+	for _, req := range []promptRequest{
+		{Prompt: "docs", Priority: priorityLow},
+		{Prompt: "one"},
+		{Prompt: "hotfix", Priority: priorityHigh},
+		{Prompt: "two"},
+		{Prompt: "urgent", Priority: priorityHigh},
+	} {
+		_ = d.submit(req)
+	}
+	d.togglePause()
+
+	if got, want := strings.Join(primary.prompts, ","), "hotfix,urgent,one,two,docs"; got != want {
+		t.Errorf("delivered %q, want %q", got, want)
+	}
+}
+
+func TestProcessQueuesAtPathPriority(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "hotfix", "a.go")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("// ai:reset\n// fix this ai!\n// why? ai? ai:priority=low\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	config := &Config{
+		RootDirectories: []string{root},
+		PriorityRules:   []priorityRule{{path: "hotfix/", level: priorityHigh}},
+	}
+	prompts := make(chan promptRequest, 3)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.Type}}")), nil, nil)
+	resolver.byMarkerType = map[string]*template.Template{claudewatch.TypeQuestion: template.Must(parsePromptTemplate("{{.Type}}"))}
+	p := newFileProcessor(config, resolver, prompts)
+
+	p.process(path)
+	if len(prompts) != 3 {
+		t.Fatalf("queued %d requests, want a reset and two prompts", len(prompts))
+	}
+	for _, want := range []struct {
+		prompt string
+		level  priority
+	}{
+		{clearCommand, priorityHigh},
+		{claudewatch.TypeEdit, priorityHigh},
+		{claudewatch.TypeQuestion, priorityLow},
+	} {
+		if req := <-prompts; req.Prompt != want.prompt || req.Priority != want.level {
+			t.Errorf("request %q at %s, want %q at %s", req.Prompt, req.Priority, want.prompt, want.level)
+		}
+	}
+}
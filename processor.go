@@ -0,0 +1,629 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// fileProcessor turns a changed file into a prompt: it scans the file for
+// active markers, strips them, renders the prompt template and queues the
+// result for dispatch.
+type fileProcessor struct {
+	config   *Config
+	resolver *promptResolver
+	prompts  chan<- promptRequest
+	cooldown *fileCooldown // When each file was last processed, so one save isn't scanned twice
+	confirm  func(question string) bool
+	pick     func(title string, items []string) []bool
+	progress *progressTracker   // With --progress-comments, marks the sites of prompts in flight
+	notes    *sessionNotes      // With --session-notes, logs each prompt
+	dedupe   *promptDedupe      // Prompts rendered recently, which aren't sent again
+	coalesce *template.Template // With --coalesce, renders the edits of files saved together
+	batch    *[]pendingPrompt   // While processAll runs with --coalesce, the edits it collects
+	scans    *scanCache         // Large files as last scanned, so only their changed lines are checked
+	hashes   *contentHashes     // Each file's content as last processed, so writes that don't change it are skipped
+	commits  *autoCommitter     // With --auto-commit, commits Claude's changes once it has answered
+	tracked  *trackedFiles      // With --tracked-only, the files git tracks, which are the only ones scanned
+
+	restoredMu sync.Mutex
+	restored   map[string]string // Content written back after a failed delivery, or left with deferred markers, keyed by path
+
+	sentMu sync.Mutex
+	sent   map[string]map[string]bool // With --keep-markers, hashes of the markers already sent, keyed by path
+}
+
+func newFileProcessor(config *Config, resolver *promptResolver, prompts chan<- promptRequest) *fileProcessor {
+	return &fileProcessor{
+		config:   config,
+		resolver: resolver,
+		prompts:  prompts,
+		cooldown: newFileCooldown(config.Cooldown),
+		restored: make(map[string]string),
+		sent:     make(map[string]map[string]bool),
+		dedupe:   newPromptDedupe(config.DedupeWindow),
+		coalesce: config.Coalesce,
+		scans:    newScanCache(config.markerScanner()),
+		hashes:   newContentHashes(),
+		commits:  newAutoCommitter(config),
+		tracked:  newTrackedFiles(config),
+	}
+}
+
+// process scans path for markers and dispatches a prompt if any are active
+func (p *fileProcessor) process(path string) {
+	config := p.config
+
+	// Skip files processed recently
+	if at, cooling := p.cooldown.cooling(path, time.Now()); cooling {
+		traceLog(config, "Skipping %s: processed %s ago (--cooldown)", path, time.Since(at).Round(time.Millisecond))
+		return
+	}
+
+	// With --tracked-only, files git doesn't know about are left alone
+	if p.tracked != nil && !p.tracked.contains(path) {
+		debugLog(config, "Skipping %s: not tracked by git", path)
+		return
+	}
+
+	// Check if file contains AI comments, skipping binary and oversized files
+	content, skip, err := claudewatch.ReadScannable(path, config.MaxFileSize)
+	if err != nil {
+		return
+	}
+	if skip != "" {
+		traceLog(config, "Skipping %s: %s", path, skip)
+		return
+	}
+
+	// Markers put back after a failed delivery wait for the user to save again
+	if p.wasRestored(path, string(content)) {
+		debugLog(config, "Skipping %s: markers were restored after a failed delivery", path)
+		return
+	}
+
+	// A write that left the content as it was (e.g. a touch) has nothing new
+	if p.hashes.unchanged(path, content) {
+		debugLog(config, "Skipping %s: content unchanged since it was last processed", path)
+		return
+	}
+
+	// A large file's changed lines are checked first, which usually rules
+	// out markers without scanning the whole file
+	if p.scans.unchanged(path, content) {
+		debugLog(config, "Skipping %s: no markers in the lines that changed", path)
+		return
+	}
+
+	// An ai:reset directive clears Claude's context before the file's
+	// prompts are sent, so it goes first
+	scanner := config.markerScanner()
+	markers := append(scanner.ForFile(path).ScanResets(string(content)), scanner.ScanFile(path, string(content))...)
+	if len(markers) == 0 {
+		return
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	// A read-only file is handled as with --keep-markers, as its markers
+	// can't be stripped
+	readOnly := !config.KeepMarkers && isReadOnly(path)
+	keep := config.KeepMarkers || readOnly
+
+	// With --keep-markers the markers stay in the file, so only send the ones
+	// that haven't been sent already
+	if keep {
+		if markers = p.unsentMarkers(absPath, markers); len(markers) == 0 {
+			debugLog(config, "Skipping %s: every marker was already sent", path)
+			return
+		}
+	}
+
+	// With --pick, the user chooses which of several markers to send now;
+	// the rest stay in the file until it is saved again
+	var deferred []claudewatch.Marker
+	if config.PickMarkers && p.pick != nil {
+		if markers, deferred = p.pickMarkers(path, markers); len(markers) == 0 {
+			console.notice("Deferred every marker in %s until it is saved again", path)
+			if keep {
+				p.forgetFunc(absPath, deferred)()
+			} else {
+				p.holdUntilSaved(path)
+			}
+			return
+		}
+		if keep {
+			p.forgetFunc(absPath, deferred)()
+		}
+	}
+
+	// Store original markers for logging
+	originalMarkers := make([]claudewatch.Marker, len(markers))
+	copy(originalMarkers, markers)
+
+	// Log file change before processing
+	announceChange(console, config, path, originalMarkers)
+	for _, marker := range originalMarkers {
+		if marker.Type != claudewatch.TypeReset {
+			config.Events.emit(editorEvent{Event: eventMarker, File: absPath, Line: marker.LineNumber, Text: marker.LineText, Type: marker.Type})
+		}
+	}
+
+	// Claude may have changed directory since the last prompt
+	warnCwdDrift(config)
+
+	updatedMarkers := markers
+	if readOnly {
+		console.warn("%s is read-only; leaving its markers in place", path)
+	} else if keep {
+		debugLog(config, "Leaving markers in %s (--keep-markers)", path)
+	} else {
+		// With --confirm-strip, show what the removal will change and ask first
+		if config.ConfirmStrip && !p.approveStrip(path, string(content), markers) {
+			console.warn("Marker removal declined: %s left unchanged and not sent", path)
+			return
+		}
+
+		// With --backup, keep a copy of the file as it was before the rewrite
+		if config.Backup {
+			if !p.backup(path, content) {
+				return
+			}
+		}
+
+		// Remove AI markers from the file and get updated markers
+		debugLog(config, "Removing AI markers from file: %s", path)
+		updatedMarkers, err = removeAIMarkersFromFile(scanner, path, markers)
+		switch {
+		case err != nil && isPermissionError(err):
+			// Permissions the up-front check couldn't see, such as ACLs
+			console.warn("%s is read-only; leaving its markers in place", path)
+			readOnly, keep = true, true
+			updatedMarkers = markers
+			p.unsentMarkers(absPath, markers)
+		case err != nil:
+			console.errorf("Error removing AI markers: %v", err)
+			return
+		default:
+			debugLog(config, "AI markers successfully removed from file")
+			// The file no longer holds the content just hashed, so saving
+			// those bytes again (the marker added back) is a change
+			p.hashes.forget(path)
+			if len(deferred) > 0 {
+				console.notice("Deferred %d marker(s) in %s until it is saved again", len(deferred), path)
+				p.holdUntilSaved(path)
+			}
+		}
+	}
+
+	// Log the updated markers for debugging
+	if config.LogLevel != levelOff && config.LogLevel <= levelDebug {
+		for i, marker := range updatedMarkers {
+			debugLog(config, "  Original: Line %d: %s", originalMarkers[i].LineNumber, originalMarkers[i].LineText)
+			debugLog(config, "  Updated:  Line %d: %s", marker.LineNumber, marker.LineText)
+		}
+	}
+
+	// Capture the surrounding code, and the code any marker names with
+	// (lines=+N) or ai:block-start, as it reads after the strip
+	if config.ContextLines > 0 || hasRegion(updatedMarkers) {
+		if stripped, readErr := os.ReadFile(path); readErr == nil {
+			updatedMarkers = withContext(string(stripped), updatedMarkers, config.ContextLines)
+			updatedMarkers = withRegion(string(stripped), updatedMarkers)
+		}
+	}
+
+	// The strip keeps the markers in order, so the groups of the original
+	// markers line up with the groups of the updated ones
+	originalGroups := groupMarkers(originalMarkers)
+
+	// Each prompt is queued at the priority of its markers, or of the file's
+	// path. A reset takes the highest, to stay ahead of the prompts after it.
+	groups := groupMarkers(updatedMarkers)
+	levels := make([]priority, len(groups))
+	resetLevel := priorityLow
+	for i, group := range groups {
+		levels[i] = groupPriority(config, absPath, group.Markers)
+		resetLevel = max(resetLevel, levels[i])
+	}
+
+	// With --progress-comments, mark where each prompt's markers were until
+	// Claude has answered it
+	// Claude then reads the file with the comments in it, so the prompts
+	// number the lines as they are once the comments are added
+	var progressNumbers []int
+	prompted := groups
+	if p.progress != nil && !keep {
+		progressNumbers, prompted, err = p.progress.insert(path, groups, originalGroups)
+		if err != nil {
+			console.warn("Could not add in-progress comments to %s: %v", path, err)
+			prompted = groups
+		}
+	}
+
+	// Render one prompt per namespace and marker type, each through its own
+	// template; namespaced markers go to their namespace's session
+	for i, group := range groups {
+		restore := p.restoreFunc(path, originalGroups[i].Markers, group.Markers)
+		if keep {
+			restore = p.forgetFunc(absPath, group.Markers)
+		}
+		var done func()
+		if progressNumbers != nil && progressNumbers[i] != 0 {
+			n, restoreMarkers := progressNumbers[i], restore
+			done = func() { p.progress.remove(n) }
+			restore = func() {
+				p.progress.remove(n)
+				restoreMarkers()
+			}
+		}
+
+		if group.Type == claudewatch.TypeReset {
+			p.prompts <- promptRequest{Prompt: clearCommand, File: path, Reset: true, Restore: restore, Priority: resetLevel}
+			continue
+		}
+
+		// Prepare the template data with the updated markers
+		pending := pendingPrompt{
+			path: path,
+			data: TemplateData{
+				File:        absPath,
+				Type:        group.Type,
+				Tag:         group.Tag,
+				Markers:     prompted[i].Markers,
+				ReadOnly:    readOnly,
+				NotesFile:   p.notes.filePath(),
+				ProjectRoot: config.Projects.rootOf(absPath),
+				fileTree:    func() string { return fileTree(config, absPath, config.FileTreeDepth) },
+				gitDiff:     func() string { return fileGitDiff(absPath) },
+				gitStatus:   func() string { return repoGitStatus(absPath) },
+				project:     sync.OnceValue(func() ProjectInfo { return lookupProject(absPath, time.Now()) }),
+			},
+			original: originalGroups[i].Markers,
+			restore:  restore,
+			done:     done,
+			level:    levels[i],
+			kept:     keep,
+		}
+		route, routed := p.config.Namespaces[group.Namespace]
+		if routed {
+			pending.tmpl, pending.target = route.tmpl, route.target
+		}
+
+		// With --coalesce, edits for the main session wait to be sent along
+		// with those from the other files saved at the same time; tagged ones
+		// keep their own template
+		if p.batch != nil && pending.target == nil && pending.tmpl == nil && group.Type == claudewatch.TypeEdit && group.Tag == "" {
+			*p.batch = append(*p.batch, pending)
+			continue
+		}
+		p.send(pending)
+	}
+}
+
+// pendingPrompt is a prompt for one group of markers, ready to render
+type pendingPrompt struct {
+	path     string
+	data     TemplateData
+	original []claudewatch.Marker // The markers as they were in the file, for the session notes
+	tmpl     *template.Template   // The namespace's template; nil resolves it per file
+	target   backend
+	restore  func()
+	done     func()
+	level    priority
+	kept     bool // The markers were left in the file (--keep-markers or read-only)
+}
+
+// stripped reports whether the markers of any of prompts were removed from
+// their file
+func stripped(prompts []pendingPrompt) bool {
+	for _, pending := range prompts {
+		if !pending.kept {
+			return true
+		}
+	}
+	return false
+}
+
+// send renders pending through its template and queues it for dispatch
+func (p *fileProcessor) send(pending pendingPrompt) {
+	// Execute the template (resolved per file, cached per dir)
+	promptTmpl := pending.tmpl
+	if promptTmpl == nil {
+		promptTmpl = p.resolver.resolveTagged(pending.data.File, pending.data.Type, pending.data.Tag)
+	}
+	var promptBuf strings.Builder
+	if err := promptTmpl.Execute(&promptBuf, pending.data); err != nil {
+		console.errorf("Error executing prompt template: %v", err)
+		return
+	}
+	p.queue(pending.path, promptBuf.String(), pending.target, pending.restore, pending.done, pending.level, []pendingPrompt{pending})
+}
+
+// queue sends a rendered prompt for path (or paths, when coalesced) to be
+// dispatched, adding the prompts it was rendered from to the session notes
+func (p *fileProcessor) queue(path, rendered string, target backend, restore, done func(), level priority, from []pendingPrompt) {
+	// With --script, the script has the last word on the prompt and its target
+	rendered, target = p.applyScript(path, rendered, target, from)
+
+	// Edits on top of other uncommitted work are hard to untangle. This is
+	// checked first, so a refused prompt isn't remembered as sent.
+	if !p.allowedOnTree(from) {
+		restore()
+		if done != nil {
+			done()
+		}
+		return
+	}
+	// Saving a file again with the same instruction still in it renders
+	// the same prompt, which has been sent already
+	if at, dup := p.dedupe.duplicate(rendered, time.Now()); dup {
+		console.notice("Skipping %s: the same prompt was sent %s ago", path, time.Since(at).Round(time.Second))
+		if stripped(from) {
+			restore()
+		}
+		if done != nil {
+			done()
+		}
+		return
+	}
+	if p.dedupe != nil {
+		restoreMarkers := restore
+		restore = func() {
+			p.dedupe.forget(rendered)
+			restoreMarkers()
+		}
+	}
+
+	var sending func()
+	if p.commits != nil {
+		sending, done = p.commits.track(done, from)
+	}
+
+	for _, pending := range from {
+		if err := p.notes.record(pending.path, pending.data.Type, pending.original); err != nil {
+			console.warn("Could not add %s to the session notes: %v", pending.path, err)
+		}
+	}
+
+	// Optionally have the terse instructions spelled out first, once the
+	// prompt is on its way out, so the command doesn't hold up the watcher
+	var expand func(string) string
+	if p.config.ExpandCommand != "" {
+		expand = func(prompt string) string { return p.expand(path, prompt) }
+	}
+
+	// Send the generated prompt to the channel for processing
+	infoLog(p.config, "Queueing prompt for %s at %s priority", path, level)
+	p.prompts <- promptRequest{
+		Prompt:   rendered,
+		File:     path,
+		Target:   target,
+		Restore:  restore,
+		Priority: level,
+		Done:     done,
+		Sending:  sending,
+		Expand:   expand,
+
+		Instruction: firstInstruction(p.config.markerScanner(), from),
+		Sites:       markerSites(from),
+		Model:       promptModel(from),
+	}
+}
+
+// markerSites is where the markers of prompts are once stripped, with the
+// text they had in the file
+func markerSites(from []pendingPrompt) []markerSite {
+	var sites []markerSite
+	for _, pending := range from {
+		for i, marker := range pending.data.Markers {
+			text := marker.LineText
+			if i < len(pending.original) {
+				text = pending.original[i].LineText
+			}
+			sites = append(sites, markerSite{File: pending.data.File, Line: marker.LineNumber, Text: text})
+		}
+	}
+	return sites
+}
+
+// firstInstruction is the instruction of the first marker prompts were
+// rendered from
+func firstInstruction(scanner *claudewatch.Scanner, from []pendingPrompt) string {
+	for _, pending := range from {
+		if len(pending.original) > 0 {
+			return instructionText(scanner, pending.original[0])
+		}
+	}
+	return ""
+}
+
+// promptModel returns the model the first marker with a model= argument
+// asks for, or an empty string if none does
+func promptModel(from []pendingPrompt) string {
+	for _, pending := range from {
+		for _, marker := range pending.data.Markers {
+			if model := marker.Args["model"]; model != "" {
+				return model
+			}
+		}
+	}
+	return ""
+}
+
+// backup saves content as a backup of path, reporting whether it succeeded.
+// Markers are left in place when the backup fails.
+func (p *fileProcessor) backup(path string, content []byte) bool {
+	stateDir, err := ensureStateDir()
+	if err != nil {
+		console.warn("Backup of %s failed: %v; markers left in place", path, err)
+		return false
+	}
+	backupPath, err := writeBackup(filepath.Join(stateDir, backupDirName), path, content, time.Now())
+	if err != nil {
+		console.warn("Backup of %s failed: %v; markers left in place", path, err)
+		return false
+	}
+	debugLog(p.config, "Backed up %s to %s", path, backupPath)
+	return true
+}
+
+// restoreFunc returns a function that puts markers back into path after their
+// prompt could not be delivered. It runs on the dispatch goroutine.
+func (p *fileProcessor) restoreFunc(path string, original, updated []claudewatch.Marker) func() {
+	return func() {
+		missing, err := restoreAIMarkersInFile(p.config.markerScanner(), path, original, updated)
+		if err != nil {
+			console.warn("Prompt not delivered; could not restore markers in %s: %v", path, err)
+			return
+		}
+		if missing > 0 {
+			console.warn("Prompt not delivered; %d marker line(s) in %s changed or moved next to identical lines and were not restored", missing, path)
+		} else {
+			console.warn("Prompt not delivered; markers restored in %s", path)
+		}
+		p.holdUntilSaved(path)
+	}
+}
+
+// holdUntilSaved keeps the markers now in path from being sent until the
+// user changes the file (see wasRestored)
+func (p *fileProcessor) holdUntilSaved(path string) {
+	if content, err := os.ReadFile(path); err == nil {
+		p.restoredMu.Lock()
+		p.restored[path] = string(content)
+		p.restoredMu.Unlock()
+	}
+}
+
+// pickMarkers asks which of the markers in path to send now, when there is
+// more than one instruction among them, and returns those picked and those
+// deferred. ai:reset directives go along with whatever is picked.
+func (p *fileProcessor) pickMarkers(path string, markers []claudewatch.Marker) (picked, deferred []claudewatch.Marker) {
+	var items []string
+	for _, marker := range markers {
+		if marker.Type != claudewatch.TypeReset {
+			items = append(items, fmt.Sprintf("Line %d: %s", marker.LineNumber, strings.TrimSpace(marker.LineText)))
+		}
+	}
+	if len(items) < 2 {
+		return markers, nil
+	}
+
+	checked := p.pick(fmt.Sprintf("%d markers in %s; which should be sent now?", len(items), path), items)
+	var resets []claudewatch.Marker
+	i := 0
+	for _, marker := range markers {
+		switch {
+		case marker.Type == claudewatch.TypeReset:
+			resets = append(resets, marker)
+		case checked[i]:
+			picked = append(picked, marker)
+			i++
+		default:
+			deferred = append(deferred, marker)
+			i++
+		}
+	}
+	if len(picked) == 0 {
+		return nil, append(deferred, resets...)
+	}
+	return append(resets, picked...), deferred
+}
+
+// markerHash identifies a marker by the text of its line, so it is recognized
+// again after lines above it are added or removed
+func markerHash(marker claudewatch.Marker) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(marker.LineText)))
+	return hex.EncodeToString(sum[:])
+}
+
+// unsentMarkers returns the markers in path that haven't been sent yet and
+// records them as sent. Markers no longer in the file are forgotten, so
+// adding one back later sends it again.
+func (p *fileProcessor) unsentMarkers(path string, markers []claudewatch.Marker) []claudewatch.Marker {
+	p.sentMu.Lock()
+	defer p.sentMu.Unlock()
+
+	previous := p.sent[path]
+	current := make(map[string]bool, len(markers))
+	var unsent []claudewatch.Marker
+	for _, marker := range markers {
+		hash := markerHash(marker)
+		if !previous[hash] && !current[hash] {
+			unsent = append(unsent, marker)
+		}
+		current[hash] = true
+	}
+	p.sent[path] = current
+	return unsent
+}
+
+// forgetFunc returns a function that forgets markers were sent, so that after
+// a failed delivery the next save of path sends them again, even if it
+// doesn't change the file
+func (p *fileProcessor) forgetFunc(path string, markers []claudewatch.Marker) func() {
+	return func() {
+		p.hashes.forget(path)
+		p.sentMu.Lock()
+		for _, marker := range markers {
+			delete(p.sent[path], markerHash(marker))
+		}
+		p.sentMu.Unlock()
+		console.warn("Prompt not delivered; %s will be sent again on its next save", path)
+	}
+}
+
+// wasRestored reports whether content is exactly what was written back to
+// path by a restore, in which case it should not be re-sent until it changes
+func (p *fileProcessor) wasRestored(path, content string) bool {
+	p.restoredMu.Lock()
+	defer p.restoredMu.Unlock()
+	restored, ok := p.restored[path]
+	if ok && restored != content {
+		delete(p.restored, path)
+		return false
+	}
+	return ok
+}
+
+// approveStrip previews the marker removal for path as a unified diff and asks
+// the user to approve it. Removals that only drop a marker from the end of a
+// comment are approved without asking.
+func (p *fileProcessor) approveStrip(path, content string, markers []claudewatch.Marker) bool {
+	scanner := p.config.markerScanner().ForFile(path)
+	stripped, _, err := scanner.StripMarkers(content, markers)
+	if err != nil {
+		// Let the removal itself report the problem
+		return true
+	}
+
+	oldLines, _ := claudewatch.SplitLines(content)
+	newLines, _ := claudewatch.SplitLines(stripped)
+	trivial := len(oldLines) == len(newLines)
+	for _, marker := range markers {
+		if !trivial {
+			break
+		}
+		trivial = scanner.IsTrivialStrip(oldLines[marker.LineNumber-1], newLines[marker.LineNumber-1])
+	}
+	if trivial || p.confirm == nil {
+		debugLog(p.config, "Auto-approving trivial marker removal in %s", path)
+		return true
+	}
+
+	diff := unifiedDiff(path, content, stripped)
+	console.diff(diff)
+	return p.confirm(fmt.Sprintf("Remove markers from %s and send to Claude?", path))
+}
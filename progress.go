@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// progressTag is the text of in-progress comment number n
+func progressTag(n int) string {
+	return fmt.Sprintf("[claudewatch: in progress #%d]", n)
+}
+
+// progressLine returns in-progress comment n for the marker on markerLine in
+// the file at path,
+// indented like it and written with the same comment syntax
+func progressLine(scanner *claudewatch.Scanner, path, markerLine string, n int) string {
+	indent := markerLine[:len(markerLine)-len(strings.TrimLeft(markerLine, " \t"))]
+	leader := scanner.ForFile(path).CommentLeader(markerLine)
+	switch {
+	case leader == "" && strings.Contains(markerLine, "<!--"):
+		return indent + "<!-- " + progressTag(n) + " -->"
+	case leader == "/*" && strings.Contains(markerLine, "{/*"):
+		return indent + "{/* " + progressTag(n) + " */}"
+	case leader == "":
+		leader = "//"
+	case leader == "/*":
+		return indent + "/* " + progressTag(n) + " */"
+	}
+	return indent + leader + " " + progressTag(n)
+}
+
+// progressTracker implements --progress-comments: while a prompt is in
+// flight, a numbered comment sits at each of its marker sites so anyone
+// opening the file can see Claude is working there
+type progressTracker struct {
+	scanner *claudewatch.Scanner
+
+	mu      sync.Mutex
+	next    int
+	pending map[int]string // File holding each outstanding comment, keyed by number
+}
+
+func newProgressTracker(scanner *claudewatch.Scanner) *progressTracker {
+	return &progressTracker{scanner: scanner, pending: make(map[int]string)}
+}
+
+// progressSite is an in-progress comment waiting to be inserted
+type progressSite struct {
+	index int // Line index in the stripped file the comment is inserted at
+	line  int // Line number of the marker in the original file, breaking ties
+	text  string
+}
+
+// insert adds a comment for each group at the sites of its markers in path,
+// which has just been stripped. groups hold the markers as returned by the
+// strip, and originals the same groups as they were found. It returns each
+// group's comment number, a group of resets getting none, and groups
+// renumbered for the file with the comments in it, for the prompts; the
+// markers' restore still goes by groups, as it runs once the comments are
+// gone.
+func (t *progressTracker) insert(path string, groups, originals []markerGroup) ([]int, []markerGroup, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines, ending := claudewatch.SplitLines(string(content))
+
+	t.mu.Lock()
+	numbers := make([]int, len(groups))
+	var sites []progressSite
+	for i, group := range groups {
+		if group.Type == claudewatch.TypeReset {
+			continue
+		}
+		t.next++
+		numbers[i] = t.next
+		t.pending[t.next] = path
+		for j, marker := range group.Markers {
+			original := originals[i].Markers[j]
+			index := marker.LineNumber - 1
+			if marker.CommentStart > 0 {
+				index = marker.CommentStart - 1 // Above the whole instruction
+			}
+			sites = append(sites, progressSite{
+				index: min(index, len(lines)),
+				line:  original.LineNumber,
+				text:  progressLine(t.scanner, path, original.LineText, t.next),
+			})
+		}
+	}
+	t.mu.Unlock()
+	if len(sites) == 0 {
+		return numbers, groups, nil
+	}
+
+	// Insert from the bottom up so earlier indexes stay valid
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].index != sites[j].index {
+			return sites[i].index > sites[j].index
+		}
+		return sites[i].line > sites[j].line
+	})
+	for _, site := range sites {
+		lines = append(lines[:site.index], append([]string{site.text}, lines[site.index:]...)...)
+	}
+	if err := claudewatch.WriteFileAtomic(path, []byte(ending.Join(lines)), 0o644); err != nil {
+		t.forget(numbers)
+		return nil, nil, err
+	}
+
+	scanner := t.scanner.ForFile(path)
+	shifted := make([]markerGroup, len(groups))
+	for i, group := range groups {
+		shifted[i] = group
+		shifted[i].Markers = make([]claudewatch.Marker, len(group.Markers))
+		for j, marker := range group.Markers {
+			shifted[i].Markers[j] = shiftPastSites(marker, originals[i].Markers[j].LineNumber, scanner.IsEmptyComment(marker.LineText), sites)
+		}
+	}
+	return numbers, shifted, nil
+}
+
+// shiftPastSites renumbers a stripped marker, found on line originalLine
+// before the strip, for the file once in-progress comments are inserted at
+// sites. A marker whose line was deleted (as an empty comment) lands on the
+// comment that took its place; any other moves down past the comments above
+// its line.
+func shiftPastSites(marker claudewatch.Marker, originalLine int, deleted bool, sites []progressSite) claudewatch.Marker {
+	above := func(line int, exact bool) int {
+		n := 0
+		for _, site := range sites {
+			if site.index < line-1 || (site.index == line-1 && (!exact || site.line < originalLine)) {
+				n++
+			}
+		}
+		return n
+	}
+	shifted := marker
+	shifted.LineNumber += above(marker.LineNumber, deleted)
+	if marker.RegionStart > 0 {
+		shifted.RegionStart += above(marker.RegionStart, false)
+		shifted.RegionEnd += above(marker.RegionEnd, false)
+	}
+	if marker.CommentStart > 0 {
+		shifted.CommentStart += above(marker.CommentStart, false)
+	}
+	return shifted
+}
+
+// forget drops comments that were never written
+func (t *progressTracker) forget(numbers []int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, n := range numbers {
+		delete(t.pending, n)
+	}
+}
+
+// remove deletes every line of comment n from its file. Lines Claude has
+// edited or moved are still found; ones it has already removed are skipped.
+func (t *progressTracker) remove(n int) {
+	t.mu.Lock()
+	path, ok := t.pending[n]
+	delete(t.pending, n)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		console.warn("Could not remove in-progress comment #%d from %s: %v", n, path, err)
+		return
+	}
+	lines, ending := claudewatch.SplitLines(string(content))
+	tag := progressTag(n)
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.Contains(line, tag) && t.scanner.ForFile(path).IsEmptyComment(strings.Replace(line, tag, "", 1)) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == len(lines) {
+		return
+	}
+	if err := claudewatch.WriteFileAtomic(path, []byte(ending.Join(kept)), 0o644); err != nil {
+		console.warn("Could not remove in-progress comment #%d from %s: %v", n, path, err)
+	}
+}
+
+// removeAll removes every outstanding comment. It is called on shutdown, when
+// the prompts they stand for will no longer be answered, and does nothing on
+// a nil tracker.
+func (t *progressTracker) removeAll() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	numbers := make([]int, 0, len(t.pending))
+	for n := range t.pending {
+		numbers = append(numbers, n)
+	}
+	t.mu.Unlock()
+	for _, n := range numbers {
+		t.remove(n)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		marker, want string
+	}{
+		{"// fix this ai!", "// [claudewatch: in progress #3]"},
+		{"\t\t# fix this ai!", "\t\t# [claudewatch: in progress #3]"},
+		{"    /* fix this ai! */", "    /* [claudewatch: in progress #3] */"},
+		{"  x := 1 // fix this ai!", "  // [claudewatch: in progress #3]"},
+		{"  <!-- fix this ai! -->", "  <!-- [claudewatch: in progress #3] -->"},
+		{"\t{/* fix this ai! */}", "\t{/* [claudewatch: in progress #3] */}"},
+	}
+
+	for _, tt := range tests {
+		if got := progressLine(defaultMarkerScanner, "f.go", tt.marker, 3); got != tt.want {
+			t.Errorf("progressLine(%q) = %q, want %q", tt.marker, got, tt.want)
+		}
+	}
+}
+
+func TestProgressInsertAndRemove(t *testing.T) {
+	content := "package p\n\n// use a map ai!\nfunc f() {\n\tx := 1 // why? ai?\n}\n// and here ai!\n"
+	path, original, updated := stripFile(t, content)
+	stripped := readString(t, path)
+
+	tracker := newProgressTracker(defaultMarkerScanner)
+	numbers, shifted, err := tracker.insert(path, groupMarkers(updated), groupMarkers(original))
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if len(numbers) != 2 || numbers[0] != 1 || numbers[1] != 2 {
+		t.Fatalf("numbers = %v, want [1 2]", numbers)
+	}
+	want := "package p\n\n// [claudewatch: in progress #1]\n// use a map\nfunc f() {\n\t// [claudewatch: in progress #2]\n\tx := 1 // why?\n}\n// [claudewatch: in progress #1]\n// and here\n"
+	if got := readString(t, path); got != want {
+		t.Errorf("after insert = %q, want %q", got, want)
+	}
+	lines := strings.Split(want, "\n")
+	for _, group := range shifted {
+		for _, marker := range group.Markers {
+			if lines[marker.LineNumber-1] != marker.LineText {
+				t.Errorf("marker %q renumbered to line %d, which is %q", marker.LineText, marker.LineNumber, lines[marker.LineNumber-1])
+			}
+		}
+	}
+
+	// Claude edits the file meanwhile; the comments are still found
+	edited := "// header\n" + readString(t, path)
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tracker.remove(1)
+	tracker.removeAll()
+	if got := readString(t, path); got != "// header\n"+stripped {
+		t.Errorf("after remove = %q, want %q", got, "// header\n"+stripped)
+	}
+}
+
+func TestProgressInsertRenumbersDeletedMarkers(t *testing.T) {
+	content := "a\n// ai!\n// ai!(lines=+2)\nb // fix ai!\nc\n" // ai:ignore
+	path, original, updated := stripFile(t, content)
+
+	_, shifted, err := newProgressTracker(defaultMarkerScanner).insert(path, groupMarkers(updated), groupMarkers(original))
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	want := "a\n// [claudewatch: in progress #1]\n// [claudewatch: in progress #1]\n// [claudewatch: in progress #1]\nb // fix\nc\n"
+	if got := readString(t, path); got != want {
+		t.Fatalf("after insert = %q, want %q", got, want)
+	}
+	// Each deleted marker is on the comment that took its place; the
+	// region and the marker kept after the strip moved down past them
+	markers := shifted[0].Markers
+	if got := []int{markers[0].LineNumber, markers[1].LineNumber, markers[2].LineNumber}; got[0] != 2 || got[1] != 3 || got[2] != 5 {
+		t.Errorf("line numbers = %v, want [2 3 5]", got)
+	}
+	if markers[1].RegionStart != 5 || markers[1].RegionEnd != 6 {
+		t.Errorf("region = %d-%d, want 5-6", markers[1].RegionStart, markers[1].RegionEnd)
+	}
+	if updated[2].LineNumber != 2 {
+		t.Errorf("stripped marker renumbered in place: line %d, want 2", updated[2].LineNumber)
+	}
+}
+
+func TestProgressInsertAboveCommentRun(t *testing.T) {
+	path, original, updated := stripFile(t, "a\n// Use a map,\n// keyed by name ai!\n") // ai:ignore
+
+	_, shifted, err := newProgressTracker(defaultMarkerScanner).insert(path, groupMarkers(updated), groupMarkers(original))
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if got, want := readString(t, path), "a\n// [claudewatch: in progress #1]\n// Use a map,\n// keyed by name\n"; got != want {
+		t.Fatalf("after insert = %q, want %q", got, want)
+	}
+	if m := shifted[0].Markers[0]; m.LineNumber != 4 || m.CommentStart != 3 || m.CommentEnd() != 4 {
+		t.Errorf("marker at line %d, comment %d-%d; want line 4, comment 3-4", m.LineNumber, m.CommentStart, m.CommentEnd())
+	}
+}
+
+func TestProcessProgressComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.py")
+	content := "def f():\n    # ai!\n    pass\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 1)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	p := newFileProcessor(&Config{}, resolver, prompts)
+	p.progress = newProgressTracker(defaultMarkerScanner)
+
+	p.process(path)
+	if got, want := readString(t, path), "def f():\n    # [claudewatch: in progress #1]\n    pass\n"; got != want {
+		t.Fatalf("while in flight = %q, want %q", got, want)
+	}
+
+	// A failed delivery takes the comment out before putting the marker back
+	req := <-prompts
+	d := &dispatcher{primary: &fakeBackend{name: "primary", err: errors.New("pty closed")}}
+	if err := d.submit(req); err == nil {
+		t.Fatal("submit() succeeded, want the delivery error")
+	}
+	if got := readString(t, path); got != content {
+		t.Errorf("after failed delivery = %q, want the original %q", got, content)
+	}
+}
+
+func TestDispatcherDoneAfterOutputQuiet(t *testing.T) {
+	old := answerQuietPeriod
+	answerQuietPeriod = 50 * time.Millisecond
+	t.Cleanup(func() { answerQuietPeriod = old })
+
+	activity := &outputActivity{}
+	d := &dispatcher{primary: &fakeBackend{name: "primary"}, activity: activity}
+	done := make(chan time.Time, 1)
+	start := time.Now()
+	if err := d.submit(promptRequest{Prompt: "p", Done: func() { done <- time.Now() }}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// Claude keeps printing for a while
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = activity.Write([]byte("."))
+	}
+	select {
+	case at := <-done:
+		if at.Sub(start) < 100*time.Millisecond+answerQuietPeriod {
+			t.Errorf("Done called after %s, before the output went quiet", at.Sub(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done was never called")
+	}
+
+	// Without output to watch, it is called straight away
+	called := false
+	d = &dispatcher{primary: &fakeBackend{name: "primary"}}
+	_ = d.submit(promptRequest{Prompt: "p", Done: func() { called = true }})
+	if !called {
+		t.Error("Done not called on delivery without an output to watch")
+	}
+}
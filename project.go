@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// projectMarkerFiles mark the top of a project inside a monorepo
+var projectMarkerFiles = []string{"go.mod", "package.json", "Cargo.toml"}
+
+// projectIndex implements --project-scope: each changed file belongs to the
+// nearest project (a directory with one of projectMarkerFiles) at or below
+// the watched root it is in. Prompts are scoped to that project, and a
+// .claudewatchignore at the top of the project applies to its files.
+type projectIndex struct {
+	config *Config
+
+	mu      sync.Mutex
+	roots   map[string]string         // Directory to the top of its project; "" for none
+	ignores map[string]IgnorePatterns // Top of a project to the patterns of its .claudewatchignore
+}
+
+// newProjectIndex returns the project index, or nil without --project-scope
+func newProjectIndex(config *Config) *projectIndex {
+	if !config.ProjectScope {
+		return nil
+	}
+	return &projectIndex{
+		config:  config,
+		roots:   make(map[string]string),
+		ignores: make(map[string]IgnorePatterns),
+	}
+}
+
+// rootOf returns the absolute path of the project path is in, or "" if
+// there is none up to its watched root. It is "" on a nil index.
+func (x *projectIndex) rootOf(path string) string {
+	if x == nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	start := filepath.Dir(abs)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var visited []string
+	root := ""
+	for dir := start; ; dir = filepath.Dir(dir) {
+		if cached, ok := x.roots[dir]; ok {
+			root = cached
+			break
+		}
+		visited = append(visited, dir)
+		if isProjectDir(dir) {
+			root = dir
+			break
+		}
+		if x.isWatchedRoot(dir) || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range visited {
+		x.roots[dir] = root
+	}
+	return root
+}
+
+// isWatchedRoot reports whether dir is one of the watched directories
+func (x *projectIndex) isWatchedRoot(dir string) bool {
+	for _, root := range x.config.RootDirectories {
+		if abs, err := filepath.Abs(root); err == nil && abs == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// isProjectFile reports whether a change to path can change the projects
+// or their ignore patterns
+func isProjectFile(path string) bool {
+	name := filepath.Base(path)
+	if name == ignoreFileName {
+		return true
+	}
+	for _, marker := range projectMarkerFiles {
+		if name == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// isProjectDir reports whether dir holds one of projectMarkerFiles
+func isProjectDir(dir string) bool {
+	for _, name := range projectMarkerFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoresFor returns the top of the project path is in and the patterns of
+// its .claudewatchignore, which path is matched against relative to the top
+// of the project (see matchesProjectPatterns). They are the same for every
+// file in a directory. A project at a watched root is left out, as its ignore
+// file applies everywhere; the root is "" then, on a nil index, and when path
+// is in no project.
+func (x *projectIndex) ignoresFor(path string) (string, IgnorePatterns) {
+	root := x.rootOf(path)
+	if root == "" || x.isWatchedRoot(root) {
+		return "", nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	patterns, ok := x.ignores[root]
+	if !ok {
+		var err error
+		patterns, err = LoadIgnorePatterns(root)
+		if err != nil {
+			console.warn("Warning: Error loading .claudewatchignore in %s: %v", root, err)
+		}
+		x.ignores[root] = patterns
+		if len(patterns) > 0 {
+			debugLog(x.config, "Loaded %d patterns from %s/.claudewatchignore", len(patterns), root)
+		}
+	}
+	return root, patterns
+}
+
+// matchesProjectPatterns reports whether path, relative to the top of its
+// project at root, matches patterns
+func matchesProjectPatterns(root string, patterns IgnorePatterns, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return false
+	}
+	return patterns.MatchesAnyPattern(filepath.ToSlash(rel))
+}
+
+// refresh drops what is known about the project at dir, after its
+// .claudewatchignore or one of projectMarkerFiles changed there. A new
+// go.mod or package.json makes a new project, so the project of every
+// directory is looked up again.
+func (x *projectIndex) refresh(dir string) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	x.mu.Lock()
+	delete(x.ignores, abs)
+	x.roots = make(map[string]string)
+	x.mu.Unlock()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProjectInfo describes the project the changed file is in, for
+// {{.Project}} in templates
+type ProjectInfo struct {
+	Root   string    // Top of the git repository the file is in; empty outside one
+	Branch string    // Current git branch; empty outside a repository or on a detached HEAD
+	Name   string    // Module or package name from the nearest go.mod, package.json or Cargo.toml, else the base name of Root
+	Time   time.Time // When the prompt was rendered, to the second
+}
+
+// lookupProject works out the ProjectInfo of the file at path. The manifest
+// naming the project is looked for from the file's directory up to the top
+// of its repository, or up to the filesystem root outside one.
+func lookupProject(path string, now time.Time) ProjectInfo {
+	dir := filepath.Dir(path)
+	info := ProjectInfo{Time: now.Truncate(time.Second)}
+	if root, err := git(dir, nil, "rev-parse", "--show-toplevel"); err == nil {
+		info.Root = filepath.Clean(root)
+		// symbolic-ref fails on a detached HEAD, leaving the branch empty
+		info.Branch, _ = git(dir, nil, "symbolic-ref", "--short", "-q", "HEAD")
+	}
+
+	// git reports the top of the repository with symlinks resolved
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if name := manifestName(d); name != "" {
+			info.Name = name
+			break
+		}
+		if d == info.Root || filepath.Dir(d) == d {
+			break
+		}
+	}
+	if info.Name == "" && info.Root != "" {
+		info.Name = filepath.Base(info.Root)
+	}
+	return info
+}
+
+// manifestName returns the module or package name declared by the first of
+// projectMarkerFiles in dir that declares one, or "" if none does
+func manifestName(dir string) string {
+	for _, file := range projectMarkerFiles {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		var name string
+		switch file {
+		case "go.mod":
+			name = goModuleName(string(content))
+		case "package.json":
+			var pkg struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(content, &pkg) == nil {
+				name = pkg.Name
+			}
+		case "Cargo.toml":
+			name = cargoPackageName(string(content))
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// goModuleName returns the module path of a go.mod file
+func goModuleName(content string) string {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "module"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			rest, _, _ = strings.Cut(rest, "//")
+			return unquoteManifest(strings.TrimSpace(rest))
+		}
+	}
+	return ""
+}
+
+// cargoPackageName returns the name in the [package] table of a Cargo.toml
+// file
+func cargoPackageName(content string) string {
+	inPackage := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inPackage = line == "[package]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if inPackage && ok && strings.TrimSpace(key) == "name" {
+			value, _, _ = strings.Cut(value, "#")
+			return unquoteManifest(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
+
+// unquoteManifest strips the quotes from a go.mod or Cargo.toml string,
+// which may be in double, single or back quotes
+func unquoteManifest(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
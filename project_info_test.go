@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestLookupProject(t *testing.T) {
+	dir := gitRepo(t)
+	if _, err := git(dir, nil, "checkout", "-q", "-b", "feature/login"); err != nil {
+		t.Fatalf("git checkout: %v", err)
+	}
+	root, _ := filepath.EvalSymlinks(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "services", "api", "handlers"), 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "services", "api", "go.mod"), "// The API\nmodule example.com/api // the service\n\ngo 1.23\n")
+
+	now := time.Date(2026, 10, 17, 9, 30, 15, 500, time.UTC)
+	info := lookupProject(filepath.Join(dir, "services", "api", "handlers", "user.go"), now)
+	want := ProjectInfo{Root: root, Branch: "feature/login", Name: "example.com/api", Time: now.Truncate(time.Second)}
+	if info != want {
+		t.Errorf("lookupProject() = %+v, want %+v", info, want)
+	}
+
+	// Without a manifest in the repository, the project is named after it
+	info = lookupProject(filepath.Join(dir, "main.go"), now)
+	if info.Name != filepath.Base(root) {
+		t.Errorf("lookupProject() name without a manifest = %q, want %q", info.Name, filepath.Base(root))
+	}
+
+	// A detached HEAD is on no branch
+	if _, err := git(dir, nil, "checkout", "-q", "--detach"); err != nil {
+		t.Fatalf("git checkout --detach: %v", err)
+	}
+	if info := lookupProject(filepath.Join(dir, "main.go"), now); info.Branch != "" || info.Root != root {
+		t.Errorf("lookupProject() on a detached HEAD = %+v", info)
+	}
+}
+
+func TestLookupProjectOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "package.json"), `{"name": "@acme/web", "version": "1.0.0"}`)
+
+	info := lookupProject(filepath.Join(dir, "index.js"), time.Now())
+	if info.Root != "" || info.Branch != "" || info.Name != "@acme/web" {
+		t.Errorf("lookupProject() outside a repository = %+v", info)
+	}
+}
+
+func TestManifestNames(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"go.mod", goModuleName("module github.com/jtrim/claudewatch\n\ngo 1.23\n"), "github.com/jtrim/claudewatch"},
+		{"quoted go.mod", goModuleName("module \"example.com/quoted\"\n"), "example.com/quoted"},
+		{"go.mod without module", goModuleName("go 1.23\n"), ""},
+		{"Cargo.toml", cargoPackageName("[workspace]\nname = \"ws\"\n\n[package]\nversion = \"0.1.0\"\nname = \"ripgrep\" # the crate\n"), "ripgrep"},
+		{"Cargo.toml single quotes", cargoPackageName("[package]\nname='fd'\n"), "fd"},
+		{"Cargo.toml without package", cargoPackageName("[workspace]\nmembers = [\"a\"]\n"), ""},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: name = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestTemplateProject(t *testing.T) {
+	calls := 0
+	data := TemplateData{File: "/src/a.go", project: func() ProjectInfo {
+		calls++
+		return ProjectInfo{Root: "/src", Branch: "main", Name: "api", Time: time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)}
+	}}
+	var out strings.Builder
+	template.Must(parsePromptTemplate("{{.File}}")).Execute(&out, data)
+	if calls != 0 {
+		t.Errorf("the project was looked up %d times for a template without {{.Project}}", calls)
+	}
+
+	out.Reset()
+	tmpl := template.Must(parsePromptTemplate(`You are working in branch {{.Project.Branch}} of {{.Project.Name}} ({{.Project.Root}}) at {{.Project.Time.Format "15:04"}}.`))
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if want := "You are working in branch main of api (/src) at 09:30."; out.String() != want {
+		t.Errorf("rendered %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	template.Must(parsePromptTemplate("[{{.Project.Name}}]")).Execute(&out, TemplateData{})
+	if out.String() != "[]" {
+		t.Errorf("rendered %q without a project lookup, want it empty", out.String())
+	}
+}
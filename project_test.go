@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// monorepo lays out a watched root with two projects and a shared directory
+// that belongs to neither
+func monorepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"services/api/internal", "web/src", "docs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	writeTestFile(t, filepath.Join(root, "services/api/go.mod"), "module api\n")
+	writeTestFile(t, filepath.Join(root, "web/package.json"), "{}\n")
+	writeTestFile(t, filepath.Join(root, "web", ignoreFileName), "^dist/\n")
+	return root
+}
+
+func TestProjectIndexRootOf(t *testing.T) {
+	root := monorepo(t)
+	x := newProjectIndex(&Config{ProjectScope: true, RootDirectories: []string{root}})
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"services/api/internal/server.go", "services/api"},
+		{"services/api/main.go", "services/api"},
+		{"web/src/app.tsx", "web"},
+		{"docs/guide.md", ""},
+	}
+	for _, tt := range tests {
+		want := ""
+		if tt.want != "" {
+			want = filepath.Join(root, tt.want)
+		}
+		if got := x.rootOf(filepath.Join(root, tt.file)); got != want {
+			t.Errorf("rootOf(%s) = %q, want %q", tt.file, got, want)
+		}
+	}
+
+	// A new project is found once the index is refreshed
+	writeTestFile(t, filepath.Join(root, "docs", "Cargo.toml"), "[package]\n")
+	x.refresh(filepath.Join(root, "docs"))
+	if got := x.rootOf(filepath.Join(root, "docs/guide.md")); got != filepath.Join(root, "docs") {
+		t.Errorf("rootOf after a new Cargo.toml = %q", got)
+	}
+
+	var none *projectIndex
+	if got := none.rootOf(filepath.Join(root, "web/src/app.tsx")); got != "" {
+		t.Errorf("rootOf on a nil index = %q", got)
+	}
+}
+
+func TestProjectIgnore(t *testing.T) {
+	root := monorepo(t)
+	config := &Config{ProjectScope: true, RootDirectories: []string{root}}
+	config.Projects = newProjectIndex(config)
+
+	// Patterns are matched relative to the project, and only within it
+	if ignored, reason := ShouldIgnorePathWithConfig(filepath.Join(root, "web/dist/bundle.js"), config); !ignored || !strings.Contains(reason, "project") {
+		t.Errorf("web/dist/bundle.js: ignored = %v (%s), want ignored by the project", ignored, reason)
+	}
+	if ignored, _ := ShouldIgnorePathWithConfig(filepath.Join(root, "services/api/dist/x.go"), config); ignored {
+		t.Error("web's .claudewatchignore applied to another project")
+	}
+	if ignored, _ := ShouldIgnorePathWithConfig(filepath.Join(root, "web/src/app.tsx"), config); ignored {
+		t.Error("web/src/app.tsx ignored")
+	}
+}
+
+func TestDefaultTemplateProjectScope(t *testing.T) {
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := TemplateData{File: "/repo/web/src/app.tsx", Type: claudewatch.TypeEdit}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "do not modify any other files") {
+		t.Errorf("unscoped prompt lacks the single-file constraint:\n%s", out.String())
+	}
+
+	data.ProjectRoot = "/repo/web"
+	out.Reset()
+	if err := tmpl.Execute(&out, data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "do not modify any files outside the project in /repo/web") || strings.Contains(out.String(), "any other files") {
+		t.Errorf("scoped prompt:\n%s", out.String())
+	}
+}
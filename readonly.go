@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// accessWrite is the W_OK mode of access(2)
+const accessWrite = 0x2
+
+// isReadOnly reports whether markers can't be stripped from path: the file,
+// or the directory the rewrite's temporary file goes in, isn't writable, as
+// with build outputs and read-only mounts
+func isReadOnly(path string) bool {
+	for _, p := range []string{path, filepath.Dir(path)} {
+		if err := syscall.Access(p, accessWrite); err != nil && isPermissionError(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPermissionError reports whether err means a file can't be written
+func isPermissionError(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
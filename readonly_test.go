@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestIsPermissionError(t *testing.T) {
+	if !isPermissionError(&os.PathError{Op: "open", Path: "f", Err: syscall.EACCES}) {
+		t.Error("EACCES is not a permission error")
+	}
+	if !isPermissionError(fmt.Errorf("writing: %w", syscall.EROFS)) {
+		t.Error("EROFS is not a permission error")
+	}
+	if isPermissionError(os.ErrNotExist) {
+		t.Error("ENOENT is a permission error")
+	}
+}
+
+func TestProcessLeavesReadOnlyFileAlone(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can write read-only files")
+	}
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	path := filepath.Join(dir, "gen.go")
+	content := "package p\n// ai! fix the generator\n"
+	if err := os.WriteFile(path, []byte(content), 0o444); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0o755) })
+
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := make(chan promptRequest, 2)
+	p := newFileProcessor(&Config{}, newPromptResolver(tmpl, nil, nil), prompts)
+	p.process(path)
+
+	if got := readString(t, path); got != content {
+		t.Errorf("read-only file rewritten to %q", got)
+	}
+	if req := <-prompts; !strings.Contains(req.Prompt, "is read-only, so do not try to edit it") {
+		t.Errorf("prompt = %q, want it to say the file is read-only", req.Prompt)
+	}
+
+	// As with --keep-markers, the marker is only sent once
+	p.cooldown.forget(path)
+	p.process(path)
+	select {
+	case req := <-prompts:
+		t.Errorf("marker sent again: %q", req.Prompt)
+	default:
+	}
+}
+
+func TestDefaultTemplateMentionsReadOnly(t *testing.T) {
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, readOnly := range []bool{false, true} {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, TemplateData{File: "/tmp/x.go", ReadOnly: readOnly}); err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		if got := strings.Contains(buf.String(), "/tmp/x.go is read-only"); got != readOnly {
+			t.Errorf("ReadOnly=%v: prompt mentions read-only = %v", readOnly, got)
+		}
+	}
+}
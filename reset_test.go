@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// noResetDelay skips the pause after a reset for the rest of the test
+func noResetDelay(t *testing.T) {
+	old := resetSettleDelay
+	resetSettleDelay = 0
+	t.Cleanup(func() { resetSettleDelay = old })
+}
+
+func TestFindResetDirectives(t *testing.T) {
+	content := "// ai:reset\nx := 1 // AI:RESET\n// ai:resets are fun\n// ai:reset and fix this ai!\nlog(\"ai:reset\")\n"
+	directives := defaultMarkerScanner.ScanResets(content)
+	if len(directives) != 2 || directives[0].LineNumber != 1 || directives[1].LineNumber != 2 {
+		t.Fatalf("directives = %+v, want lines 1 and 2", directives)
+	}
+	if directives[0].Type != claudewatch.TypeReset {
+		t.Errorf("Type = %q, want %q", directives[0].Type, claudewatch.TypeReset)
+	}
+}
+
+func TestRemoveResetDirectives(t *testing.T) {
+	content := "a\n// ai:reset\nx := 1 // ai:reset\n# ai:reset new topic\n"
+	updated, _, err := defaultMarkerScanner.StripMarkers(content, defaultMarkerScanner.ScanResets(content))
+	if err != nil {
+		t.Fatalf("StripMarkers: %v", err)
+	}
+	if want := "a\nx := 1\n# new topic\n"; updated != want {
+		t.Errorf("updated = %q, want %q", updated, want)
+	}
+}
+
+func TestProcessSendsResetFirst(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte("// use a map ai!\n// ai:reset\nfunc f() {}\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	prompts := make(chan promptRequest, 2)
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{range .Markers}}{{.LineText}}{{end}}")), nil, nil)
+	p := newFileProcessor(&Config{}, resolver, prompts)
+
+	p.process(path)
+	if len(prompts) != 2 {
+		t.Fatalf("queued %d requests, want a reset and a prompt", len(prompts))
+	}
+	if reset := <-prompts; !reset.Reset || reset.Prompt != clearCommand {
+		t.Errorf("first request = %+v, want the reset", reset)
+	}
+	if prompt := <-prompts; prompt.Reset || prompt.Prompt != "// use a map" {
+		t.Errorf("second request = %+v, want the marker's prompt", prompt)
+	}
+	if got := readString(t, path); got != "// use a map\nfunc f() {}\n" {
+		t.Errorf("file = %q, want the directive and marker removed", got)
+	}
+}
+
+func TestDispatcherResetSendsPreambleOnce(t *testing.T) {
+	noResetDelay(t)
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary, preamble: "Use tabs."}
+
+	for _, req := range []promptRequest{
+		{Prompt: "first"},
+		{Prompt: clearCommand, Reset: true},
+		{Prompt: "second"},
+		{Prompt: "third"},
+	} {
+		if err := d.submit(req); err != nil {
+			t.Fatalf("submit(%q): %v", req.Prompt, err)
+		}
+	}
+
+	want := "first|/clear|Use tabs.\n\nsecond|third"
+	if got := strings.Join(primary.prompts, "|"); got != want {
+		t.Errorf("primary received %q, want %q", got, want)
+	}
+}
+
+func TestDispatcherResetSkippedAfterFailover(t *testing.T) {
+	noResetDelay(t)
+	primary := &fakeBackend{name: "primary", err: errors.New("pty closed")}
+	fallback := &fakeBackend{name: "fallback"}
+	d := &dispatcher{primary: primary, fallback: fallback}
+
+	restored := false
+	if err := d.submit(promptRequest{Prompt: clearCommand, Reset: true, Restore: func() { restored = true }}); err != nil {
+		t.Fatalf("submit(reset): %v", err)
+	}
+	if err := d.submit(promptRequest{Prompt: clearCommand, Reset: true}); err != nil {
+		t.Fatalf("submit(reset): %v", err)
+	}
+	if len(fallback.prompts) != 0 || restored {
+		t.Errorf("fallback received %q (restored %v), want no reset sent to it and nothing restored", fallback.prompts, restored)
+	}
+}
+
+func TestResolveSignalActionsAcceptsReset(t *testing.T) {
+	actions, err := resolveSignalActions(map[string]string{"USR2": "reset"})
+	if err != nil {
+		t.Fatalf("resolveSignalActions: %v", err)
+	}
+	if actions[syscall.SIGUSR2] != signalActionReset {
+		t.Errorf("SIGUSR2 = %q, want reset", actions[syscall.SIGUSR2])
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// defaultRestartLimit is how many times --restart-on-exit relaunches Claude
+// when no number is given
+const defaultRestartLimit = 3
+
+// restartDelay is how long claudewatch waits before relaunching Claude, which
+// is the user's chance to press Ctrl-C and quit instead
+var restartDelay = 3 * time.Second
+
+// outputDrainTimeout bounds how long Claude's remaining output is copied
+// after it exits, in case something it started still holds the terminal
+var outputDrainTimeout = time.Second
+
+// restartLimitFlag is the value of --restart-on-exit, which takes an optional
+// number: "--restart-on-exit" alone allows defaultRestartLimit restarts
+type restartLimitFlag struct {
+	limit *int
+}
+
+func (f restartLimitFlag) String() string {
+	if f.limit == nil {
+		return "0"
+	}
+	return strconv.Itoa(*f.limit)
+}
+
+// IsBoolFlag lets the flag be given without a value
+func (f restartLimitFlag) IsBoolFlag() bool { return true }
+
+func (f restartLimitFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*f.limit = defaultRestartLimit
+	case "false":
+		*f.limit = 0
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%q is not a number of restarts", value)
+		}
+		*f.limit = n
+	}
+	return nil
+}
+
+// ptySession is the Claude CLI running on a PTY. With --restart-on-exit it
+// is relaunched when it exits; writes always go to the current process.
+type ptySession struct {
+	command string
+	args    []string
+
+	mu  sync.Mutex
+	pty *os.File
+	cmd *exec.Cmd
+}
+
+// start launches Claude on a new PTY, sized like claudewatch's terminal.
+// Any previous PTY is closed.
+func (c *ptySession) start() error {
+	cmd := exec.Command(c.command, c.args...)
+	ptyMaster, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	// Not being run from a terminal leaves the default size
+	_ = pty.InheritSize(os.Stdin, ptyMaster)
+
+	c.mu.Lock()
+	previous := c.pty
+	c.pty, c.cmd = ptyMaster, cmd
+	c.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// current returns the PTY of the current process
+func (c *ptySession) current() *os.File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pty
+}
+
+// pid returns the process ID of the current process
+func (c *ptySession) pid() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cmd.Process.Pid
+}
+
+// Write types p into the current process's terminal
+func (c *ptySession) Write(p []byte) (int, error) {
+	return c.current().Write(p)
+}
+
+// resize gives the current PTY the size of claudewatch's terminal
+func (c *ptySession) resize() error {
+	return pty.InheritSize(os.Stdin, c.current())
+}
+
+// run copies the current process's output to output until it exits, and
+// returns how it exited. Meanwhile SIGINT and SIGTERM sent to claudewatch are
+// passed on to Claude's process group (it leads its own session on the PTY);
+// the last one passed on is returned.
+func (c *ptySession) run(output io.Writer) (os.Signal, error) {
+	c.mu.Lock()
+	ptyMaster, cmd := c.pty, c.cmd
+	c.mu.Unlock()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	var forwarded os.Signal
+	forwarding := make(chan struct{})
+	go func() {
+		for sig := range signals {
+			forwarded = sig
+			_ = syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+		}
+		close(forwarding)
+	}()
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(output, ptyMaster)
+		close(copied)
+	}()
+	err := cmd.Wait()
+	select {
+	case <-copied:
+	case <-time.After(outputDrainTimeout):
+	}
+
+	signal.Stop(signals)
+	close(signals)
+	<-forwarding
+	return forwarded, err
+}
+
+// exitStatus is the status claudewatch exits with after Claude ended with
+// err: Claude's own, or 128 plus the signal that killed it, as shells report
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// close closes the current PTY
+func (c *ptySession) close() {
+	if f := c.current(); f != nil {
+		f.Close()
+	}
+}
+
+// awaitRestart tells the user Claude is about to be relaunched and waits
+// restartDelay, returning false if they press Ctrl-C to quit instead. The
+// terminal is taken out of raw mode meanwhile, so Ctrl-C raises SIGINT.
+func awaitRestart(restoreTerminal, rawTerminal func(), n, limit int) bool {
+	restoreTerminal()
+	defer rawTerminal()
+	fmt.Fprintf(os.Stderr, "\r\nclaudewatch: Claude exited; restarting it in %s (%d of %d), or press Ctrl-C to quit\n", restartDelay, n, limit)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+		return false
+	case <-time.After(restartDelay):
+		return true
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestPTYSessionRestarts(t *testing.T) {
+	session := &ptySession{command: "sh", args: []string{"-c", "read line; echo got $line"}}
+	for run := 1; run <= 2; run++ {
+		if err := session.start(); err != nil {
+			t.Fatalf("start %d: %v", run, err)
+		}
+		// Writes go to whichever process is current
+		if _, err := session.Write([]byte("hello\n")); err != nil {
+			t.Fatalf("Write %d: %v", run, err)
+		}
+		var output bytes.Buffer
+		if _, err := session.run(&output); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if !strings.Contains(output.String(), "got hello") {
+			t.Errorf("run %d output = %q, want the process to have read the input", run, output.String())
+		}
+	}
+	session.close()
+}
+
+// notifyWriter closes ready on the first write to it
+type notifyWriter struct {
+	ready chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.ready:
+	default:
+		close(w.ready)
+	}
+	return len(p), nil
+}
+
+func TestPTYSessionForwardsSignals(t *testing.T) {
+	session := &ptySession{command: "sh", args: []string{"-c", "echo ready; sleep 5"}}
+	if err := session.start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer session.close()
+
+	// Once Claude has written something, run is passing signals on
+	output := &notifyWriter{ready: make(chan struct{})}
+	go func() {
+		<-output.ready
+		_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+	forwarded, err := session.run(output)
+	if forwarded != syscall.SIGTERM {
+		t.Errorf("run() forwarded %v, want SIGTERM", forwarded)
+	}
+	if got := exitStatus(err); got != 128+int(syscall.SIGTERM) {
+		t.Errorf("exitStatus() = %d, want %d after SIGTERM (err %v)", got, 128+int(syscall.SIGTERM), err)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	if got := exitStatus(nil); got != 0 {
+		t.Errorf("exitStatus(nil) = %d, want 0", got)
+	}
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if got := exitStatus(err); got != 3 {
+		t.Errorf("exitStatus(exit 3) = %d, want 3", got)
+	}
+	if got := exitStatus(errors.New("pty closed")); got != 1 {
+		t.Errorf("exitStatus(other error) = %d, want 1", got)
+	}
+}
+
+func TestDispatcherHoldsPromptsWhileRestarting(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+
+	d.setUnavailable(true)
+	if err := d.submit(promptRequest{Prompt: "first"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if results := d.deliverBatch(); len(results) != 0 {
+		t.Errorf("a digest batch while restarting sent %d prompts", len(results))
+	}
+	if len(primary.prompts) != 0 {
+		t.Fatalf("prompts sent while restarting: %q", primary.prompts)
+	}
+
+	d.setUnavailable(false)
+	if strings.Join(primary.prompts, ",") != "first" {
+		t.Errorf("prompts after the restart = %q, want the held one", primary.prompts)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// stripFile writes content to a temp file, strips its markers and returns the
+// path along with the original and updated markers
+func stripFile(t *testing.T, content string) (string, []claudewatch.Marker, []claudewatch.Marker) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	original := defaultMarkerScanner.Scan(content)
+	updated, err := removeAIMarkersFromFile(defaultMarkerScanner, path, original)
+	if err != nil {
+		t.Fatalf("removeAIMarkersFromFile: %v", err)
+	}
+	return path, original, updated
+}
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(content)
+}
+
+func TestRestoreAIMarkersInFile(t *testing.T) {
+	content := "package main\n// use a map ai!\nfunc f() {}\n"
+	path, original, updated := stripFile(t, content)
+
+	missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated)
+	if err != nil || missing != 0 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 0, nil", missing, err)
+	}
+	if got := readString(t, path); got != content {
+		t.Errorf("restored content = %q, want %q", got, content)
+	}
+}
+
+func TestRestoreAIMarkersFollowsMovedLines(t *testing.T) {
+	path, original, updated := stripFile(t, "// use a map ai!\nfunc f() {}\n")
+	if err := os.WriteFile(path, []byte("// new header\n// use a map\nfunc f() {}\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated); err != nil || missing != 0 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 0, nil", missing, err)
+	}
+	if got, want := readString(t, path), "// new header\n// use a map ai!\nfunc f() {}\n"; got != want {
+		t.Errorf("restored content = %q, want %q", got, want)
+	}
+}
+
+func TestRestoreAIMarkersSkipsEditedLines(t *testing.T) {
+	path, original, updated := stripFile(t, "// use a map ai!\n// add logging ai!\n")
+	edited := "// use a slice after all\n// add logging\n"
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated)
+	if err != nil || missing != 1 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 1, nil", missing, err)
+	}
+	if got, want := readString(t, path), "// use a slice after all\n// add logging ai!\n"; got != want {
+		t.Errorf("restored content = %q, want %q", got, want)
+	}
+}
+
+func TestRestoreAIMarkersSkipsAmbiguousMovedLines(t *testing.T) {
+	path, original, updated := stripFile(t, "// fix this ai!\nfunc f() {}\n")
+	moved := "package main\n// fix this\nfunc f() {}\n// fix this\n"
+	if err := os.WriteFile(path, []byte(moved), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated)
+	if err != nil || missing != 1 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 1, nil", missing, err)
+	}
+	if got := readString(t, path); got != moved {
+		t.Errorf("restored content = %q, want it unchanged", got)
+	}
+}
+
+func TestDispatcherRestoresOnFailedDelivery(t *testing.T) {
+	restored := 0
+	req := promptRequest{Prompt: "p", Restore: func() { restored++ }}
+
+	d := &dispatcher{primary: &fakeBackend{name: "primary"}}
+	if err := d.deliver(req); err != nil || restored != 0 {
+		t.Fatalf("deliver() = %v with %d restores, want success without restoring", err, restored)
+	}
+
+	d = &dispatcher{primary: &fakeBackend{name: "primary", err: errors.New("pty closed")}}
+	if err := d.deliver(req); err == nil || restored != 1 {
+		t.Errorf("deliver() = %v with %d restores, want an error and one restore", err, restored)
+	}
+}
+
+func TestDispatcherAbandonRestoresHeldPrompts(t *testing.T) {
+	restored := 0
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+	d.togglePause()
+	_ = d.submit(promptRequest{Prompt: "p", Restore: func() { restored++ }})
+
+	d.abandon()
+	if restored != 1 || len(primary.prompts) != 0 {
+		t.Errorf("abandon() restored %d and sent %d prompts, want 1 restored and none sent", restored, len(primary.prompts))
+	}
+}
+
+func TestProcessRestoresMarkersWhenDeliveryFails(t *testing.T) {
+	content := "// use a map ai!\n"
+	path := filepath.Join(t.TempDir(), "f.go")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	resolver := newPromptResolver(template.Must(parsePromptTemplate("{{.File}}")), nil, nil)
+	prompts := make(chan promptRequest, 1)
+	p := newFileProcessor(&Config{}, resolver, prompts)
+	p.process(path)
+
+	d := &dispatcher{primary: &fakeBackend{name: "primary", err: errors.New("pty closed")}}
+	if err := d.submit(<-prompts); err == nil {
+		t.Fatal("submit() succeeded, want the delivery error")
+	}
+	if got := readString(t, path); got != content {
+		t.Fatalf("content after failed delivery = %q, want the markers restored", got)
+	}
+
+	// The restored markers aren't re-sent until the file changes again
+	p.cooldown.forget(path)
+	p.process(path)
+	select {
+	case req := <-prompts:
+		t.Errorf("restored file was re-sent: %q", req.Prompt)
+	default:
+	}
+}
+
+func TestRestoreAIMarkersReinsertsDeletedLines(t *testing.T) {
+	content := "// Use a map here\n// ai!\nvar m []int\n// !ai\n"
+	path, original, updated := stripFile(t, content)
+	if got := readString(t, path); got != "// Use a map here\nvar m []int\n" {
+		t.Fatalf("stripped content = %q, want the empty comment lines deleted", got)
+	}
+
+	if missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated); err != nil || missing != 0 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 0, nil", missing, err)
+	}
+	if got := readString(t, path); got != content {
+		t.Errorf("restored content = %q, want %q", got, content)
+	}
+}
+func TestRestoreAIMarkersKeepsCRLF(t *testing.T) {
+	content := "package main\r\n// use a map ai!\r\n// ai!\r\nfunc f() {}\r\n"
+	path, original, updated := stripFile(t, content)
+	if got := readString(t, path); got != "package main\r\n// use a map\r\nfunc f() {}\r\n" {
+		t.Fatalf("stripped content = %q", got)
+	}
+
+	if missing, err := restoreAIMarkersInFile(defaultMarkerScanner, path, original, updated); err != nil || missing != 0 {
+		t.Fatalf("restoreAIMarkersInFile() = %d, %v; want 0, nil", missing, err)
+	}
+	if got := readString(t, path); got != content {
+		t.Errorf("restored content = %q, want %q", got, content)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// markerSighting is a marker found by "claudewatch scan"
+type markerSighting struct {
+	path   string
+	marker claudewatch.Marker
+}
+
+// runScan implements "claudewatch scan": it walks the given directories once,
+// as the watcher would, and lists the markers waiting in them. It returns the
+// process exit code: 0 when there are none, 1 when there are (so CI can fail
+// on them) and 2 for errors.
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	ignore := fs.String("ignore", "", "Regex pattern of files to skip, as with claudewatch --ignore")
+	configPath := fs.String("config", "", "Config file to use instead of the nearest .claudewatch.json")
+	followSymlinks := fs.Bool("follow-symlinks", false, "Walk symlinked directories too")
+	noBuiltinIgnores := fs.Bool("no-builtin-ignores", false, "Scan editors' temp files too, as with claudewatch --no-builtin-ignores")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: claudewatch scan [options] [directory...]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "List the markers waiting in the files claudewatch would watch, without starting")
+		fmt.Fprintln(fs.Output(), "Claude. Exits 1 if there are any.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	config := &Config{
+		RootDirectories:  fs.Args(),
+		FollowSymlinks:   *followSymlinks,
+		WatchEditorTemps: *noBuiltinIgnores,
+		ConfigPath:       *configPath,
+	}
+	if len(config.RootDirectories) == 0 {
+		config.RootDirectories = []string{"."}
+	}
+	for _, dir := range config.RootDirectories {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", dir)
+			return 2
+		}
+	}
+	if *ignore != "" {
+		pattern, err := regexp.Compile(*ignore)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing ignore pattern: %v\n", err)
+			return 2
+		}
+		config.IgnorePattern = pattern
+	}
+	if config.ConfigPath == "" {
+		config.ConfigPath = findConfigFile(".")
+	}
+	if config.ConfigPath != "" {
+		fileConfig, err := LoadFileConfig(config.ConfigPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading config file: %v\n", err)
+			return 2
+		}
+		config.FileConfig = fileConfig
+	}
+	config.MaxFileSize = maxFileSize(-1, config.FileConfig)
+	scanner, err := newMarkerScanner(config.FileConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config file: %v\n", err)
+		return 2
+	}
+	config.Scanner = scanner
+	loadAllIgnorePatterns(config)
+
+	sightings := scanMarkers(config)
+	files := make(map[string]bool)
+	for _, s := range sightings {
+		fmt.Printf("%s:%d: %s\n", s.path, s.marker.LineNumber, strings.TrimSpace(s.marker.LineText))
+		files[s.path] = true
+	}
+	if len(sightings) == 0 {
+		fmt.Fprintln(os.Stderr, "No markers found")
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Found %d markers in %d files\n", len(sightings), len(files))
+	return 1
+}
+
+// scanMarkers returns the markers in every file the watcher would consider,
+// in path and then line order. Binary and oversized files are skipped, as
+// they are when watching.
+func scanMarkers(config *Config) []markerSighting {
+	var sightings []markerSighting
+	walkWatchedFiles(config, func(path string) {
+		content, skip, err := claudewatch.ReadScannable(path, config.MaxFileSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return
+		}
+		if skip != "" {
+			return
+		}
+		for _, marker := range config.markerScanner().ScanFile(path, string(content)) {
+			sightings = append(sightings, markerSighting{path: path, marker: marker})
+		}
+	})
+	return sightings
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// diffScanMinSize is the size from which a file's lines are remembered
+// between scans, so that a save only has its changed lines checked for
+// markers. Smaller files are cheap enough to scan in full every time.
+const diffScanMinSize = 256 << 10
+
+// scanCache remembers the lines of large files as last scanned
+type scanCache struct {
+	scanner *claudewatch.Scanner
+
+	mu    sync.Mutex
+	files map[string]*scannedFile
+}
+
+// scannedFile is a file as last scanned
+type scannedFile struct {
+	lines map[uint64]int // How many lines have each hash
+	clean bool           // No line may hold a marker (see claudewatch.Scanner.MayHoldMarker)
+}
+
+func newScanCache(scanner *claudewatch.Scanner) *scanCache {
+	return &scanCache{scanner: scanner, files: make(map[string]*scannedFile)}
+}
+
+// unchanged reports whether content can't have markers, judging by the lines
+// that changed since path was last seen: the file had no line that may hold
+// one and none of the lines added since does. A file seen for the first time
+// (or again after being renamed or removed) is never judged this way, as
+// there is nothing to compare with.
+func (c *scanCache) unchanged(path string, content []byte) bool {
+	if len(content) < diffScanMinSize {
+		c.forget(path)
+		return false
+	}
+	lines, _ := claudewatch.SplitLines(string(content))
+
+	c.mu.Lock()
+	previous := c.files[path]
+	c.mu.Unlock()
+
+	current := &scannedFile{lines: make(map[uint64]int, len(lines)), clean: true}
+	var remaining map[uint64]int // Lines of the previous version not matched yet
+	if previous != nil && previous.clean {
+		remaining = make(map[uint64]int, len(previous.lines))
+		for hash, n := range previous.lines {
+			remaining[hash] = n
+		}
+	}
+	for _, line := range lines {
+		hash := lineHash(line)
+		current.lines[hash]++
+		if remaining[hash] > 0 {
+			// Unchanged lines of a clean file hold no markers
+			remaining[hash]--
+			continue
+		}
+		if current.clean && c.scanner.MayHoldMarker(line) {
+			current.clean = false
+		}
+	}
+
+	c.mu.Lock()
+	c.files[path] = current
+	c.mu.Unlock()
+	return previous != nil && previous.clean && current.clean
+}
+
+// forget drops what is remembered about path, and about the files under it
+// when it was a directory, so their next scans are full ones
+func (c *scanCache) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	c.mu.Lock()
+	for file := range c.files {
+		if file == path || strings.HasPrefix(file, prefix) {
+			delete(c.files, file)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// lineHash hashes a line for comparison with the previous version of a file
+func lineHash(line string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	return h.Sum64()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// largeSource returns Go source of at least diffScanMinSize bytes
+func largeSource() string {
+	var b strings.Builder
+	b.WriteString("package p\n")
+	for i := 0; b.Len() < diffScanMinSize; i++ {
+		b.WriteString("var x = 1 // plain line\n")
+	}
+	return b.String()
+}
+
+func TestScanCacheUnchanged(t *testing.T) {
+	c := newScanCache(defaultMarkerScanner)
+	content := largeSource()
+
+	if c.unchanged("f.go", []byte(content)) {
+		t.Error("a file seen for the first time was not scanned")
+	}
+	edited := strings.Replace(content, "var x = 1", "var y = 2", 1)
+	if !c.unchanged("f.go", []byte(edited)) {
+		t.Error("an edit without markers was scanned")
+	}
+	marked := edited + "// tidy this ai!\n"
+	if c.unchanged("f.go", []byte(marked)) {
+		t.Error("an added marker was not scanned")
+	}
+	// While the file holds a marker, every save is scanned in full
+	if c.unchanged("f.go", []byte(marked+"var z = 3\n")) {
+		t.Error("a file holding a marker was not scanned")
+	}
+	// Once it is stripped, changed lines are enough again
+	if c.unchanged("f.go", []byte(edited+"// tidy this\n")) {
+		t.Error("the save after a strip was not scanned in full")
+	}
+	if !c.unchanged("f.go", []byte(edited+"// tidy this\nvar z = 3\n")) {
+		t.Error("an edit without markers was scanned")
+	}
+
+	c.forget("f.go")
+	if c.unchanged("f.go", []byte(edited)) {
+		t.Error("a renamed file was not scanned in full")
+	}
+	if c.unchanged("small.go", []byte("package p\n")) || c.unchanged("small.go", []byte("package q\n")) {
+		t.Error("a small file was not scanned in full")
+	}
+}
+
+func TestProcessFindsMarkerAddedToLargeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.go")
+	content := largeSource()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	tmpl, err := GetDefaultPromptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompts := make(chan promptRequest, 1)
+	p := newFileProcessor(&Config{}, newPromptResolver(tmpl, nil, nil), prompts)
+	p.process(path)
+
+	// Removing an ai:ignore makes an existing marker active; adding the line
+	// holding the directive had the file scanned in full
+	withMarker := strings.Replace(content, "var x = 1 // plain line\n", "// ai:ignore\n// split this file ai!\n", 1)
+	if err := os.WriteFile(path, []byte(withMarker), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	p.cooldown.forget(path)
+	p.process(path)
+	if len(prompts) != 0 {
+		t.Fatal("an ignored marker was sent")
+	}
+
+	activated := strings.Replace(withMarker, "// ai:ignore\n", "", 1)
+	if err := os.WriteFile(path, []byte(activated), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	p.cooldown.forget(path)
+	p.process(path)
+	if req := <-prompts; !strings.Contains(req.Prompt, "Line 2: // split this file") {
+		t.Errorf("prompt = %q, want the marker that was ignored", firstLine(req.Prompt))
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renameSettleDelay is how long a changed file must go without being renamed
+// or removed before it is scanned. Atomic-save editors write a temp file and
+// rename it over the target within a few milliseconds; waiting lets the temp
+// file disappear so only the final destination is scanned and stripped.
+const renameSettleDelay = 100 * time.Millisecond
+
+// scanScheduler delays scans of changed paths until their rename chain has
+// settled. Each new event for a path restarts its timer; a rename or removal
+// of the path cancels the pending scan, since the content now lives (or will
+// be created) under a different name.
+type scanScheduler struct {
+	mu         sync.Mutex
+	delay      time.Duration
+	formatters *formatterActivity // While a formatter runs, scans wait longer for its write
+	pending    map[string]*time.Timer
+	ready      chan string // Paths whose scan is due
+}
+
+func newScanScheduler(delay time.Duration) *scanScheduler {
+	return &scanScheduler{
+		delay:   delay,
+		pending: make(map[string]*time.Timer),
+		ready:   make(chan string, 64),
+	}
+}
+
+// schedule (re)starts the settle timer for path
+func (s *scanScheduler) schedule(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if timer, ok := s.pending[path]; ok {
+		timer.Stop()
+	}
+	delay := s.delay
+	if settle, _ := s.formatters.settleDelay(); settle > delay {
+		delay = settle
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		current := s.pending[path] == timer
+		if current {
+			delete(s.pending, path)
+		}
+		s.mu.Unlock()
+		if current {
+			s.ready <- path
+		}
+	})
+	s.pending[path] = timer
+}
+
+// cancel drops the pending scan for path, and those of any paths under it
+// when it was a directory, returning true if one was pending
+func (s *scanScheduler) cancel(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelled := false
+	prefix := path + string(filepath.Separator)
+	for pending, timer := range s.pending {
+		if pending == path || strings.HasPrefix(pending, prefix) {
+			timer.Stop()
+			delete(s.pending, pending)
+			cancelled = true
+		}
+	}
+	return cancelled
+}
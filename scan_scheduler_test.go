@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const testSettleDelay = 20 * time.Millisecond
+
+// receivePath waits for the next ready path, failing the test on timeout
+func receivePath(t *testing.T, s *scanScheduler) string {
+	t.Helper()
+	select {
+	case path := <-s.ready:
+		return path
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a scheduled scan")
+		return ""
+	}
+}
+
+// expectNoPath fails the test if any path becomes ready within a few settle delays
+func expectNoPath(t *testing.T, s *scanScheduler) {
+	t.Helper()
+	select {
+	case path := <-s.ready:
+		t.Fatalf("unexpected scan of %s", path)
+	case <-time.After(5 * testSettleDelay):
+	}
+}
+
+func TestScanSchedulerScansAfterSettling(t *testing.T) {
+	s := newScanScheduler(testSettleDelay)
+	s.schedule("/repo/main.go")
+
+	if got := receivePath(t, s); got != "/repo/main.go" {
+		t.Errorf("ready path = %q, want /repo/main.go", got)
+	}
+}
+
+func TestScanSchedulerCoalescesRepeatedEvents(t *testing.T) {
+	s := newScanScheduler(testSettleDelay)
+	s.schedule("/repo/main.go")
+	s.schedule("/repo/main.go")
+	s.schedule("/repo/main.go")
+
+	receivePath(t, s)
+	expectNoPath(t, s)
+}
+
+func TestScanSchedulerFollowsRenameChain(t *testing.T) {
+	s := newScanScheduler(testSettleDelay)
+
+	// Atomic save: temp file created and written, then renamed over the target
+	s.schedule("/repo/.main.go.tmp1234")
+	if !s.cancel("/repo/.main.go.tmp1234") {
+		t.Fatal("cancel() = false, want true for a pending temp file")
+	}
+	s.schedule("/repo/main.go")
+
+	if got := receivePath(t, s); got != "/repo/main.go" {
+		t.Errorf("ready path = %q, want only the rename destination", got)
+	}
+	expectNoPath(t, s)
+}
+
+func TestScanSchedulerCancelWithoutPending(t *testing.T) {
+	s := newScanScheduler(testSettleDelay)
+	if s.cancel("/repo/never-seen.go") {
+		t.Error("cancel() = true for a path that was never scheduled")
+	}
+}
+
+func TestScanSchedulerCancelsScansUnderDirectory(t *testing.T) {
+	s := newScanScheduler(testSettleDelay)
+	s.schedule("/repo/pkg/a.go")
+	s.schedule("/repo/pkg/sub/b.go")
+	s.schedule("/repo/pkgs/c.go")
+
+	if !s.cancel("/repo/pkg") {
+		t.Error("cancel(/repo/pkg) = false, want the scans under it dropped")
+	}
+	if got := receivePath(t, s); got != "/repo/pkgs/c.go" {
+		t.Errorf("ready path = %q, want only /repo/pkgs/c.go", got)
+	}
+	expectNoPath(t, s)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanMarkers(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"sub", "gen", ".hidden"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatalf("Mkdir: %v", err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "a.go"), "package a\n// use a map ai!\n// ai:ignore\n// not this one ai!\n")
+	writeTestFile(t, filepath.Join(dir, "sub", "b.py"), "x = 1  # why? ai?\n")           // ai:ignore
+	writeTestFile(t, filepath.Join(dir, "gen", "c.go"), "// generated ai!\n")            // ai:ignore
+	writeTestFile(t, filepath.Join(dir, ".hidden", "d.go"), "// hidden ai!\n")           // ai:ignore
+	writeTestFile(t, filepath.Join(dir, "logo.png"), "\x89PNG\r\n\x1a\n\x00\x00 // ai!") // ai:ignore
+	writeTestFile(t, filepath.Join(dir, ignoreFileName), "^.*/gen/\n")
+
+	config := &Config{RootDirectories: []string{dir}}
+	loadAllIgnorePatterns(config)
+	sightings := scanMarkers(config)
+
+	want := []struct {
+		path string
+		line int
+	}{
+		{filepath.Join(dir, "a.go"), 2},
+		{filepath.Join(dir, "sub", "b.py"), 1},
+	}
+	if len(sightings) != len(want) {
+		t.Fatalf("scanMarkers = %+v, want %d markers", sightings, len(want))
+	}
+	for i, w := range want {
+		if sightings[i].path != w.path || sightings[i].marker.LineNumber != w.line {
+			t.Errorf("marker %d = %s:%d, want %s:%d", i, sightings[i].path, sightings[i].marker.LineNumber, w.path, w.line)
+		}
+	}
+}
+
+func TestRunScanExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	writeTestFile(t, filepath.Join(dir, "a.go"), "package a\n")
+	if code := runScan(nil); code != 0 {
+		t.Errorf("runScan without markers = %d, want 0", code)
+	}
+	writeTestFile(t, filepath.Join(dir, "a.go"), "package a\n// use a map ai!\n") // ai:ignore
+	if code := runScan(nil); code != 1 {
+		t.Errorf("runScan with a marker = %d, want 1", code)
+	}
+	if code := runScan([]string{"--ignore", `\.go$`}); code != 0 {
+		t.Errorf("runScan --ignore = %d, want 0", code)
+	}
+	if code := runScan([]string{"missing"}); code != 2 {
+		t.Errorf("runScan of a missing directory = %d, want 2", code)
+	}
+	if code := runScan([]string{"--ignore", "("}); code != 2 {
+		t.Errorf("runScan with a bad pattern = %d, want 2", code)
+	}
+}
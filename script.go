@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// scriptFunction is the function a --script must define
+const scriptFunction = "prompt"
+
+// mainTarget names the main Claude session as a script's target
+const mainTarget = "main"
+
+// scriptTimeout bounds how long a script may take for one prompt before the
+// prompt is sent as rendered
+var scriptTimeout = 5 * time.Second
+
+// promptScript is a Starlark script given with --script, which sees each
+// rendered prompt before it is queued and decides what is sent, and where.
+// Its prompt(ctx) function is called with:
+//
+//	ctx.file       the changed file (the first, when coalesced)
+//	ctx.files      every file the prompt is for
+//	ctx.type       "edit" or "question"
+//	ctx.namespace  the markers' namespace, or ""
+//	ctx.markers    the markers, each with line, text, token, type, namespace, priority and instruction
+//	ctx.prompt     the prompt as rendered by the templates
+//	ctx.target     "main", or the namespace whose session the prompt goes to
+//	ctx.time       when the file was processed (a time.time)
+//
+// It returns None to send the prompt as rendered, a string to send in its
+// place, or a dict with "prompt" and/or "target" keys.
+type promptScript struct {
+	path string
+	fn   starlark.Callable
+}
+
+// loadPromptScript runs the script at path, which must define prompt(ctx)
+func loadPromptScript(path string) (*promptScript, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	thread := &starlark.Thread{Name: "load " + path}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, scriptBuiltins())
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	fn, ok := globals[scriptFunction].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s does not define a %s(ctx) function", path, scriptFunction)
+	}
+	return &promptScript{path: path, fn: fn}, nil
+}
+
+// scriptBuiltins are the names predeclared for scripts, besides Starlark's own
+func scriptBuiltins() starlark.StringDict {
+	return starlark.StringDict{
+		"time":   starlarktime.Module,
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+}
+
+// scriptInput is what a script is told about a prompt
+type scriptInput struct {
+	scanner   *claudewatch.Scanner // Reads the markers' instructions
+	files     []string
+	markers   []claudewatch.Marker
+	mtype     string
+	namespace string
+	prompt    string
+	target    string
+	at        time.Time
+}
+
+// scriptResult is what a script decided: the prompt to send and the target
+// to send it to ("main" or a namespace)
+type scriptResult struct {
+	prompt string
+	target string
+}
+
+// run calls the script's prompt(ctx) for in
+func (s *promptScript) run(in scriptInput) (scriptResult, error) {
+	result := scriptResult{prompt: in.prompt, target: in.target}
+
+	thread := &starlark.Thread{
+		Name: s.path,
+		Print: func(_ *starlark.Thread, msg string) {
+			console.detail("%s: %s", s.path, msg)
+		},
+	}
+	timer := time.AfterFunc(scriptTimeout, func() { thread.Cancel(fmt.Sprintf("took longer than %s", scriptTimeout)) })
+	defer timer.Stop()
+
+	value, err := starlark.Call(thread, s.fn, starlark.Tuple{scriptContext(in)}, nil)
+	if err != nil {
+		return result, scriptError(err)
+	}
+	switch value := value.(type) {
+	case starlark.NoneType:
+		return result, nil
+	case starlark.String:
+		result.prompt = string(value)
+	case *starlark.Dict:
+		for _, item := range value.Items() {
+			key, ok := item[0].(starlark.String)
+			text, isString := item[1].(starlark.String)
+			switch {
+			case !ok:
+				return result, fmt.Errorf("%s() returned a dict with key %s; want \"prompt\" or \"target\"", scriptFunction, item[0])
+			case !isString:
+				return result, fmt.Errorf("%s() returned %s for %q; want a string", scriptFunction, item[1].Type(), string(key))
+			case key == "prompt":
+				result.prompt = string(text)
+			case key == "target":
+				result.target = string(text)
+			default:
+				return result, fmt.Errorf("%s() returned a dict with key %q; want \"prompt\" or \"target\"", scriptFunction, string(key))
+			}
+		}
+	default:
+		return result, fmt.Errorf("%s() returned %s; want None, a string or a dict", scriptFunction, value.Type())
+	}
+	if strings.TrimSpace(result.prompt) == "" {
+		return scriptResult{prompt: in.prompt, target: in.target}, errors.New(scriptFunction + "() returned an empty prompt")
+	}
+	return result, nil
+}
+
+// scriptContext builds the ctx value passed to prompt(ctx)
+func scriptContext(in scriptInput) starlark.Value {
+	files := make([]starlark.Value, len(in.files))
+	for i, file := range in.files {
+		files[i] = starlark.String(file)
+	}
+	markers := make([]starlark.Value, len(in.markers))
+	for i, marker := range in.markers {
+		markers[i] = starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"line":        starlark.MakeInt(marker.LineNumber),
+			"text":        starlark.String(marker.LineText),
+			"token":       starlark.String(marker.Token),
+			"type":        starlark.String(marker.Type),
+			"namespace":   starlark.String(marker.Namespace),
+			"priority":    starlark.String(marker.Priority),
+			"instruction": starlark.String(instructionText(in.scanner, marker)),
+		})
+	}
+	var file string
+	if len(in.files) > 0 {
+		file = in.files[0]
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"file":      starlark.String(file),
+		"files":     starlark.NewList(files),
+		"type":      starlark.String(in.mtype),
+		"namespace": starlark.String(in.namespace),
+		"markers":   starlark.NewList(markers),
+		"prompt":    starlark.String(in.prompt),
+		"target":    starlark.String(in.target),
+		"time":      starlarktime.Time(in.at),
+	})
+}
+
+// scriptError adds the Starlark backtrace to an error from a script
+func scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(strings.TrimSpace(evalErr.Backtrace()))
+	}
+	return err
+}
+
+// applyScript passes a rendered prompt through --script, returning the prompt
+// and target to use. A script that fails leaves both as they were.
+func (p *fileProcessor) applyScript(path, rendered string, target backend, from []pendingPrompt) (string, backend) {
+	script := p.config.Script
+	if script == nil {
+		return rendered, target
+	}
+
+	in := scriptInput{scanner: p.config.markerScanner(), prompt: rendered, target: mainTarget, at: time.Now()}
+	for _, pending := range from {
+		in.files = append(in.files, pending.data.File)
+		in.markers = append(in.markers, pending.original...)
+		in.mtype = pending.data.Type
+		if len(pending.data.Markers) > 0 {
+			in.namespace = pending.data.Markers[0].Namespace
+		}
+	}
+	names := make([]string, 0, len(p.config.Namespaces))
+	for name, route := range p.config.Namespaces {
+		names = append(names, name)
+		if target != nil && route.target == target {
+			in.target = name
+		}
+	}
+	sort.Strings(names)
+
+	result, err := script.run(in)
+	if err != nil {
+		console.warn("Script %s failed for %s: %v; sending the prompt as rendered", script.path, path, err)
+		return rendered, target
+	}
+	if result.target != in.target {
+		switch route, ok := p.config.Namespaces[result.target]; {
+		case result.target == mainTarget:
+			target = nil
+		case ok && route.target != nil:
+			target = route.target
+		case ok:
+			target = nil // The namespace's prompts go to the main session
+		default:
+			console.warn("Script %s chose target %q for %s, which is neither %q nor a namespace (%s); sending to the main session", script.path, result.target, path, mainTarget, strings.Join(names, ", "))
+			target = nil
+		}
+		infoLog(p.config, "Script %s sent the prompt for %s to %s", script.path, path, result.target)
+	}
+	if result.prompt != rendered {
+		infoLog(p.config, "Script %s rewrote the prompt for %s", script.path, path)
+	}
+	return result.prompt, target
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+// writeScript writes a Starlark script to a temporary file and loads it
+func writeScript(t *testing.T, src string) (*promptScript, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.star")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return loadPromptScript(path)
+}
+
+func TestLoadPromptScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"no function", "x = 1\n", "does not define a prompt(ctx) function"},
+		{"syntax error", "def prompt(ctx)\n", "got newline"},
+		{"failing top level", "fail('bad rules')\n", "bad rules"},
+	}
+	for _, tt := range tests {
+		if _, err := writeScript(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: loadPromptScript = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := loadPromptScript(filepath.Join(t.TempDir(), "missing.star")); err == nil {
+		t.Error("loadPromptScript of a missing file succeeded")
+	}
+}
+
+func TestPromptScriptRun(t *testing.T) {
+	script, err := writeScript(t, `
+def prompt(ctx):
+    m = ctx.markers[0]
+    if m.instruction == "keep":
+        return None
+    if m.instruction == "rewrite":
+        return "%s:%d %s %s at %d" % (ctx.file, m.line, ctx.type, m.token, ctx.time.hour)
+    if m.instruction == "route":
+        return {"target": "be"}
+    if m.instruction == "empty":
+        return ""
+    if m.instruction == "number":
+        return 3
+    if m.instruction == "bad key":
+        return {"model": "x"}
+    if m.instruction == "loop":
+        for i in range(100000000):
+            pass
+    fail("unexpected")
+`)
+	if err != nil {
+		t.Fatalf("loadPromptScript: %v", err)
+	}
+	orig := scriptTimeout
+	scriptTimeout = 100 * time.Millisecond
+	defer func() { scriptTimeout = orig }()
+
+	input := func(instruction string) scriptInput {
+		return scriptInput{
+			scanner: defaultMarkerScanner,
+			files:   []string{"/src/main.go"},
+			markers: []claudewatch.Marker{{LineNumber: 4, LineText: "// " + instruction + " ai!", Token: "ai!", Type: claudewatch.TypeEdit}}, // ai:ignore
+			mtype:   claudewatch.TypeEdit,
+			prompt:  "Modify /src/main.go",
+			target:  mainTarget,
+			at:      time.Date(2026, 1, 2, 15, 4, 0, 0, time.Local),
+		}
+	}
+
+	tests := []struct {
+		instruction string
+		want        scriptResult
+		wantErr     string
+	}{
+		{"keep", scriptResult{prompt: "Modify /src/main.go", target: mainTarget}, ""},
+		{"rewrite", scriptResult{prompt: "/src/main.go:4 edit ai! at 15", target: mainTarget}, ""}, // ai:ignore
+		{"route", scriptResult{prompt: "Modify /src/main.go", target: "be"}, ""},
+		{"empty", scriptResult{}, "empty prompt"},
+		{"number", scriptResult{}, "returned int"},
+		{"bad key", scriptResult{}, `key "model"`},
+		{"loop", scriptResult{}, "took longer than"},
+		{"other", scriptResult{}, "unexpected"},
+	}
+	for _, tt := range tests {
+		got, err := script.run(input(tt.instruction))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: run = %v, want an error containing %q", tt.instruction, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: run = %+v, %v; want %+v", tt.instruction, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyScriptRoutes(t *testing.T) {
+	script, err := writeScript(t, `
+def prompt(ctx):
+    if ctx.target == "be":
+        return {"target": "main", "prompt": "moved"}
+    return {"target": ctx.markers[0].instruction}
+`)
+	if err != nil {
+		t.Fatalf("loadPromptScript: %v", err)
+	}
+	backendSession := &fakeBackend{name: "be"}
+	p := &fileProcessor{
+		config: &Config{Script: script, Namespaces: map[string]*namespaceRoute{"be": {target: backendSession}, "docs": {}}},
+	}
+	from := func(instruction string) []pendingPrompt {
+		return []pendingPrompt{{
+			path:     "main.go",
+			data:     TemplateData{File: "/src/main.go", Type: claudewatch.TypeEdit},
+			original: []claudewatch.Marker{{LineNumber: 1, LineText: "// " + instruction + " ai!"}}, // ai:ignore
+		}}
+	}
+
+	if prompt, target := p.applyScript("main.go", "fix", nil, from("be")); prompt != "fix" || target != backendSession {
+		t.Errorf("routing to be = %q, %v; want the be session", prompt, target)
+	}
+	if prompt, target := p.applyScript("main.go", "fix", backendSession, from("x")); prompt != "moved" || target != nil {
+		t.Errorf("routing from be = %q, %v; want the main session", prompt, target)
+	}
+	if _, target := p.applyScript("main.go", "fix", nil, from("docs")); target != nil {
+		t.Errorf("routing to a namespace without a session = %v, want the main session", target)
+	}
+	if prompt, target := p.applyScript("main.go", "fix", nil, from("nowhere")); prompt != "fix" || target != nil {
+		t.Errorf("routing to an unknown target = %q, %v; want the main session", prompt, target)
+	}
+}
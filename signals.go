@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Actions that can be bound to SIGUSR1 and SIGUSR2
+const (
+	signalActionPause  = "pause"  // Pause dispatching, or resume it and send held prompts
+	signalActionRescan = "rescan" // Scan every watched file for markers now
+	signalActionReset  = "reset"  // Clear Claude's context, as an ai:reset directive does
+	signalActionFlush  = "flush"  // Send the prompts held with --batch
+	signalActionNone   = "none"   // Ignore the signal
+)
+
+// defaultSignalActions is the signal mapping used unless the config file overrides it
+var defaultSignalActions = map[string]string{
+	"SIGUSR1": signalActionPause,
+	"SIGUSR2": signalActionRescan,
+}
+
+// bindableSignals are the signals whose action can be configured
+var bindableSignals = map[string]syscall.Signal{
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+// resolveSignalActions merges configured signal actions over the defaults.
+// Signal names may be given with or without the SIG prefix, in any case.
+func resolveSignalActions(configured map[string]string) (map[syscall.Signal]string, error) {
+	actions := make(map[syscall.Signal]string)
+	for name, action := range defaultSignalActions {
+		actions[bindableSignals[name]] = action
+	}
+
+	for name, action := range configured {
+		normalized := strings.ToUpper(name)
+		if !strings.HasPrefix(normalized, "SIG") {
+			normalized = "SIG" + normalized
+		}
+		sig, ok := bindableSignals[normalized]
+		if !ok {
+			return nil, fmt.Errorf("signals: cannot bind %q (only SIGUSR1 and SIGUSR2 are configurable)", name)
+		}
+		switch action {
+		case signalActionPause, signalActionRescan, signalActionReset, signalActionFlush, signalActionNone:
+		default:
+			return nil, fmt.Errorf("signals: unknown action %q for %s (want %q, %q, %q, %q or %q)", action, normalized, signalActionPause, signalActionRescan, signalActionReset, signalActionFlush, signalActionNone)
+		}
+		actions[sig] = action
+	}
+	return actions, nil
+}
+
+// describeSignalActions summarizes the signal mapping for the debug log
+func describeSignalActions(actions map[syscall.Signal]string) string {
+	var parts []string
+	for name, sig := range bindableSignals {
+		parts = append(parts, name+"="+actions[sig])
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// walkWatchedFiles calls fn for every file under the watched roots that the
+// watcher would consider: hidden files and directories, .git and ignored
+// paths are skipped.
+func walkWatchedFiles(config *Config, fn func(path string)) {
+	for _, root := range config.RootDirectories {
+		walkTree(config, root, fn)
+	}
+}
+
+// walkTree is walkWatchedFiles for the tree under root
+func walkTree(config *Config, root string, fn func(path string)) {
+	walkTreeOnce(config, root, fn, &dirVisits{})
+}
+
+// walkTreeOnce is walkTree, skipping directories already in visits
+func walkTreeOnce(config *Config, root string, fn func(path string), visits *dirVisits) {
+	root = walkRoot(root)
+	_ = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && !visits.enter(info) {
+			return filepath.SkipDir
+		}
+		if path != root && config.skipsFile(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if shouldIgnore, _ := ShouldIgnorePathWithConfig(path, config); shouldIgnore {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if followsSymlink(config, path, info) {
+			walkTreeOnce(config, path, fn, visits)
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			fn(path)
+		}
+		return nil
+	})
+}
+
+// configSignals returns the signal mapping from the config file, if any
+func configSignals(fileConfig *FileConfig) map[string]string {
+	if fileConfig == nil {
+		return nil
+	}
+	return fileConfig.Signals
+}
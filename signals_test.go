@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestResolveSignalActions(t *testing.T) {
+	actions, err := resolveSignalActions(nil)
+	if err != nil {
+		t.Fatalf("resolveSignalActions(nil): %v", err)
+	}
+	if actions[syscall.SIGUSR1] != signalActionPause || actions[syscall.SIGUSR2] != signalActionRescan {
+		t.Errorf("default actions = %v", actions)
+	}
+
+	actions, err = resolveSignalActions(map[string]string{"usr1": "rescan", "SIGUSR2": "none"})
+	if err != nil {
+		t.Fatalf("resolveSignalActions: %v", err)
+	}
+	if actions[syscall.SIGUSR1] != signalActionRescan || actions[syscall.SIGUSR2] != signalActionNone {
+		t.Errorf("configured actions = %v", actions)
+	}
+}
+
+func TestResolveSignalActionsRejectsInvalid(t *testing.T) {
+	tests := []map[string]string{
+		{"SIGINT": "pause"},
+		{"SIGUSR1": "explode"},
+	}
+	for _, configured := range tests {
+		if _, err := resolveSignalActions(configured); err == nil {
+			t.Errorf("resolveSignalActions(%v) error = nil", configured)
+		}
+	}
+}
+
+func TestWalkWatchedFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"main.go", "pkg/util.go", ".hidden/secret.go", "pkg/.env", "vendor/dep.go"} {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	config := &Config{
+		RootDirectories: []string{root},
+		IgnorePatterns:  IgnorePatterns{regexp.MustCompile(`/vendor(/|$)`)},
+	}
+	var got []string
+	walkWatchedFiles(config, func(path string) {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, rel)
+	})
+	sort.Strings(got)
+
+	if want := "main.go,pkg/util.go"; strings.Join(got, ",") != want {
+		t.Errorf("walkWatchedFiles visited %v, want %s", got, want)
+	}
+}
+
+func TestDispatcherPauseHoldsAndResumeFlushes(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+
+	if !d.togglePause() {
+		t.Fatal("togglePause() = false, want paused")
+	}
+	_ = d.submit(promptRequest{Prompt: "one"})
+	_ = d.submit(promptRequest{Prompt: "two"})
+	if len(primary.prompts) != 0 {
+		t.Fatalf("prompts delivered while paused: %v", primary.prompts)
+	}
+
+	if d.togglePause() {
+		t.Fatal("togglePause() = true, want resumed")
+	}
+	if got := strings.Join(primary.prompts, ","); got != "one,two" {
+		t.Errorf("delivered after resume = %q, want %q", got, "one,two")
+	}
+
+	_ = d.submit(promptRequest{Prompt: "three"})
+	if len(primary.prompts) != 3 {
+		t.Errorf("prompt submitted after resume was not delivered")
+	}
+}
+
+func TestDispatcherResumeWakesDeliveryGoroutine(t *testing.T) {
+	primary := &fakeBackend{name: "primary"}
+	d := &dispatcher{primary: primary}
+	queued := make(chan struct{}, 1)
+	d.setDelivery(queued)
+
+	d.togglePause()
+	d.enqueue(promptRequest{Prompt: "one"})
+	d.togglePause()
+	if len(primary.prompts) != 0 {
+		t.Fatalf("resuming delivered %q itself, want it left to the delivery goroutine", primary.prompts)
+	}
+	select {
+	case <-queued:
+	default:
+		t.Fatal("resuming did not wake the delivery goroutine")
+	}
+
+	if err := d.flush(); err != nil || strings.Join(primary.prompts, ",") != "one" {
+		t.Errorf("flush() = %v, delivered %q; want the held prompt", err, primary.prompts)
+	}
+}
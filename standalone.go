@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// outputBackend writes prompts out instead of sending them to Claude, for
+// --no-claude. Each prompt is followed by a blank line.
+type outputBackend struct {
+	mu   sync.Mutex
+	out  io.Writer
+	name string
+}
+
+// newOutputBackend writes to stdout, or appends to the file at path if one is given
+func newOutputBackend(path string) (*outputBackend, error) {
+	if path == "" {
+		return &outputBackend{out: os.Stdout, name: "standard output"}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &outputBackend{out: file, name: path}, nil
+}
+
+func (b *outputBackend) Name() string { return b.name }
+
+func (b *outputBackend) Send(prompt string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := io.WriteString(b.out, strings.TrimRight(prompt, "\n")+"\n\n")
+	return err
+}
+
+// close closes the output file, if prompts are written to one
+func (b *outputBackend) close() {
+	if file, ok := b.out.(*os.File); ok && file != os.Stdout {
+		file.Close()
+	}
+}
+
+// runStandalone watches for markers and writes the rendered prompts to
+// stdout or the --output file, without a Claude session. It returns once
+// the user interrupts claudewatch.
+func runStandalone(config *Config, watcher fileWatcher, resolver *promptResolver, signalActions map[syscall.Signal]string) {
+	var primary backend
+	copies := config.Clipboard
+	if config.Clipboard != nil && config.OutputPath == "" {
+		// With --clipboard, prompts go only to the clipboard unless --output
+		// asks for a file too
+		primary, copies = &clipboardBackend{clipboard: config.Clipboard}, nil
+	} else {
+		output, err := newOutputBackend(config.OutputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening prompt output: %v\n", err)
+			os.Exit(1)
+		}
+		defer output.close()
+		primary = output
+	}
+
+	dispatch := &dispatcher{
+		primary:    primary,
+		preamble:   resetPreamble(config.FileConfig),
+		budget:     newPromptBudget(config.MaxPerMinute, config.MaxPerSession),
+		checkpoint: newGitCheckpoints(config),
+		branches:   newBranchSwitcher(config),
+		hooks:      newSendHooks(config),
+		events:     config.Events,
+		history:    openSessionHistory(config),
+		clipboard:  copies,
+		echo:       config.ShowPrompts,
+	}
+	startDigest(dispatch, config)
+	startBatch(dispatch, config)
+	fmt.Fprintf(os.Stderr, "claudewatch: writing prompts to %s; press Ctrl-C to stop\n", primary.Name())
+
+	// Our own stdin only answers questions (e.g. from --confirm-strip)
+	input := newInputRouter(io.Discard)
+	go input.run(os.Stdin)
+
+	// Nothing answers the prompts, so in-progress comments come out as soon
+	// as their prompt is written
+	var progress *progressTracker
+	if config.ProgressComments {
+		progress = newProgressTracker(config.markerScanner())
+	}
+
+	notes := openSessionNotes(config)
+
+	prompts := make(chan promptRequest)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processor := newFileProcessor(config, resolver, prompts)
+		processor.confirm = input.confirm
+		processor.pick = input.pick
+		processor.progress = progress
+		processor.notes = notes
+		watchAndDispatch(config, watcher, processor, dispatch, signalActions, prompts)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	signal.Stop(stop)
+
+	close(prompts)
+	<-done
+	dispatch.abandon()
+	progress.removeAll()
+	dispatch.history.close()
+	logStats(config)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputBackendAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.txt")
+	writeTestFile(t, path, "earlier\n\n")
+
+	b, err := newOutputBackend(path)
+	if err != nil {
+		t.Fatalf("newOutputBackend: %v", err)
+	}
+	if b.Name() != path {
+		t.Errorf("Name() = %q, want %q", b.Name(), path)
+	}
+	for _, prompt := range []string{"Modify a.go\n\nLine 1: fix it\n", "Answer the question"} {
+		if err := b.Send(prompt); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	b.close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := "earlier\n\nModify a.go\n\nLine 1: fix it\n\nAnswer the question\n\n"; string(got) != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestDispatcherWritesToOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.txt")
+	b, err := newOutputBackend(path)
+	if err != nil {
+		t.Fatalf("newOutputBackend: %v", err)
+	}
+	defer b.close()
+
+	done := 0
+	d := &dispatcher{primary: b}
+	if err := d.deliver(promptRequest{Prompt: "Fix it", Done: func() { done++ }}); err != nil {
+		t.Fatalf("deliver() = %v", err)
+	}
+	if got := readString(t, path); got != "Fix it\n\n" {
+		t.Errorf("output = %q, want the prompt", got)
+	}
+	if done != 1 {
+		t.Errorf("done called %d times, want 1 as nothing answers", done)
+	}
+
+	if _, err := newOutputBackend(filepath.Join(t.TempDir(), "missing", "prompts.txt")); err == nil {
+		t.Error("newOutputBackend in a missing directory succeeded")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SubmitConfig configures how a typed prompt is submitted, under "submit" in
+// the config file. Not every Claude CLI version (or other REPL) takes the
+// prompt on a bare carriage return straight after it was typed.
+type SubmitConfig struct {
+	// DelayMS is the pause between typing the prompt and submitting it, so
+	// the CLI has taken in the prompt. Unset uses 300.
+	DelayMS *int `json:"delay_ms"`
+	// Keys are the keystrokes that submit the prompt: "cr" (the default),
+	// "lf", "crlf" or "double-enter"
+	Keys string `json:"keys"`
+	// AfterMS is a pause after submitting, before the next prompt is typed
+	AfterMS int `json:"after_ms"`
+}
+
+// submitKeys maps the names of submit key sequences to their keystrokes.
+// Each element is typed separately, submitKeyGap apart.
+var submitKeys = map[string][]string{
+	"cr":           {"\r"},
+	"lf":           {"\n"},
+	"crlf":         {"\r\n"},
+	"double-enter": {"\r", "\r"},
+}
+
+// submitKeyGap separates the keystrokes of a sequence such as double-enter,
+// so the second Enter isn't taken as part of the first
+var submitKeyGap = 100 * time.Millisecond
+
+// submitSequence is a compiled SubmitConfig
+type submitSequence struct {
+	delay time.Duration
+	keys  []string
+	after time.Duration
+}
+
+// defaultSubmit waits 300 ms after typing the prompt, then sends a carriage return
+var defaultSubmit = submitSequence{delay: 300 * time.Millisecond, keys: submitKeys["cr"]}
+
+// compileSubmit checks the submit settings from the config file. It returns
+// nil when there are none, so the default sequence is used.
+func compileSubmit(fileConfig *FileConfig) (*submitSequence, error) {
+	if fileConfig == nil || fileConfig.Submit == nil {
+		return nil, nil
+	}
+	c := fileConfig.Submit
+	s := defaultSubmit
+	if c.DelayMS != nil {
+		if *c.DelayMS < 0 {
+			return nil, fmt.Errorf("submit.delay_ms: %d is negative", *c.DelayMS)
+		}
+		s.delay = time.Duration(*c.DelayMS) * time.Millisecond
+	}
+	if c.Keys != "" {
+		keys, ok := submitKeys[strings.ToLower(strings.TrimSpace(c.Keys))]
+		if !ok {
+			return nil, fmt.Errorf("submit.keys: unknown key sequence %q (want cr, lf, crlf or double-enter)", c.Keys)
+		}
+		s.keys = keys
+	}
+	if c.AfterMS < 0 {
+		return nil, fmt.Errorf("submit.after_ms: %d is negative", c.AfterMS)
+	}
+	s.after = time.Duration(c.AfterMS) * time.Millisecond
+	return &s, nil
+}
+
+// submit submits a prompt that was just typed, typing keystrokes with
+// typeKeys. A nil sequence is the default one.
+func (s *submitSequence) submit(typeKeys func(keys string) error) error {
+	if s == nil {
+		s = &defaultSubmit
+	}
+	time.Sleep(s.delay)
+	for i, keys := range s.keys {
+		if i > 0 {
+			time.Sleep(submitKeyGap)
+		}
+		if err := typeKeys(keys); err != nil {
+			return err
+		}
+	}
+	time.Sleep(s.after)
+	return nil
+}
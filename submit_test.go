@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCompileSubmit(t *testing.T) {
+	if s, err := compileSubmit(&FileConfig{}); s != nil || err != nil {
+		t.Errorf("no submit settings = %+v, %v; want nil, nil", s, err)
+	}
+
+	zero := 0
+	s, err := compileSubmit(&FileConfig{Submit: &SubmitConfig{DelayMS: &zero, Keys: "Double-Enter", AfterMS: 50}})
+	if err != nil {
+		t.Fatalf("compileSubmit: %v", err)
+	}
+	if s.delay != 0 || len(s.keys) != 2 || s.after != 50*time.Millisecond {
+		t.Errorf("compileSubmit() = %+v", s)
+	}
+
+	// Unset settings keep their defaults
+	s, _ = compileSubmit(&FileConfig{Submit: &SubmitConfig{Keys: "lf"}})
+	if s.delay != defaultSubmit.delay || s.keys[0] != "\n" {
+		t.Errorf("compileSubmit(lf) = %+v, want the default delay and a line feed", s)
+	}
+
+	negative := -1
+	for _, bad := range []SubmitConfig{{Keys: "tab"}, {DelayMS: &negative}, {AfterMS: -5}} {
+		if _, err := compileSubmit(&FileConfig{Submit: &bad}); err == nil {
+			t.Errorf("compileSubmit(%+v) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestPTYBackendSubmitSequence(t *testing.T) {
+	old := submitKeyGap
+	submitKeyGap = 0
+	t.Cleanup(func() { submitKeyGap = old })
+
+	var pty bytes.Buffer
+	submit := &submitSequence{keys: submitKeys["double-enter"]}
+	b := &ptyBackend{pty: &pty, config: &Config{InputEncoding: encodingRaw, Submit: submit}}
+	if err := b.Send("hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := pty.String(); got != "hello\r\r" {
+		t.Errorf("PTY received %q, want the prompt and two Enters", got)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dirVisits records the directories a walk has entered. With
+// --follow-symlinks the same directory can be reached by several paths, and
+// a link to one of its own ancestors would otherwise be walked forever.
+type dirVisits []os.FileInfo
+
+// enter records the directory described by info, returning false if the
+// walk has already entered it
+func (v *dirVisits) enter(info os.FileInfo) bool {
+	for _, visited := range *v {
+		if os.SameFile(visited, info) {
+			return false
+		}
+	}
+	*v = append(*v, info)
+	return true
+}
+
+// followsSymlink reports whether a walk should descend into path, whose
+// lstat info is info: it must be a symlink to a directory and
+// --follow-symlinks must be set
+func followsSymlink(config *Config, path string, info os.FileInfo) bool {
+	if !config.FollowSymlinks || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	target, err := os.Stat(path)
+	return err == nil && target.IsDir()
+}
+
+// walkRoot returns root in a form filepath.Walk descends into even when it
+// is a symlink: Walk doesn't follow a symlink given as its root, but it does
+// follow one written with a trailing separator
+func walkRoot(root string) string {
+	if info, err := os.Lstat(root); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return root + string(filepath.Separator)
+	}
+	return root
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// symlinkTree builds a watch root holding a regular directory, a symlink to a
+// directory outside the root and a symlink back to the root itself
+func symlinkTree(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "root")
+	outside := filepath.Join(t.TempDir(), "shared")
+	for _, dir := range []string{filepath.Join(root, "a"), filepath.Join(outside, "lib")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "a", "x.go"), filepath.Join(outside, "lib", "y.go")} {
+		if err := os.WriteFile(file, []byte("package p\n"), 0o644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "shared")); err != nil {
+		t.Skipf("Symlink: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "a", "loop")); err != nil {
+		t.Fatalf("Symlink: %v", err)
+	}
+	return root
+}
+
+func walkedFiles(config *Config) []string {
+	var files []string
+	walkWatchedFiles(config, func(path string) {
+		rel, _ := filepath.Rel(config.RootDirectories[0], path)
+		files = append(files, rel)
+	})
+	sort.Strings(files)
+	return files
+}
+
+func watchedDirs(t *testing.T, root string, config *Config) []string {
+	t.Helper()
+	watcher, err := newFileWatcher(config)
+	if err != nil {
+		t.Fatalf("NewWatcher: %v", err)
+	}
+	defer watcher.Close()
+	if err := watchDirectory(watcher, root, config, false); err != nil {
+		t.Fatalf("watchDirectory: %v", err)
+	}
+	var dirs []string
+	for _, path := range watcher.WatchList() {
+		rel, _ := filepath.Rel(root, path)
+		dirs = append(dirs, rel)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func TestSymlinksNotFollowedByDefault(t *testing.T) {
+	root := symlinkTree(t)
+	config := &Config{RootDirectories: []string{root}}
+
+	if got, want := walkedFiles(config), []string{"a/x.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+	if got, want := watchedDirs(t, root, config), []string{".", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("watched %v, want %v", got, want)
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	root := symlinkTree(t)
+	config := &Config{RootDirectories: []string{root}, FollowSymlinks: true}
+
+	// The loop back to the root is entered no more than once
+	if got, want := walkedFiles(config), []string{"a/x.go", "shared/lib/y.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+	if got, want := watchedDirs(t, root, config), []string{".", "a", "shared", "shared/lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("watched %v, want %v", got, want)
+	}
+}
+
+func TestDirVisits(t *testing.T) {
+	dir := t.TempDir()
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	again, err := os.Stat(dir + "/.")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	var visits dirVisits
+	if !visits.enter(info) {
+		t.Error("enter() = false for a new directory")
+	}
+	if visits.enter(again) {
+		t.Error("enter() = true for a directory reached by another path")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+const (
+	templateShellTimeout   = 10 * time.Second // Maximum run time of a {{shell}} command
+	templateShellMaxOutput = 16 * 1024        // Maximum bytes of {{shell}} output embedded in a prompt
+)
+
+// allowTemplateShell enables the {{shell}} template helper (--allow-template-shell)
+var allowTemplateShell bool
+
+// promptFuncs are the helper functions available to every prompt template
+var promptFuncs = template.FuncMap{
+	"shell":      templateShell,
+	"readFile":   templateReadFile,
+	"relPath":    templateRelPath,
+	"now":        templateNow,
+	"trim":       strings.TrimSpace,
+	"shellQuote": shellQuote,
+}
+
+// promptTemplateName is the name of every prompt template, which can't be
+// used for a partial
+const promptTemplateName = "prompt"
+
+// newPromptTemplate returns an empty prompt template with the function
+// library and the helper functions registered, and the config file's
+// partials defined
+func newPromptTemplate() *template.Template {
+	if templatePartials != nil {
+		// The partials are never executed, so they can always be cloned
+		if partials, err := templatePartials.Clone(); err == nil {
+			return partials.New(promptTemplateName)
+		}
+	}
+	return template.New(promptTemplateName).Funcs(libraryFuncs).Funcs(promptFuncs)
+}
+
+// parsePromptTemplate parses text as a prompt template
+func parsePromptTemplate(text string) (*template.Template, error) {
+	tmpl, err := newPromptTemplate().Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTemplateCalls(tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// templateShell runs command with sh and returns its combined output, capped
+// at templateShellMaxOutput bytes. A non-zero exit status or timeout is noted
+// in the output rather than failing the prompt, since linters routinely exit
+// non-zero when they have something to report.
+func templateShell(command string) (string, error) {
+	if !allowTemplateShell {
+		return "", errors.New("the shell template helper is disabled; pass --allow-template-shell to enable it")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), templateShellTimeout)
+	defer cancel()
+
+	out := &cappedBuffer{max: templateShellMaxOutput}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second // Don't wait on children still holding the output open
+	runErr := cmd.Run()
+	if errors.Is(runErr, exec.ErrWaitDelay) {
+		// The command itself succeeded; a child it left running kept the
+		// output open, and what it printed so far is what is used
+		runErr = nil
+	}
+
+	result := out.buf.String()
+	if claudewatch.LooksBinary(out.buf.Bytes()) {
+		result = fmt.Sprintf("[binary output omitted: %d bytes]", out.total)
+	} else if out.total > templateShellMaxOutput {
+		result += "\n[output truncated]"
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result += fmt.Sprintf("\n[timed out after %s]", templateShellTimeout)
+	} else if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return "", fmt.Errorf("running %q: %w", command, runErr)
+		}
+		result += fmt.Sprintf("\n[%s]", exitErr)
+	}
+
+	return result, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it. It accepts and counts
+// the rest without keeping it, so a command printing without end can't grow
+// it or be blocked on a full pipe.
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	max   int
+	total int // Bytes written, kept or not
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	c.total += len(p)
+	if room := c.max - c.buf.Len(); room > 0 {
+		c.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// templateReadFile returns the contents of the file at path. A binary or
+// minified file is replaced by a note, and a large one is truncated.
+func templateReadFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return guardContext(string(content)), nil
+}
+
+// templateRelPath returns path relative to the working directory of the
+// Claude session, so Claude resolves it to the right file even if it has
+// changed directory since it started. Paths outside that directory, which
+// could only be reached with "..", are returned as absolute paths.
+func templateRelPath(path string) string {
+	return relativeTo(claudeCwd.dir(), path)
+}
+
+// templateNow returns the current local time in RFC 3339 format
+func templateNow() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+// shellQuote quotes s for safe use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
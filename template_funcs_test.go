@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTemplateShell enables the shell helper for the duration of a test
+func withTemplateShell(t *testing.T, enabled bool) {
+	t.Helper()
+	previous := allowTemplateShell
+	allowTemplateShell = enabled
+	t.Cleanup(func() { allowTemplateShell = previous })
+}
+
+// chdir changes into dir for the duration of a test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir(%q): %v", dir, err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(previous) })
+}
+
+func TestTemplateShellDisabledByDefault(t *testing.T) {
+	withTemplateShell(t, false)
+
+	tmpl, err := parsePromptTemplate(`{{shell "echo hi"}}`)
+	if err != nil {
+		t.Fatalf("parsePromptTemplate: %v", err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err == nil || !strings.Contains(err.Error(), "--allow-template-shell") {
+		t.Errorf("Execute() error = %v, want an error mentioning --allow-template-shell", err)
+	}
+}
+
+func TestTemplateShellEmbedsOutput(t *testing.T) {
+	withTemplateShell(t, true)
+
+	tmpl, err := parsePromptTemplate(`lint: {{shell "echo found 1 issue"}}`)
+	if err != nil {
+		t.Fatalf("parsePromptTemplate: %v", err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := buf.String(); got != "lint: found 1 issue\n" {
+		t.Errorf("rendered = %q, want %q", got, "lint: found 1 issue\n")
+	}
+}
+
+func TestTemplateShellNotesExitStatus(t *testing.T) {
+	withTemplateShell(t, true)
+
+	out, err := templateShell("echo oops; exit 3")
+	if err != nil {
+		t.Fatalf("templateShell: %v", err)
+	}
+	if !strings.Contains(out, "oops") || !strings.Contains(out, "exit status 3") {
+		t.Errorf("templateShell() = %q, want output and exit status", out)
+	}
+}
+
+func TestTemplateShellCapsOutput(t *testing.T) {
+	withTemplateShell(t, true)
+
+	out, err := templateShell("head -c 100000 /dev/zero | tr '\\0' x")
+	if err != nil {
+		t.Fatalf("templateShell: %v", err)
+	}
+	if len(out) > templateShellMaxOutput+len("\n[output truncated]") {
+		t.Errorf("templateShell() returned %d bytes, want at most %d", len(out), templateShellMaxOutput)
+	}
+	if !strings.HasSuffix(out, "[output truncated]") {
+		t.Errorf("templateShell() output is missing the truncation note")
+	}
+}
+
+func TestTemplateShellDoesNotWaitForBackgroundChildren(t *testing.T) {
+	withTemplateShell(t, true)
+
+	start := time.Now()
+	out, err := templateShell("sleep 30 & echo started")
+	if err != nil {
+		t.Fatalf("templateShell: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("templateShell() took %s, waiting on a child holding its output open", elapsed)
+	}
+	if !strings.Contains(out, "started") {
+		t.Errorf("templateShell() = %q, want the command's output", out)
+	}
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("  hello  \n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	chdir(t, dir)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"readFile", `{{readFile .}}`, "  hello  \n"},
+		{"trim", `{{readFile . | trim}}`, "hello"},
+		{"relPath", `{{relPath .}}`, "notes.txt"},
+		{"shellQuote", `{{shellQuote "it's"}}`, `'it'\''s'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parsePromptTemplate(tt.text)
+			if err != nil {
+				t.Fatalf("parsePromptTemplate(%q): %v", tt.text, err)
+			}
+			var buf strings.Builder
+			if err := tmpl.Execute(&buf, file); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("%s rendered %q, want %q", tt.text, buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateNowIsRFC3339(t *testing.T) {
+	if _, err := time.Parse(time.RFC3339, templateNow()); err != nil {
+		t.Errorf("templateNow() = %q is not RFC 3339: %v", templateNow(), err)
+	}
+}
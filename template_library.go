@@ -0,0 +1,595 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// libraryFuncs are general-purpose template functions for strings, lists,
+// defaults, numbers, dicts and paths. Their names and argument order follow
+// Sprig (masterminds.github.io/sprig), so the value being worked on comes
+// last and can be piped in: {{.Tag | default "none" | upper}}.
+var libraryFuncs = template.FuncMap{
+	// Strings
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      templateTitle,
+	"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"replace":    func(old, with, s string) string { return strings.ReplaceAll(s, old, with) },
+	"repeat":     templateRepeat,
+	"substr":     templateSubstr,
+	"trunc":      templateTrunc,
+	"nospace":    templateNoSpace,
+	"quote":      templateQuote,
+	"squote":     templateSquote,
+	"cat":        templateCat,
+	"indent":     templateIndent,
+	"nindent":    func(spaces int, s string) string { return "\n" + templateIndent(spaces, s) },
+	"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       templateJoin,
+	"toString":   templateToString,
+
+	// Regular expressions
+	"regexMatch":      templateRegexMatch,
+	"regexFind":       templateRegexFind,
+	"regexReplaceAll": templateRegexReplaceAll,
+
+	// Lists
+	"list":      func(items ...interface{}) []interface{} { return items },
+	"first":     templateFirst,
+	"last":      templateLast,
+	"rest":      templateRest,
+	"initial":   templateInitial,
+	"append":    templateAppend,
+	"prepend":   templatePrepend,
+	"has":       templateHas,
+	"without":   templateWithout,
+	"uniq":      templateUniq,
+	"compact":   templateCompact,
+	"reverse":   templateReverse,
+	"sortAlpha": templateSortAlpha,
+
+	// Defaults
+	"default":  templateDefault,
+	"empty":    templateEmpty,
+	"coalesce": templateCoalesce,
+	"ternary":  templateTernary,
+
+	// Numbers
+	"add":  templateAdd,
+	"add1": func(a interface{}) (int, error) { return templateAdd(a, 1) },
+	"sub":  templateSub,
+	"mul":  templateMul,
+	"div":  templateDiv,
+	"mod":  templateMod,
+	"max":  templateMax,
+	"min":  templateMin,
+
+	// Dicts
+	"dict":   templateDict,
+	"get":    templateGet,
+	"hasKey": templateHasKey,
+	"keys":   templateKeys,
+
+	// Paths
+	"base":  filepath.Base,
+	"dir":   filepath.Dir,
+	"ext":   filepath.Ext,
+	"clean": filepath.Clean,
+}
+
+// templateTitle upper-cases the first letter of each word in s
+func templateTitle(s string) string {
+	var out strings.Builder
+	start := true
+	for _, r := range s {
+		if start {
+			out.WriteRune(unicode.ToUpper(r))
+		} else {
+			out.WriteRune(r)
+		}
+		start = unicode.IsSpace(r)
+	}
+	return out.String()
+}
+
+// templateRepeat repeats s count times; a negative count is an error rather
+// than a panic
+func templateRepeat(count int, s string) (string, error) {
+	if count < 0 {
+		return "", fmt.Errorf("repeat: negative count %d", count)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+// templateSubstr returns the characters of s from start up to end. A
+// negative start counts from the beginning; a negative end, or one past the
+// end of s, runs to the end.
+func templateSubstr(start, end int, s string) string {
+	runes := []rune(s)
+	start = min(max(start, 0), len(runes))
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	if end < start {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+// templateTrunc keeps the first n characters of s, or the last -n if n is
+// negative
+func templateTrunc(n int, s string) string {
+	count := utf8.RuneCountInString(s)
+	switch {
+	case n >= 0 && n < count:
+		return string([]rune(s)[:n])
+	case n < 0 && -n < count:
+		return string([]rune(s)[count+n:])
+	}
+	return s
+}
+
+// templateNoSpace removes all whitespace from s
+func templateNoSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// templateQuote double-quotes each of values, Go-style, separated by spaces
+func templateQuote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, strconv.Quote(templateToString(v)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// templateSquote single-quotes each of values, separated by spaces
+func templateSquote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, "'"+templateToString(v)+"'")
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// templateCat joins values with spaces, leaving out nils
+func templateCat(values ...interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			parts = append(parts, templateToString(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// templateIndent puts spaces spaces in front of every line of s
+func templateIndent(spaces int, s string) string {
+	pad := strings.Repeat(" ", max(spaces, 0))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// templateJoin joins the items of list with sep
+func templateJoin(sep string, list interface{}) (string, error) {
+	items, err := toList("join", list)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = templateToString(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// templateToString formats v as text, the way templates print it
+func templateToString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func templateRegexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+func templateRegexFind(pattern, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+// templateRegexReplaceAll replaces the matches of pattern in s with repl,
+// in which $1 and ${name} refer to submatches
+func templateRegexReplaceAll(pattern, s, repl string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// toList converts list, a slice or array of any type (such as .Markers), to
+// []interface{} for the list functions; fn names the function for errors
+func toList(fn string, list interface{}) ([]interface{}, error) {
+	if list == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: cannot use %T as a list", fn, list)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// templateFirst returns the first item of list, or nil if it is empty
+func templateFirst(list interface{}) (interface{}, error) {
+	items, err := toList("first", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// templateLast returns the last item of list, or nil if it is empty
+func templateLast(list interface{}) (interface{}, error) {
+	items, err := toList("last", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// templateRest returns all but the first item of list
+func templateRest(list interface{}) ([]interface{}, error) {
+	items, err := toList("rest", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[1:], nil
+}
+
+// templateInitial returns all but the last item of list
+func templateInitial(list interface{}) ([]interface{}, error) {
+	items, err := toList("initial", list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[:len(items)-1], nil
+}
+
+// templateAppend returns a new list of list's items followed by item
+func templateAppend(list interface{}, item interface{}) ([]interface{}, error) {
+	items, err := toList("append", list)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]interface{}{}, items...), item), nil
+}
+
+// templatePrepend returns a new list of item followed by list's items
+func templatePrepend(list interface{}, item interface{}) ([]interface{}, error) {
+	items, err := toList("prepend", list)
+	if err != nil {
+		return nil, err
+	}
+	return append([]interface{}{item}, items...), nil
+}
+
+// templateHas reports whether list contains needle
+func templateHas(needle interface{}, list interface{}) (bool, error) {
+	items, err := toList("has", list)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// templateWithout returns list without any of omit
+func templateWithout(list interface{}, omit ...interface{}) ([]interface{}, error) {
+	items, err := toList("without", list)
+	if err != nil {
+		return nil, err
+	}
+	var kept []interface{}
+	for _, item := range items {
+		dropped := false
+		for _, o := range omit {
+			if reflect.DeepEqual(item, o) {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, item)
+		}
+	}
+	return kept, nil
+}
+
+// templateUniq returns list with repeated items left out, keeping the first
+// of each
+func templateUniq(list interface{}) ([]interface{}, error) {
+	items, err := toList("uniq", list)
+	if err != nil {
+		return nil, err
+	}
+	var unique []interface{}
+	for _, item := range items {
+		seen := false
+		for _, u := range unique {
+			if reflect.DeepEqual(item, u) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			unique = append(unique, item)
+		}
+	}
+	return unique, nil
+}
+
+// templateCompact returns list without its empty items
+func templateCompact(list interface{}) ([]interface{}, error) {
+	items, err := toList("compact", list)
+	if err != nil {
+		return nil, err
+	}
+	var kept []interface{}
+	for _, item := range items {
+		if !templateEmpty(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept, nil
+}
+
+// templateReverse returns list's items in reverse order
+func templateReverse(list interface{}) ([]interface{}, error) {
+	items, err := toList("reverse", list)
+	if err != nil {
+		return nil, err
+	}
+	reversed := make([]interface{}, len(items))
+	for i, item := range items {
+		reversed[len(items)-1-i] = item
+	}
+	return reversed, nil
+}
+
+// templateSortAlpha returns list's items as strings, sorted
+func templateSortAlpha(list interface{}) ([]string, error) {
+	items, err := toList("sortAlpha", list)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]string, len(items))
+	for i, item := range items {
+		sorted[i] = templateToString(item)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// templateDefault returns given if it is set and not empty, and def
+// otherwise: {{.Tag | default "none"}}
+func templateDefault(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || templateEmpty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// templateEmpty reports whether v is nil, a zero value, or an empty string,
+// list or dict
+func templateEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
+
+// templateCoalesce returns the first of values that isn't empty, or nil
+func templateCoalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !templateEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// templateTernary returns ifTrue if cond holds and ifFalse otherwise:
+// {{.ReadOnly | ternary "read" "edit"}}
+func templateTernary(ifTrue, ifFalse interface{}, cond bool) interface{} {
+	if cond {
+		return ifTrue
+	}
+	return ifFalse
+}
+
+// toInt converts a template number (any integer or float type, or a string
+// holding one) to an int; fn names the function for errors
+func toInt(fn string, v interface{}) (int, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int(rv.Float()), nil
+	case reflect.String:
+		n, err := strconv.Atoi(strings.TrimSpace(rv.String()))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %q is not a number", fn, rv.String())
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s: cannot use %T as a number", fn, v)
+}
+
+// arithmetic converts a and b to ints for op, the name of the function
+func arithmetic(op string, a, b interface{}) (int, int, error) {
+	x, err := toInt(op, a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err := toInt(op, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
+}
+
+func templateAdd(a, b interface{}) (int, error) {
+	x, y, err := arithmetic("add", a, b)
+	return x + y, err
+}
+
+func templateSub(a, b interface{}) (int, error) {
+	x, y, err := arithmetic("sub", a, b)
+	return x - y, err
+}
+
+func templateMul(a, b interface{}) (int, error) {
+	x, y, err := arithmetic("mul", a, b)
+	return x * y, err
+}
+
+func templateDiv(a, b interface{}) (int, error) {
+	x, y, err := arithmetic("div", a, b)
+	if err == nil && y == 0 {
+		err = errors.New("div: division by zero")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return x / y, nil
+}
+
+func templateMod(a, b interface{}) (int, error) {
+	x, y, err := arithmetic("mod", a, b)
+	if err == nil && y == 0 {
+		err = errors.New("mod: division by zero")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return x % y, nil
+}
+
+// templateMax returns the largest of its arguments
+func templateMax(a interface{}, rest ...interface{}) (int, error) {
+	best, err := toInt("max", a)
+	for _, v := range rest {
+		if err != nil {
+			break
+		}
+		var n int
+		n, err = toInt("max", v)
+		best = max(best, n)
+	}
+	return best, err
+}
+
+// templateMin returns the smallest of its arguments
+func templateMin(a interface{}, rest ...interface{}) (int, error) {
+	best, err := toInt("min", a)
+	for _, v := range rest {
+		if err != nil {
+			break
+		}
+		var n int
+		n, err = toInt("min", v)
+		best = min(best, n)
+	}
+	return best, err
+}
+
+// templateDict makes a dict of alternating keys and values, for passing
+// several values to a nested template: {{dict "file" .File "tag" .Tag}}
+func templateDict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments; want key/value pairs")
+	}
+	dict := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		dict[templateToString(pairs[i])] = pairs[i+1]
+	}
+	return dict, nil
+}
+
+// templateGet returns the value of key in dict, or "" if it has none
+func templateGet(dict map[string]interface{}, key string) interface{} {
+	if v, ok := dict[key]; ok {
+		return v
+	}
+	return ""
+}
+
+// templateHasKey reports whether dict has key
+func templateHasKey(dict map[string]interface{}, key string) bool {
+	_, ok := dict[key]
+	return ok
+}
+
+// templateKeys returns dict's keys, sorted
+func templateKeys(dict map[string]interface{}) []string {
+	return sortedKeys(dict)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
+
+func TestLibraryFuncs(t *testing.T) {
+	data := TemplateData{
+		File: "/src/pkg/handler.go",
+		Markers: []claudewatch.Marker{
+			{LineNumber: 3, LineText: "// use a map"},
+			{LineNumber: 9, LineText: "// log it"},
+		},
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Strings
+		{`{{"hello world" | upper}}`, "HELLO WORLD"},
+		{`{{"hello world" | title}}`, "Hello World"},
+		{`{{.File | base | trimSuffix ".go"}}`, "handler"},
+		{`{{.File | replace "/src/" "" }}`, "pkg/handler.go"},
+		{`{{contains "pkg" .File}} {{hasPrefix "/src" .File}} {{hasSuffix ".py" .File}}`, "true true false"},
+		{`{{"abcdef" | substr 1 3}}|{{"abcdef" | substr 4 99}}`, "bc|ef"},
+		{`{{"abcdef" | trunc 3}}|{{"abcdef" | trunc -2}}|{{"ab" | trunc 5}}`, "abc|ef|ab"},
+		{`{{"a b\tc" | nospace}}`, "abc"},
+		{`{{quote "a\"b" 3}} {{squote "x"}}`, `"a\"b" "3" 'x'`},
+		{`{{cat "a" nil 1}}`, "a 1"},
+		{`{{"one\ntwo" | indent 2}}`, "  one\n  two"},
+		{`x{{"one" | nindent 4}}`, "x\n    one"},
+		{`{{"a,b,c" | splitList "," | join "+"}}`, "a+b+c"},
+		{`{{"-" | repeat 3}}`, "---"},
+		{`{{regexMatch "^/src/" .File}} {{regexFind "[a-z]+\\.go" .File}}`, "true handler.go"},
+		{`{{regexReplaceAll "(\\w+)\\.go$" .File "${1}_test.go"}}`, "/src/pkg/handler_test.go"},
+
+		// Lists
+		{`{{(first .Markers).LineNumber}}-{{(last .Markers).LineNumber}}`, "3-9"},
+		{`{{len (rest .Markers)}} {{len (initial .Markers)}}`, "1 1"},
+		{`{{list "b" "a" "b" | uniq | join ","}}`, "b,a"},
+		{`{{list "b" "c" "a" | sortAlpha | join ","}}`, "a,b,c"},
+		{`{{list 1 2 3 | reverse | join ""}}`, "321"},
+		{`{{list "a" "" "b" | compact | join ","}}`, "a,b"},
+		{`{{without (list "a" "b" "c") "b" | join ","}}`, "a,c"},
+		{`{{append (list "a") "b" | join ","}} {{prepend (list "a") "b" | join ","}}`, "a,b b,a"},
+		{`{{has "b" (list "a" "b")}} {{has 2 (list 1 3)}}`, "true false"},
+		{`{{first (list)}}`, "<no value>"},
+
+		// Defaults
+		{`{{.Tag | default "untagged"}}`, "untagged"},
+		{`{{"test" | default "untagged"}}`, "test"},
+		{`{{empty .Tag}} {{empty .Markers}} {{empty 0}} {{empty 1}}`, "true false true false"},
+		{`{{coalesce .Tag .Type "edit"}}`, "edit"},
+		{`{{.ReadOnly | ternary "read-only" "writable"}}`, "writable"},
+
+		// Numbers
+		{`{{add 1 2}} {{sub 5 7}} {{mul 3 4}} {{div 7 2}} {{mod 7 2}} {{add1 (len .Markers)}}`, "3 -2 12 3 1 3"},
+		{`{{max 3 9 4}} {{min 3 9 4}} {{add "2" 2}}`, "9 3 4"},
+
+		// Dicts and paths
+		{`{{$d := dict "file" .File "n" 2}}{{get $d "n"}} {{hasKey $d "file"}} {{get $d "x"}} {{keys $d | join ","}}`, "2 true  file,n"},
+		{`{{dir .File}} {{ext .File}} {{clean "a//b/../c"}}`, "/src/pkg .go a/c"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parsePromptTemplate(tt.text)
+		if err != nil {
+			t.Errorf("parsePromptTemplate(%q): %v", tt.text, err)
+			continue
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			t.Errorf("%s: Execute: %v", tt.text, err)
+			continue
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s rendered %q, want %q", tt.text, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestLibraryFuncErrors(t *testing.T) {
+	for _, text := range []string{
+		`{{div 1 0}}`,
+		`{{mod 1 0}}`,
+		`{{add "x" 1}}`,
+		`{{"a" | repeat -1}}`,
+		`{{first "not a list"}}`,
+		`{{dict "odd"}}`,
+		`{{regexMatch "(" "x"}}`,
+	} {
+		tmpl, err := parsePromptTemplate(text)
+		if err != nil {
+			t.Errorf("parsePromptTemplate(%q): %v", text, err)
+			continue
+		}
+		if err := tmpl.Execute(&strings.Builder{}, nil); err == nil {
+			t.Errorf("%s: Execute succeeded, want an error", text)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Shopping cart helpers
+
+export function total(items) {
+  // round to cents ai!
+  return items.reduce((sum, item) => sum + item.price * item.qty, 0);
+}
+
+export function addItem(cart, item) {
+  /* merge quantities when the item is already in the cart ai! */
+  return [...cart, item];
+}
+
+/**
+ * Removes an item.
+ * ai? should this mutate the cart
+ */
+export function removeItem(cart, id) {
+  return cart.filter((item) => item.id !== id); // !AI keep the original order
+}
+
+const label = "total ai!"; // marker inside a string literal
@@ -0,0 +1,12 @@
+#!/bin/sh
+set -e
+
+# fail if the working tree is dirty ai!
+git pull --ff-only
+
+# ai:ignore this whole block is fine as is ai!
+make build
+
+# ai:ignore
+echo "deploying" # add a timestamp ai!
+rsync -a build/ "$HOST:/srv/app/"   # ai!
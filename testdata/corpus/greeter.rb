@@ -0,0 +1,6 @@
+class Greeter
+  # take the name as a keyword argument ai!
+  def greet(name)
+    "Hello, #{name}"
+  end
+end
\ No newline at end of file
@@ -0,0 +1,25 @@
+//! Token bucket rate limiter
+
+use std::time::Instant;
+
+pub struct Bucket {
+    capacity: u32,
+    tokens: f64,
+    last: Instant,
+}
+
+impl Bucket {
+    /// Creates a full bucket ai!
+    pub fn new(capacity: u32) -> Self {
+        Bucket { capacity, tokens: capacity as f64, last: Instant::now() }
+    }
+
+    pub fn take(&mut self) -> bool {
+        // refill based on elapsed time before taking ai!
+        if self.tokens >= 1.0 {
+            self.tokens -= 1.0;
+            return true;
+        }
+        false
+    }
+}
@@ -0,0 +1,8 @@
+// Windows-authored file
+#include <stdio.h>
+
+int main(void) {
+    // print the arguments too ai!
+    printf("hello\n");
+    return 0; // ai!
+}
@@ -0,0 +1,26 @@
+"""Data models for the order service.
+
+Validate the totals in __post_init__ ai!
+"""
+
+from dataclasses import dataclass
+
+
+@dataclass
+class Order:
+    '''An order placed by a customer.'''
+
+    id: int
+    total: float
+
+    def describe(self):
+        """Return a one-line summary. ai?"""
+        return f"{self.id}: {self.total}"
+
+
+TEMPLATE = """
+Order {id} ai!
+"""
+
+# r"""
+# not a docstring ai!
@@ -0,0 +1,25 @@
+#!/usr/bin/env python3
+"""Summarize a CSV export."""
+
+import csv
+import sys
+
+
+def load(path):
+    # use csv.DictReader here ai!
+    with open(path) as f:
+        return list(csv.reader(f))
+
+
+def summarize(rows):
+    total = 0
+    for row in rows:  # skip the header row ai!
+        total += int(row[2])
+    # Is int() safe for values like "1,200"? ai?
+    return total
+
+
+if __name__ == "__main__":
+    # ai!
+    print(summarize(load(sys.argv[1])))
+    ##  handle a missing argument with a usage message  ai!
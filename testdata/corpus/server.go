@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// Server serves the API
+type Server struct {
+	mux     *http.ServeMux
+	timeout time.Duration // make this configurable ai!
+}
+
+// New returns a Server with its routes registered
+func New() *Server {
+	s := &Server{mux: http.NewServeMux(), timeout: 5 * time.Second}
+	// ai:ignore
+	// this handler is deprecated, delete it ai!
+	s.mux.HandleFunc("/old", s.handleOld)
+	// add a /healthz endpoint AI!
+	s.mux.HandleFunc("/", s.handleIndex)
+	return s
+}
+
+/*
+ * Why does this hold the lock for the whole request? ai?
+ */
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	// !ai return JSON instead of plain text
+	w.Write([]byte("hello"))
+}
+
+func (s *Server) handleOld(w http.ResponseWriter, r *http.Request) {
+	// a marker ai! in the middle of a comment
+	http.NotFound(w, r)
+}
+
+var url = "http://example.com/ai!" // ai!
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trackedRefreshInterval is how long the list of a repository's tracked
+// files is used before git is asked again
+var trackedRefreshInterval = 30 * time.Second
+
+// trackedMissRefresh is how soon a file missing from the list has it
+// refreshed, so a file just added with git add is picked up quickly
+var trackedMissRefresh = 2 * time.Second
+
+// trackedFiles implements --tracked-only: only files git tracks are scanned
+// for markers, which leaves out build output, virtualenvs and caches
+// without ignore patterns to maintain. Files outside a repository aren't
+// tracked.
+type trackedFiles struct {
+	config *Config
+	roots  gitRoots
+
+	mu    sync.Mutex
+	repos map[string]*trackedRepo // Keyed by the top of the repository
+}
+
+// trackedRepo is the tracked files of one repository, by path relative to its top
+type trackedRepo struct {
+	files  map[string]bool
+	listed time.Time
+}
+
+// newTrackedFiles returns the tracked file list, or nil without --tracked-only
+func newTrackedFiles(config *Config) *trackedFiles {
+	if !config.TrackedOnly {
+		return nil
+	}
+	return &trackedFiles{config: config, repos: make(map[string]*trackedRepo)}
+}
+
+// contains reports whether git tracks path
+func (t *trackedFiles) contains(path string) bool {
+	root, err := t.roots.lookup(filepath.Dir(path))
+	if err != nil || root == "" {
+		return false
+	}
+	rel, ok := repoRelative(root, path)
+	if !ok {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	repo := t.repos[root]
+	now := time.Now()
+	if repo == nil || now.Sub(repo.listed) >= trackedRefreshInterval {
+		repo = t.list(root, now)
+	}
+	if !repo.files[rel] && now.Sub(repo.listed) >= trackedMissRefresh {
+		repo = t.list(root, now)
+	}
+	return repo.files[rel]
+}
+
+// list asks git for the files tracked in the repository at root. Called
+// with mu held.
+func (t *trackedFiles) list(root string, now time.Time) *trackedRepo {
+	repo := &trackedRepo{files: make(map[string]bool), listed: now}
+	output, err := git(root, nil, "ls-files", "-z")
+	if err != nil {
+		warnLog(t.config, "Could not list the files tracked in %s: %v", root, err)
+	}
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			repo.files[file] = true
+		}
+	}
+	t.repos[root] = repo
+	debugLog(t.config, "%d files tracked in %s", len(repo.files), root)
+	return repo
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrackedFiles(t *testing.T) {
+	dir := gitRepo(t)
+	defer func(interval, miss time.Duration) {
+		trackedRefreshInterval, trackedMissRefresh = interval, miss
+	}(trackedRefreshInterval, trackedMissRefresh)
+	trackedRefreshInterval, trackedMissRefresh = time.Hour, time.Hour
+
+	if err := os.MkdirAll(filepath.Join(dir, "build"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "build", "out.go")
+	writeTestFile(t, output, "// generated ai!\n")
+
+	tracked := newTrackedFiles(&Config{TrackedOnly: true})
+	if !tracked.contains(filepath.Join(dir, "main.go")) {
+		t.Error("main.go is tracked but contains() = false")
+	}
+	if tracked.contains(output) {
+		t.Error("untracked build output reported as tracked")
+	}
+
+	// A file added to git is picked up once the list is refreshed
+	if _, err := git(dir, nil, "add", "build/out.go"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if tracked.contains(output) {
+		t.Error("list refreshed before trackedMissRefresh")
+	}
+	trackedMissRefresh = 0
+	if !tracked.contains(output) {
+		t.Error("added file not picked up after a refresh")
+	}
+
+	outside := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(outside))
+	if tracked.contains(filepath.Join(outside, "a.go")) {
+		t.Error("a file outside any repository reported as tracked")
+	}
+	if newTrackedFiles(&Config{}) != nil {
+		t.Error("newTrackedFiles without --tracked-only is not nil")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcriptFileName is the session output log inside the state directory
+const transcriptFileName = "transcript.log"
+
+// maxTranscriptLine bounds how much output is buffered waiting for a newline;
+// full-screen redraws can go a long time without one
+const maxTranscriptLine = 64 * 1024
+
+// ansiPattern matches terminal escape sequences: CSI sequences (colors,
+// cursor movement), OSC sequences (titles, hyperlinks) and two-byte escapes
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes terminal escape sequences and other control characters
+// (except tabs) from s
+func stripANSI(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\t') || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// transcriptEntry is one recorded line of session output
+type transcriptEntry struct {
+	Time     time.Time
+	Dispatch int // Number of prompts dispatched when the line was printed
+	Text     string
+}
+
+// formatTranscriptEntry renders an entry as a tab-separated transcript line
+func formatTranscriptEntry(e transcriptEntry) string {
+	return fmt.Sprintf("%s\t%d\t%s\n", e.Time.Format(time.RFC3339), e.Dispatch, e.Text)
+}
+
+// parseTranscriptEntry parses a line written by formatTranscriptEntry
+func parseTranscriptEntry(line string) (transcriptEntry, error) {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 {
+		return transcriptEntry{}, fmt.Errorf("malformed transcript line %q", line)
+	}
+	ts, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return transcriptEntry{}, err
+	}
+	dispatch, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return transcriptEntry{}, err
+	}
+	return transcriptEntry{Time: ts, Dispatch: dispatch, Text: fields[2]}, nil
+}
+
+// transcriptRecorder is an io.Writer that receives Claude's raw terminal
+// output and appends it, ANSI-stripped and line by line, to the transcript
+// log. It never returns an error, so it can sit in an io.MultiWriter next to
+// the terminal without interrupting the session.
+type transcriptRecorder struct {
+	mu       sync.Mutex
+	out      io.Writer
+	pending  []byte
+	dispatch int
+	now      func() time.Time
+}
+
+func newTranscriptRecorder(out io.Writer) *transcriptRecorder {
+	return &transcriptRecorder{out: out, now: time.Now}
+}
+
+// Write buffers p and records every complete line
+func (r *transcriptRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, p...)
+	for {
+		i := bytes.IndexAny(r.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		r.record(string(r.pending[:i]))
+		r.pending = r.pending[i+1:]
+	}
+	if len(r.pending) > maxTranscriptLine {
+		r.record(string(r.pending))
+		r.pending = nil
+	}
+	return len(p), nil
+}
+
+// beginDispatch records that dispatch number id is starting, tagging the
+// output that follows with it
+func (r *transcriptRecorder) beginDispatch(id int, summary string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dispatch = id
+	r.record(fmt.Sprintf("[claudewatch] dispatch #%d: %s", id, summary))
+}
+
+// record writes one line, skipping lines that are blank once stripped
+func (r *transcriptRecorder) record(raw string) {
+	text := strings.TrimRight(stripANSI(raw), " \t")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	_, _ = io.WriteString(r.out, formatTranscriptEntry(transcriptEntry{Time: r.now(), Dispatch: r.dispatch, Text: text}))
+}
+
+// transcriptFilter selects transcript entries for claudewatch grep
+type transcriptFilter struct {
+	Pattern  *regexp.Regexp
+	Since    time.Time // Zero means no lower bound
+	Until    time.Time // Zero means no upper bound
+	Dispatch int       // Negative means any dispatch
+}
+
+// matches reports whether e passes the filter
+func (f transcriptFilter) matches(e transcriptEntry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Dispatch >= 0 && e.Dispatch != f.Dispatch {
+		return false
+	}
+	return f.Pattern.MatchString(e.Text)
+}
+
+// searchTranscript returns the entries in the transcript at path that pass filter
+func searchTranscript(path string, filter transcriptFilter) ([]transcriptEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matches []transcriptEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTranscriptLine+1024)
+	for scanner.Scan() {
+		entry, err := parseTranscriptEntry(scanner.Text())
+		if err != nil {
+			continue
+		}
+		if filter.matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, scanner.Err()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"Plain text", "hello world", "hello world"},
+		{"Colors", "\x1b[1;32mok\x1b[0m done", "ok done"},
+		{"Cursor movement", "\x1b[2K\x1b[1Gprompt>", "prompt>"},
+		{"OSC title", "\x1b]0;claude\x07text", "text"},
+		{"OSC hyperlink with ST", "\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"Control characters", "a\bb\x00c\td", "abc\td"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripANSI(tt.input); got != tt.want {
+				t.Errorf("stripANSI(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptRecorder(t *testing.T) {
+	var out bytes.Buffer
+	r := newTranscriptRecorder(&out)
+	fixed := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.now = func() time.Time { return fixed }
+
+	// A line split across writes, a blank redraw, then a dispatch
+	r.Write([]byte("\x1b[32mhel"))
+	r.Write([]byte("lo\x1b[0m\r\n\x1b[2K\r\n"))
+	r.beginDispatch(1, "Modify main.go")
+	r.Write([]byte("Updated parseConfig\n"))
+
+	want := "2026-01-02T03:04:05Z\t0\thello\n" +
+		"2026-01-02T03:04:05Z\t1\t[claudewatch] dispatch #1: Modify main.go\n" +
+		"2026-01-02T03:04:05Z\t1\tUpdated parseConfig\n"
+	if out.String() != want {
+		t.Errorf("transcript =\n%q\nwant\n%q", out.String(), want)
+	}
+}
+
+func TestTranscriptEntryRoundTrip(t *testing.T) {
+	entry := transcriptEntry{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Dispatch: 7, Text: "a\tb"}
+	got, err := parseTranscriptEntry(strings.TrimSuffix(formatTranscriptEntry(entry), "\n"))
+	if err != nil {
+		t.Fatalf("parseTranscriptEntry: %v", err)
+	}
+	if !got.Time.Equal(entry.Time) || got.Dispatch != entry.Dispatch || got.Text != entry.Text {
+		t.Errorf("round trip = %+v, want %+v", got, entry)
+	}
+}
+
+func TestSearchTranscript(t *testing.T) {
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	var content strings.Builder
+	for i, text := range []string{"parseConfig added", "tests pass", "renamed parseConfig"} {
+		content.WriteString(formatTranscriptEntry(transcriptEntry{Time: base.Add(time.Duration(i) * time.Hour), Dispatch: i, Text: text}))
+	}
+	path := filepath.Join(t.TempDir(), transcriptFileName)
+	if err := os.WriteFile(path, []byte(content.String()), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter transcriptFilter
+		want   []string
+	}{
+		{"Pattern only", transcriptFilter{Pattern: regexp.MustCompile("parseConfig"), Dispatch: -1}, []string{"parseConfig added", "renamed parseConfig"}},
+		{"Since", transcriptFilter{Pattern: regexp.MustCompile("parseConfig"), Since: base.Add(30 * time.Minute), Dispatch: -1}, []string{"renamed parseConfig"}},
+		{"Until", transcriptFilter{Pattern: regexp.MustCompile("."), Until: base.Add(time.Hour), Dispatch: -1}, []string{"parseConfig added", "tests pass"}},
+		{"Dispatch", transcriptFilter{Pattern: regexp.MustCompile("."), Dispatch: 1}, []string{"tests pass"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := searchTranscript(path, tt.filter)
+			if err != nil {
+				t.Fatalf("searchTranscript: %v", err)
+			}
+			var got []string
+			for _, m := range matches {
+				got = append(got, m.Text)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeSpec(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseTimeSpec("2h", now)
+	if err != nil || !got.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("parseTimeSpec(2h) = %v, %v; want %v", got, err, now.Add(-2*time.Hour))
+	}
+
+	got, err = parseTimeSpec("2d", now)
+	if err != nil || !got.Equal(now.AddDate(0, 0, -2)) {
+		t.Errorf("parseTimeSpec(2d) = %v, %v; want %v", got, err, now.AddDate(0, 0, -2))
+	}
+
+	got, err = parseTimeSpec("2026-01-01T08:00:00Z", now)
+	if err != nil || !got.Equal(time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseTimeSpec(RFC3339) = %v, %v", got, err)
+	}
+
+	got, err = parseTimeSpec("2026-01-01 08:30", now)
+	if err != nil || got.Hour() != 8 || got.Minute() != 30 {
+		t.Errorf("parseTimeSpec(date time) = %v, %v", got, err)
+	}
+
+	if _, err := parseTimeSpec("yesterday-ish", now); err == nil {
+		t.Error("parseTimeSpec(garbage) error = nil")
+	}
+}
@@ -6,40 +6,44 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
-)
 
-// isEmacsTemp checks if a filename is an Emacs temporary file
-func isEmacsTemp(filename string) bool {
-	// Emacs auto-save files: #filename#
-	if strings.HasPrefix(filename, "#") && strings.HasSuffix(filename, "#") {
-		return true
-	}
+	"github.com/jtrim/claudewatch/pkg/claudewatch"
+)
 
-	// Emacs backup files: filename~
-	if strings.HasSuffix(filename, "~") {
-		return true
-	}
+// The per-directory ignore patterns file and the prompt template file, which
+// applies to the directory it is in and those below
+const (
+	ignoreFileName = ".claudewatchignore"
+	promptFileName = ".claudewatchprompt"
+)
 
-	// Emacs lock files: .#filename
-	if strings.HasPrefix(filename, ".#") {
-		return true
+// firstLine returns s up to its first newline
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
 	}
-
-	return false
+	return s
 }
 
 // findPromptFile walks upward from startDir looking for a .claudewatchprompt
 // file. It returns the path of the nearest one (closest to startDir), or an
 // empty string if none exists between startDir and the filesystem root.
 func findPromptFile(startDir string) string {
+	return findFileUpward(startDir, promptFileName)
+}
+
+// findFileUpward walks upward from startDir looking for a regular file called
+// name, returning the nearest match or an empty string if there is none.
+func findFileUpward(startDir, name string) string {
 	dir, err := filepath.Abs(startDir)
 	if err != nil {
 		return ""
 	}
 
 	for {
-		candidate := filepath.Join(dir, ".claudewatchprompt")
+		candidate := filepath.Join(dir, name)
 		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
 			return candidate
 		}
@@ -52,150 +56,73 @@ func findPromptFile(startDir string) string {
 	}
 }
 
-// supportedAIMarkers contains all the supported AI markers
-var supportedAIMarkers = []string{"ai!", "!ai", "ai?"}
-
-// Create common regex patterns once for performance
-var (
-	markerPattern = buildMarkerPattern()
-	ignoreRegex   = regexp.MustCompile(`(?i)ai:ignore`)
-	commentStart  = regexp.MustCompile(`(?:\s*\/\/|\s*#|\s*\/\*|\s*\*)`)
-)
-
-// buildMarkerPattern builds a regex pattern that matches any of the supported markers
-func buildMarkerPattern() *regexp.Regexp {
-	// Escape special characters in markers
-	escapedMarkers := make([]string, len(supportedAIMarkers))
-	for i, marker := range supportedAIMarkers {
-		escapedMarkers[i] = regexp.QuoteMeta(marker)
-	}
-
-	// Create a pattern that matches any of the markers in case-insensitive mode
-	pattern := `(?i)(?:` + strings.Join(escapedMarkers, "|") + `)`
-	return regexp.MustCompile(pattern)
-}
-
-// hasAIMarker checks if a line contains any AI marker
-func hasAIMarker(line string) bool {
-	return markerPattern.MatchString(line)
-}
-
-// hasIgnoreDirective checks if a line contains the ignore directive
-func hasIgnoreDirective(line string) bool {
-	return ignoreRegex.MatchString(line)
-}
-
-// isComment checks if a line starts with a comment marker
-func isComment(line string) bool {
-	return commentStart.MatchString(line)
-}
-
-// hasBothMarkerAndIgnore checks if a line contains both a marker and ignore directive
-func hasBothMarkerAndIgnore(line string) bool {
-	return isComment(line) && hasIgnoreDirective(line) && hasAIMarker(line)
-}
-
-// AIMarkerLocation represents a line with an AI marker
-type AIMarkerLocation struct {
-	LineNumber int
-	LineText   string
-}
-
-// findActiveAIMarkers checks if the content has any non-ignored AI markers
-// and returns their locations (line numbers and text)
-func findActiveAIMarkers(content string) []AIMarkerLocation {
-	lines := strings.Split(content, "\n")
-	var markers []AIMarkerLocation
+// withContext returns a copy of markers with Context filled in from the n lines
+// above and below each marker line in content. Each context line is prefixed
+// with its line number; binary or overly long lines are replaced by a note.
+func withContext(content string, markers []claudewatch.Marker, n int) []claudewatch.Marker {
+	lines, _ := claudewatch.SplitLines(content)
+	result := make([]claudewatch.Marker, len(markers))
 
-	ignoreNextAI := false
-
-	for i, line := range lines {
-		lineNumber := i + 1 // Line numbers start from 1
-
-		if hasBothMarkerAndIgnore(line) {
+	for i, marker := range markers {
+		result[i] = marker
+		if n <= 0 || marker.LineNumber <= 0 || marker.LineNumber > len(lines) {
 			continue
 		}
 
-		if isComment(line) && hasIgnoreDirective(line) && !hasAIMarker(line) {
-			ignoreNextAI = true
-			continue
+		start := marker.LineNumber - n
+		if start < 1 {
+			start = 1
+		}
+		end := marker.LineNumber + n
+		if end > len(lines) {
+			end = len(lines)
 		}
 
-		// Check if this line contains an AI marker
-		if isComment(line) && hasAIMarker(line) {
-			if ignoreNextAI {
-				// This AI marker is ignored
-				ignoreNextAI = false // Reset for the next marker
-			} else {
-				// Found an active AI marker
-				markers = append(markers, AIMarkerLocation{
-					LineNumber: lineNumber,
-					LineText:   line,
-				})
-			}
-		} else {
-			// If we see any non-AI line after an ai:ignore line, the ignore is no longer active
-			// This ensures that ai:ignore only applies to the very next line with an AI marker
-			ignoreNextAI = false
+		var context strings.Builder
+		for lineNumber := start; lineNumber <= end; lineNumber++ {
+			fmt.Fprintf(&context, "%d: %s\n", lineNumber, guardContextLine(lines[lineNumber-1]))
 		}
+		result[i].Context = strings.TrimSuffix(context.String(), "\n")
 	}
 
-	return markers
+	return result
 }
 
-// hasActiveAIMarkers checks if the content has any non-ignored AI markers
-func hasActiveAIMarkers(content string) bool {
-	markers := findActiveAIMarkers(content)
-	return len(markers) > 0
-}
-
-// removeAIMarkersFromContent is a pure function that removes AI markers from content
-// and returns both the updated content and updated markers
-func removeAIMarkersFromContent(content string, markers []AIMarkerLocation) (string, []AIMarkerLocation, error) {
-	lines := strings.Split(content, "\n")
-
-	// Create a new slice for the updated markers
-	updatedMarkers := make([]AIMarkerLocation, len(markers))
+// withRegion returns a copy of markers with Region filled in from content
+// for each marker that names a region, in the form withContext uses
+func withRegion(content string, markers []claudewatch.Marker) []claudewatch.Marker {
+	lines, _ := claudewatch.SplitLines(content)
+	result := make([]claudewatch.Marker, len(markers))
 
-	// Process each marker by removing the AI marker text from the line
 	for i, marker := range markers {
-		if marker.LineNumber <= 0 || marker.LineNumber > len(lines) {
-			return "", nil, fmt.Errorf("invalid line number %d for content with %d lines", marker.LineNumber, len(lines))
+		result[i] = marker
+		if marker.RegionStart <= 0 || marker.RegionEnd > len(lines) || marker.RegionStart > marker.RegionEnd {
+			continue
 		}
 
-		lineIndex := marker.LineNumber - 1
-		line := lines[lineIndex]
-
-		// Find and remove all AI markers from this line
-		updatedLine := line
-		for _, markerText := range supportedAIMarkers {
-			// Case insensitive replacement
-			updatedLine = regexp.MustCompile("(?i)"+regexp.QuoteMeta(markerText)).ReplaceAllString(updatedLine, "")
+		var region strings.Builder
+		for lineNumber := marker.RegionStart; lineNumber <= marker.RegionEnd; lineNumber++ {
+			fmt.Fprintf(&region, "%d: %s\n", lineNumber, guardContextLine(lines[lineNumber-1]))
 		}
+		result[i].Region = strings.TrimSuffix(region.String(), "\n")
+	}
 
-		// A marker at the end of the line leaves trailing whitespace behind;
-		// strip it so we don't write trailing spaces back into the file.
-		updatedLine = strings.TrimRight(updatedLine, " \t")
-
-		// Update the line in the content
-		lines[lineIndex] = updatedLine
+	return result
+}
 
-		// Create updated marker with the AI marker removed from the text
-		updatedMarkers[i] = AIMarkerLocation{
-			LineNumber: marker.LineNumber,
-			LineText:   updatedLine,
+// hasRegion reports whether any of markers names a region
+func hasRegion(markers []claudewatch.Marker) bool {
+	for _, marker := range markers {
+		if marker.RegionStart > 0 {
+			return true
 		}
 	}
-
-	// Join the lines back into content
-	updatedContent := strings.Join(lines, "\n")
-
-	return updatedContent, updatedMarkers, nil
+	return false
 }
 
 // removeAIMarkersFromFile removes AI markers from a file's comments
 // and returns the updated markers with the marker text removed
-func removeAIMarkersFromFile(filePath string, markers []AIMarkerLocation) ([]AIMarkerLocation, error) {
+func removeAIMarkersFromFile(scanner *claudewatch.Scanner, filePath string, markers []claudewatch.Marker) ([]claudewatch.Marker, error) {
 	// Read file content
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -203,13 +130,13 @@ func removeAIMarkersFromFile(filePath string, markers []AIMarkerLocation) ([]AIM
 	}
 
 	// Process the content
-	updatedContent, updatedMarkers, err := removeAIMarkersFromContent(string(content), markers)
+	updatedContent, updatedMarkers, err := scanner.ForFile(filePath).StripMarkers(string(content), markers)
 	if err != nil {
 		return nil, err
 	}
 
 	// Write the updated content back to the file
-	err = os.WriteFile(filePath, []byte(updatedContent), 0644)
+	err = claudewatch.WriteFileAtomic(filePath, []byte(updatedContent), 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write updated content: %w", err)
 	}
@@ -217,6 +144,80 @@ func removeAIMarkersFromFile(filePath string, markers []AIMarkerLocation) ([]AIM
 	return updatedMarkers, nil
 }
 
+// restoreAIMarkersInFile puts the original text of markers back on the lines
+// they were stripped from. updated holds the markers as returned by the strip.
+// A line is found at its recorded line number, or else at the one line whose
+// text still matches the stripped line; a marker whose line was edited since,
+// or whose text now matches more than one line, is left alone. Lines deleted
+// because only an empty comment was left are inserted again. It returns the
+// number of markers that could not be restored.
+func restoreAIMarkersInFile(scanner *claudewatch.Scanner, filePath string, original, updated []claudewatch.Marker) (int, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return len(updated), fmt.Errorf("failed to read file: %w", err)
+	}
+
+	lines, ending := claudewatch.SplitLines(string(content))
+	restored := make(map[int]bool)
+	missing := 0
+	var reinsert []claudewatch.Marker // Marker lines that were deleted as empty comments
+	var moved []int                   // Markers not at their recorded line, by index in updated
+	for i, marker := range updated {
+		if scanner.ForFile(filePath).IsEmptyComment(marker.LineText) {
+			reinsert = append(reinsert, original[i])
+			continue
+		}
+		index := marker.LineNumber - 1
+		if index < 0 || index >= len(lines) || restored[index] || lines[index] != marker.LineText {
+			moved = append(moved, i)
+			continue
+		}
+		lines[index] = original[i].LineText
+		restored[index] = true
+	}
+
+	// A marker whose line moved is only restored where it can't be mistaken
+	// for another line with the same text
+	for _, i := range moved {
+		index := -1
+		for j, line := range lines {
+			if restored[j] || line != updated[i].LineText {
+				continue
+			}
+			if index >= 0 {
+				index = -1
+				break
+			}
+			index = j
+		}
+		if index < 0 {
+			missing++
+			continue
+		}
+		lines[index] = original[i].LineText
+		restored[index] = true
+	}
+
+	// Put deleted lines back where they were, in order, so each insertion
+	// lands at its original line number
+	sort.Slice(reinsert, func(i, j int) bool { return reinsert[i].LineNumber < reinsert[j].LineNumber })
+	for _, marker := range reinsert {
+		index := marker.LineNumber - 1
+		if index > len(lines) {
+			index = len(lines)
+		}
+		lines = append(lines[:index], append([]string{marker.LineText}, lines[index:]...)...)
+	}
+
+	if len(restored) == 0 && len(reinsert) == 0 {
+		return missing, nil
+	}
+	if err := claudewatch.WriteFileAtomic(filePath, []byte(ending.Join(lines)), 0644); err != nil {
+		return len(updated), fmt.Errorf("failed to write restored content: %w", err)
+	}
+	return missing, nil
+}
+
 // CompileIgnorePattern creates a regular expression from a pattern string
 // It returns the compiled pattern and any error encountered
 func CompileIgnorePattern(pattern string) (*regexp.Regexp, error) {
@@ -235,37 +236,33 @@ func ShouldIgnoreFile(filePath string, ignorePattern *regexp.Regexp) bool {
 	return ignorePattern.MatchString(filePath)
 }
 
-// IsHiddenOrSpecialFile checks if a file is a hidden file, a special file, or an Emacs temp file
-// It properly handles directory reference "." (not considered special) but treats ".." as special
-func IsHiddenOrSpecialFile(filePath string) bool {
-	// Get the base filename
-	baseName := filepath.Base(filePath)
-
-	// Parent directory reference is treated as special (we don't want to watch outside the root)
-	if baseName == ".." {
-		return true
-	}
+// IgnorePatterns contains compiled regular expressions from .claudewatchignore
+type IgnorePatterns []*regexp.Regexp
 
-	// Check if it's a hidden file (starts with a dot)
-	// but exclude current directory "."
-	if strings.HasPrefix(baseName, ".") && baseName != "." {
-		return true
+// LoadIgnorePatterns loads ignore patterns from .claudewatchignore file
+func LoadIgnorePatterns(rootDir string) (IgnorePatterns, error) {
+	rules, err := loadIgnoreRules(rootDir)
+	if err != nil || rules == nil {
+		return nil, err
 	}
-
-	// Check if it's an Emacs temporary file
-	if isEmacsTemp(baseName) {
-		return true
+	patterns := make(IgnorePatterns, len(rules))
+	for i, rule := range rules {
+		patterns[i] = rule.pattern
 	}
-
-	return false
+	return patterns, nil
 }
 
-// IgnorePatterns contains compiled regular expressions from .claudewatchignore
-type IgnorePatterns []*regexp.Regexp
+// ignoreRule is a pattern from a .claudewatchignore file, with where it is
+type ignoreRule struct {
+	file    string
+	line    int
+	pattern *regexp.Regexp
+}
 
-// LoadIgnorePatterns loads ignore patterns from .claudewatchignore file
-func LoadIgnorePatterns(rootDir string) (IgnorePatterns, error) {
-	ignoreFilePath := filepath.Join(rootDir, ".claudewatchignore")
+// loadIgnoreRules reads the patterns of the .claudewatchignore file in
+// rootDir, with their line numbers. Patterns that don't compile are skipped.
+func loadIgnoreRules(rootDir string) ([]ignoreRule, error) {
+	ignoreFilePath := filepath.Join(rootDir, ignoreFileName)
 
 	// Check if the ignore file exists
 	_, err := os.Stat(ignoreFilePath)
@@ -284,11 +281,13 @@ func LoadIgnorePatterns(rootDir string) (IgnorePatterns, error) {
 	}
 	defer file.Close()
 
-	var patterns IgnorePatterns
+	var rules []ignoreRule
 	scanner := bufio.NewScanner(file)
 
 	// Read line by line
+	lineNumber := 0
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
@@ -303,14 +302,14 @@ func LoadIgnorePatterns(rootDir string) (IgnorePatterns, error) {
 			continue
 		}
 
-		patterns = append(patterns, pattern)
+		rules = append(rules, ignoreRule{file: ignoreFilePath, line: lineNumber, pattern: pattern})
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	return patterns, nil
+	return rules, nil
 }
 
 // MatchesAnyPattern checks if a file path matches any of the ignore patterns
@@ -329,8 +328,23 @@ func (p IgnorePatterns) MatchesAnyPattern(filePath string) bool {
 }
 
 // ShouldIgnorePathWithConfig checks if a path should be ignored based on both ignore pattern and ignore patterns
-// Works for both files and directories
+// Works for both files and directories. Decisions are memoized in config.IgnoreCache when one is set.
 func ShouldIgnorePathWithConfig(path string, config *Config) (bool, string) {
+	if config.IgnoreCache != nil {
+		return config.IgnoreCache.lookup(path, config)
+	}
+	return matchIgnoreRules(path, config, ignoreRulesFor(path, config))
+}
+
+// ignoreRulesFor looks up the rules that apply to the directory of path
+func ignoreRulesFor(path string, config *Config) dirIgnoreRules {
+	root, patterns := config.Projects.ignoresFor(path)
+	return dirIgnoreRules{projectRoot: root, projectPatterns: patterns}
+}
+
+// matchIgnoreRules evaluates the ignore rules for path, with rules those of
+// its directory, without consulting the cache
+func matchIgnoreRules(path string, config *Config, rules dirIgnoreRules) (bool, string) {
 	// Check the single ignore pattern first
 	if config.IgnorePattern != nil && config.IgnorePattern.MatchString(path) {
 		return true, "ignore pattern (--ignore)"
@@ -341,5 +355,10 @@ func ShouldIgnorePathWithConfig(path string, config *Config) (bool, string) {
 		return true, ".claudewatchignore pattern"
 	}
 
+	// With --project-scope, a project's own .claudewatchignore applies to it
+	if rules.projectRoot != "" && matchesProjectPatterns(rules.projectRoot, rules.projectPatterns, path) {
+		return true, "project .claudewatchignore pattern"
+	}
+
 	return false, ""
 }
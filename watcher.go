@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher backends, as named by --backend-watcher
+const (
+	watcherFsnotify = "fsnotify"
+	watcherWatchman = "watchman"
+)
+
+// fileWatcher reports changes to files below the directories it watches
+type fileWatcher interface {
+	Add(path string) error
+	Remove(path string) error
+	WatchList() []string
+	Close() error
+
+	// events and errs are where changes and failures are reported
+	events() <-chan fsnotify.Event
+	errs() <-chan error
+	// recursive reports whether watching a directory also watches the
+	// directories below it, so they needn't be added one by one
+	recursive() bool
+}
+
+// fsnotifyWatcher is the default backend: one inotify (or kqueue) watch per
+// directory
+type fsnotifyWatcher struct {
+	*fsnotify.Watcher
+}
+
+func (w fsnotifyWatcher) events() <-chan fsnotify.Event { return w.Events }
+func (w fsnotifyWatcher) errs() <-chan error            { return w.Errors }
+func (w fsnotifyWatcher) recursive() bool               { return false }
+
+// newFileWatcher creates the watcher backend chosen with --backend-watcher
+func newFileWatcher(config *Config) (fileWatcher, error) {
+	switch config.WatcherBackend {
+	case "", watcherFsnotify:
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		return fsnotifyWatcher{w}, nil
+	case watcherWatchman:
+		return newWatchmanWatcher(config)
+	}
+	return nil, fmt.Errorf("unknown watcher backend %q", config.WatcherBackend)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchmanCommand is the Watchman CLI, asked for the daemon's socket when
+// $WATCHMAN_SOCK isn't set
+var watchmanCommand = "watchman"
+
+// watchmanTimeout bounds how long a Watchman command may take. Watching a
+// huge tree for the first time makes the daemon crawl it before answering.
+var watchmanTimeout = 2 * time.Minute
+
+// watchmanWatcher watches through a running Watchman daemon, whose
+// subscriptions cover a whole tree at once. Each root is one subscription;
+// Watchman itself leaves out the VCS directories (.git, .hg).
+type watchmanWatcher struct {
+	config *Config
+	conn   net.Conn
+
+	cmdMu     sync.Mutex // One command at a time
+	responses chan watchmanPDU
+
+	mu      sync.Mutex
+	subs    map[string]string // Subscription name to the directory it watches
+	dirs    []string          // Watched directories, in the order added
+	backlog []fsnotify.Event  // Events read but not yet passed on
+	wake    chan struct{}
+
+	eventCh chan fsnotify.Event
+	errCh   chan error
+	done    chan struct{}
+	closing sync.Once
+}
+
+// watchmanPDU is a message from the daemon: the answer to a command, or
+// (unilaterally) the changes to a subscription
+type watchmanPDU struct {
+	Error        string         `json:"error"`
+	Watch        string         `json:"watch"`
+	RelativePath string         `json:"relative_path"`
+	Sockname     string         `json:"sockname"`
+	Unilateral   bool           `json:"unilateral"`
+	Subscription string         `json:"subscription"`
+	Log          string         `json:"log"`
+	Files        []watchmanFile `json:"files"`
+	Canceled     bool           `json:"canceled"`
+}
+
+// watchmanFile is one changed file in a subscription's changes
+type watchmanFile struct {
+	Name   string `json:"name"` // Relative to the subscribed directory
+	Exists bool   `json:"exists"`
+	New    bool   `json:"new"`
+}
+
+// unilateral reports whether the message was sent without a command
+func (p *watchmanPDU) unilateral() bool {
+	return p.Unilateral || p.Subscription != "" || p.Log != ""
+}
+
+// watchmanSocket returns the path of the daemon's socket: $WATCHMAN_SOCK, or
+// what the Watchman CLI reports (which starts the daemon if needed)
+func watchmanSocket() (string, error) {
+	if sock := os.Getenv("WATCHMAN_SOCK"); sock != "" {
+		return sock, nil
+	}
+	output, err := exec.Command(watchmanCommand, "--output-encoding=json", "--no-pretty", "get-sockname").Output()
+	if err != nil {
+		return "", fmt.Errorf("finding the watchman socket: %w", err)
+	}
+	var pdu watchmanPDU
+	if err := json.Unmarshal(output, &pdu); err != nil {
+		return "", fmt.Errorf("finding the watchman socket: %w", err)
+	}
+	if pdu.Error != "" {
+		return "", fmt.Errorf("finding the watchman socket: %s", pdu.Error)
+	}
+	if pdu.Sockname == "" {
+		return "", errors.New("watchman did not report its socket")
+	}
+	return pdu.Sockname, nil
+}
+
+// newWatchmanWatcher connects to the Watchman daemon
+func newWatchmanWatcher(config *Config) (*watchmanWatcher, error) {
+	sock, err := watchmanSocket()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to watchman: %w", err)
+	}
+	w := &watchmanWatcher{
+		config:    config,
+		conn:      conn,
+		responses: make(chan watchmanPDU, 1),
+		subs:      make(map[string]string),
+		wake:      make(chan struct{}, 1),
+		eventCh:   make(chan fsnotify.Event),
+		errCh:     make(chan error, 1),
+		done:      make(chan struct{}),
+	}
+	go w.read()
+	go w.pump()
+	debugLog(config, "Connected to watchman at %s", sock)
+	return w, nil
+}
+
+func (w *watchmanWatcher) events() <-chan fsnotify.Event { return w.eventCh }
+func (w *watchmanWatcher) errs() <-chan error            { return w.errCh }
+func (w *watchmanWatcher) recursive() bool               { return true }
+
+// Add subscribes to changes below dir. A directory below one already
+// watched is covered by that subscription.
+func (w *watchmanWatcher) Add(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	for _, watched := range w.dirs {
+		if watchedAbs, err := filepath.Abs(watched); err == nil && (abs == watchedAbs || strings.HasPrefix(abs, watchedAbs+string(filepath.Separator))) {
+			w.mu.Unlock()
+			return nil
+		}
+	}
+	name := fmt.Sprintf("claudewatch-%d", len(w.dirs)+1)
+	w.mu.Unlock()
+
+	watch, err := w.command("watch-project", abs)
+	if err != nil {
+		return err
+	}
+	query := map[string]any{
+		"expression":              []string{"type", "f"},
+		"fields":                  []string{"name", "exists", "new"},
+		"empty_on_fresh_instance": true,
+	}
+	if watch.RelativePath != "" {
+		query["relative_root"] = watch.RelativePath
+	}
+
+	// The first changes may arrive before the answer to subscribe
+	w.mu.Lock()
+	w.subs[name] = dir
+	w.dirs = append(w.dirs, dir)
+	w.mu.Unlock()
+	if _, err := w.command("subscribe", watch.Watch, name, query); err != nil {
+		w.mu.Lock()
+		delete(w.subs, name)
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove does nothing: subscriptions cover whole trees, and a directory
+// that is gone reports no more changes
+func (w *watchmanWatcher) Remove(string) error { return nil }
+
+// WatchList returns the subscribed directories
+func (w *watchmanWatcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.dirs...)
+}
+
+// Close disconnects from the daemon, which ends the subscriptions
+func (w *watchmanWatcher) Close() error {
+	err := errors.New("watchman watcher already closed")
+	w.closing.Do(func() {
+		close(w.done)
+		err = w.conn.Close()
+	})
+	return err
+}
+
+// command sends a command to the daemon and returns its answer
+func (w *watchmanWatcher) command(args ...any) (watchmanPDU, error) {
+	w.cmdMu.Lock()
+	defer w.cmdMu.Unlock()
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return watchmanPDU{}, err
+	}
+	if _, err := w.conn.Write(append(data, '\n')); err != nil {
+		return watchmanPDU{}, fmt.Errorf("watchman %s: %w", args[0], err)
+	}
+	select {
+	case pdu := <-w.responses:
+		if pdu.Error != "" {
+			return pdu, fmt.Errorf("watchman %s: %s", args[0], pdu.Error)
+		}
+		return pdu, nil
+	case <-w.done:
+		return watchmanPDU{}, fmt.Errorf("watchman %s: connection closed", args[0])
+	case <-time.After(watchmanTimeout):
+		return watchmanPDU{}, fmt.Errorf("watchman %s: no answer after %s", args[0], watchmanTimeout)
+	}
+}
+
+// read takes the daemon's messages off the connection: answers go to the
+// command waiting for them, and subscription changes to the backlog
+func (w *watchmanWatcher) read() {
+	decoder := json.NewDecoder(w.conn)
+	for {
+		var pdu watchmanPDU
+		if err := decoder.Decode(&pdu); err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.fail(fmt.Errorf("watchman connection lost: %w", err))
+			}
+			return
+		}
+		if !pdu.unilateral() {
+			select {
+			case w.responses <- pdu:
+			case <-w.done:
+				return
+			}
+			continue
+		}
+		if pdu.Log != "" {
+			traceLog(w.config, "watchman: %s", strings.TrimSpace(pdu.Log))
+		}
+		if pdu.Subscription == "" {
+			continue
+		}
+
+		w.mu.Lock()
+		dir, ok := w.subs[pdu.Subscription]
+		w.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if pdu.Canceled {
+			w.fail(fmt.Errorf("watchman stopped watching %s", dir))
+			continue
+		}
+		var events []fsnotify.Event
+		for _, file := range pdu.Files {
+			if event, ok := w.event(dir, file); ok {
+				events = append(events, event)
+			}
+		}
+		if len(events) == 0 {
+			continue
+		}
+		w.mu.Lock()
+		w.backlog = append(w.backlog, events...)
+		w.mu.Unlock()
+		select {
+		case w.wake <- struct{}{}:
+		default: // The pump is already due to look at the backlog
+		}
+	}
+}
+
+// event translates a changed file below dir into an fsnotify event. Files
+// in directories that watching one by one would skip (hidden, .git, or
+// ignored) are left out.
+func (w *watchmanWatcher) event(dir string, file watchmanFile) (fsnotify.Event, bool) {
+	rel := filepath.FromSlash(file.Name)
+	for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+		path := filepath.Join(dir, parent)
+		if w.config.skipsFile(path) || filepath.Base(path) == ".git" {
+			return fsnotify.Event{}, false
+		}
+		if ignored, _ := ShouldIgnorePathWithConfig(path, w.config); ignored {
+			return fsnotify.Event{}, false
+		}
+	}
+
+	event := fsnotify.Event{Name: filepath.Join(dir, rel), Op: fsnotify.Write}
+	switch {
+	case !file.Exists:
+		event.Op = fsnotify.Remove
+	case file.New:
+		event.Op = fsnotify.Create
+	}
+	return event, true
+}
+
+// pump passes the backlog on to the events channel in order, so reading
+// from the daemon never waits for the event loop
+func (w *watchmanWatcher) pump() {
+	defer close(w.eventCh)
+	for {
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+		w.mu.Lock()
+		events := w.backlog
+		w.backlog = nil
+		w.mu.Unlock()
+		for _, event := range events {
+			select {
+			case w.eventCh <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// fail reports err, unless an earlier failure is still unread
+func (w *watchmanWatcher) fail(err error) {
+	select {
+	case w.errCh <- err:
+	default:
+	}
+}
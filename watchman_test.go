@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fakeWatchman is a Watchman daemon on a unix socket that answers
+// watch-project and subscribe, and records the commands it got
+type fakeWatchman struct {
+	t        *testing.T
+	mu       sync.Mutex
+	commands [][]any
+	conn     net.Conn
+	failWith string // Error answered to watch-project
+}
+
+// startFakeWatchman starts a fakeWatchman and points $WATCHMAN_SOCK at it
+func startFakeWatchman(t *testing.T) *fakeWatchman {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv("WATCHMAN_SOCK", sock)
+
+	f := &fakeWatchman{t: t}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conn = conn
+		f.mu.Unlock()
+		decoder := json.NewDecoder(conn)
+		for {
+			var command []any
+			if err := decoder.Decode(&command); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.commands = append(f.commands, command)
+			failWith := f.failWith
+			f.mu.Unlock()
+			switch {
+			case command[0] == "watch-project" && failWith != "":
+				f.send(map[string]any{"error": failWith})
+			case command[0] == "watch-project":
+				f.send(map[string]any{"watch": filepath.Dir(command[1].(string)), "relative_path": filepath.Base(command[1].(string))})
+			case command[0] == "subscribe":
+				f.send(map[string]any{"subscribe": command[2], "clock": "c:1"})
+			}
+		}
+	}()
+	return f
+}
+
+// send writes a message to the connected client
+func (f *fakeWatchman) send(pdu map[string]any) {
+	data, err := json.Marshal(pdu)
+	if err != nil {
+		f.t.Errorf("marshal: %v", err)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conn.Write(append(data, '\n'))
+}
+
+// sent returns the commands received so far
+func (f *fakeWatchman) sent() [][]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]any(nil), f.commands...)
+}
+
+func TestWatchmanWatcherEvents(t *testing.T) {
+	daemon := startFakeWatchman(t)
+	root := t.TempDir()
+	config := &Config{RootDirectories: []string{root}}
+
+	w, err := newWatchmanWatcher(config)
+	if err != nil {
+		t.Fatalf("newWatchmanWatcher: %v", err)
+	}
+	defer w.Close()
+	if !w.recursive() {
+		t.Error("recursive() = false, want true")
+	}
+	if err := w.Add(root); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// Directories below a subscribed one are already covered
+	if err := w.Add(filepath.Join(root, "pkg", "sub")); err != nil {
+		t.Fatalf("Add of a subdirectory: %v", err)
+	}
+
+	commands := daemon.sent()
+	if len(commands) != 2 || commands[0][0] != "watch-project" || commands[1][0] != "subscribe" {
+		t.Fatalf("commands = %v, want watch-project then subscribe", commands)
+	}
+	query := commands[1][3].(map[string]any)
+	if query["relative_root"] != filepath.Base(root) || query["empty_on_fresh_instance"] != true {
+		t.Errorf("subscribe query = %v", query)
+	}
+	if list := w.WatchList(); len(list) != 1 || list[0] != root {
+		t.Errorf("WatchList() = %v, want [%s]", list, root)
+	}
+
+	daemon.send(map[string]any{
+		"subscription": commands[1][2],
+		"unilateral":   true,
+		"files": []map[string]any{
+			{"name": "pkg/new.go", "exists": true, "new": true},
+			{"name": "main.go", "exists": true, "new": false},
+			{"name": "old.go", "exists": false, "new": false},
+			{"name": ".cache/tmp.go", "exists": true, "new": true},
+		},
+	})
+
+	want := []fsnotify.Event{
+		{Name: filepath.Join(root, "pkg", "new.go"), Op: fsnotify.Create},
+		{Name: filepath.Join(root, "main.go"), Op: fsnotify.Write},
+		{Name: filepath.Join(root, "old.go"), Op: fsnotify.Remove},
+	}
+	for _, wantEvent := range want {
+		select {
+		case event := <-w.events():
+			if event != wantEvent {
+				t.Errorf("event = %v, want %v", event, wantEvent)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no event for %s", wantEvent.Name)
+		}
+	}
+	select {
+	case event := <-w.events():
+		t.Errorf("unexpected event %v from a hidden directory", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchmanWatcherErrors(t *testing.T) {
+	daemon := startFakeWatchman(t)
+	daemon.mu.Lock()
+	daemon.failWith = "unable to resolve root"
+	daemon.mu.Unlock()
+	w, err := newWatchmanWatcher(&Config{})
+	if err != nil {
+		t.Fatalf("newWatchmanWatcher: %v", err)
+	}
+	defer w.Close()
+
+	err = w.Add(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "unable to resolve root") {
+		t.Errorf("Add = %v, want the daemon's error", err)
+	}
+	if list := w.WatchList(); len(list) != 0 {
+		t.Errorf("WatchList() = %v after a failed Add, want nothing", list)
+	}
+
+	// Losing the daemon is reported
+	daemon.mu.Lock()
+	daemon.conn.Close()
+	daemon.mu.Unlock()
+	select {
+	case err := <-w.errs():
+		if !strings.Contains(err.Error(), "watchman connection lost") {
+			t.Errorf("error = %v, want the lost connection", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no error after the daemon went away")
+	}
+}
+
+func TestWatchmanSocketMissing(t *testing.T) {
+	t.Setenv("WATCHMAN_SOCK", "")
+	original := watchmanCommand
+	defer func() { watchmanCommand = original }()
+	watchmanCommand = filepath.Join(t.TempDir(), "no-watchman")
+
+	if _, err := newWatchmanWatcher(&Config{}); err == nil {
+		t.Error("newWatchmanWatcher succeeded without a watchman")
+	}
+
+	t.Setenv("WATCHMAN_SOCK", filepath.Join(t.TempDir(), "gone"))
+	if _, err := newWatchmanWatcher(&Config{}); err == nil || !strings.Contains(err.Error(), "connecting to watchman") {
+		t.Errorf("newWatchmanWatcher = %v, want a connection error", err)
+	}
+}
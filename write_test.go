@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveAIMarkersKeepsPermissions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.sh")
+	content := "#!/bin/sh\n# quote the args ai!\necho \"$@\"\n"
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chmod(path, 0o750); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+
+	if _, err := removeAIMarkersFromFile(defaultMarkerScanner, path, defaultMarkerScanner.Scan(content)); err != nil {
+		t.Fatalf("removeAIMarkersFromFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o750 {
+		t.Errorf("mode = %v, want -rwxr-x---", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want the temporary file gone", len(entries))
+	}
+}